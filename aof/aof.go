@@ -12,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
 // CmdLine -> [][]byte的别名，用于表示一行命令
@@ -39,6 +40,8 @@ type Handler struct {
 	aofFileName string
 	aofFinished chan struct{} // 与主协程通信的管道，通知主协程aof写入完成
 	pausingAof  sync.RWMutex  // 终止当前aof写入，以便开始或结束aof重写
+
+	bufferedBytes int64 // 已经提交但是尚未写入文件的命令大小
 }
 
 // NewAOFHandler
@@ -69,6 +72,7 @@ func NewAOFHandler(db database.EmbedDB, tmpDBMaker func() database.EmbedDB) (*Ha
 func (handler *Handler) AddAof(dbIndex int, cmdline CmdLine) {
 	// 先判断是否可以加入
 	if config.Properties.AppendOnly && handler.aofChan != nil {
+		atomic.AddInt64(&handler.bufferedBytes, cmdLineSize(cmdline))
 		handler.aofChan <- &payLoad{
 			cmdLine: cmdline,
 			dbIndex: dbIndex,
@@ -76,6 +80,20 @@ func (handler *Handler) AddAof(dbIndex int, cmdline CmdLine) {
 	}
 }
 
+// BufferedBytes 返回aof缓冲区中尚未写入文件的命令大小
+func (handler *Handler) BufferedBytes() int64 {
+	return atomic.LoadInt64(&handler.bufferedBytes)
+}
+
+// cmdLineSize 命令中所有参数的长度之和
+func cmdLineSize(cmdLine CmdLine) int64 {
+	var size int64
+	for _, arg := range cmdLine {
+		size += int64(len(arg))
+	}
+	return size
+}
+
 // LoadAOF 加载aof文件
 func (handler *Handler) LoadAOF(maxBytes int) {
 	// 加载aof文件时，需要暂时将aofChan关闭，避免重复写入
@@ -136,6 +154,8 @@ func (handler *Handler) LoadAOF(maxBytes int) {
 func (handler *Handler) handleAof() {
 	handler.currentDB = 0 // 设定当前默认数据库
 	for p := range handler.aofChan {
+		atomic.AddInt64(&handler.bufferedBytes, -cmdLineSize(p.cmdLine))
+
 		// 共享锁
 		handler.pausingAof.RLock()
 
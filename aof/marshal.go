@@ -1,8 +1,17 @@
 package aof
 
 import (
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/datastruct/vector"
 	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/lib/utils"
 	"github.com/HildaM/GoKV/redis/protocol"
+	"math"
 	"strconv"
 	"time"
 )
@@ -17,12 +26,41 @@ func EntityToCmd(key string, entity *database.DataEntity) *protocol.MultiBulkRep
 	switch val := entity.Data.(type) {
 	case []byte:
 		cmd = stringToCmd(key, val)
+	case dict.Dict:
+		cmd = hashToCmd(key, val)
+	case *lease.Lease:
+		cmd = leaseToCmd(key, val)
+	case *sortedset.SortedSet:
+		cmd = zSetToCmd(key, val)
 		// TODO 支持更多格式
 	}
 
 	return cmd
 }
 
+// EntityToCmds 序列化需要多条命令才能还原的数据库实例
+// deferred 中的命令依赖其他key（例如降采样规则），需要在整个数据库还原之后执行
+func EntityToCmds(key string, entity *database.DataEntity) (cmds []*protocol.MultiBulkReply, deferred []*protocol.MultiBulkReply) {
+	if entity == nil {
+		return nil, nil
+	}
+	if cmd := EntityToCmd(key, entity); cmd != nil {
+		return []*protocol.MultiBulkReply{cmd}, nil
+	}
+
+	switch val := entity.Data.(type) {
+	case *timeseries.TimeSeries:
+		return timeSeriesToCmds(key, val)
+	case *vector.Index:
+		return vectorIndexToCmds(key, val), nil
+	case *queue.Queue:
+		return queueToCmds(key, val), nil
+	case *ratelimit.SlidingWindow:
+		return slidingWindowToCmds(key, val), nil
+	}
+	return nil, nil
+}
+
 // Set 命令
 var setCmd = []byte("SET")
 
@@ -34,6 +72,48 @@ func stringToCmd(key string, bytes []byte) *protocol.MultiBulkReply {
 	return protocol.MakeMultiBulkReply(args)
 }
 
+// HSet 命令
+var hSetCmd = []byte("HSET")
+
+func hashToCmd(key string, hash dict.Dict) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+hash.Len()*2)
+	args[0] = hSetCmd
+	args[1] = []byte(key)
+	hash.ForEach(func(field string, val interface{}) bool {
+		args = append(args, []byte(field), val.([]byte))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(args)
+}
+
+// ZAdd 命令
+var zAddCmd = []byte("ZADD")
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) *protocol.MultiBulkReply {
+	args := make([][]byte, 2, 2+zset.Len()*2)
+	args[0] = zAddCmd
+	args[1] = []byte(key)
+	zset.ForEach(0, zset.Len(), false, func(element *sortedset.Element) bool {
+		score := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		args = append(args, []byte(score), []byte(element.Member))
+		return true
+	})
+	return protocol.MakeMultiBulkReply(args)
+}
+
+// LOCK.RESTORE 命令
+var lockRestoreCmd = []byte("LOCK.RESTORE")
+
+func leaseToCmd(key string, l *lease.Lease) *protocol.MultiBulkReply {
+	args := make([][]byte, 5)
+	args[0] = lockRestoreCmd
+	args[1] = []byte(key)
+	args[2] = []byte(l.Owner)
+	args[3] = []byte(strconv.FormatInt(l.Token, 10))
+	args[4] = []byte(strconv.FormatInt(l.Deadline.UnixMilli(), 10))
+	return protocol.MakeMultiBulkReply(args)
+}
+
 // Expired 设置过期时间
 var pExpireAtBytes = []byte("PEXPIREAT")
 
@@ -41,6 +121,111 @@ func MakeExpireCmd(key string, expireAt time.Time) *protocol.MultiBulkReply {
 	args := make([][]byte, 3)
 	args[0] = pExpireAtBytes
 	args[1] = []byte(key)
-	args[2] = []byte(strconv.FormatInt(expireAt.UnixNano()/1e6, 10))
+	args[2] = []byte(strconv.FormatInt(expireAt.UnixMilli(), 10))
+	return protocol.MakeMultiBulkReply(args)
+}
+
+// MakeTsCreateCmd 生成与时间序列选项等价的 TS.CREATE 命令
+func MakeTsCreateCmd(key string, series *timeseries.TimeSeries) *protocol.MultiBulkReply {
+	args := utils.ToCmdLine("TS.CREATE", key,
+		"RETENTION", strconv.FormatInt(series.Retention(), 10),
+		"DUPLICATE_POLICY", series.DuplicatePolicy())
+	labels := series.Labels()
+	names := series.SortedLabelNames()
+	if len(names) > 0 {
+		args = append(args, []byte("LABELS"))
+		for _, name := range names {
+			args = append(args, []byte(name), []byte(labels[name]))
+		}
+	}
 	return protocol.MakeMultiBulkReply(args)
 }
+
+// timeSeriesToCmds TS.CREATE + TS.MADD 还原样本，降采样规则延后还原
+func timeSeriesToCmds(key string, series *timeseries.TimeSeries) (cmds []*protocol.MultiBulkReply, deferred []*protocol.MultiBulkReply) {
+	cmds = append(cmds, MakeTsCreateCmd(key, series))
+
+	samples := series.Range(0, math.MaxInt64)
+	if len(samples) > 0 {
+		args := make([][]byte, 0, 1+3*len(samples))
+		args = append(args, []byte("TS.MADD"))
+		for _, s := range samples {
+			args = append(args, []byte(key),
+				[]byte(strconv.FormatInt(s.Timestamp, 10)),
+				[]byte(strconv.FormatFloat(s.Value, 'f', -1, 64)))
+		}
+		cmds = append(cmds, protocol.MakeMultiBulkReply(args))
+	}
+
+	for _, rule := range series.Rules() {
+		deferred = append(deferred, protocol.MakeMultiBulkReply(utils.ToCmdLine("TS.CREATERULE",
+			key, rule.DestKey, "AGGREGATION", rule.Aggregation, strconv.FormatInt(rule.Bucket, 10))))
+	}
+	return cmds, deferred
+}
+
+// vectorIndexToCmds VCREATE 还原索引参数，每个元素一条 VADD
+func vectorIndexToCmds(key string, index *vector.Index) []*protocol.MultiBulkReply {
+	opts := index.Options()
+	cmds := []*protocol.MultiBulkReply{protocol.MakeMultiBulkReply(utils.ToCmdLine("VCREATE", key,
+		"DIM", strconv.Itoa(opts.Dim),
+		"METRIC", opts.Metric,
+		"M", strconv.Itoa(opts.M),
+		"EF_CONSTRUCTION", strconv.Itoa(opts.EfConstruct),
+		"FLAT_THRESHOLD", strconv.Itoa(opts.FlatThreshold)))}
+
+	index.ForEach(func(id string, vec []float32, attrs map[string]string) bool {
+		args := make([][]byte, 0, 4+len(vec)+1+2*len(attrs))
+		args = append(args, []byte("VADD"), []byte(key), []byte(id), []byte("VALUES"))
+		for _, v := range vec {
+			args = append(args, []byte(strconv.FormatFloat(float64(v), 'g', -1, 32)))
+		}
+		if len(attrs) > 0 {
+			args = append(args, []byte("ATTRS"))
+			for name, value := range attrs {
+				args = append(args, []byte(name), []byte(value))
+			}
+		}
+		cmds = append(cmds, protocol.MakeMultiBulkReply(args))
+		return true
+	})
+	return cmds
+}
+
+// queueToCmds QCREATE 还原队列参数，每条消息一条 QADD（包含投递次数和租约到期时间）
+func queueToCmds(key string, q *queue.Queue) []*protocol.MultiBulkReply {
+	create := utils.ToCmdLine("QCREATE", key, "MAXDELIVERIES", strconv.Itoa(q.MaxDeliveries()))
+	if q.DeadLetter() != "" {
+		create = append(create, []byte("DEADLETTER"), []byte(q.DeadLetter()))
+	}
+	cmds := []*protocol.MultiBulkReply{protocol.MakeMultiBulkReply(create)}
+
+	q.ForEach(func(msg queue.Message) bool {
+		deadline := "0"
+		if msg.Leased() {
+			deadline = strconv.FormatInt(msg.Deadline.UnixMilli(), 10)
+		}
+		cmds = append(cmds, protocol.MakeMultiBulkReply([][]byte{
+			[]byte("QADD"),
+			[]byte(key),
+			[]byte(msg.ID),
+			[]byte(strconv.Itoa(msg.Deliveries)),
+			[]byte(deadline),
+			msg.Payload,
+		}))
+		return true
+	})
+	return cmds
+}
+
+// slidingWindowToCmds 每个时刻的请求生成一条 RATELIMIT.RECORD
+func slidingWindowToCmds(key string, w *ratelimit.SlidingWindow) []*protocol.MultiBulkReply {
+	window := strconv.FormatInt(w.Window().Milliseconds(), 10)
+	buckets := w.Buckets()
+	cmds := make([]*protocol.MultiBulkReply, 0, len(buckets))
+	for _, bucket := range buckets {
+		cmds = append(cmds, protocol.MakeMultiBulkReply(utils.ToCmdLine("RATELIMIT.RECORD", key, window,
+			strconv.FormatInt(bucket.Timestamp, 10), strconv.FormatInt(bucket.Count, 10))))
+	}
+	return cmds
+}
@@ -97,15 +97,19 @@ func (handler *Handler) DoRewrite(ctx *RewriteCtx) error {
 			return err
 		}
 
+		// 依赖其他key的命令，等当前数据库全部写入后再追加
+		var deferredCmds []*protocol.MultiBulkReply
+
 		// 定义写入aof的匿名函数
 		writeDataToAof := func(key string, entity *database.DataEntity, expiration *time.Time) bool {
 			// 遍历到的每一个数据，都对其执行func方法中的操作 ————> golang的函数式编程
-			cmd := EntityToCmd(key, entity)
-			if cmd != nil {
+			cmds, deferred := EntityToCmds(key, entity)
+			for _, cmd := range cmds {
 				_, _ = tmpFile.Write(cmd.ToBytes())
 			}
+			deferredCmds = append(deferredCmds, deferred...)
 			if expiration != nil {
-				cmd = MakeExpireCmd(key, *expiration)
+				cmd := MakeExpireCmd(key, *expiration)
 				if cmd != nil {
 					_, _ = tmpFile.Write(cmd.ToBytes())
 				}
@@ -114,6 +118,14 @@ func (handler *Handler) DoRewrite(ctx *RewriteCtx) error {
 		}
 
 		handler.db.ForEach(i, writeDataToAof)
+		for _, cmd := range deferredCmds {
+			_, _ = tmpFile.Write(cmd.ToBytes())
+		}
+
+		// 最后写入元数据命令，例如二级索引，还原时会扫描已经写入的数据
+		for _, cmdLine := range handler.db.GetMetaCmds(i) {
+			_, _ = tmpFile.Write(protocol.MakeMultiBulkReply(cmdLine).ToBytes())
+		}
 	}
 
 	return nil
@@ -152,6 +152,14 @@ func (cluster *Cluster) Exec(c redis.Connection, cmdLine [][]byte) (result redis
 		return protocol.MakeErrReply("NOAUTH Authentication required")
 	}
 
+	// 2. 通过路由表转发命令
+	if cmdFunc, ok := router[cmdName]; ok {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return cmdFunc(cluster, c, cmdLine)
+	}
+
 	return protocol.MakeOkReply()
 }
 
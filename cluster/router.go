@@ -1,4 +1,49 @@
 package cluster
 
+import (
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
 // CmdLine 命令抽象
 type CmdLine = [][]byte
+
+var router = makeRouter()
+
+// makeRouter 集群模式下命令的处理函数
+func makeRouter() map[string]CmdFunc {
+	routerMap := make(map[string]CmdFunc)
+
+	// 分布式锁只涉及一个key，转发到key所在的节点，保证同一把锁的token由同一个节点生成
+	routerMap["lock.acquire"] = defaultFunc
+	routerMap["lock.renew"] = defaultFunc
+	routerMap["lock.release"] = defaultFunc
+	routerMap["lock.info"] = defaultFunc
+
+	// 版本号保存在key所在的节点上
+	routerMap["version"] = defaultFunc
+	routerMap["setifversion"] = defaultFunc
+	routerMap["casexec"] = defaultFunc
+
+	// 查看单个key的子命令，key为第三个参数
+	routerMap["object"] = subCommandKeyFunc
+	routerMap["memory"] = subCommandKeyFunc
+
+	return routerMap
+}
+
+// defaultFunc 将单key命令转发到key所在的节点
+func defaultFunc(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	key := string(cmdLine[1])
+	peer := cluster.peerPickr.PickNode(key)
+	return cluster.relay(peer, c, cmdLine)
+}
+
+// subCommandKeyFunc 转发 OBJECT ENCODING key、MEMORY USAGE key 等子命令，不涉及key的子命令在本节点执行
+func subCommandKeyFunc(cluster *Cluster, c redis.Connection, cmdLine CmdLine) redis.Reply {
+	if len(cmdLine) < 3 {
+		return cluster.db.Exec(c, cmdLine)
+	}
+	key := string(cmdLine[2])
+	peer := cluster.peerPickr.PickNode(key)
+	return cluster.relay(peer, c, cmdLine)
+}
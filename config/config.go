@@ -16,7 +16,9 @@ type ServerProperties struct {
 	Port              int    `cfg:"port"`                // 绑定端口
 	AppendOnly        bool   `cfg:"appendonly"`          // 是否开启AOF持久化模式
 	AppendFilename    string `cfg:"appendfilename"`      // AOF文件名设置
-	MaxClients        int    `cfg:"maxclients"`          // 最大接收客户端数量
+	MaxClients        int    `cfg:"maxclients"`          // 最大接收客户端数量，0表示不限制
+	Timeout           int    `cfg:"timeout"`             // 客户端空闲多少秒后关闭连接，0表示不关闭
+	TCPKeepalive      int    `cfg:"tcp-keepalive"`       // TCP keepalive 探测间隔（秒），0表示关闭，未配置时为300秒
 	RequirePass       string `cfg:"requirepass"`         // redis认证密码
 	Databases         int    `cfg:"databases"`           // 可用数据库数量
 	RDBFilename       string `cfg:"dbfilename"`          // RDB文件名
@@ -24,6 +26,15 @@ type ServerProperties struct {
 	SlaveAnnouncePort int    `cfg:"slave-announce-port"` // 备份服务器端口
 	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`   // 备份服务器IP地址
 	ReplTimeout       int    `cfg:"repl-timeout"`        // 主从复制超时时间
+	MaxMemory         int    `cfg:"maxmemory"`           // 最大内存（字节），0表示不限制
+	MaxMemoryPolicy   string `cfg:"maxmemory-policy"`    // 内存达到上限时的淘汰策略
+	MaxMemorySamples  int    `cfg:"maxmemory-samples"`   // 每次淘汰时采样的key数量
+
+	ZSetMaxListpackEntries int `cfg:"zset-max-listpack-entries"` // 有序集合使用紧凑编码的最大元素数量
+	ZSetMaxListpackValue   int `cfg:"zset-max-listpack-value"`   // 有序集合使用紧凑编码的最大member长度
+
+	ProtoMaxBulkLen        int `cfg:"proto-max-bulk-len"`        // 单个参数的最大长度，0表示默认的512mb
+	ClientQueryBufferLimit int `cfg:"client-query-buffer-limit"` // 单条命令的最大长度，0表示默认的1gb
 
 	Peers []string `cfg:"peers"` // 备份服务器存储
 	Self  string   `cfg:"self"`
@@ -32,12 +43,17 @@ type ServerProperties struct {
 // 全局配置类
 var Properties *ServerProperties
 
+// DefaultTCPKeepalive 未配置 tcp-keepalive 时的默认值，与redis一致
+const DefaultTCPKeepalive = 300
+
 func init() {
 	// default config
 	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       6379,
-		AppendOnly: false,
+		Bind:            "127.0.0.1",
+		Port:            6379,
+		AppendOnly:      false,
+		MaxMemoryPolicy: "noeviction",
+		TCPKeepalive:    DefaultTCPKeepalive,
 	}
 }
 
@@ -49,7 +65,9 @@ redis.conf 文件格式：
 	maxclients 128
 */
 func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+	config := &ServerProperties{
+		TCPKeepalive: DefaultTCPKeepalive, // 配置文件中显式设置为0时关闭
+	}
 
 	rawMap := make(map[string]string)
 	scanner := bufio.NewScanner(src) // 带有缓存的读取流
@@ -92,7 +110,7 @@ func parse(src io.Reader) *ServerProperties {
 			case reflect.String:
 				fieldVal.SetString(val)
 			case reflect.Int:
-				intVal, err := strconv.ParseInt(val, 10, 64)
+				intVal, err := parseInt(val)
 				if err != nil {
 					logger.Fatal(err)
 				}
@@ -112,6 +130,61 @@ func parse(src io.Reader) *ServerProperties {
 	return config
 }
 
+// parseInt 解析整数，支持 1k、1kb、1m、1mb、1g、1gb 形式的内存单位
+// k/m/g 以1000为进制，kb/mb/gb 以1024为进制，与redis一致
+func parseInt(val string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	lower := strings.ToLower(val)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(lower, unit.suffix), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return n * unit.factor, nil
+		}
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
+
+// Lookup 返回名称满足match的配置项及其取值，名称为cfg标签的值
+func (p *ServerProperties) Lookup(match func(name string) bool) (names []string, values []string) {
+	t := reflect.TypeOf(p).Elem()
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := t.Field(i).Tag.Lookup("cfg")
+		if !ok || !match(name) {
+			continue
+		}
+		var value string
+		fieldVal := v.Field(i)
+		switch fieldVal.Kind() {
+		case reflect.String:
+			value = fieldVal.String()
+		case reflect.Int:
+			value = strconv.FormatInt(fieldVal.Int(), 10)
+		case reflect.Bool:
+			value = "no"
+			if fieldVal.Bool() {
+				value = "yes"
+			}
+		case reflect.Slice:
+			if strs, ok := fieldVal.Interface().([]string); ok {
+				value = strings.Join(strs, ",")
+			}
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+	return names, values
+}
+
 // SetupConfig
 func SetupConfig(configFileName string) {
 	file, err := os.Open(configFileName)
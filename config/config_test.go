@@ -11,7 +11,14 @@ func TestParse(t *testing.T) {
 		"maxclients 128\n" +
 		"appendonly no\n" +
 		"appendfilename appendonly.aof\n" +
-		"peers a,b"
+		"peers a,b\n" +
+		"maxmemory 100mb\n" +
+		"maxmemory-policy allkeys-lru\n" +
+		"zset-max-listpack-entries 64\n" +
+		"proto-max-bulk-len 1mb\n" +
+		"timeout 60\n" +
+		"tcp-keepalive -1\n" +
+		"client-query-buffer-limit 16mb"
 	p := parse(strings.NewReader(src))
 
 	if p == nil {
@@ -36,4 +43,44 @@ func TestParse(t *testing.T) {
 	if len(p.Peers) != 2 || p.Peers[0] != "a" || p.Peers[1] != "b" {
 		t.Error("list parse failed")
 	}
+	if p.MaxMemory != 100<<20 {
+		t.Errorf("memory size parse failed: %d", p.MaxMemory)
+	}
+	if p.MaxMemoryPolicy != "allkeys-lru" {
+		t.Error("maxmemory-policy parse failed")
+	}
+	if p.ZSetMaxListpackEntries != 64 || p.ZSetMaxListpackValue != 0 {
+		t.Error("zset-max-listpack parse failed")
+	}
+	if p.Timeout != 60 || p.TCPKeepalive != -1 {
+		t.Error("timeout parse failed")
+	}
+	if p.ProtoMaxBulkLen != 1<<20 || p.ClientQueryBufferLimit != 16<<20 {
+		t.Error("protocol limits parse failed")
+	}
+}
+
+func TestParseTCPKeepalive(t *testing.T) {
+	if p := parse(strings.NewReader("port 6399")); p.TCPKeepalive != DefaultTCPKeepalive {
+		t.Errorf("tcp-keepalive should default to %d, actual %d", DefaultTCPKeepalive, p.TCPKeepalive)
+	}
+	if p := parse(strings.NewReader("tcp-keepalive 0")); p.TCPKeepalive != 0 {
+		t.Errorf("tcp-keepalive 0 should disable keepalive, actual %d", p.TCPKeepalive)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	p := parse(strings.NewReader("port 6399\nappendonly yes\npeers a,b"))
+	names, values := p.Lookup(func(name string) bool {
+		return name == "port" || name == "appendonly" || name == "peers"
+	})
+	if len(names) != 3 || len(values) != 3 {
+		t.Fatalf("expected 3 items, actual %d", len(names))
+	}
+	expected := map[string]string{"port": "6399", "appendonly": "yes", "peers": "a,b"}
+	for i, name := range names {
+		if expected[name] != values[i] {
+			t.Errorf("%s: expected %s, actual %s", name, expected[name], values[i])
+		}
+	}
 }
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/datastruct/vector"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	BIGKEYS [SAMPLES n]
+	遍历db中所有key，按照估算的内存占用返回每种类型中最大的key
+	遍历以分片为单位分批进行，每批key逐个加读锁估算大小，不会长时间占用dict分片的锁
+*/
+
+const bigKeysBatchSize = 256
+
+// typeName 返回数据的类型名
+func typeName(data interface{}) string {
+	switch data.(type) {
+	case []byte:
+		return "string"
+	case dict.Dict:
+		return "hash"
+	case *sortedset.SortedSet:
+		return "zset"
+	case *queue.Queue:
+		return "queue"
+	case *timeseries.TimeSeries:
+		return "timeseries"
+	case *vector.Index:
+		return "vector"
+	case *ratelimit.SlidingWindow:
+		return "ratelimit"
+	case *lease.Lease:
+		return "lease"
+	}
+	return "unknown"
+}
+
+// elementCount 字符串返回字节数，集合返回元素数量
+func elementCount(data interface{}) int64 {
+	switch val := data.(type) {
+	case []byte:
+		return int64(len(val))
+	case dict.Dict:
+		return int64(val.Len())
+	case *sortedset.SortedSet:
+		return val.Len()
+	case *queue.Queue:
+		return int64(val.Len())
+	case *timeseries.TimeSeries:
+		return int64(val.Len())
+	case *vector.Index:
+		return int64(val.Len())
+	case *ratelimit.SlidingWindow:
+		return val.Len()
+	}
+	return 1
+}
+
+// bigKeyStats 一种类型的统计结果
+type bigKeyStats struct {
+	typ        string
+	biggest    string
+	bytes      int64
+	elements   int64
+	keys       int64
+	totalBytes int64
+}
+
+// scanKeys 分批遍历db中的所有key，每批处理完毕后让出CPU
+func (db *DB) scanKeys(consumer func(key string)) {
+	concurrent, ok := db.data.(*dict.ConcurrentDict)
+	if !ok {
+		for _, key := range db.data.Keys() {
+			consumer(key)
+		}
+		return
+	}
+	cursor := 0
+	for {
+		var keys []string
+		keys, cursor = concurrent.Scan(cursor, bigKeysBatchSize)
+		for _, key := range keys {
+			consumer(key)
+		}
+		if cursor == 0 {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// execBigKeys BIGKEYS [SAMPLES n]
+func execBigKeys(db *DB, args [][]byte) redis.Reply {
+	samples := int64(memorySamples)
+	if len(args) != 0 {
+		if len(args) != 2 || strings.ToLower(string(args[0])) != "samples" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || n < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		samples = n
+	}
+
+	statsMap := make(map[string]*bigKeyStats)
+	db.scanKeys(func(key string) {
+		db.RWLocks(nil, []string{key})
+		defer db.RWULocks(nil, []string{key})
+		entity, ok := db.peekEntity(key)
+		if !ok {
+			return
+		}
+		typ := typeName(entity.Data)
+		size := int64(entityOverhead+len(key)) + estimateDataSize(entity.Data, samples)
+		stats, ok := statsMap[typ]
+		if !ok {
+			stats = &bigKeyStats{typ: typ}
+			statsMap[typ] = stats
+		}
+		stats.keys++
+		stats.totalBytes += size
+		if size > stats.bytes {
+			stats.biggest = key
+			stats.bytes = size
+			stats.elements = elementCount(entity.Data)
+		}
+	})
+
+	types := make([]string, 0, len(statsMap))
+	for typ := range statsMap {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	result := make([]redis.Reply, 0, len(types))
+	for _, typ := range types {
+		stats := statsMap[typ]
+		result = append(result, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("type")), protocol.MakeBulkReply([]byte(stats.typ)),
+			protocol.MakeBulkReply([]byte("key")), protocol.MakeBulkReply([]byte(stats.biggest)),
+			protocol.MakeBulkReply([]byte("bytes")), protocol.MakeIntReply(stats.bytes),
+			protocol.MakeBulkReply([]byte("elements")), protocol.MakeIntReply(stats.elements),
+			protocol.MakeBulkReply([]byte("keys")), protocol.MakeIntReply(stats.keys),
+			protocol.MakeBulkReply([]byte("total-bytes")), protocol.MakeIntReply(stats.totalBytes),
+		}))
+	}
+	return protocol.MakeMultiRawReply(result)
+}
+
+func init() {
+	RegisterCommand("BigKeys", execBigKeys, noPrepare, nil, -1, flagReadOnly)
+	registerSelfLocking("BigKeys") // 扫描时逐个key加读锁
+}
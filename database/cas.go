@@ -0,0 +1,130 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HildaM/GoKV/aof"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	基于key版本号的乐观锁命令：
+	VERSION key                              返回key当前的版本号，每次写入都会自增
+	SETIFVERSION key expected value [EX s]   版本号一致时写入
+	CASEXEC key expected cmd [args ...]      版本号一致时执行任意写命令
+	版本号的校验和写入在同一次加锁中完成，不需要 WATCH/MULTI 的往返
+*/
+
+// execVersion VERSION key
+func execVersion(db *DB, args [][]byte) redis.Reply {
+	return protocol.MakeIntReply(int64(db.GetVersion(string(args[0]))))
+}
+
+func parseVersion(raw []byte) (uint32, bool) {
+	version, err := strconv.ParseUint(string(raw), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(version), true
+}
+
+// SetIfVersion SETIFVERSION key expected value [EX seconds]
+// 写入成功返回OK，版本号不一致时返回空
+func SetIfVersion(db *DB, conn redis.Connection, args [][]byte) redis.Reply {
+	// 版本号在入队时无法确定，不能在事务中使用，入队失败时放弃整个事务
+	if conn != nil && conn.InMultiState() {
+		return rejectInMulti(conn, "setifversion")
+	}
+	key := string(args[0])
+	expected, ok := parseVersion(args[1])
+	if !ok {
+		return protocol.MakeErrReply("ERR version is not an integer or out of range")
+	}
+	value := args[2]
+	var ttl time.Duration
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "EX" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		seconds, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil || seconds <= 0 {
+			return protocol.MakeErrReply("ERR invalid expire time in 'setifversion' command")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWULocks(keys, nil)
+	if db.GetVersion(key) != expected {
+		return &protocol.NullBulkReply{}
+	}
+	db.addVersion(conn, key)
+
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLine3("set", args[0], value))
+	if ttl > 0 {
+		// aof 中使用毫秒记录过期时间，这里先截断，保证重放后完全一致
+		expireAt := time.UnixMilli(time.Now().Add(ttl).UnixMilli())
+		db.Expire(key, expireAt)
+		db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	} else {
+		db.Persist(key)
+	}
+	db.updateIndexes(key)
+	db.updateMemory(key)
+	return protocol.MakeOkReply()
+}
+
+// CasExec CASEXEC key expected cmd [args ...]
+// key的版本号一致时执行写命令并返回其结果，不一致时返回空的多行回复（与被WATCH打断的EXEC一致）
+func CasExec(db *DB, conn redis.Connection, args [][]byte) redis.Reply {
+	if conn != nil && conn.InMultiState() {
+		return rejectInMulti(conn, "casexec")
+	}
+	key := string(args[0])
+	expected, ok := parseVersion(args[1])
+	if !ok {
+		return protocol.MakeErrReply("ERR version is not an integer or out of range")
+	}
+	cmdLine := args[2:]
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if cmd.flags != flagWrite || cmd.prepare == nil || cmd.selfLocking {
+		return protocol.MakeErrReply("ERR command '" + cmdName + "' cannot be used in CASEXEC")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+
+	// 作为条件的key不一定会被写入，加读锁即可保证校验期间版本号不变
+	write, read := db.lockRelatedKeys(cmd.dynPrepare != nil, func() ([]string, []string) {
+		write, read := db.relatedKeys(cmd, cmdLine[1:])
+		return write, append(read, key)
+	})
+	defer db.RWULocks(write, read)
+	if db.GetVersion(key) != expected {
+		return protocol.MakeNullMultiBulkReply()
+	}
+
+	result := cmd.executor(db, cmdLine[1:])
+	// 命令执行失败时没有写入，版本号保持不变
+	if !protocol.IsErrorReply(result) {
+		db.addVersion(conn, write...)
+	}
+	db.updateIndexes(write...)
+	db.updateMemory(write...)
+	return result
+}
+
+func init() {
+	RegisterCommand("Version", execVersion, readFirstKey, nil, 2, flagReadOnly)
+}
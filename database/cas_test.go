@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestSetIfVersion(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"version", "a"}, ":0\r\n"},
+		{[]string{"setifversion", "a", "1", "x"}, "$-1\r\n"},
+		{[]string{"setifversion", "a", "0", "x"}, "+OK\r\n"},
+		{[]string{"version", "a"}, ":1\r\n"},
+		{[]string{"setifversion", "a", "0", "y"}, "$-1\r\n"},
+		{[]string{"get", "a"}, "$1\r\nx\r\n"},
+		{[]string{"setifversion", "a", "1", "y", "EX", "0"}, "-ERR invalid expire time in 'setifversion' command\r\n"},
+		{[]string{"setifversion", "a", "1", "y", "EX", "100"}, "+OK\r\n"},
+	})
+	if _, ok := db.ttlMap.Get("a"); !ok {
+		t.Error("expire time not set")
+	}
+
+	// 写入后重新估算内存占用
+	before := db.UsedMemory()
+	value := make([]byte, 1024)
+	execString(db, conn, "setifversion", "a", "2", string(value))
+	if _, ok := db.ttlMap.Get("a"); ok {
+		t.Error("expire time should be removed without EX")
+	}
+	if delta := db.UsedMemory() - before; delta < 1000 {
+		t.Errorf("used memory should grow by about 1KB, actual %d", delta)
+	}
+	entity, _ := db.getRawEntity("a")
+	if entity.Size != estimateSize("a", entity.Data) {
+		t.Errorf("entity size %d not updated", entity.Size)
+	}
+}
+
+func TestCasExec(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"casexec", "h", "0", "hset", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"version", "h"}, ":1\r\n"},
+		{[]string{"casexec", "h", "0", "hset", "h", "f", "v2"}, "*-1\r\n"},
+		{[]string{"hget", "h", "f"}, "$1\r\nv\r\n"},
+		{[]string{"casexec", "h", "1", "get", "h"}, "-ERR command 'get' cannot be used in CASEXEC\r\n"},
+		{[]string{"casexec", "h", "1", "nosuchcmd"}, "-ERR unknown command 'nosuchcmd'\r\n"},
+	})
+
+	// 内部命令执行失败时版本号不变，可以用同一个版本号重试
+	execString(db, conn, "set", "s", "str")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"version", "s"}, ":1\r\n"},
+		{[]string{"casexec", "s", "1", "hset", "s", "f", "v"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"version", "s"}, ":1\r\n"},
+		{[]string{"casexec", "s", "1", "set", "s", "v"}, "+OK\r\n"},
+		{[]string{"version", "s"}, ":2\r\n"},
+	})
+
+	// 条件key与写入的key不同时，只有写入的key版本号自增
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"casexec", "s", "2", "set", "other", "v"}, "+OK\r\n"},
+		{[]string{"version", "s"}, ":2\r\n"},
+		{[]string{"version", "other"}, ":1\r\n"},
+	})
+}
+
+func TestCasInMulti(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "1"}, "+QUEUED\r\n"},
+		{[]string{"setifversion", "b", "0", "1"}, "-ERR command 'setifversion' cannot be used in MULTI\r\n"},
+		{[]string{"casexec", "b", "0", "set", "b", "1"}, "-ERR command 'casexec' cannot be used in MULTI\r\n"},
+		{[]string{"exec"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"get", "a"}, "$-1\r\n"},
+		{[]string{"get", "b"}, "$-1\r\n"},
+	})
+}
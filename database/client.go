@@ -0,0 +1,495 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	CLIENT 命令，操作的是连接本身而不是db中的数据
+*/
+
+var clientHelp = []string{
+	"CLIENT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CACHING (YES|NO)",
+	"    Enable/disable tracking of the keys for next command in OPTIN/OPTOUT modes.",
+	"GETNAME",
+	"    Return the name of the current connection.",
+	"ID",
+	"    Return the ID of the current connection.",
+	"INFO",
+	"    Return information about the current client connection.",
+	"KILL <ip:port>",
+	"    Kill connection made from <ip:port>.",
+	"KILL <option> <value> [<option> <value> [...]]",
+	"    Kill connections. Options are:",
+	"    * ADDR (<ip:port>|<unixsocket>:0)",
+	"      Kill connections made from the specified address",
+	"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+	"      Kill connections by type.",
+	"    * USER <username>",
+	"      Kill connections authenticated by <username>.",
+	"    * ID <client-id>",
+	"      Kill connections by client id.",
+	"    * SKIPME (YES|NO)",
+	"      Skip killing current connection (default: yes).",
+	"LIST [options ...]",
+	"    Return information about client connections. Options:",
+	"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+	"      Return clients of specified type.",
+	"    * ID <client-id> [<client-id> ...]",
+	"      Return clients of specified IDs only.",
+	"NO-EVICT (ON|OFF)",
+	"    Protect current client connection from eviction.",
+	"PAUSE <timeout> [WRITE|ALL]",
+	"    Suspend all, or just write, clients for <timeout> milliseconds.",
+	"REPLY (ON|OFF|SKIP)",
+	"    Control the replies sent to the current connection.",
+	"SETNAME <name>",
+	"    Assign the name <name> to the current connection.",
+	"UNPAUSE",
+	"    Stop the current client pause, resuming traffic.",
+	"TRACKING (ON|OFF) [REDIRECT <id>] [PREFIX <prefix>] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]",
+	"    Control server assisted client side caching.",
+	"TRACKINGINFO",
+	"    Report tracking status for the current connection.",
+	"HELP",
+	"    Print this help.",
+}
+
+// execClient CLIENT subcommand [args ...]
+func execClient(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("client")
+	}
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "help":
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(clientHelp...))
+	case "tracking":
+		return execClientTracking(mdb, c, args[1:])
+	case "caching":
+		return execClientCaching(mdb, c, args[1:])
+	case "trackinginfo":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|trackinginfo")
+		}
+		return execClientTrackingInfo(mdb, c)
+	case "id":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|id")
+		}
+		return protocol.MakeIntReply(int64(c.GetID()))
+	case "getname":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|getname")
+		}
+		if name := c.GetName(); name != "" {
+			return protocol.MakeBulkReply([]byte(name))
+		}
+		return protocol.MakeNullBulkReply()
+	case "setname":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("client|setname")
+		}
+		if errReply := checkClientName(string(args[1])); errReply != nil {
+			return errReply
+		}
+		c.SetName(string(args[1]))
+		return protocol.MakeOkReply()
+	case "info":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|info")
+		}
+		return protocol.MakeVerbatimReply("txt", []byte(mdb.clientInfo(c)))
+	case "list":
+		return execClientList(mdb, args[1:])
+	case "kill":
+		return execClientKill(c, args[1:])
+	case "pause":
+		return execClientPause(mdb, args[1:])
+	case "unpause":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|unpause")
+		}
+		mdb.pause.unpause()
+		return protocol.MakeOkReply()
+	case "no-evict":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("client|no-evict")
+		}
+		switch strings.ToLower(string(args[1])) {
+		case "on":
+			c.SetNoEvict(true)
+		case "off":
+			c.SetNoEvict(false)
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+		return protocol.MakeOkReply()
+	case "reply":
+		return execClientReply(c, args[1:])
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CLIENT HELP.")
+}
+
+// checkClientName 客户端名称中不能包含空格和换行
+func checkClientName(name string) redis.Reply {
+	for _, ch := range name {
+		if ch < '!' || ch > '~' {
+			return protocol.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+	return nil
+}
+
+// addrOf 连接的地址，测试使用的连接没有地址
+func addrOf(c redis.Connection) string {
+	if addr := c.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+// isPubSubClient 是否处于订阅模式
+func isPubSubClient(c redis.Connection) bool {
+	return c.SubsCount()+c.PSubsCount() > 0
+}
+
+// clientInfo CLIENT LIST 和 CLIENT INFO 中的一行，格式为 field=value，以空格分隔
+func (mdb *MultiDB) clientInfo(c redis.Connection) string {
+	flags := ""
+	if isPubSubClient(c) {
+		flags += "P"
+	}
+	if c.InMultiState() {
+		flags += "x"
+	}
+	if c.IsNoEvict() {
+		flags += "e"
+	}
+	if _, _, _, ok := mdb.tracking.info(c); ok {
+		flags += "t"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	multi := -1
+	if c.InMultiState() {
+		multi = len(c.GetQueuedCmdLine())
+	}
+	cmd := c.LastCommand()
+	if cmd == "" {
+		cmd = "NULL"
+	}
+
+	var b strings.Builder
+	b.WriteString("id=" + strconv.FormatUint(c.GetID(), 10))
+	b.WriteString(" addr=" + addrOf(c))
+	b.WriteString(" name=" + c.GetName())
+	b.WriteString(" age=" + strconv.FormatInt(int64(time.Since(c.CreatedAt())/time.Second), 10))
+	b.WriteString(" idle=" + strconv.FormatInt(int64(c.IdleTime()/time.Second), 10))
+	b.WriteString(" flags=" + flags)
+	b.WriteString(" db=" + strconv.Itoa(c.GetDBIndex()))
+	b.WriteString(" sub=" + strconv.Itoa(c.SubsCount()))
+	b.WriteString(" psub=" + strconv.Itoa(c.PSubsCount()))
+	b.WriteString(" multi=" + strconv.Itoa(multi))
+	b.WriteString(" cmd=" + cmd)
+	b.WriteString(" user=default")
+	b.WriteString(" resp=" + strconv.Itoa(c.GetProtocol()))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// clientTypeFilter 按照连接的类型过滤，只有 normal 和 pubsub 两种连接，没有主从复制的连接
+func clientTypeFilter(typ string) (func(c redis.Connection) bool, redis.Reply) {
+	switch strings.ToLower(typ) {
+	case "normal":
+		return func(c redis.Connection) bool {
+			return !isPubSubClient(c)
+		}, nil
+	case "pubsub":
+		return isPubSubClient, nil
+	case "master", "replica", "slave":
+		return func(c redis.Connection) bool {
+			return false
+		}, nil
+	}
+	return nil, protocol.MakeErrReply("ERR Unknown client type '" + typ + "'")
+}
+
+// execClientList CLIENT LIST [TYPE type] [ID id [id ...]]
+func execClientList(mdb *MultiDB, args [][]byte) redis.Reply {
+	var typeFilter func(c redis.Connection) bool
+	var ids map[uint64]bool
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "type":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			var errReply redis.Reply
+			typeFilter, errReply = clientTypeFilter(string(args[i+1]))
+			if errReply != nil {
+				return errReply
+			}
+			i++
+		case "id":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			ids = make(map[uint64]bool)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseUint(string(args[i]), 10, 64)
+				if err != nil || id == 0 {
+					return protocol.MakeErrReply("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	var b strings.Builder
+	connection.ForEachClient(func(c *connection.Connection) bool {
+		if ids != nil && !ids[c.GetID()] {
+			return true
+		}
+		if typeFilter != nil && !typeFilter(c) {
+			return true
+		}
+		b.WriteString(mdb.clientInfo(c))
+		return true
+	})
+	return protocol.MakeVerbatimReply("txt", []byte(b.String()))
+}
+
+// execClientKill CLIENT KILL addr 或者 CLIENT KILL [ID id] [ADDR addr] [USER user] [TYPE type] [SKIPME yes|no]
+func execClientKill(self redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("client|kill")
+	}
+
+	// 旧的格式：只能按照地址关闭，返回OK
+	if len(args) == 1 {
+		addr := string(args[0])
+		killed := killClients(self, func(c redis.Connection) bool {
+			return addrOf(c) == addr
+		})
+		if killed == 0 {
+			return protocol.MakeErrReply("ERR No such client")
+		}
+		return protocol.MakeOkReply()
+	}
+
+	if len(args)%2 != 0 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	var filters []func(c redis.Connection) bool
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || id == 0 {
+				return protocol.MakeErrReply("ERR client-id should be greater than 0")
+			}
+			filters = append(filters, func(c redis.Connection) bool {
+				return c.GetID() == id
+			})
+		case "addr":
+			filters = append(filters, func(c redis.Connection) bool {
+				return addrOf(c) == value
+			})
+		case "user":
+			// 没有ACL，所有连接都是default用户
+			if value != "default" {
+				return protocol.MakeErrReply("ERR No such user '" + value + "'")
+			}
+		case "type":
+			typeFilter, errReply := clientTypeFilter(value)
+			if errReply != nil {
+				return errReply
+			}
+			filters = append(filters, typeFilter)
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return protocol.MakeSyntaxErrReply()
+			}
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	killed := killClients(self, func(c redis.Connection) bool {
+		if skipMe && c.GetID() == self.GetID() {
+			return false
+		}
+		for _, filter := range filters {
+			if !filter(c) {
+				return false
+			}
+		}
+		return true
+	})
+	return protocol.MakeIntReply(int64(killed))
+}
+
+// killClients 关闭所有满足条件的连接，当前连接在发送回复之后关闭
+func killClients(self redis.Connection, match func(c redis.Connection) bool) int {
+	killed := 0
+	connection.ForEachClient(func(c *connection.Connection) bool {
+		if !match(c) {
+			return true
+		}
+		if c.GetID() == self.GetID() {
+			self.CloseAfterReply()
+		} else {
+			_ = c.Close()
+		}
+		killed++
+		return true
+	})
+	return killed
+}
+
+// execClientReply CLIENT REPLY ON|OFF|SKIP，OFF和SKIP本身没有回复
+func execClientReply(c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 1 {
+		return protocol.MakeArgNumErrReply("client|reply")
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		c.SetReplyMode(redis.ReplyOn)
+		return protocol.MakeOkReply()
+	case "off":
+		c.SetReplyMode(redis.ReplyOff)
+		return &protocol.NoReply{}
+	case "skip":
+		// 已经关闭回复时 SKIP 不生效
+		if c.GetReplyMode() != redis.ReplyOff {
+			c.SetReplyMode(redis.ReplySkipNext)
+		}
+		return &protocol.NoReply{}
+	}
+	return protocol.MakeSyntaxErrReply()
+}
+
+/* ---- CLIENT PAUSE ---- */
+
+// pauseState CLIENT PAUSE 的状态，暂停期间命令阻塞直到超时或者 UNPAUSE
+type pauseState struct {
+	mu     sync.Mutex
+	until  time.Time
+	all    bool          // ALL模式暂停所有命令，WRITE模式只暂停写命令
+	resume chan struct{} // UNPAUSE 时关闭，唤醒所有等待的命令
+}
+
+func makePauseState() *pauseState {
+	return &pauseState{}
+}
+
+// pause 暂停期间再次暂停时，取更晚的结束时间和更严格的模式
+func (p *pauseState) pause(timeout time.Duration, all bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until := time.Now().Add(timeout)
+	if time.Now().Before(p.until) {
+		all = all || p.all
+		if p.until.After(until) {
+			until = p.until
+		}
+	}
+	p.until = until
+	p.all = all
+	if p.resume == nil {
+		p.resume = make(chan struct{})
+	}
+}
+
+func (p *pauseState) unpause() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until = time.Time{}
+	if p.resume != nil {
+		close(p.resume)
+		p.resume = nil
+	}
+}
+
+// wait 命令被暂停时阻塞，直到暂停结束
+func (p *pauseState) wait(write bool) {
+	if p == nil {
+		return
+	}
+	for {
+		p.mu.Lock()
+		remaining := time.Until(p.until)
+		if remaining <= 0 || (!p.all && !write) {
+			p.mu.Unlock()
+			return
+		}
+		resume := p.resume
+		p.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-resume:
+		}
+		timer.Stop()
+	}
+}
+
+// isWriteCommand WRITE模式下需要暂停的命令
+func isWriteCommand(cmdName string) bool {
+	switch cmdName {
+	case "flushdb", "flushall", "publish", "exec", "casexec":
+		return true
+	}
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags == flagWrite
+}
+
+// execClientPause CLIENT PAUSE timeout [WRITE|ALL]，timeout 单位为毫秒
+func execClientPause(mdb *MultiDB, args [][]byte) redis.Reply {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.MakeArgNumErrReply("client|pause")
+	}
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "all":
+		case "write":
+			all = false
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if mdb.pause == nil {
+		return protocol.MakeErrReply("ERR CLIENT PAUSE is not supported")
+	}
+	mdb.pause.pause(time.Duration(timeout)*time.Millisecond, all)
+	return protocol.MakeOkReply()
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// makePipeConn 创建注册在连接表中的连接，另一端读取到的数据全部丢弃
+func makePipeConn(t *testing.T) *connection.Connection {
+	server, client := net.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, client)
+	}()
+	conn := connection.NewConn(server)
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = client.Close()
+	})
+	return conn
+}
+
+func idOf(c redis.Connection) string {
+	return strconv.FormatUint(c.GetID(), 10)
+}
+
+func TestClientList(t *testing.T) {
+	mdb := NewStandaloneServer()
+	normal := makePipeConn(t)
+	sub := makePipeConn(t)
+	mdb.Exec(normal, utils.ToCmdLine("client", "setname", "app"))
+	mdb.Exec(sub, utils.ToCmdLine("subscribe", "ch"))
+
+	result := string(mdb.Exec(normal, utils.ToCmdLine("client", "list", "id", idOf(normal), idOf(sub))).ToBytes())
+	lines := strings.Split(strings.TrimSuffix(strings.SplitN(result, "\r\n", 2)[1], "\n\r\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 clients, actual %q", result)
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "id="+idOf(normal)+" "):
+			if !strings.Contains(line, " name=app ") || !strings.Contains(line, " flags=N ") {
+				t.Errorf("unexpected client info %q", line)
+			}
+		case strings.HasPrefix(line, "id="+idOf(sub)+" "):
+			if !strings.Contains(line, " flags=P ") || !strings.Contains(line, " sub=1 ") {
+				t.Errorf("unexpected client info %q", line)
+			}
+		default:
+			t.Errorf("unexpected client %q", line)
+		}
+	}
+
+	result = string(mdb.Exec(normal, utils.ToCmdLine("client", "list", "type", "pubsub", "id", idOf(normal), idOf(sub))).ToBytes())
+	if !strings.Contains(result, "id="+idOf(sub)+" ") || strings.Contains(result, "id="+idOf(normal)+" ") {
+		t.Errorf("TYPE pubsub should only list subscribed client, actual %q", result)
+	}
+	for _, args := range [][]string{
+		{"client", "list", "type", "unknown"},
+		{"client", "list", "id", "abc"},
+		{"client", "list", "foo"},
+	} {
+		if result := mdb.Exec(normal, utils.ToCmdLine(args...)); !protocol.IsErrorReply(result) {
+			t.Errorf("%v: expected error, actual %q", args, result.ToBytes())
+		}
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	mdb := NewStandaloneServer()
+	self := makePipeConn(t)
+	other := makePipeConn(t)
+
+	// 默认跳过自身
+	if result := string(mdb.Exec(self, utils.ToCmdLine("client", "kill", "id", idOf(self))).ToBytes()); result != ":0\r\n" {
+		t.Errorf("expected :0, actual %q", result)
+	}
+	if result := string(mdb.Exec(self, utils.ToCmdLine("client", "kill", "id", idOf(other))).ToBytes()); result != ":1\r\n" {
+		t.Errorf("expected :1, actual %q", result)
+	}
+	if _, ok := connection.Lookup(other.GetID()); ok {
+		t.Error("killed client still registered")
+	}
+
+	// 关闭自身时先发送回复
+	result := string(mdb.Exec(self, utils.ToCmdLine("client", "kill", "id", idOf(self), "skipme", "no")).ToBytes())
+	if result != ":1\r\n" {
+		t.Errorf("expected :1, actual %q", result)
+	}
+	if !self.IsCloseAfterReply() {
+		t.Error("killing self should close after reply")
+	}
+	if _, ok := connection.Lookup(self.GetID()); !ok {
+		t.Error("self should not be closed before reply is sent")
+	}
+
+	for _, c := range []replyCase{
+		{[]string{"client", "kill", "no-such-addr:1"}, "-ERR No such client\r\n"},
+		{[]string{"client", "kill", "id", "0"}, "-ERR client-id should be greater than 0\r\n"},
+		{[]string{"client", "kill", "user", "admin"}, "-ERR No such user 'admin'\r\n"},
+		{[]string{"client", "kill", "id", "1", "skipme"}, "-Err syntax error\r\n"},
+	} {
+		if actual := string(mdb.Exec(self, utils.ToCmdLine(c.args...)).ToBytes()); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	if result := mdb.Exec(conn, utils.ToCmdLine("client", "pause", "10000", "write")); protocol.IsErrorReply(result) {
+		t.Fatalf("client pause: %s", result.ToBytes())
+	}
+
+	// 读命令不受影响
+	if result := string(execTimeout(t, mdb.mustSelectDB(0), conn, "get", "a")); result != "$1\r\n1\r\n" {
+		t.Errorf("unexpected reply %q", result)
+	}
+	done := make(chan struct{})
+	go func() {
+		mdb.Exec(conn, utils.ToCmdLine("get", "a"))
+		mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("set", "a", "2"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write command should be paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mdb.Exec(conn, utils.ToCmdLine("client", "unpause"))
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("write command not resumed after CLIENT UNPAUSE")
+	}
+	if result := string(mdb.Exec(conn, utils.ToCmdLine("get", "a")).ToBytes()); result != "$1\r\n2\r\n" {
+		t.Errorf("unexpected reply %q", result)
+	}
+
+	// 超时后自动恢复
+	mdb.Exec(conn, utils.ToCmdLine("client", "pause", "50"))
+	start := time.Now()
+	mdb.Exec(conn, utils.ToCmdLine("get", "a"))
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("ALL mode should pause reads until timeout, elapsed %v", elapsed)
+	}
+}
+
+func TestClientReply(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	// 与 Handler 一样，每条命令执行后检查是否发送回复
+	replied := func(args ...string) bool {
+		mdb.Exec(conn, utils.ToCmdLine(args...))
+		return conn.ShouldReply()
+	}
+
+	if !replied("set", "a", "1") {
+		t.Error("reply should be sent by default")
+	}
+	if replied("client", "reply", "skip") || replied("get", "a") {
+		t.Error("CLIENT REPLY SKIP and the next command should not reply")
+	}
+	if !replied("get", "a") {
+		t.Error("only one command should be skipped")
+	}
+
+	if replied("client", "reply", "off") || replied("get", "a") || replied("client", "reply", "skip") || replied("get", "a") {
+		t.Error("no reply should be sent when CLIENT REPLY OFF")
+	}
+	if !replied("client", "reply", "on") || !replied("get", "a") {
+		t.Error("CLIENT REPLY ON should resume replies")
+	}
+	if result := mdb.Exec(conn, utils.ToCmdLine("client", "reply", "foo")); !protocol.IsErrorReply(result) {
+		t.Errorf("expected syntax error, actual %q", result.ToBytes())
+	}
+}
+
+func TestEchoQuitReset(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	if result := string(mdb.Exec(conn, utils.ToCmdLine("echo", "hello")).ToBytes()); result != "$5\r\nhello\r\n" {
+		t.Errorf("unexpected ECHO reply %q", result)
+	}
+
+	mdb.Exec(conn, utils.ToCmdLine("hello", "3"))
+	mdb.Exec(conn, utils.ToCmdLine("client", "tracking", "on"))
+	mdb.Exec(conn, utils.ToCmdLine("client", "reply", "off"))
+	mdb.Exec(conn, utils.ToCmdLine("multi"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	if result := string(mdb.Exec(conn, utils.ToCmdLine("reset")).ToBytes()); result != "+RESET\r\n" {
+		t.Errorf("unexpected RESET reply %q", result)
+	}
+	if conn.InMultiState() || len(conn.GetQueuedCmdLine()) != 0 {
+		t.Error("RESET should discard transaction")
+	}
+	if _, _, _, ok := mdb.tracking.info(conn); ok {
+		t.Error("RESET should disable tracking")
+	}
+	if conn.GetProtocol() != protocol.RESP2 {
+		t.Errorf("RESET should switch back to RESP2, actual %d", conn.GetProtocol())
+	}
+	if conn.GetReplyMode() != redis.ReplyOn {
+		t.Error("RESET should turn replies on")
+	}
+	if result := string(mdb.Exec(conn, utils.ToCmdLine("get", "a")).ToBytes()); result != "$-1\r\n" {
+		t.Errorf("queued command should not be executed, actual %q", result)
+	}
+
+	if result := string(mdb.Exec(conn, utils.ToCmdLine("quit")).ToBytes()); result != "+OK\r\n" {
+		t.Errorf("unexpected QUIT reply %q", result)
+	}
+	if !conn.IsCloseAfterReply() {
+		t.Error("QUIT should close after reply")
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"github.com/HildaM/GoKV/aof"
 	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/datastruct/sortedset"
 	"github.com/HildaM/GoKV/interface/database"
 	"github.com/HildaM/GoKV/interface/redis"
 	"github.com/HildaM/GoKV/lib/logger"
+	"github.com/HildaM/GoKV/pubsub"
 	"github.com/HildaM/GoKV/redis/protocol"
 	"runtime/debug"
 	"strings"
@@ -18,9 +20,14 @@ import (
 type MultiDB struct {
 	dbSet []*atomic.Value // *DB
 
-	// TODO
 	// handle publish/subscribe
-	// hub *pubsub.Hub
+	hub *pubsub.Hub
+
+	// 客户端缓存的追踪表
+	tracking *trackingTable
+
+	// CLIENT PAUSE 的状态
+	pause *pauseState
 
 	// handle aof persistence
 	aofHandler *aof.Handler
@@ -29,6 +36,44 @@ type MultiDB struct {
 	slaveOf string
 	role    int32
 	//replication *replicationStatus
+
+	// 创建子数据库，FLUSHDB 时用于创建新的db替换旧的db
+	makeDB func() *DB
+
+	// 是否按照maxmemory淘汰key，加载aof期间以及aof重写使用的临时数据库不淘汰
+	evictionEnabled bool
+	evictedKeys     int64
+
+	// 子数据库是否向时间轮注册定时任务，与 evictionEnabled 相同，数据加载完成后才开启
+	tasksEnabled bool
+}
+
+// subscribeModeCmds 订阅模式下允许执行的命令
+var subscribeModeCmds = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+	"reset":        true,
+}
+
+// multiDBCmds 在 MultiDB 层面执行的命令，不经过 DB.Exec，无法进入事务队列
+var multiDBCmds = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"publish":      true,
+	"pubsub":       true,
+	"rewriteaof":   true,
+	"memory":       true,
+	"flushdb":      true,
+	"flushall":     true,
+	"client":       true,
+	"config":       true,
+	"info":         true,
 }
 
 // Exec 执行操作数据库命令
@@ -47,30 +92,91 @@ func (mdb *MultiDB) Exec(client redis.Connection, cmdLine [][]byte) (result redi
 	// TODO 1. auth登录验证
 	if cmdName == "auth" {
 		return Auth(client, cmdLine[1:])
+	} else if cmdName == "hello" {
+		return Hello(client, cmdLine[1:])
+	} else if cmdName == "quit" {
+		return execQuit(client)
+	} else if cmdName == "reset" {
+		return execReset(mdb, client)
 	}
 	if !isAuthenticated(client) {
 		return protocol.MakeErrReply("NOAUTH Authentication required")
 	}
 
+	// CLIENT PAUSE 期间阻塞，CLIENT 命令不受影响，保证能够执行 UNPAUSE
+	if cmdName != "client" {
+		mdb.pause.wait(isWriteCommand(cmdName))
+	}
+
 	// TODO 2. 集群命令
 
-	// 3. 无法在集群模式下执行的特殊命令
+	// 事务中不能立即执行这些命令，否则会打乱与队列中命令的先后顺序
+	if client.InMultiState() && multiDBCmds[cmdName] {
+		return rejectInMulti(client, cmdName)
+	}
+
+	// 3. 发布订阅，订阅模式下只能执行订阅相关的命令
+	if client.SubsCount()+client.PSubsCount() > 0 && !subscribeModeCmds[cmdName] {
+		return protocol.MakeErrReply("ERR Can't execute '" + cmdName +
+			"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+	}
+	switch cmdName {
+	case "subscribe":
+		return pubsub.Subscribe(mdb.hub, client, cmdLine[1:])
+	case "unsubscribe":
+		return pubsub.UnSubscribe(mdb.hub, client, cmdLine[1:])
+	case "psubscribe":
+		return pubsub.PSubscribe(mdb.hub, client, cmdLine[1:])
+	case "punsubscribe":
+		return pubsub.PUnSubscribe(mdb.hub, client, cmdLine[1:])
+	case "publish":
+		return pubsub.Publish(mdb.hub, cmdLine[1:])
+	case "pubsub":
+		return pubsub.PubSub(mdb.hub, cmdLine[1:])
+	case "ping":
+		if client.SubsCount()+client.PSubsCount() > 0 {
+			return subscribeModePing(cmdLine[1:])
+		}
+	}
+
+	// 4. 无法在集群模式下执行的特殊命令
+	defer mdb.tracking.afterCommand(client, cmdLine)
 	if cmdName == "rewriteaof" {
 		return RewriteAOF(mdb, cmdLine[1:])
+	} else if cmdName == "memory" {
+		return execMemory(mdb, client, cmdLine[1:])
+	} else if cmdName == "flushdb" {
+		return execFlushDB(mdb, client, cmdLine[1:])
+	} else if cmdName == "flushall" {
+		return execFlushAll(mdb, client, cmdLine[1:])
+	} else if cmdName == "client" {
+		return execClient(mdb, client, cmdLine[1:])
+	} else if cmdName == "config" {
+		return execConfig(cmdLine[1:])
+	} else if cmdName == "info" {
+		return execInfo(cmdLine[1:])
 	}
 
-	// 4. 普通命令
+	// 5. 普通命令
 	dbIndex := client.GetDBIndex()
 	selectedDB, errReply := mdb.SelectDB(dbIndex)
 	if errReply != nil {
 		return errReply
 	}
+	if denyOOM(client, cmdLine) && !mdb.freeMemoryIfNeeded() {
+		if cmdName == "exec" {
+			// 与redis一致，EXEC被拒绝时放弃整个事务
+			client.SetMultiState(false)
+		}
+		return &protocol.OOMErrReply{}
+	}
 	return selectedDB.Exec(client, cmdLine)
 }
 
-func (m MultiDB) AfterClientClose(c redis.Connection) {
-	//TODO implement me
-	panic("implement me")
+// AfterClientClose 连接关闭后取消其所有订阅，关闭客户端缓存的追踪
+func (mdb *MultiDB) AfterClientClose(c redis.Connection) {
+	pubsub.UnsubscribeAll(mdb.hub, c)
+	mdb.tracking.disable(c)
 }
 
 func (m MultiDB) Close() {
@@ -82,6 +188,29 @@ func (m MultiDB) Close() {
 	}
 }
 
+// newDB 创建序号为index的子数据库
+func (mdb *MultiDB) newDB(index int) *DB {
+	db := mdb.makeDB()
+	db.index = index
+	db.tracking = mdb.tracking
+	db.hub = mdb.hub
+	db.tasksEnabled = mdb.tasksEnabled
+	return db
+}
+
+// bindAof 为db配置aof写入，被FLUSHDB替换掉的db不再写入aof
+func (mdb *MultiDB) bindAof(db *DB) {
+	if mdb.aofHandler == nil {
+		return
+	}
+	holder := mdb.dbSet[db.index]
+	db.addAof = func(line CmdLine) {
+		if holder.Load().(*DB) == db {
+			mdb.aofHandler.AddAof(db.index, line)
+		}
+	}
+}
+
 // SelectDB 返回给定的子数据库
 func (mdb *MultiDB) SelectDB(index int) (*DB, *protocol.StandardErrReply) {
 	if index >= len(mdb.dbSet) || index < 0 {
@@ -92,20 +221,19 @@ func (mdb *MultiDB) SelectDB(index int) (*DB, *protocol.StandardErrReply) {
 
 // NewStandaloneServer 以单机模式启动godis服务器，同时设置额外的redis功能（发布订阅，主从复制等）
 func NewStandaloneServer() *MultiDB {
-	mdb := &MultiDB{}
+	mdb := &MultiDB{makeDB: MakeDB, hub: pubsub.MakeHub(), tracking: makeTrackingTable(), pause: makePauseState()}
 
 	// 1. 初始化参数
 	if config.Properties.Databases == 0 {
 		config.Properties.Databases = 16 // 默认16个数据库
 	}
+	sortedset.SetListpackLimits(config.Properties.ZSetMaxListpackEntries, config.Properties.ZSetMaxListpackValue)
 
 	// 2. 初始化并创建数据库
 	mdb.dbSet = make([]*atomic.Value, config.Properties.Databases)
 	for i := range mdb.dbSet {
-		single := MakeDB()
-		single.index = i
 		holder := &atomic.Value{}
-		holder.Store(single) // 使用atomic原子变量包装，确保并发安全
+		holder.Store(mdb.newDB(i)) // 使用atomic原子变量包装，确保并发安全
 		mdb.dbSet[i] = holder
 	}
 
@@ -122,10 +250,7 @@ func NewStandaloneServer() *MultiDB {
 
 		// 为每个子数据库配置aof相关内容
 		for _, db := range mdb.dbSet {
-			singleDB := db.Load().(*DB)
-			singleDB.addAof = func(line CmdLine) {
-				mdb.aofHandler.AddAof(singleDB.index, line)
-			}
+			mdb.bindAof(db.Load().(*DB))
 		}
 
 		validAOF = true
@@ -136,16 +261,23 @@ func NewStandaloneServer() *MultiDB {
 		// TODO
 	}
 
+	// 5. 数据加载完成后才开始按照maxmemory淘汰，执行到期的定时任务
+	mdb.evictionEnabled = true
+	mdb.tasksEnabled = true
+	for _, holder := range mdb.dbSet {
+		holder.Load().(*DB).startTasks()
+	}
+
 	return mdb
 }
 
 // MakeBasicMultiDB 此数据库仅仅用于aof重写时的备份，或者其他需求。不是主数据库
 func MakeBasicMultiDB() database.EmbedDB {
-	mdb := &MultiDB{}
+	mdb := &MultiDB{makeDB: makeBasicDB, hub: pubsub.MakeHub()}
 	mdb.dbSet = make([]*atomic.Value, config.Properties.Databases)
 	for i := range mdb.dbSet {
 		holder := &atomic.Value{}
-		holder.Store(makeBasicDB())
+		holder.Store(mdb.newDB(i))
 		mdb.dbSet[i] = holder
 	}
 	return mdb
@@ -187,6 +319,11 @@ func (mdb *MultiDB) GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine {
 	return mdb.mustSelectDB(dbIndex).GetUndoLogs(cmdLine)
 }
 
+// GetMetaCmds 返回无法通过遍历key还原的状态（例如二级索引定义），用于aof重写
+func (mdb *MultiDB) GetMetaCmds(dbIndex int) []CmdLine {
+	return mdb.mustSelectDB(dbIndex).getMetaCmds()
+}
+
 func (mdb *MultiDB) ExecWithLock(conn redis.Connection, cmdLine [][]byte) redis.Reply {
 	db, errReply := mdb.SelectDB(conn.GetDBIndex())
 	if errReply != nil {
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestMultiDBCmdsInMulti(t *testing.T) {
+	mdb := NewStandaloneServer()
+	subscriber := &connection.FakeConn{}
+	mdb.Exec(subscriber, utils.ToCmdLine("subscribe", "ch"))
+	subscriber.Clean()
+
+	conn := &connection.FakeConn{}
+	mdb.Exec(conn, utils.ToCmdLine("multi"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	for _, line := range [][]string{
+		{"publish", "ch", "msg"},
+		{"subscribe", "ch"},
+		{"pubsub", "channels"},
+		{"memory", "usage", "a"},
+		{"flushdb"},
+		{"client", "id"},
+		{"config", "get", "port"},
+		{"info"},
+	} {
+		result := string(mdb.Exec(conn, utils.ToCmdLine(line...)).ToBytes())
+		if !strings.HasPrefix(result, "-ERR command '"+line[0]+"' cannot be used in MULTI") {
+			t.Errorf("%v: unexpected reply %q", line, result)
+		}
+	}
+	if len(subscriber.Bytes()) != 0 {
+		t.Errorf("message published inside MULTI: %q", subscriber.Bytes())
+	}
+	if conn.SubsCount() != 0 {
+		t.Error("subscribed inside MULTI")
+	}
+
+	result := string(mdb.Exec(conn, utils.ToCmdLine("exec")).ToBytes())
+	if !strings.HasPrefix(result, "-EXECABORT") {
+		t.Errorf("expected EXECABORT, actual %q", result)
+	}
+	if result = string(mdb.Exec(conn, utils.ToCmdLine("get", "a")).ToBytes()); result != "$-1\r\n" {
+		t.Errorf("transaction should be discarded, actual %q", result)
+	}
+	if result = string(mdb.Exec(conn, utils.ToCmdLine("publish", "ch", "msg")).ToBytes()); result != ":1\r\n" {
+		t.Errorf("publish outside MULTI: expected :1, actual %q", result)
+	}
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	maxmemory 淘汰策略：
+	1. 执行写命令之前，如果估算的内存超过 maxmemory，按照 maxmemory-policy 淘汰key，直到内存低于上限
+	2. 与redis一致采用近似算法：每次从每个db中随机采样 maxmemory-samples 个key，淘汰其中最合适的一个
+	3. volatile-* 策略只从设置了过期时间的key中采样；无法淘汰时写命令返回OOM错误，读命令不受影响
+	4. 淘汰的key以 DEL 写入aof
+*/
+
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+
+	defaultEvictionSamples = 5
+
+	lfuInitValue  = 5  // 新key的初始计数，避免刚写入就被淘汰
+	lfuLogFactor  = 10 // 计数器增长的对数因子，约100万次访问达到255
+	lfuDecayTime  = 60 // 每空闲60秒计数器减1
+	lfuMaxCounter = 255
+)
+
+// oomAllowedCmds 可以释放内存的写命令，内存不足时仍然允许执行
+var oomAllowedCmds = map[string]bool{
+	"del":           true,
+	"unlink":        true,
+	"persist":       true,
+	"pexpireat":     true,
+	"ft.dropindex":  true,
+	"ts.deleterule": true,
+	"unschedule":    true,
+	"lock.release":  true,
+	"qack":          true,
+}
+
+// lruClock 访问时钟，精度为秒
+func lruClock() uint32 {
+	return uint32(time.Now().Unix())
+}
+
+// idleTime 返回entity自上次访问以来的空闲时间（秒）
+func idleTime(entity *database.DataEntity) uint32 {
+	now := lruClock()
+	last := atomic.LoadUint32(&entity.AccessClock)
+	if now < last {
+		return 0
+	}
+	return now - last
+}
+
+// lfuDecay 按照空闲时间衰减后的LFU计数
+func lfuDecay(entity *database.DataEntity) uint32 {
+	counter := atomic.LoadUint32(&entity.LFUCounter)
+	periods := idleTime(entity) / lfuDecayTime
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr 以对数概率增加计数，计数越大增加的概率越小
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= lfuMaxCounter {
+		return lfuMaxCounter
+	}
+	base := 0.0
+	if counter > lfuInitValue {
+		base = float64(counter - lfuInitValue)
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// touchEntity 记录一次访问，更新LRU时钟和LFU计数
+func touchEntity(entity *database.DataEntity) {
+	if entity == nil {
+		return
+	}
+	counter := lfuLogIncr(lfuDecay(entity))
+	atomic.StoreUint32(&entity.LFUCounter, counter)
+	atomic.StoreUint32(&entity.AccessClock, lruClock())
+}
+
+// evictionCandidate 采样得到的待淘汰key，score 越大越应该被淘汰
+type evictionCandidate struct {
+	db    *DB
+	key   string
+	score int64
+}
+
+// sampleEvictionCandidate 按照淘汰策略从db中采样，返回最合适的key
+func (db *DB) sampleEvictionCandidate(policy string, samples int) (*evictionCandidate, bool) {
+	volatile := strings.HasPrefix(policy, "volatile-")
+	var keys []string
+	if volatile {
+		if db.ttlMap.Len() == 0 {
+			return nil, false
+		}
+		keys = db.ttlMap.RandomKeys(samples)
+	} else {
+		if db.data.Len() == 0 {
+			return nil, false
+		}
+		keys = db.data.RandomKeys(samples)
+	}
+
+	var best *evictionCandidate
+	for _, key := range keys {
+		entity, ok := db.getRawEntity(key)
+		if !ok {
+			continue
+		}
+		var score int64
+		switch policy {
+		case policyAllKeysLRU, policyVolatileLRU:
+			score = int64(idleTime(entity))
+		case policyAllKeysLFU, policyVolatileLFU:
+			score = lfuMaxCounter - int64(lfuDecay(entity))
+		case policyVolatileTTL:
+			// 越早过期越优先淘汰
+			raw, ok := db.ttlMap.Get(key)
+			if !ok {
+				continue
+			}
+			score = -raw.(time.Time).UnixMilli()
+		default:
+			score = rand.Int63()
+		}
+		if best == nil || score > best.score {
+			best = &evictionCandidate{db: db, key: key, score: score}
+		}
+	}
+	return best, best != nil
+}
+
+// evict 淘汰指定的key
+func (db *DB) evict(key string) {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWULocks([]string{key}, nil)
+	if _, ok := db.getRawEntity(key); !ok {
+		return
+	}
+	db.Remove(key)
+	db.addVersion(nil, key)
+	db.addAof(utils.ToCmdLine("del", key))
+}
+
+// UsedMemory 返回所有db中数据估算的内存占用
+func (mdb *MultiDB) UsedMemory() int64 {
+	var used int64
+	for i := range mdb.dbSet {
+		used += mdb.mustSelectDB(i).UsedMemory()
+	}
+	return used
+}
+
+// EvictedKeys 返回因为maxmemory被淘汰的key的数量
+func (mdb *MultiDB) EvictedKeys() int64 {
+	return atomic.LoadInt64(&mdb.evictedKeys)
+}
+
+// freeMemoryIfNeeded 内存超过maxmemory时淘汰key，无法降低到maxmemory以下时返回false
+func (mdb *MultiDB) freeMemoryIfNeeded() bool {
+	maxMemory := int64(config.Properties.MaxMemory)
+	if maxMemory <= 0 || !mdb.evictionEnabled {
+		return true
+	}
+	policy := strings.ToLower(config.Properties.MaxMemoryPolicy)
+	samples := config.Properties.MaxMemorySamples
+	if samples <= 0 {
+		samples = defaultEvictionSamples
+	}
+	for mdb.UsedMemory() > maxMemory {
+		switch policy {
+		case policyAllKeysLRU, policyAllKeysLFU, policyAllKeysRandom,
+			policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL:
+		default:
+			// noeviction 以及无法识别的策略都不淘汰
+			return false
+		}
+		var best *evictionCandidate
+		for i := range mdb.dbSet {
+			candidate, ok := mdb.mustSelectDB(i).sampleEvictionCandidate(policy, samples)
+			if ok && (best == nil || candidate.score > best.score) {
+				best = candidate
+			}
+		}
+		if best == nil {
+			return false
+		}
+		best.db.evict(best.key)
+		atomic.AddInt64(&mdb.evictedKeys, 1)
+	}
+	return true
+}
+
+// denyOOM 内存不足时是否拒绝执行该命令
+func denyOOM(c redis.Connection, cmdLine [][]byte) bool {
+	inMulti := c != nil && c.InMultiState()
+	if strings.ToLower(string(cmdLine[0])) == "exec" {
+		if !inMulti {
+			return false
+		}
+		for _, queued := range c.GetQueuedCmdLine() {
+			if isDenyOOMCommand(queued) {
+				return true
+			}
+		}
+		return false
+	}
+	if inMulti {
+		// 进入队列的命令在EXEC时统一检查
+		return false
+	}
+	return isDenyOOMCommand(cmdLine)
+}
+
+// isDenyOOMCommand 除了可以释放内存的命令之外，所有写命令都会被拒绝
+func isDenyOOMCommand(cmdLine [][]byte) bool {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	switch cmdName {
+	case "setifversion", "casexec":
+		return true
+	}
+	if oomAllowedCmds[cmdName] {
+		return false
+	}
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags == flagWrite
+}
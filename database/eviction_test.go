@@ -0,0 +1,229 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+const (
+	evictionMaxMemory = 20 * 1024
+	evictionValueSize = 1000
+)
+
+var oomReply = string((&protocol.OOMErrReply{}).ToBytes())
+
+// setupEviction 设置maxmemory以及淘汰策略，采样数量足够大时每次淘汰都会比较所有key，结果是确定的
+func setupEviction(policy string) (*MultiDB, func()) {
+	maxMemory, maxMemoryPolicy, samples := config.Properties.MaxMemory, config.Properties.MaxMemoryPolicy, config.Properties.MaxMemorySamples
+	mdb := NewStandaloneServer()
+	config.Properties.MaxMemory = evictionMaxMemory
+	config.Properties.MaxMemoryPolicy = policy
+	config.Properties.MaxMemorySamples = 1000
+	return mdb, func() {
+		config.Properties.MaxMemory = maxMemory
+		config.Properties.MaxMemoryPolicy = maxMemoryPolicy
+		config.Properties.MaxMemorySamples = samples
+	}
+}
+
+func execMDB(mdb *MultiDB, args ...string) string {
+	return string(mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine(args...)).ToBytes())
+}
+
+// fillUntilOOM 不断写入 prefix0、prefix1 ... 直到返回OOM错误，返回成功写入的数量
+func fillUntilOOM(t *testing.T, mdb *MultiDB, prefix string) int {
+	t.Helper()
+	value := strings.Repeat("x", evictionValueSize)
+	for n := 0; n < 100; n++ {
+		actual := execMDB(mdb, "set", prefix+strconv.Itoa(n), value)
+		if actual == oomReply {
+			return n
+		}
+		if actual != "+OK\r\n" {
+			t.Fatalf("set %s: %q", prefix+strconv.Itoa(n), actual)
+		}
+	}
+	t.Fatal("writes should be rejected after maxmemory is reached")
+	return 0
+}
+
+// fillKeys 写入 prefix0 ~ prefix{n-1}，expire 为true时设置一小时后过期
+func fillKeys(t *testing.T, mdb *MultiDB, prefix string, n int, expire bool) {
+	t.Helper()
+	value := strings.Repeat("x", evictionValueSize)
+	for i := 0; i < n; i++ {
+		key := prefix + strconv.Itoa(i)
+		if actual := execMDB(mdb, "set", key, value); actual != "+OK\r\n" {
+			t.Fatalf("set %s: %q", key, actual)
+		}
+		if expire {
+			expireAt := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+			execMDB(mdb, "pexpireat", key, expireAt)
+		}
+	}
+}
+
+func existingKeys(mdb *MultiDB, prefix string, n int) []string {
+	var keys []string
+	for i := 0; i < n; i++ {
+		key := prefix + strconv.Itoa(i)
+		if _, ok := mdb.mustSelectDB(0).getRawEntity(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// assertMemoryBounded 写命令执行前淘汰，内存最多超出一个key
+func assertMemoryBounded(t *testing.T, mdb *MultiDB) {
+	t.Helper()
+	if mdb.EvictedKeys() == 0 {
+		t.Error("keys should be evicted")
+	}
+	if used := mdb.UsedMemory(); used > evictionMaxMemory+estimateSize("key00", make([]byte, evictionValueSize)) {
+		t.Errorf("used memory %d exceeds maxmemory %d", used, evictionMaxMemory)
+	}
+}
+
+func TestEvictionAllKeys(t *testing.T) {
+	for _, c := range []struct {
+		policy string
+		// age 将冷数据标记为很久没有访问或者访问频率很低，hot 标记为刚刚访问并且访问频繁
+		age func(entity *database.DataEntity, hot bool)
+	}{
+		{policyAllKeysLRU, func(entity *database.DataEntity, hot bool) {
+			if !hot {
+				atomic.StoreUint32(&entity.AccessClock, lruClock()-100)
+			}
+		}},
+		{policyAllKeysLFU, func(entity *database.DataEntity, hot bool) {
+			counter := uint32(0)
+			if hot {
+				counter = lfuMaxCounter
+			}
+			atomic.StoreUint32(&entity.LFUCounter, counter)
+		}},
+		{policyAllKeysRandom, nil},
+	} {
+		t.Run(c.policy, func(t *testing.T) {
+			mdb, restore := setupEviction(c.policy)
+			defer restore()
+			fillKeys(t, mdb, "cold", 15, false)
+			fillKeys(t, mdb, "hot", 1, false)
+			if c.age != nil {
+				for i := 0; i < 15; i++ {
+					entity, _ := mdb.mustSelectDB(0).getRawEntity("cold" + strconv.Itoa(i))
+					c.age(entity, false)
+				}
+				entity, _ := mdb.mustSelectDB(0).getRawEntity("hot0")
+				c.age(entity, true)
+			}
+
+			fillKeys(t, mdb, "new", 10, false)
+			assertMemoryBounded(t, mdb)
+			if c.age == nil {
+				return
+			}
+			if len(existingKeys(mdb, "hot", 1)) != 1 {
+				t.Error("hot key should not be evicted")
+			}
+			if keys := existingKeys(mdb, "new", 10); len(keys) != 10 {
+				t.Errorf("new keys should not be evicted before cold keys, remaining %v", keys)
+			}
+			if len(existingKeys(mdb, "cold", 15)) == 15 {
+				t.Error("cold keys should be evicted")
+			}
+		})
+	}
+}
+
+func TestEvictionVolatile(t *testing.T) {
+	for _, policy := range []string{policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL} {
+		t.Run(policy, func(t *testing.T) {
+			mdb, restore := setupEviction(policy)
+			defer restore()
+			fillKeys(t, mdb, "volatile", 10, true)
+			fillKeys(t, mdb, "persistent", 12, false)
+			assertMemoryBounded(t, mdb)
+			if keys := existingKeys(mdb, "persistent", 12); len(keys) != 12 {
+				t.Errorf("keys without ttl should not be evicted, remaining %v", keys)
+			}
+
+			// 没有可以淘汰的key之后拒绝写入
+			fillUntilOOM(t, mdb, "more")
+			if keys := existingKeys(mdb, "volatile", 10); len(keys) != 0 {
+				t.Errorf("all volatile keys should be evicted, remaining %v", keys)
+			}
+		})
+	}
+}
+
+func TestEvictionVolatileTTL(t *testing.T) {
+	mdb, restore := setupEviction(policyVolatileTTL)
+	defer restore()
+	value := strings.Repeat("x", evictionValueSize)
+	for i := 0; i < 10; i++ {
+		key := "volatile" + strconv.Itoa(i)
+		execMDB(mdb, "set", key, value)
+		expireAt := strconv.FormatInt(time.Now().Add(time.Duration(i+1)*time.Hour).UnixMilli(), 10)
+		execMDB(mdb, "pexpireat", key, expireAt)
+	}
+	fillKeys(t, mdb, "persistent", 12, false)
+	assertMemoryBounded(t, mdb)
+
+	// 越早过期越先被淘汰，剩下的是过期时间最晚的key
+	keys := existingKeys(mdb, "volatile", 10)
+	if len(keys) == 0 || len(keys) == 10 {
+		t.Fatalf("some volatile keys should be evicted, remaining %v", keys)
+	}
+	for i, key := range keys {
+		if expected := "volatile" + strconv.Itoa(10-len(keys)+i); key != expected {
+			t.Errorf("expected %s to remain, actual %v", expected, keys)
+			break
+		}
+	}
+}
+
+func TestEvictionNoEviction(t *testing.T) {
+	mdb, restore := setupEviction(policyNoEviction)
+	defer restore()
+	fillUntilOOM(t, mdb, "k")
+	if mdb.EvictedKeys() != 0 {
+		t.Fatalf("noeviction should not evict keys, evicted %d", mdb.EvictedKeys())
+	}
+	value := strings.Repeat("x", evictionValueSize)
+
+	conn := &connection.FakeConn{}
+	exec := func(args ...string) string {
+		return string(mdb.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	expireAt := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	for _, c := range []replyCase{
+		// 写命令被拒绝，读命令不受影响
+		{[]string{"hset", "h", "f", "v"}, oomReply},
+		{[]string{"get", "k0"}, "$1000\r\n" + value + "\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "k0", "x"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, oomReply},
+		{[]string{"exec"}, "-ERR EXEC without MULTI\r\n"},
+		// 可以释放内存的写命令仍然可以执行
+		{[]string{"pexpireat", "k0", expireAt}, ":1\r\n"},
+		{[]string{"persist", "k0"}, ":1\r\n"},
+		{[]string{"unlink", "k0"}, ":1\r\n"},
+		{[]string{"del", "k1", "k2"}, ":2\r\n"},
+		{[]string{"set", "k0", "x"}, "+OK\r\n"},
+	} {
+		if actual := exec(c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	Dict "github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// getAsDict 获取hash数据
+func (db *DB) getAsDict(key string) (Dict.Dict, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	dict, ok := entity.Data.(Dict.Dict)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return dict, nil
+}
+
+// getOrInitDict 懒加载hash
+func (db *DB) getOrInitDict(key string) (dict Dict.Dict, inited bool, errReply protocol.ErrorReply) {
+	dict, errReply = db.getAsDict(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if dict == nil {
+		dict = Dict.MakeSimple()
+		db.PutEntity(key, &database.DataEntity{
+			Data: dict,
+		})
+		inited = true
+	}
+	return dict, inited, nil
+}
+
+// execHSet HSET key field value [field value ...]
+func execHSet(db *DB, args [][]byte) redis.Reply {
+	if len(args)%2 != 1 {
+		return protocol.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	added := 0
+	for i := 1; i+1 < len(args); i += 2 {
+		added += dict.Put(string(args[i]), args[i+1])
+	}
+
+	db.addAof(utils.ToCmdLine3("hset", args...))
+	return protocol.MakeIntReply(int64(added))
+}
+
+// execHGet HGET key field
+func execHGet(db *DB, args [][]byte) redis.Reply {
+	dict, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return &protocol.NullBulkReply{}
+	}
+	raw, exists := dict.Get(string(args[1]))
+	if !exists {
+		return &protocol.NullBulkReply{}
+	}
+	return protocol.MakeBulkReply(raw.([]byte))
+}
+
+// execHMGet HMGET key field [field ...]
+func execHMGet(db *DB, args [][]byte) redis.Reply {
+	dict, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if dict == nil {
+		return protocol.MakeMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		if raw, exists := dict.Get(string(field)); exists {
+			result[i] = raw.([]byte)
+		}
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execHDel HDEL key field [field ...]，hash为空时删除key
+func execHDel(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return protocol.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		deleted += dict.Remove(string(field))
+	}
+	if dict.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("hdel", args...))
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+// execHExists HEXISTS key field
+func execHExists(db *DB, args [][]byte) redis.Reply {
+	dict, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return protocol.MakeIntReply(0)
+	}
+	if _, exists := dict.Get(string(args[1])); exists {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execHLen HLEN key
+func execHLen(db *DB, args [][]byte) redis.Reply {
+	dict, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(dict.Len()))
+}
+
+// execHGetAll HGETALL key
+func execHGetAll(db *DB, args [][]byte) redis.Reply {
+	dict, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return protocol.MakeMapReply(nil, nil)
+	}
+	result := make([][]byte, 0, dict.Len()*2)
+	dict.ForEach(func(field string, val interface{}) bool {
+		result = append(result, []byte(field), val.([]byte))
+		return true
+	})
+	return protocol.MakeBulkMapReply(result)
+}
+
+// hashToStringMap 将hash转换为 field --> value，用于二级索引
+func hashToStringMap(dict Dict.Dict) map[string]string {
+	values := make(map[string]string, dict.Len())
+	dict.ForEach(func(field string, val interface{}) bool {
+		values[field] = string(val.([]byte))
+		return true
+	})
+	return values
+}
+
+func init() {
+	RegisterCommand("HSet", execHSet, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("HDel", execHDel, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("HGet", execHGet, readFirstKey, nil, 3, flagReadOnly)
+	RegisterCommand("HMGet", execHMGet, readFirstKey, nil, -3, flagReadOnly)
+	RegisterCommand("HExists", execHExists, readFirstKey, nil, 3, flagReadOnly)
+	RegisterCommand("HLen", execHLen, readFirstKey, nil, 2, flagReadOnly)
+	RegisterCommand("HGetAll", execHGetAll, readFirstKey, nil, 2, flagReadOnly)
+}
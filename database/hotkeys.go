@@ -0,0 +1,70 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/topk"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	HOTKEYS [COUNT n]
+	每次读写key时记录到db的热点统计中，返回最近一段时间内访问次数最多的key及其估算的访问次数
+*/
+
+const (
+	hotKeysTracked      = 64 // 每个db统计的热点key数量，也是 COUNT 的上限
+	hotKeysDefaultCount = 10
+	hotKeysSketchWidth  = 4096
+	hotKeysSketchDepth  = 4
+	hotKeysDecayPeriod  = 10 * time.Second // 访问次数每10秒减半
+)
+
+func makeHotKeys() *topk.TopK {
+	return topk.Make(hotKeysTracked, hotKeysSketchWidth, hotKeysSketchDepth, hotKeysDecayPeriod)
+}
+
+// recordAccess 记录一次对key的访问
+func (db *DB) recordAccess(key string) {
+	if db.hotKeys != nil {
+		db.hotKeys.Record(key)
+	}
+}
+
+// execHotKeys HOTKEYS [COUNT n]
+func execHotKeys(db *DB, args [][]byte) redis.Reply {
+	count := hotKeysDefaultCount
+	if len(args) != 0 {
+		if len(args) != 2 || strings.ToLower(string(args[0])) != "count" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n <= 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	if db.hotKeys == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	// 已经被删除的key仍然可能留在统计中，返回前过滤掉
+	result := make([][]byte, 0, 2*count)
+	for _, item := range db.hotKeys.List(-1) {
+		if len(result) >= 2*count {
+			break
+		}
+		if _, ok := db.data.Get(item.Key); !ok {
+			continue
+		}
+		result = append(result, []byte(item.Key), []byte(strconv.FormatUint(uint64(item.Count), 10)))
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+func init() {
+	RegisterCommand("HotKeys", execHotKeys, noPrepare, nil, -1, flagReadOnly)
+}
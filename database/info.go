@@ -0,0 +1,67 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	INFO [section ...]
+	以 "# Section" 开头、"field:value" 为行的文本返回服务器状态，RESP3下为verbatim string
+*/
+
+type infoSection struct {
+	name   string
+	fields func() [][2]string
+}
+
+var infoSections = []infoSection{
+	{"server", func() [][2]string {
+		return [][2]string{
+			{"redis_version", serverVersion},
+			{"redis_mode", "standalone"},
+			{"tcp_port", strconv.Itoa(config.Properties.Port)},
+		}
+	}},
+	{"clients", func() [][2]string {
+		return [][2]string{
+			{"connected_clients", strconv.FormatInt(connection.ConnectedClients(), 10)},
+			{"maxclients", strconv.Itoa(config.Properties.MaxClients)},
+		}
+	}},
+	{"stats", func() [][2]string {
+		return [][2]string{
+			{"total_connections_received", strconv.FormatInt(connection.TotalConnections(), 10)},
+			{"rejected_connections", strconv.FormatInt(connection.RejectedConnections(), 10)},
+		}
+	}},
+}
+
+// execInfo INFO [section ...]，不指定或者指定 all、everything、default 时返回所有部分
+func execInfo(args [][]byte) redis.Reply {
+	selected := make(map[string]bool)
+	for _, arg := range args {
+		selected[strings.ToLower(string(arg))] = true
+	}
+	all := len(args) == 0 || selected["all"] || selected["everything"] || selected["default"]
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !selected[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(protocol.CRLF)
+		}
+		b.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + protocol.CRLF)
+		for _, field := range section.fields() {
+			b.WriteString(field[0] + ":" + field[1] + protocol.CRLF)
+		}
+	}
+	return protocol.MakeVerbatimReply("txt", []byte(b.String()))
+}
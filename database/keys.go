@@ -0,0 +1,86 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	通用key命令
+*/
+
+// execDel DEL key [key ...]
+func execDel(db *DB, args [][]byte) redis.Reply {
+	deleted := 0
+	for _, arg := range args {
+		key := string(arg)
+		if _, exists := db.GetEntity(key); exists {
+			db.Remove(key)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("del", args...))
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+// prepareDel 所有参数均为写入key
+func prepareDel(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+// execPExpireAt PEXPIREAT key unix-time-milliseconds，时间已经过去时直接删除key
+func execPExpireAt(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(0)
+	}
+	expireAt := time.UnixMilli(raw)
+	if !expireAt.After(time.Now()) {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("del", key))
+		return protocol.MakeIntReply(1)
+	}
+	db.Expire(key, expireAt)
+	db.addAof(utils.ToCmdLine3("pexpireat", args...))
+	return protocol.MakeIntReply(1)
+}
+
+// undoDel 还原所有被删除的key
+func undoDel(db *DB, args [][]byte) []CmdLine {
+	keys, _ := prepareDel(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execPersist PERSIST key 取消key的过期时间
+func execPersist(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return protocol.MakeIntReply(0)
+	}
+	if _, exists := db.ttlMap.Get(key); !exists {
+		return protocol.MakeIntReply(0)
+	}
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine3("persist", args...))
+	return protocol.MakeIntReply(1)
+}
+
+func init() {
+	RegisterCommand("Del", execDel, prepareDel, undoDel, -2, flagWrite)
+	RegisterCommand("Persist", execPersist, writeFirstKey, rollbackFirstKey, 2, flagWrite)
+	RegisterCommand("PExpireAt", execPExpireAt, writeFirstKey, rollbackFirstKey, 3, flagWrite)
+}
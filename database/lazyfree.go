@@ -0,0 +1,172 @@
+package database
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/timewheel"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	惰性释放：UNLINK、FLUSHDB ASYNC、FLUSHALL ASYNC
+	1. UNLINK 在锁内把key从db中摘除，被摘除的数据交给后台协程释放引用，命令本身的耗时与数据大小无关
+	2. FLUSHDB 通过 MultiDB.dbSet 中的 atomic.Value 换上一个新的db，旧db在后台协程中取消定时任务并逐个摘除key
+	   被替换的db不再写入aof，仍在旧db上执行的命令相当于在清空之前执行
+	3. 被摘除的数据可能仍被不加锁遍历的命令（TS.MRANGE、FT.CREATE、BIGKEYS 等）持有，后台协程不能修改数据本身
+*/
+
+var (
+	lazyFreePendingObjects int64 // 等待后台释放的对象数量
+	lazyFreedObjects       int64 // 已经在后台释放的对象数量
+)
+
+// LazyFreePendingObjects 返回等待后台释放的对象数量
+func LazyFreePendingObjects() int64 {
+	return atomic.LoadInt64(&lazyFreePendingObjects)
+}
+
+// LazyFreedObjects 返回已经在后台释放的对象数量
+func LazyFreedObjects() int64 {
+	return atomic.LoadInt64(&lazyFreedObjects)
+}
+
+// freeLazily 在后台协程中释放objects个对象
+func freeLazily(objects int64, free func()) {
+	atomic.AddInt64(&lazyFreePendingObjects, objects)
+	go func() {
+		free()
+		atomic.AddInt64(&lazyFreePendingObjects, -objects)
+		atomic.AddInt64(&lazyFreedObjects, objects)
+	}()
+}
+
+// release 释放被FLUSHDB替换掉的db
+func (db *DB) release() {
+	db.schedules.mu.Lock()
+	for id := range db.schedules.jobs {
+		timewheel.Cancel(db.genTaskKey("schedule", id))
+	}
+	db.schedules.jobs = make(map[string]*scheduledJob)
+	db.schedules.mu.Unlock()
+
+	// 仍然可能有命令在旧db上执行，摘除每个key之前需要加锁，数据本身交给GC回收
+	for _, key := range db.data.Keys() {
+		db.RWLocks([]string{key}, nil)
+		if entity, ok := db.getRawEntity(key); ok {
+			db.cancelTasks(key, entity)
+		}
+		db.data.Remove(key)
+		db.RWULocks([]string{key}, nil)
+	}
+}
+
+// execUnlink UNLINK key [key ...] 摘除key，数据在后台协程中释放
+func execUnlink(db *DB, args [][]byte) redis.Reply {
+	var unlinked []*database.DataEntity
+	for _, arg := range args {
+		key := string(arg)
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		db.Remove(key)
+		unlinked = append(unlinked, entity)
+	}
+	if len(unlinked) == 0 {
+		return protocol.MakeIntReply(0)
+	}
+	db.addAof(utils.ToCmdLine3("unlink", args...))
+	// 数据可能仍被不加锁遍历的命令持有，只释放引用
+	freeLazily(int64(len(unlinked)), func() {
+		for i := range unlinked {
+			unlinked[i] = nil
+		}
+	})
+	return protocol.MakeIntReply(int64(len(unlinked)))
+}
+
+// parseFlushMode 解析 FLUSHDB/FLUSHALL 的 ASYNC|SYNC 参数，默认同步释放
+func parseFlushMode(cmdName string, args [][]byte) (bool, redis.Reply) {
+	if len(args) > 1 {
+		return false, protocol.MakeArgNumErrReply(cmdName)
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "async":
+		return true, nil
+	case "sync":
+		return false, nil
+	}
+	return false, protocol.MakeSyntaxErrReply()
+}
+
+// flushDB 用新的db替换指定的db，旧db中的数据同步或者在后台释放
+func (mdb *MultiDB) flushDB(index int, async bool) {
+	holder := mdb.dbSet[index]
+	old := holder.Load().(*DB)
+	fresh := mdb.newDB(index)
+	base := atomic.LoadUint32(&old.maxVersion)
+	if old.versionBase > base {
+		base = old.versionBase
+	}
+	fresh.versionBase = base + 1
+	mdb.bindAof(fresh)
+	holder.Store(fresh)
+
+	objects := int64(old.data.Len())
+	if async {
+		freeLazily(objects, old.release)
+	} else {
+		old.release()
+	}
+}
+
+// execFlushDB FLUSHDB [ASYNC|SYNC]
+func execFlushDB(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if c != nil && c.InMultiState() {
+		return protocol.MakeErrReply("ERR FLUSHDB inside MULTI is not allowed")
+	}
+	async, errReply := parseFlushMode("flushdb", args)
+	if errReply != nil {
+		return errReply
+	}
+	index := c.GetDBIndex()
+	if _, errReply := mdb.SelectDB(index); errReply != nil {
+		return errReply
+	}
+	mdb.flushDB(index, async)
+	mdb.tracking.invalidateAll()
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(index, utils.ToCmdLine("flushdb"))
+	}
+	return protocol.MakeOkReply()
+}
+
+// execFlushAll FLUSHALL [ASYNC|SYNC]
+func execFlushAll(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if c != nil && c.InMultiState() {
+		return protocol.MakeErrReply("ERR FLUSHALL inside MULTI is not allowed")
+	}
+	async, errReply := parseFlushMode("flushall", args)
+	if errReply != nil {
+		return errReply
+	}
+	for i := range mdb.dbSet {
+		mdb.flushDB(i, async)
+	}
+	mdb.tracking.invalidateAll()
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(0, utils.ToCmdLine("flushall"))
+	}
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("Unlink", execUnlink, prepareDel, undoDel, -2, flagWrite)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+// 不加锁遍历的命令可能仍然持有被删除的数据，删除后数据本身不能被修改
+func TestLazyFreeKeepsEntityIntact(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	args := []string{"hset", "h"} // 元素较多的hash
+	for i := 0; i < 100; i++ {
+		args = append(args, "f"+strconv.Itoa(i), "v")
+	}
+	mdb.Exec(conn, utils.ToCmdLine(args...))
+	mdb.Exec(conn, utils.ToCmdLine("hset", "h2", "f", "v"))
+
+	db := mdb.mustSelectDB(0)
+	held, _ := db.getRawEntity("h")
+	held2, _ := db.getRawEntity("h2")
+	mdb.Exec(conn, utils.ToCmdLine("unlink", "h"))
+	mdb.Exec(conn, utils.ToCmdLine("flushdb", "async"))
+	for LazyFreePendingObjects() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, entity := range []interface{}{held.Data, held2.Data} {
+		hash, ok := entity.(dict.Dict)
+		if !ok || hash.Len() == 0 {
+			t.Fatalf("released entity was modified: %v", entity)
+		}
+	}
+	if _, exists := db.getRawEntity("h2"); exists {
+		t.Error("old db should be emptied by FLUSHDB ASYNC")
+	}
+}
+
+func TestUnlinkFreesLazily(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	for LazyFreePendingObjects() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	freed := LazyFreedObjects()
+	mdb.Exec(conn, utils.ToCmdLine("hset", "h", "f", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "s", "v"))
+
+	result := string(mdb.Exec(conn, utils.ToCmdLine("unlink", "h", "s", "missing")).ToBytes())
+	if result != ":2\r\n" {
+		t.Fatalf("expected :2, actual %q", result)
+	}
+	for LazyFreePendingObjects() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if actual := LazyFreedObjects() - freed; actual != 2 {
+		t.Errorf("expected 2 objects freed lazily, actual %d", actual)
+	}
+	if result = string(mdb.Exec(conn, utils.ToCmdLine("get", "s")).ToBytes()); result != "$-1\r\n" {
+		t.Errorf("unlinked key still exists: %q", result)
+	}
+
+	// 没有删除任何key时不经过后台协程
+	mdb.Exec(conn, utils.ToCmdLine("unlink", "missing"))
+	if actual := LazyFreedObjects() - freed; actual != 2 {
+		t.Errorf("expected 2 objects freed lazily, actual %d", actual)
+	}
+}
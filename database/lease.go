@@ -0,0 +1,184 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/idgenerator"
+	"github.com/HildaM/GoKV/lib/timewheel"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	分布式锁命令：LOCK.ACQUIRE LOCK.RENEW LOCK.RELEASE LOCK.INFO
+	aof 中使用 LOCK.RESTORE 记录确定的持有者、fencing token 和到期时间
+*/
+
+// fencingTokens 雪花算法生成的id随时间单调递增，可以直接作为fencing token
+var fencingTokens = idgenerator.MakeGenerator("lock")
+
+// getAsLease 获取锁，租约已经到期的锁视为不存在
+// 时间轮的精度是秒，不能依赖它及时删除到期的锁
+func (db *DB) getAsLease(key string) (*lease.Lease, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	l, ok := entity.Data.(*lease.Lease)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	if l.Expired(time.Now()) {
+		db.Remove(key)
+		return nil, nil
+	}
+	return l, nil
+}
+
+// putLease 保存锁并通过时间轮在租约到期时删除
+func (db *DB) putLease(key string, l *lease.Lease) {
+	db.PutEntity(key, &database.DataEntity{Data: l})
+	db.scheduleLeaseExpire(key, l)
+	db.addAof(utils.ToCmdLine("lock.restore", key, l.Owner,
+		strconv.FormatInt(l.Token, 10), strconv.FormatInt(l.Deadline.UnixMilli(), 10)))
+}
+
+func (db *DB) scheduleLeaseExpire(key string, l *lease.Lease) {
+	db.delayTask(l.Remaining(time.Now()), db.genTaskKey("lock", key), func() {
+		db.expireLock(key, l)
+	})
+}
+
+// expireLock 租约到期，删除锁
+func (db *DB) expireLock(key string, l *lease.Lease) {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWULocks([]string{key}, nil)
+
+	entity, exists := db.GetEntity(key)
+	if !exists || entity.Data != l {
+		return // 锁已经被释放、覆盖或者续约（续约会替换为新的租约）
+	}
+	db.addVersion(nil, key)
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("del", key))
+}
+
+func parseLeaseTTL(raw []byte) (time.Duration, protocol.ErrorReply) {
+	ttl, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || ttl <= 0 {
+		return 0, protocol.MakeErrReply("ERR invalid ttl")
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+// leaseDeadline 到期时间截断到毫秒，与aof中记录的数值保持一致
+func leaseDeadline(ttl time.Duration) time.Time {
+	return time.UnixMilli(time.Now().Add(ttl).UnixMilli())
+}
+
+// execLockAcquire LOCK.ACQUIRE key owner ttl-milliseconds
+// 获取成功时返回fencing token；锁被其他持有者占用时返回nil
+// 持有者重复获取视为续约，返回原有的token
+func execLockAcquire(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	owner := string(args[1])
+	ttl, errReply := parseLeaseTTL(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	l, errReply := db.getAsLease(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l != nil && l.Owner != owner {
+		return protocol.MakeNullBulkReply()
+	}
+
+	if l != nil {
+		l = lease.Make(owner, l.Token, leaseDeadline(ttl))
+	} else {
+		l = lease.Make(owner, fencingTokens.NextID(), leaseDeadline(ttl))
+	}
+	db.putLease(key, l)
+	return protocol.MakeIntReply(l.Token)
+}
+
+// execLockRenew LOCK.RENEW key owner ttl-milliseconds，续约成功返回1
+func execLockRenew(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	ttl, errReply := parseLeaseTTL(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	l, errReply := db.getAsLease(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil || l.Owner != string(args[1]) {
+		return protocol.MakeIntReply(0)
+	}
+	db.putLease(key, lease.Make(l.Owner, l.Token, leaseDeadline(ttl)))
+	return protocol.MakeIntReply(1)
+}
+
+// execLockRelease LOCK.RELEASE key owner，只有持有者可以释放锁
+func execLockRelease(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	l, errReply := db.getAsLease(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil || l.Owner != string(args[1]) {
+		return protocol.MakeIntReply(0)
+	}
+	db.Remove(key)
+	timewheel.Cancel(db.genTaskKey("lock", key))
+	db.addAof(utils.ToCmdLine3("lock.release", args...))
+	return protocol.MakeIntReply(1)
+}
+
+// execLockInfo LOCK.INFO key 返回 owner、token 和剩余的租约毫秒数
+func execLockInfo(db *DB, args [][]byte) redis.Reply {
+	l, errReply := db.getAsLease(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(
+		"owner", l.Owner,
+		"token", strconv.FormatInt(l.Token, 10),
+		"ttl", strconv.FormatInt(l.Remaining(time.Now()).Milliseconds(), 10),
+	))
+}
+
+// execLockRestore LOCK.RESTORE key owner token deadline-ms，用于aof重放和重写
+func execLockRestore(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	token, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	deadline, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if _, errReply := db.getAsLease(key); errReply != nil {
+		return errReply
+	}
+	db.putLease(key, lease.Make(string(args[1]), token, time.UnixMilli(deadline)))
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("Lock.Acquire", execLockAcquire, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	RegisterCommand("Lock.Renew", execLockRenew, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	RegisterCommand("Lock.Release", execLockRelease, writeFirstKey, rollbackFirstKey, 3, flagWrite)
+	RegisterCommand("Lock.Info", execLockInfo, readFirstKey, nil, 2, flagReadOnly)
+	RegisterCommand("Lock.Restore", execLockRestore, writeFirstKey, rollbackFirstKey, 5, flagWrite)
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestLockAcquireRelease(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	token := execString(db, conn, "lock.acquire", "l", "a", "10000")
+	if !strings.HasPrefix(token, ":") {
+		t.Fatalf("acquire should return a token, actual %q", token)
+	}
+	assertReplies(t, db, conn, []replyCase{
+		// 其他持有者无法获取，持有者重复获取视为续约，token不变
+		{[]string{"lock.acquire", "l", "b", "10000"}, "$-1\r\n"},
+		{[]string{"lock.acquire", "l", "a", "20000"}, token},
+		{[]string{"lock.renew", "l", "b", "10000"}, ":0\r\n"},
+		{[]string{"lock.renew", "l", "a", "30000"}, ":1\r\n"},
+		{[]string{"lock.release", "l", "b"}, ":0\r\n"},
+		{[]string{"lock.release", "l", "a"}, ":1\r\n"},
+		{[]string{"lock.release", "l", "a"}, ":0\r\n"},
+		{[]string{"lock.renew", "l", "a", "10000"}, ":0\r\n"},
+		{[]string{"lock.info", "l"}, "$-1\r\n"},
+	})
+
+	// 释放之后重新获取，token单调递增
+	next := execString(db, conn, "lock.acquire", "l", "b", "10000")
+	prev, _ := strconv.ParseInt(strings.TrimSpace(token[1:]), 10, 64)
+	if actual, _ := strconv.ParseInt(strings.TrimSpace(next[1:]), 10, 64); actual <= prev {
+		t.Errorf("token should increase, previous %d, actual %q", prev, next)
+	}
+}
+
+func TestLockInfo(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execString(db, conn, "lock.restore", "l", "a", "42", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	l, _ := db.getAsLease("l")
+	ttl := strconv.FormatInt(l.Remaining(time.Now()).Milliseconds(), 10)
+	expected := "*6\r\n$5\r\nowner\r\n$1\r\na\r\n$5\r\ntoken\r\n$2\r\n42\r\n$3\r\nttl\r\n$" +
+		strconv.Itoa(len(ttl)) + "\r\n"
+	if actual := execString(db, conn, "lock.info", "l"); !strings.HasPrefix(actual, expected) {
+		t.Errorf("expected prefix %q, actual %q", expected, actual)
+	}
+
+	execString(db, conn, "set", "s", "v")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"lock.info", "s"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"lock.acquire", "s", "a", "1000"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"lock.restore", "s", "a", "1", "1"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"lock.acquire", "l2", "a", "0"}, "-ERR invalid ttl\r\n"},
+		{[]string{"lock.acquire", "l2", "a", "abc"}, "-ERR invalid ttl\r\n"},
+		{[]string{"lock.renew", "l", "a", "-1"}, "-ERR invalid ttl\r\n"},
+		{[]string{"lock.restore", "l2", "a", "x", "1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"lock.restore", "l2", "a", "1", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"lock.acquire", "l2", "a"}, "-ERR wrong number of arguments for 'lock.acquire' command\r\n"},
+		{[]string{"lock.info"}, "-ERR wrong number of arguments for 'lock.info' command\r\n"},
+	})
+}
+
+func TestLockExpire(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execString(db, conn, "lock.acquire", "l", "a", "100")
+	if !waitUntil(func() bool {
+		_, exists := db.getRawEntity("l")
+		return !exists
+	}) {
+		t.Fatal("lock should be removed when the lease expires")
+	}
+
+	// 读取时发现租约已经到期同样删除
+	execString(db, conn, "lock.restore", "old", "a", "1", "1")
+	if actual := execString(db, conn, "lock.info", "old"); actual != "$-1\r\n" {
+		t.Errorf("expired lock should be removed, actual %q", actual)
+	}
+	if actual := execString(db, conn, "lock.acquire", "old", "b", "10000"); !strings.HasPrefix(actual, ":") {
+		t.Errorf("expired lock should be acquirable by others, actual %q", actual)
+	}
+}
+
+func TestLockRestoreTasksDisabled(t *testing.T) {
+	// aof重写使用的临时数据库不注册租约到期任务，到期之后数据仍然保留
+	basic := makeBasicDB()
+	deadline := strconv.FormatInt(time.Now().Add(100*time.Millisecond).UnixMilli(), 10)
+	execString(basic, &connection.FakeConn{}, "lock.restore", "l", "a", "1", deadline)
+	time.Sleep(1500 * time.Millisecond)
+	if _, exists := basic.getRawEntity("l"); !exists {
+		t.Error("lease expiry should not be scheduled on the basic db")
+	}
+}
@@ -0,0 +1,453 @@
+package database
+
+import (
+	"fmt"
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/datastruct/vector"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+	内存统计：
+	1. 每个 DataEntity 记录自身估算的内存占用，db.usedMemory 为所有 DataEntity 之和
+	2. 写入新的 DataEntity 或者删除 key 时更新统计；命令原地修改数据结构时，执行结束后重新估算被写入的key
+	3. 集合类型采样少量元素计算平均大小再乘以元素数量，估算的开销与集合大小无关
+*/
+
+const (
+	entityOverhead  = 64 // DataEntity、dict节点等固定开销
+	elementOverhead = 16 // 集合中每个元素的固定开销
+	memorySamples   = 5  // 估算集合大小时默认采样的元素数量，与 MEMORY USAGE 的默认值一致
+
+	// 跳表节点：Element（member字符串头16 + score 8） + backward 8 + level切片头24 + 平均4/3层 *（指针8 + Level 16）
+	skiplistNodeSize = 88
+	// 有序集合dict中的一项：key字符串头16 + 指针8 + Element 24 + 哈希桶开销8，member与跳表节点共享
+	zsetDictEntrySize = 56
+	// 跳表头节点（16层）与空map
+	zsetOverhead = 512
+	// 紧凑编码：SortedSet 8*3 + listpack结构（切片头24 + 长度8）
+	listpackOverhead = 56
+)
+
+// estimateSize 估算key及其数据占用的内存
+func estimateSize(key string, data interface{}) int64 {
+	return int64(entityOverhead+len(key)) + estimateDataSize(data, memorySamples)
+}
+
+// estimateDataSize 估算数据本身占用的内存
+// 集合类型采样 samples 个元素计算平均大小再乘以元素数量，samples <= 0 时遍历全部元素
+func estimateDataSize(data interface{}, samples int64) int64 {
+	enough := func(sampled int64) bool {
+		return samples > 0 && sampled >= samples
+	}
+	var size int64
+	switch val := data.(type) {
+	case []byte:
+		size += int64(len(val))
+	case dict.Dict:
+		var sampled, total int64
+		val.ForEach(func(field string, raw interface{}) bool {
+			total += int64(len(field) + elementOverhead)
+			if bytes, ok := raw.([]byte); ok {
+				total += int64(len(bytes))
+			}
+			sampled++
+			return !enough(sampled)
+		})
+		size += average(total, sampled) * int64(val.Len())
+	case *sortedset.SortedSet:
+		if val.Encoding() == sortedset.EncodingListpack {
+			// 紧凑编码的大小可以直接得到，不需要采样
+			size += listpackOverhead + val.ListpackBytes()
+			break
+		}
+		var sampled, total int64
+		if val.Len() > 0 {
+			end := val.Len()
+			if samples > 0 {
+				end = minInt64(end, samples)
+			}
+			val.ForEach(0, end, false, func(element *sortedset.Element) bool {
+				total += int64(len(element.Member) + skiplistNodeSize + zsetDictEntrySize)
+				sampled++
+				return true
+			})
+		}
+		size += zsetOverhead + average(total, sampled)*val.Len()
+	case *queue.Queue:
+		var sampled, total int64
+		val.ForEach(func(msg queue.Message) bool {
+			total += int64(len(msg.ID) + len(msg.Payload) + 4*elementOverhead)
+			sampled++
+			return !enough(sampled)
+		})
+		size += average(total, sampled) * int64(val.Len())
+	case *vector.Index:
+		var sampled, total int64
+		val.ForEach(func(id string, vec []float32, attrs map[string]string) bool {
+			// 向量本身和HNSW图中的邻居
+			total += int64(len(id) + 4*len(vec) + 16*elementOverhead)
+			for k, v := range attrs {
+				total += int64(len(k) + len(v) + elementOverhead)
+			}
+			sampled++
+			return !enough(sampled)
+		})
+		size += average(total, sampled) * int64(val.Len())
+	case *timeseries.TimeSeries:
+		size += int64(val.Len()) * 16
+	case *ratelimit.SlidingWindow:
+		size += int64(val.BucketCount()) * 16
+	case *lease.Lease:
+		size += elementOverhead
+	}
+	return size
+}
+
+func average(total, count int64) int64 {
+	if count == 0 {
+		return 0
+	}
+	return total / count
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// UsedMemory 返回db中所有数据估算的内存占用
+func (db *DB) UsedMemory() int64 {
+	return atomic.LoadInt64(&db.usedMemory)
+}
+
+// trackEntity 开始统计新写入的entity，replaced 为被覆盖的entity
+func (db *DB) trackEntity(key string, entity *database.DataEntity, replaced *database.DataEntity) {
+	var oldSize int64
+	counter := uint32(lfuInitValue)
+	if replaced != nil {
+		// 覆盖写入时保留访问频率，与redis一致
+		oldSize = atomic.LoadInt64(&replaced.Size)
+		counter = atomic.LoadUint32(&replaced.LFUCounter)
+	}
+	size := estimateSize(key, entity.Data)
+	atomic.StoreInt64(&entity.Size, size)
+	atomic.StoreUint32(&entity.LFUCounter, counter)
+	atomic.StoreUint32(&entity.AccessClock, lruClock())
+	atomic.AddInt64(&db.usedMemory, size-oldSize)
+	db.recordAccess(key)
+}
+
+// untrackEntity 被删除的entity不再计入内存统计
+func (db *DB) untrackEntity(entity *database.DataEntity) {
+	atomic.AddInt64(&db.usedMemory, -atomic.LoadInt64(&entity.Size))
+}
+
+// updateMemory 命令执行后重新估算被写入的key的内存占用
+func (db *DB) updateMemory(keys ...string) {
+	for _, key := range keys {
+		entity, ok := db.getRawEntity(key)
+		if !ok {
+			continue
+		}
+		size := estimateSize(key, entity.Data)
+		old := atomic.SwapInt64(&entity.Size, size)
+		atomic.AddInt64(&db.usedMemory, size-old)
+	}
+}
+
+/* ---- MEMORY 命令 ---- */
+
+const (
+	dictShardOverhead = 80 // 分片：map头48 + 读写锁24 + 指针8
+	dictEntryOverhead = 40 // 版本号等小对象dict中的一项：key字符串头16 + interface 16 + 哈希桶开销8
+	expireEntrySize   = 64 // 过期时间dict中的一项：dict开销40 + time.Time 24
+)
+
+var memoryHelp = []string{
+	"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"DOCTOR",
+	"    Return memory problems reports.",
+	"STATS",
+	"    Return information about the memory usage of the server.",
+	"USAGE <key> [SAMPLES <count>]",
+	"    Return memory in bytes used by <key> and its value. Nested values are",
+	"    sampled up to <count> times (default: 5, 0 means sample all).",
+	"HELP",
+	"    Print this help.",
+}
+
+// execMemory MEMORY subcommand [args]
+func execMemory(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("memory")
+	}
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "help":
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(memoryHelp...))
+	case "usage":
+		db, errReply := mdb.SelectDB(c.GetDBIndex())
+		if errReply != nil {
+			return errReply
+		}
+		return execMemoryUsage(db, args[1:])
+	case "stats":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("memory|stats")
+		}
+		return mdb.memoryStats().toReply()
+	case "doctor":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("memory|doctor")
+		}
+		return protocol.MakeBulkReply([]byte(mdb.memoryStats().doctor()))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try MEMORY HELP.")
+}
+
+// execMemoryUsage MEMORY USAGE key [SAMPLES count]
+func execMemoryUsage(db *DB, args [][]byte) redis.Reply {
+	if len(args) != 1 && len(args) != 3 {
+		return protocol.MakeArgNumErrReply("memory|usage")
+	}
+	samples := int64(memorySamples)
+	if len(args) == 3 {
+		if strings.ToLower(string(args[1])) != "samples" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil || n < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		samples = n
+	}
+
+	key := string(args[0])
+	db.RWLocks(nil, []string{key})
+	defer db.RWULocks(nil, []string{key})
+	entity, ok := db.peekEntity(key)
+	if !ok {
+		return protocol.MakeNullBulkReply()
+	}
+	size := int64(entityOverhead+len(key)) + estimateDataSize(entity.Data, samples)
+	if _, ok := db.ttlMap.Get(key); ok {
+		size += expireEntrySize
+	}
+	return protocol.MakeIntReply(size)
+}
+
+// dbMemoryStats 单个db的内存统计
+type dbMemoryStats struct {
+	index            int
+	keys             int
+	expires          int
+	dataset          int64
+	overheadMain     int64
+	overheadExpires  int64
+	overheadVersions int64
+	shards           []int // 为空表示db没有使用分片dict
+}
+
+// memoryStats MEMORY STATS 和 MEMORY DOCTOR 使用的统计信息
+type memoryStats struct {
+	heapAlloc   int64
+	heapSys     int64
+	dataset     int64
+	overhead    int64
+	keys        int
+	expires     int
+	aofBuffer   int64
+	evictedKeys int64
+	dbs         []*dbMemoryStats
+}
+
+// dictOverhead 估算dict本身（不包括数据）占用的内存
+func dictOverhead(d dict.Dict, entrySize int64) int64 {
+	size := int64(d.Len()) * entrySize
+	if concurrent, ok := d.(*dict.ConcurrentDict); ok {
+		size += int64(len(concurrent.ShardSizes())) * dictShardOverhead
+	}
+	return size
+}
+
+func (db *DB) memoryStats() *dbMemoryStats {
+	stats := &dbMemoryStats{
+		index:   db.index,
+		keys:    db.data.Len(),
+		expires: db.ttlMap.Len(),
+		dataset: db.UsedMemory(),
+		// 数据dict中每一项的开销已经计入entityOverhead
+		overheadMain:     dictOverhead(db.data, 0),
+		overheadExpires:  dictOverhead(db.ttlMap, expireEntrySize),
+		overheadVersions: dictOverhead(db.versionMap, dictEntryOverhead),
+	}
+	if concurrent, ok := db.data.(*dict.ConcurrentDict); ok {
+		stats.shards = concurrent.ShardSizes()
+	}
+	return stats
+}
+
+func (mdb *MultiDB) memoryStats() *memoryStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats := &memoryStats{
+		heapAlloc:   int64(ms.HeapAlloc),
+		heapSys:     int64(ms.HeapSys),
+		evictedKeys: mdb.EvictedKeys(),
+	}
+	if mdb.aofHandler != nil {
+		stats.aofBuffer = mdb.aofHandler.BufferedBytes()
+	}
+	for i := range mdb.dbSet {
+		dbStats := mdb.mustSelectDB(i).memoryStats()
+		stats.dataset += dbStats.dataset
+		stats.overhead += dbStats.overheadMain + dbStats.overheadExpires + dbStats.overheadVersions
+		stats.keys += dbStats.keys
+		stats.expires += dbStats.expires
+		if dbStats.keys > 0 {
+			stats.dbs = append(stats.dbs, dbStats)
+		}
+	}
+	return stats
+}
+
+// shardSummary 返回非空分片数量、最大分片和平均分片的key数量
+func (stats *dbMemoryStats) shardSummary() (nonEmpty int, max int, avg float64) {
+	for _, size := range stats.shards {
+		if size > 0 {
+			nonEmpty++
+		}
+		if size > max {
+			max = size
+		}
+	}
+	if len(stats.shards) > 0 {
+		avg = float64(stats.keys) / float64(len(stats.shards))
+	}
+	return
+}
+
+func (stats *memoryStats) toReply() redis.Reply {
+	var bytesPerKey int64
+	if stats.keys > 0 {
+		bytesPerKey = (stats.dataset + stats.overhead) / int64(stats.keys)
+	}
+	var datasetPercentage float64
+	if stats.heapAlloc > 0 {
+		datasetPercentage = float64(stats.dataset) * 100 / float64(stats.heapAlloc)
+	}
+	replies := []redis.Reply{
+		protocol.MakeBulkReply([]byte("total.allocated")), protocol.MakeIntReply(stats.heapAlloc),
+		protocol.MakeBulkReply([]byte("heap.system")), protocol.MakeIntReply(stats.heapSys),
+		protocol.MakeBulkReply([]byte("maxmemory")), protocol.MakeIntReply(int64(config.Properties.MaxMemory)),
+		protocol.MakeBulkReply([]byte("aof.buffer")), protocol.MakeIntReply(stats.aofBuffer),
+		protocol.MakeBulkReply([]byte("overhead.total")), protocol.MakeIntReply(stats.overhead),
+	}
+	for _, db := range stats.dbs {
+		nonEmpty, max, _ := db.shardSummary()
+		dbReplies := []redis.Reply{
+			protocol.MakeBulkReply([]byte("overhead.hashtable.main")), protocol.MakeIntReply(db.overheadMain),
+			protocol.MakeBulkReply([]byte("overhead.hashtable.expires")), protocol.MakeIntReply(db.overheadExpires),
+			protocol.MakeBulkReply([]byte("overhead.hashtable.versions")), protocol.MakeIntReply(db.overheadVersions),
+			protocol.MakeBulkReply([]byte("dataset.bytes")), protocol.MakeIntReply(db.dataset),
+			protocol.MakeBulkReply([]byte("keys")), protocol.MakeIntReply(int64(db.keys)),
+			protocol.MakeBulkReply([]byte("expires")), protocol.MakeIntReply(int64(db.expires)),
+			protocol.MakeBulkReply([]byte("shards")), protocol.MakeIntReply(int64(len(db.shards))),
+			protocol.MakeBulkReply([]byte("shards.nonempty")), protocol.MakeIntReply(int64(nonEmpty)),
+			protocol.MakeBulkReply([]byte("shards.max")), protocol.MakeIntReply(int64(max)),
+		}
+		replies = append(replies,
+			protocol.MakeBulkReply([]byte("db."+strconv.Itoa(db.index))), protocol.MakeMultiRawReply(dbReplies))
+	}
+	replies = append(replies,
+		protocol.MakeBulkReply([]byte("keys.count")), protocol.MakeIntReply(int64(stats.keys)),
+		protocol.MakeBulkReply([]byte("keys.expires")), protocol.MakeIntReply(int64(stats.expires)),
+		protocol.MakeBulkReply([]byte("keys.bytes-per-key")), protocol.MakeIntReply(bytesPerKey),
+		protocol.MakeBulkReply([]byte("dataset.bytes")), protocol.MakeIntReply(stats.dataset),
+		protocol.MakeBulkReply([]byte("dataset.percentage")),
+		protocol.MakeBulkReply([]byte(strconv.FormatFloat(datasetPercentage, 'f', 2, 64))),
+		protocol.MakeBulkReply([]byte("evicted.keys")), protocol.MakeIntReply(stats.evictedKeys),
+		protocol.MakeBulkReply([]byte("lazyfree.pending-objects")), protocol.MakeIntReply(LazyFreePendingObjects()),
+		protocol.MakeBulkReply([]byte("lazyfreed.objects")), protocol.MakeIntReply(LazyFreedObjects()),
+	)
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// doctor 根据内存统计给出建议
+func (stats *memoryStats) doctor() string {
+	if stats.keys == 0 {
+		return "This instance is empty or holds very little data, there is nothing to diagnose."
+	}
+	var advices []string
+	maxMemory := int64(config.Properties.MaxMemory)
+	policy := strings.ToLower(config.Properties.MaxMemoryPolicy)
+	if policy == "" {
+		policy = policyNoEviction
+	}
+	if maxMemory <= 0 {
+		advices = append(advices, "maxmemory is not set: the instance can grow until it is killed by the operating system. "+
+			"Consider setting maxmemory and a maxmemory-policy.")
+	} else if used := stats.dataset; used*10 > maxMemory*9 && policy == policyNoEviction {
+		advices = append(advices, fmt.Sprintf("The dataset uses %s, more than 90%% of maxmemory (%s), and maxmemory-policy is noeviction: "+
+			"writes will soon fail with OOM errors. Consider an eviction policy or a larger maxmemory.",
+			bytesToHuman(used), bytesToHuman(maxMemory)))
+	}
+	if maxMemory > 0 && strings.HasPrefix(policy, "volatile-") && stats.expires == 0 {
+		advices = append(advices, "maxmemory-policy is "+policy+" but no key has a TTL, so no key can be evicted.")
+	}
+	if stats.evictedKeys > 0 {
+		advices = append(advices, fmt.Sprintf("%d keys were evicted because of maxmemory. "+
+			"If this is unexpected, increase maxmemory.", stats.evictedKeys))
+	}
+	if stats.heapAlloc > 16<<20 && stats.heapAlloc > 2*(stats.dataset+stats.overhead) {
+		advices = append(advices, fmt.Sprintf("The Go heap (%s) is much larger than the estimated dataset (%s). "+
+			"Big replies, scripts, AOF rewrite or garbage not yet collected may be the cause.",
+			bytesToHuman(stats.heapAlloc), bytesToHuman(stats.dataset+stats.overhead)))
+	}
+	if stats.aofBuffer > 32<<20 {
+		advices = append(advices, fmt.Sprintf("The AOF buffer holds %s of commands not yet written to disk. "+
+			"The disk may be too slow for the write load.", bytesToHuman(stats.aofBuffer)))
+	}
+	for _, db := range stats.dbs {
+		_, max, avg := db.shardSummary()
+		if max > 64 && float64(max) > 8*avg {
+			advices = append(advices, fmt.Sprintf("Keys of db %d are unevenly distributed among dict shards: "+
+				"the biggest shard holds %d keys while the average is %.2f.", db.index, max, avg))
+		}
+	}
+	if len(advices) == 0 {
+		return "No memory issues detected in this instance."
+	}
+	return strings.Join(advices, "\n")
+}
+
+// bytesToHuman 将字节数转换为便于阅读的形式，例如 1.50M
+func bytesToHuman(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	return strconv.FormatFloat(size, 'f', 2, 64) + units[i]
+}
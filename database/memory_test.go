@@ -0,0 +1,109 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/config"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	mdb := NewStandaloneServer()
+	execMDB(mdb, "set", "k", "abc")
+	execMDB(mdb, "hset", "h", "f1", "v1", "f2", "v2")
+	execMDB(mdb, "set", "ttl", "abc")
+	execMDB(mdb, "pexpireat", "ttl", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+
+	// 固定开销 + key + value，设置了过期时间的key额外计入过期字典中的一项
+	hashSize := strconv.Itoa(entityOverhead + 1 + 2*(2+elementOverhead+2))
+	for _, c := range []replyCase{
+		{[]string{"memory", "usage", "k"}, ":" + strconv.Itoa(entityOverhead+1+3) + "\r\n"},
+		{[]string{"memory", "usage", "ttl"}, ":" + strconv.Itoa(entityOverhead+3+3+expireEntrySize) + "\r\n"},
+		{[]string{"memory", "usage", "h"}, ":" + hashSize + "\r\n"},
+		{[]string{"memory", "usage", "h", "SAMPLES", "0"}, ":" + hashSize + "\r\n"},
+		{[]string{"memory", "usage", "h", "samples", "1"}, ":" + hashSize + "\r\n"},
+		{[]string{"memory", "usage", "missing"}, "$-1\r\n"},
+	} {
+		if actual := execMDB(mdb, c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	mdb := NewStandaloneServer()
+	execMDB(mdb, "set", "k", "abc")
+	execMDB(mdb, "pexpireat", "k", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	actual := execMDB(mdb, "memory", "stats")
+	for _, expected := range []string{
+		"$15\r\ntotal.allocated\r\n:",
+		"$4\r\ndb.0\r\n*18\r\n",
+		"$10\r\nkeys.count\r\n:1\r\n",
+		"$12\r\nkeys.expires\r\n:1\r\n",
+		"$13\r\ndataset.bytes\r\n:" + strconv.Itoa(entityOverhead+1+3) + "\r\n",
+		"$12\r\nevicted.keys\r\n:0\r\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("MEMORY STATS should contain %q, actual %q", expected, actual)
+		}
+	}
+	// 空的db不出现在统计中
+	if strings.Contains(actual, "db.1\r\n") {
+		t.Errorf("empty db should be omitted: %q", actual)
+	}
+}
+
+func TestMemoryDoctor(t *testing.T) {
+	maxMemory, policy := config.Properties.MaxMemory, config.Properties.MaxMemoryPolicy
+	defer func() {
+		config.Properties.MaxMemory = maxMemory
+		config.Properties.MaxMemoryPolicy = policy
+	}()
+	config.Properties.MaxMemory = 0
+
+	mdb := NewStandaloneServer()
+	expected := "This instance is empty or holds very little data, there is nothing to diagnose."
+	if actual := execMDB(mdb, "memory", "doctor"); !strings.Contains(actual, expected) {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+	execMDB(mdb, "set", "k", "abc")
+	if actual := execMDB(mdb, "memory", "doctor"); !strings.Contains(actual, "maxmemory is not set") {
+		t.Errorf("doctor should report missing maxmemory, actual %q", actual)
+	}
+
+	// 堆内存的建议与运行环境有关，只检查与配置相关的建议
+	config.Properties.MaxMemory = 1 << 30
+	config.Properties.MaxMemoryPolicy = policyVolatileLRU
+	actual := execMDB(mdb, "memory", "doctor")
+	if strings.Contains(actual, "maxmemory is not set") {
+		t.Errorf("doctor should not report maxmemory once set, actual %q", actual)
+	}
+	if expected := "maxmemory-policy is volatile-lru but no key has a TTL"; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
+
+func TestMemoryErrors(t *testing.T) {
+	mdb := NewStandaloneServer()
+	execMDB(mdb, "set", "k", "abc")
+	for _, c := range []replyCase{
+		{[]string{"memory"}, "-ERR wrong number of arguments for 'memory' command\r\n"},
+		{[]string{"memory", "usage"}, "-ERR wrong number of arguments for 'memory|usage' command\r\n"},
+		{[]string{"memory", "usage", "k", "samples"}, "-ERR wrong number of arguments for 'memory|usage' command\r\n"},
+		{[]string{"memory", "usage", "k", "foo", "1"}, "-Err syntax error\r\n"},
+		{[]string{"memory", "usage", "k", "samples", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"memory", "usage", "k", "samples", "x"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"memory", "stats", "x"}, "-ERR wrong number of arguments for 'memory|stats' command\r\n"},
+		{[]string{"memory", "doctor", "x"}, "-ERR wrong number of arguments for 'memory|doctor' command\r\n"},
+		{[]string{"memory", "foo"}, "-ERR unknown subcommand 'foo'. Try MEMORY HELP.\r\n"},
+	} {
+		if actual := execMDB(mdb, c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+	if actual := execMDB(mdb, "memory", "help"); !strings.HasPrefix(actual, "*"+strconv.Itoa(len(memoryHelp))+"\r\n") {
+		t.Errorf("unexpected MEMORY HELP reply %q", actual)
+	}
+}
@@ -0,0 +1,13 @@
+package database
+
+/*
+	元数据持久化：不属于任何key的状态，在aof重写时需要通过命令还原
+*/
+
+// getMetaCmds 汇总当前数据库的元数据命令
+func (db *DB) getMetaCmds() []CmdLine {
+	cmds := make([]CmdLine, 0)
+	cmds = append(cmds, db.getIndexMetaCmds()...)
+	cmds = append(cmds, db.getScheduleMetaCmds()...)
+	return cmds
+}
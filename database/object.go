@@ -0,0 +1,129 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/datastruct/vector"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key
+	查看key的内部编码和访问统计，查询本身不会更新key的访问时间
+*/
+
+// 与redis一致，长度不超过44的字符串使用embstr编码
+const embstrSizeLimit = 44
+
+// objectEncoding 返回数据的内部编码
+func objectEncoding(data interface{}) string {
+	switch val := data.(type) {
+	case []byte:
+		if len(val) <= 20 {
+			// 带有前导0或者'+'号的整数无法还原为原始字符串，不能使用int编码
+			if n, err := strconv.ParseInt(string(val), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(val) {
+				return "int"
+			}
+		}
+		if len(val) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case dict.Dict:
+		return "hashtable"
+	case *sortedset.SortedSet:
+		return val.Encoding()
+	case *queue.Queue:
+		return "queue"
+	case *timeseries.TimeSeries:
+		return "timeseries"
+	case *vector.Index:
+		return "hnsw"
+	case *ratelimit.SlidingWindow:
+		return "slidingwindow"
+	case *lease.Lease:
+		return "lease"
+	}
+	return "unknown"
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"ENCODING <key>",
+	"    Return the kind of internal representation used in order to store the value",
+	"    associated with a <key>.",
+	"FREQ <key>",
+	"    Return the access frequency index of the <key>. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the <key>, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    <key>.",
+	"HELP",
+	"    Print this help.",
+}
+
+// prepareObject OBJECT 的第二个参数为key
+func prepareObject(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+// peekEntity 返回未过期的entity，不更新访问时间
+func (db *DB) peekEntity(key string) (*database.DataEntity, bool) {
+	entity, ok := db.getRawEntity(key)
+	if !ok || db.IsExpired(key) {
+		return nil, false
+	}
+	return entity, true
+}
+
+// execObject OBJECT subcommand [key]
+func execObject(db *DB, args [][]byte) redis.Reply {
+	sub := strings.ToLower(string(args[0]))
+	if sub == "help" {
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(objectHelp...))
+	}
+	switch sub {
+	case "encoding", "idletime", "freq", "refcount":
+	default:
+		return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("object|" + sub)
+	}
+
+	entity, ok := db.peekEntity(string(args[1]))
+	if !ok {
+		return protocol.MakeNullBulkReply()
+	}
+	switch sub {
+	case "encoding":
+		return protocol.MakeBulkReply([]byte(objectEncoding(entity.Data)))
+	case "idletime":
+		return protocol.MakeIntReply(int64(idleTime(entity)))
+	case "freq":
+		return protocol.MakeIntReply(int64(lfuDecay(entity)))
+	default:
+		// 数据不会在key之间共享
+		return protocol.MakeIntReply(1)
+	}
+}
+
+func init() {
+	RegisterCommand("Object", execObject, prepareObject, nil, -2, flagReadOnly)
+}
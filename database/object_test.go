@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execString(db, conn, "set", "int", "12345")
+	execString(db, conn, "set", "leading", "0123")
+	execString(db, conn, "set", "embstr", strings.Repeat("a", embstrSizeLimit))
+	execString(db, conn, "set", "raw", strings.Repeat("a", embstrSizeLimit+1))
+	execString(db, conn, "hset", "hash", "f", "v")
+	execString(db, conn, "zadd", "small", "1", "a")
+	execString(db, conn, "zadd", "big", "1", strings.Repeat("a", 100))
+	execString(db, conn, "lock.acquire", "lock", "a", "10000")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"object", "encoding", "int"}, "$3\r\nint\r\n"},
+		{[]string{"object", "encoding", "leading"}, "$6\r\nembstr\r\n"},
+		{[]string{"object", "encoding", "embstr"}, "$6\r\nembstr\r\n"},
+		{[]string{"object", "encoding", "raw"}, "$3\r\nraw\r\n"},
+		{[]string{"object", "encoding", "hash"}, "$9\r\nhashtable\r\n"},
+		{[]string{"object", "encoding", "small"}, "$8\r\nlistpack\r\n"},
+		{[]string{"object", "encoding", "big"}, "$8\r\nskiplist\r\n"},
+		{[]string{"OBJECT", "ENCODING", "lock"}, "$5\r\nlease\r\n"},
+		{[]string{"object", "encoding", "missing"}, "$-1\r\n"},
+	})
+}
+
+func TestObjectAccessStats(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execString(db, conn, "set", "a", "1")
+	entity, _ := db.getRawEntity("a")
+	atomic.StoreUint32(&entity.AccessClock, lruClock()-100)
+
+	// 查询本身不更新访问时间和访问频率，空闲超过60秒的计数衰减1
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"object", "refcount", "a"}, ":1\r\n"},
+		{[]string{"object", "freq", "a"}, ":" + strconv.Itoa(lfuInitValue-1) + "\r\n"},
+	})
+	for i := 0; i < 2; i++ {
+		// 时钟精度为秒，查询期间可能跨过一秒
+		if actual := execString(db, conn, "object", "idletime", "a"); actual != ":100\r\n" && actual != ":101\r\n" {
+			t.Errorf("expected idle time 100, actual %q", actual)
+		}
+	}
+	execString(db, conn, "get", "a")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"object", "idletime", "a"}, ":0\r\n"},
+	})
+
+	db.Expire("a", time.Now().Add(-time.Second))
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"object", "refcount", "a"}, "$-1\r\n"},
+		{[]string{"object", "idletime", "missing"}, "$-1\r\n"},
+		{[]string{"object", "freq", "missing"}, "$-1\r\n"},
+	})
+}
+
+func TestObjectErrors(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"object"}, "-ERR wrong number of arguments for 'object' command\r\n"},
+		{[]string{"object", "encoding"}, "-ERR wrong number of arguments for 'object|encoding' command\r\n"},
+		{[]string{"object", "idletime", "a", "b"}, "-ERR wrong number of arguments for 'object|idletime' command\r\n"},
+		{[]string{"object", "freq"}, "-ERR wrong number of arguments for 'object|freq' command\r\n"},
+		{[]string{"object", "refcount"}, "-ERR wrong number of arguments for 'object|refcount' command\r\n"},
+		{[]string{"object", "foo", "a"}, "-ERR unknown subcommand 'foo'. Try OBJECT HELP.\r\n"},
+	})
+	if actual := execString(db, conn, "object", "help"); !strings.HasPrefix(actual, "*"+strconv.Itoa(len(objectHelp))+"\r\n") {
+		t.Errorf("unexpected OBJECT HELP reply %q", actual)
+	}
+}
@@ -20,12 +20,29 @@ func Ping(db *DB, args [][]byte) redis.Reply {
 	if len(args) == 0 {
 		return &PongReply{}
 	} else if len(args) == 1 {
-		return protocol.MakeStatusReply("\"" + string(args[0]))
+		return protocol.MakeBulkReply(args[0])
 	} else {
 		return &ArgNumErrReply{}
 	}
 }
 
+// subscribeModePing 订阅模式下的PING回复 ["pong", message]
+func subscribeModePing(args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return &ArgNumErrReply{}
+	}
+	message := []byte{}
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return protocol.MakeMultiBulkReply([][]byte{[]byte("pong"), message})
+}
+
+// Echo ECHO message
+func Echo(db *DB, args [][]byte) redis.Reply {
+	return protocol.MakeBulkReply(args[0])
+}
+
 type ArgNumErrReply struct {
 }
 
@@ -39,5 +56,6 @@ func testSkip(args [][]byte) ([]string, []string) {
 
 // 初始化
 func init() {
-	RegisterCommand("ping", Ping, testSkip, nil, 0, 0)
+	RegisterCommand("ping", Ping, testSkip, nil, -1, flagReadOnly)
+	RegisterCommand("echo", Echo, testSkip, nil, 2, flagReadOnly)
 }
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/idgenerator"
+	"github.com/HildaM/GoKV/lib/logger"
+	"github.com/HildaM/GoKV/lib/timewheel"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	可靠队列命令：QCREATE QPUSH QPOP QACK QNACK QLEN QINFO
+	aof 中只记录确定性的命令：QADD（指定id入队）、QLEASE（指定id和到期时间的租约）、QACK、QNACK
+*/
+
+var queueIDGenerator = idgenerator.MakeGenerator("queue")
+
+// getAsQueue 获取队列
+func (db *DB) getAsQueue(key string) (*queue.Queue, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	q, ok := entity.Data.(*queue.Queue)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return q, nil
+}
+
+// getOrInitQueue 队列不存在时使用默认参数创建（不限制投递次数，没有死信队列）
+func (db *DB) getOrInitQueue(key string) (*queue.Queue, protocol.ErrorReply) {
+	q, errReply := db.getAsQueue(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if q == nil {
+		q = queue.Make(0, "")
+		db.PutIfAbsent(key, &database.DataEntity{Data: q})
+		// 死信转移没有持有目标key的锁，可能有其他协程同时创建
+		return db.getAsQueue(key)
+	}
+	return q, nil
+}
+
+/* ---- 租约 ---- */
+
+// scheduleLease 租约到期时通过时间轮将消息放回队列
+func (db *DB) scheduleLease(key string, q *queue.Queue, id string, deadline time.Time) {
+	db.delayTask(time.Until(deadline), db.genTaskKey("queue", key, id), func() {
+		db.expireLease(key, q, id, deadline)
+	})
+}
+
+func (db *DB) cancelLease(key string, id string) {
+	timewheel.Cancel(db.genTaskKey("queue", key, id))
+}
+
+// expireLease 租约到期，消息未被确认
+func (db *DB) expireLease(key string, q *queue.Queue, id string, deadline time.Time) {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWULocks([]string{key}, nil)
+
+	current, errReply := db.getAsQueue(key)
+	if errReply != nil || current != q {
+		return // key已经被删除或者覆盖
+	}
+	leaseDeadline, ok := q.Deadline(id)
+	if !ok || !leaseDeadline.Equal(deadline) {
+		return // 消息已经被确认，或者已经开始了新的租约
+	}
+	db.addVersion(nil, key)
+	db.nackMessage(q, id)
+	db.addAof(utils.ToCmdLine("qnack", key, id))
+}
+
+// nackMessage 结束租约，投递次数达到上限的消息转移到死信队列
+func (db *DB) nackMessage(q *queue.Queue, id string) bool {
+	msg, dead := q.Nack(id)
+	if msg == nil {
+		return false
+	}
+	if !dead || q.DeadLetter() == "" {
+		return true
+	}
+	dlq, errReply := db.getOrInitQueue(q.DeadLetter())
+	if errReply != nil {
+		logger.Warn("dead letter queue " + q.DeadLetter() + " is not a queue, drop message " + id)
+		return true
+	}
+	db.addVersion(nil, q.DeadLetter())
+	dlq.Push(&queue.Message{
+		ID:         msg.ID,
+		Payload:    msg.Payload,
+		Deliveries: msg.Deliveries,
+	})
+	return true
+}
+
+func parseMillis(raw []byte) (time.Time, bool) {
+	ms, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || ms < 0 {
+		return time.Time{}, false
+	}
+	if ms == 0 {
+		return time.Time{}, true
+	}
+	return time.UnixMilli(ms), true
+}
+
+func formatMillis(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+/* ---- 命令 ---- */
+
+// execQCreate QCREATE key [MAXDELIVERIES n] [DEADLETTER dlq]
+func execQCreate(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR key already exists")
+	}
+	maxDeliveries := 0
+	deadLetter := ""
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MAXDELIVERIES":
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || n < 0 {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			maxDeliveries = n
+		case "DEADLETTER":
+			deadLetter = string(args[i+1])
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if deadLetter == key {
+		return protocol.MakeErrReply("ERR dead letter queue cannot be the queue itself")
+	}
+	db.PutEntity(key, &database.DataEntity{Data: queue.Make(maxDeliveries, deadLetter)})
+	db.addAof(utils.ToCmdLine3("qcreate", args...))
+	return protocol.MakeOkReply()
+}
+
+// execQPush QPUSH key payload [payload ...]，返回消息id
+func execQPush(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	q, errReply := db.getOrInitQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	ids := make([][]byte, 0, len(args)-1)
+	for _, payload := range args[1:] {
+		id := strconv.FormatInt(queueIDGenerator.NextID(), 10)
+		q.Push(&queue.Message{ID: id, Payload: payload})
+		ids = append(ids, []byte(id))
+		db.addAof(utils.ToCmdLine3("qadd", []byte(key), []byte(id), []byte("0"), []byte("0"), payload))
+	}
+	return protocol.MakeMultiBulkReply(ids)
+}
+
+// execQAdd QADD key id deliveries deadline-ms payload
+// 指定id入队，deadline-ms 不为0时消息处于租约中。用于aof重放和重写
+func execQAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	deliveries, err := strconv.Atoi(string(args[2]))
+	if err != nil || deliveries < 0 {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	deadline, ok := parseMillis(args[3])
+	if !ok {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	q, errReply := db.getOrInitQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	msg := &queue.Message{
+		ID:         string(args[1]),
+		Payload:    args[4],
+		Deliveries: deliveries,
+		Deadline:   deadline,
+	}
+	if !q.Push(msg) {
+		return protocol.MakeIntReply(0)
+	}
+	if msg.Leased() {
+		db.scheduleLease(key, q, msg.ID, deadline)
+	}
+	db.addAof(utils.ToCmdLine3("qadd", args...))
+	return protocol.MakeIntReply(1)
+}
+
+// execQPop QPOP key lease-seconds [COUNT n]
+// 返回 [[id, payload, deliveries] ...]，消息在租约到期前需要 QACK
+func execQPop(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	leaseSeconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || leaseSeconds <= 0 {
+		return protocol.MakeErrReply("ERR invalid lease time")
+	}
+	count := 1
+	if len(args) > 2 {
+		if len(args) != 4 || strings.ToUpper(string(args[2])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		count, err = strconv.Atoi(string(args[3]))
+		if err != nil || count <= 0 {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+
+	q, errReply := db.getAsQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	// aof 中使用毫秒记录到期时间，这里先截断，保证重放后的租约完全一致
+	deadline := time.UnixMilli(time.Now().Add(time.Duration(leaseSeconds) * time.Second).UnixMilli())
+	messages := q.Pop(count, deadline)
+	if len(messages) == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	replies := make([]redis.Reply, 0, len(messages))
+	aofLine := utils.ToCmdLine("qlease", key, formatMillis(deadline))
+	for _, msg := range messages {
+		db.scheduleLease(key, q, msg.ID, deadline)
+		replies = append(replies, protocol.MakeMultiBulkReply([][]byte{
+			[]byte(msg.ID),
+			msg.Payload,
+			[]byte(strconv.Itoa(msg.Deliveries)),
+		}))
+		aofLine = append(aofLine, []byte(msg.ID))
+	}
+	db.addAof(aofLine)
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execQLease QLEASE key deadline-ms id [id ...]
+// 为指定的就绪消息设置租约，用于aof重放
+func execQLease(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	deadline, ok := parseMillis(args[1])
+	if !ok || deadline.IsZero() {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	q, errReply := db.getAsQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeIntReply(0)
+	}
+	leased := 0
+	for _, raw := range args[2:] {
+		id := string(raw)
+		if _, ok := q.Lease(id, deadline); ok {
+			db.scheduleLease(key, q, id, deadline)
+			leased++
+		}
+	}
+	if leased > 0 {
+		db.addAof(utils.ToCmdLine3("qlease", args...))
+	}
+	return protocol.MakeIntReply(int64(leased))
+}
+
+// execQAck QACK key id [id ...]，返回确认成功的消息数量
+func execQAck(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	q, errReply := db.getAsQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeIntReply(0)
+	}
+	acked := 0
+	for _, raw := range args[1:] {
+		id := string(raw)
+		if q.Ack(id) {
+			db.cancelLease(key, id)
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.addAof(utils.ToCmdLine3("qack", args...))
+	}
+	return protocol.MakeIntReply(int64(acked))
+}
+
+// execQNack QNACK key id [id ...]，立即结束租约，消息重新入队或者进入死信队列
+func execQNack(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	q, errReply := db.getAsQueue(key)
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeIntReply(0)
+	}
+	nacked := 0
+	for _, raw := range args[1:] {
+		id := string(raw)
+		if db.nackMessage(q, id) {
+			db.cancelLease(key, id)
+			nacked++
+		}
+	}
+	if nacked > 0 {
+		db.addAof(utils.ToCmdLine3("qnack", args...))
+	}
+	return protocol.MakeIntReply(int64(nacked))
+}
+
+// execQLen QLEN key 返回就绪消息数量
+func execQLen(db *DB, args [][]byte) redis.Reply {
+	q, errReply := db.getAsQueue(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(q.Len()))
+}
+
+// execQInfo QINFO key
+func execQInfo(db *DB, args [][]byte) redis.Reply {
+	q, errReply := db.getAsQueue(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if q == nil {
+		return protocol.MakeErrReply("ERR no such queue")
+	}
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(
+		"ready", strconv.Itoa(q.Len()),
+		"leased", strconv.Itoa(q.LeasedLen()),
+		"max_deliveries", strconv.Itoa(q.MaxDeliveries()),
+		"dead_letter", q.DeadLetter(),
+	))
+}
+
+// undoQueueWrite 消息可能被转移到死信队列，需要一起还原
+func undoQueueWrite(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	keys := []string{key}
+	if q, _ := db.getAsQueue(key); q != nil && q.DeadLetter() != "" {
+		keys = append(keys, q.DeadLetter())
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+func init() {
+	RegisterCommand("QCreate", execQCreate, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	RegisterCommand("QPush", execQPush, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("QAdd", execQAdd, writeFirstKey, rollbackFirstKey, 6, flagWrite)
+	RegisterCommand("QPop", execQPop, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("QLease", execQLease, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("QAck", execQAck, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("QNack", execQNack, writeFirstKey, undoQueueWrite, -3, flagWrite)
+	RegisterCommand("QLen", execQLen, readFirstKey, nil, 2, flagReadOnly)
+	RegisterCommand("QInfo", execQInfo, readFirstKey, nil, 2, flagReadOnly)
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/HildaM/GoKV/aof"
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	限流命令：
+	THROTTLE key max_burst count period [quantity]  GCRA 算法，与 redis-cell 的 CL.THROTTLE 一致
+	RATELIMIT key limit period [quantity]           滑动窗口日志算法
+	两个命令都返回 [是否被限流(0/1), limit, remaining, retry-after, reset-after]，时间单位为秒
+*/
+
+func parseNonNegative(raw []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ceilSeconds 向上取整到秒，避免客户端过早重试；负数保持为-1
+func ceilSeconds(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+func makeRateLimitReply(result *ratelimit.Result) redis.Reply {
+	limited := int64(1)
+	if result.Allowed {
+		limited = 0
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(limited),
+		protocol.MakeIntReply(result.Limit),
+		protocol.MakeIntReply(result.Remaining),
+		protocol.MakeIntReply(ceilSeconds(result.RetryAfter)),
+		protocol.MakeIntReply(ceilSeconds(result.ResetAfter)),
+	})
+}
+
+// execThrottle THROTTLE key max_burst count period [quantity]
+// 每 period 秒允许 count 个请求，允许额外突发 max_burst 个请求
+// 状态是一个字符串：理论到达时间（纳秒时间戳），过期时间与其一致
+func execThrottle(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	maxBurst, ok1 := parseNonNegative(args[1])
+	count, ok2 := parseNonNegative(args[2])
+	period, ok3 := parseNonNegative(args[3])
+	if !ok1 || !ok2 || !ok3 || count == 0 || period == 0 {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if len(args) > 5 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	quantity := int64(1)
+	if len(args) == 5 {
+		var ok bool
+		quantity, ok = parseNonNegative(args[4])
+		if !ok {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+
+	// period 转换为纳秒后平均分配给 count 个请求，间隔为0或者乘法溢出时无法计算
+	if period > math.MaxInt64/int64(time.Second) {
+		return protocol.MakeErrReply("ERR period is out of range")
+	}
+	emission := int64(time.Duration(period)*time.Second) / count
+	if emission == 0 {
+		return protocol.MakeErrReply("ERR count is too large for the period")
+	}
+	if maxBurst >= math.MaxInt64/emission || quantity > math.MaxInt64/emission {
+		return protocol.MakeErrReply("ERR max_burst or quantity is out of range")
+	}
+
+	var tat time.Time
+	if entity, exists := db.GetEntity(key); exists {
+		raw, ok := entity.Data.([]byte)
+		if !ok {
+			return &protocol.WrongTypeErrReply{}
+		}
+		nanos, err := strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return protocol.MakeErrReply("ERR value is not a valid throttle state")
+		}
+		tat = time.Unix(0, nanos)
+	}
+
+	now := time.Now()
+	result, newTat := ratelimit.GCRA(tat, now, maxBurst, count, time.Duration(period)*time.Second, quantity)
+	if result.Allowed && newTat.After(now) {
+		value := []byte(strconv.FormatInt(newTat.UnixNano(), 10))
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.Expire(key, newTat)
+		db.addAof(utils.ToCmdLine3("set", []byte(key), value))
+		db.addAof(aof.MakeExpireCmd(key, newTat).Args)
+	}
+	return makeRateLimitReply(result)
+}
+
+// getAsSlidingWindow 获取滑动窗口，窗口长度变化时沿用已有的请求记录
+func (db *DB) getAsSlidingWindow(key string, window time.Duration) (*ratelimit.SlidingWindow, protocol.ErrorReply) {
+	w := ratelimit.MakeSlidingWindow(window)
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return w, nil
+	}
+	current, ok := entity.Data.(*ratelimit.SlidingWindow)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	if current.Window() == window {
+		return current, nil
+	}
+	for _, bucket := range current.Buckets() {
+		w.Add(bucket.Timestamp, bucket.Count)
+	}
+	return w, nil
+}
+
+// saveSlidingWindow 保存窗口，所有请求滑出窗口时key随之过期
+func (db *DB) saveSlidingWindow(key string, w *ratelimit.SlidingWindow) {
+	expireAt, ok := w.ExpireAt()
+	if !ok {
+		db.Remove(key)
+		return
+	}
+	db.PutEntity(key, &database.DataEntity{Data: w})
+	db.Expire(key, time.UnixMilli(expireAt))
+}
+
+// execRateLimit RATELIMIT key limit period [quantity]，任意 period 秒内最多通过 limit 个请求
+func execRateLimit(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	limit, ok1 := parseNonNegative(args[1])
+	period, ok2 := parseNonNegative(args[2])
+	if !ok1 || !ok2 || period == 0 {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if len(args) > 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	quantity := int64(1)
+	if len(args) == 4 {
+		var ok bool
+		quantity, ok = parseNonNegative(args[3])
+		if !ok {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+
+	window := time.Duration(period) * time.Second
+	w, errReply := db.getAsSlidingWindow(key, window)
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now().UnixMilli()
+	result := w.Allow(now, limit, quantity)
+	if result.Allowed && quantity > 0 {
+		db.saveSlidingWindow(key, w)
+		db.addAof(utils.ToCmdLine("ratelimit.record", key,
+			strconv.FormatInt(window.Milliseconds(), 10),
+			strconv.FormatInt(now, 10),
+			strconv.FormatInt(quantity, 10)))
+	}
+	return makeRateLimitReply(result)
+}
+
+// execRateLimitRecord RATELIMIT.RECORD key window-ms timestamp-ms quantity
+// 在指定时刻记录请求，用于aof重放和重写
+func execRateLimitRecord(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	window, ok1 := parseNonNegative(args[1])
+	timestamp, ok2 := parseNonNegative(args[2])
+	quantity, ok3 := parseNonNegative(args[3])
+	if !ok1 || !ok2 || !ok3 || window == 0 {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	w, errReply := db.getAsSlidingWindow(key, time.Duration(window)*time.Millisecond)
+	if errReply != nil {
+		return errReply
+	}
+	w.Trim(timestamp)
+	if quantity > math.MaxInt64-w.Len() {
+		return protocol.MakeErrReply("ERR quantity is out of range")
+	}
+	w.Add(timestamp, quantity)
+	db.saveSlidingWindow(key, w)
+	db.addAof(utils.ToCmdLine3("ratelimit.record", args...))
+	return protocol.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("Throttle", execThrottle, writeFirstKey, rollbackFirstKey, -5, flagWrite)
+	RegisterCommand("RateLimit", execRateLimit, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	RegisterCommand("RateLimit.Record", execRateLimitRecord, writeFirstKey, rollbackFirstKey, 5, flagWrite)
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/ratelimit"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+// rateLimitReply [是否被限流, limit, remaining, retry-after, reset-after]
+func rateLimitReply(values ...string) string {
+	return "*5\r\n:" + strings.Join(values, "\r\n:") + "\r\n"
+}
+
+func TestThrottle(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	// 每秒1个请求，允许突发1个
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"throttle", "k", "1", "1", "1"}, rateLimitReply("0", "2", "1", "-1", "1")},
+		{[]string{"throttle", "k", "1", "1", "1"}, rateLimitReply("0", "2", "0", "-1", "2")},
+		{[]string{"throttle", "k", "1", "1", "1"}, rateLimitReply("1", "2", "0", "1", "2")},
+		{[]string{"throttle", "k", "1", "1", "1", "3"}, rateLimitReply("1", "2", "0", "-1", "2")},
+		{[]string{"set", "s", "v"}, "+OK\r\n"},
+		{[]string{"throttle", "s", "1", "1", "1"}, "-ERR value is not a valid throttle state\r\n"},
+	})
+
+	valueErr := "-ERR value is not an integer or out of range\r\n"
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"throttle", "k", "1", "0", "1"}, valueErr},
+		{[]string{"throttle", "k", "1", "1", "0"}, valueErr},
+		{[]string{"throttle", "k", "-1", "1", "1"}, valueErr},
+		{[]string{"throttle", "k", "1", "1", "1", "x"}, valueErr},
+		{[]string{"throttle", "k", "1", "1", "1", "1", "1"}, "-Err syntax error\r\n"},
+		// 每个请求的间隔不足1纳秒
+		{[]string{"throttle", "k", "0", "2000000000", "1"}, "-ERR count is too large for the period\r\n"},
+		{[]string{"throttle", "k", "0", "1", "9223372036854775807"}, "-ERR period is out of range\r\n"},
+		{[]string{"throttle", "k", "9223372036854775807", "1", "1"}, "-ERR max_burst or quantity is out of range\r\n"},
+		{[]string{"throttle", "k", "1", "1", "1", "9223372036854775807"}, "-ERR max_burst or quantity is out of range\r\n"},
+		{[]string{"throttle"}, "-ERR wrong number of arguments for 'throttle' command\r\n"},
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"ratelimit", "k", "2", "10"}, rateLimitReply("0", "2", "1", "-1", "10")},
+		{[]string{"ratelimit", "k", "2", "10"}, rateLimitReply("0", "2", "0", "-1", "10")},
+		{[]string{"ratelimit", "k", "2", "10"}, rateLimitReply("1", "2", "0", "10", "10")},
+		{[]string{"ratelimit", "k", "2", "10", "3"}, rateLimitReply("1", "2", "0", "-1", "10")},
+		{[]string{"ratelimit", "k", "2", "10", "0"}, rateLimitReply("0", "2", "0", "-1", "10")},
+		{[]string{"ratelimit", "k", "2", "0"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ratelimit", "k", "-1", "10"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ratelimit", "k", "2", "10", "1", "1"}, "-Err syntax error\r\n"},
+		{[]string{"hset", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"ratelimit", "h", "2", "10"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+
+	// 数量很大的请求只占用一条记录
+	now := strconv.FormatInt(time.Now().UnixMilli()+10, 10)
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"ratelimit", "big", "1000000000000", "10", "1000000000000"}, rateLimitReply("0", "1000000000000", "0", "-1", "10")},
+		{[]string{"ratelimit.record", "big", "10000", now, "1000000000000"}, "+OK\r\n"},
+		{[]string{"ratelimit.record", "big", "10000", now, "9223372036854775807"}, "-ERR quantity is out of range\r\n"},
+		{[]string{"ratelimit.record", "big", "0", now, "1"}, "-ERR value is not an integer or out of range\r\n"},
+	})
+	entity, ok := db.GetEntity("big")
+	if !ok {
+		t.Fatal("key big not found")
+	}
+	if w := entity.Data.(*ratelimit.SlidingWindow); w.BucketCount() > 2 || w.Len() != 2000000000000 {
+		t.Errorf("expected 2000000000000 requests in at most 2 buckets, actual %d/%d", w.Len(), w.BucketCount())
+	}
+}
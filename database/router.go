@@ -6,11 +6,15 @@ var cmdTable = make(map[string]*command)
 
 // command 接口
 type command struct {
-	executor ExecFunc
-	prepare  PreFunc // return related keys command
-	undo     UndoFunc
-	arity    int // allow number of args, arity < 0 means len(args) >= -arity
-	flags    int
+	executor   ExecFunc
+	prepare    PreFunc    // return related keys command
+	dynPrepare DynPreFunc // 依赖数据库状态的额外写入key，可以为nil
+	undo       UndoFunc
+	arity      int // allow number of args, arity < 0 means len(args) >= -arity
+	flags      int
+	// 执行器内部自行对key加锁，涉及的key取决于执行过程，无法通过prepare预先声明
+	// 锁不可重入，这类命令不能在已经持有锁的 MULTI、脚本、CASEXEC 中执行
+	selfLocking bool
 }
 
 const (
@@ -31,3 +35,15 @@ func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback U
 		flags:    flags,
 	}
 }
+
+// registerDynPrepare 为已注册的命令设置依赖数据库状态的prepare函数
+func registerDynPrepare(name string, dynPrepare DynPreFunc) {
+	cmdTable[strings.ToLower(name)].dynPrepare = dynPrepare
+}
+
+// registerSelfLocking 将已注册的命令标记为在执行器内部自行加锁
+func registerSelfLocking(names ...string) {
+	for _, name := range names {
+		cmdTable[strings.ToLower(name)].selfLocking = true
+	}
+}
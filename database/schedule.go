@@ -0,0 +1,199 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/logger"
+	"github.com/HildaM/GoKV/lib/timewheel"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/pubsub"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	延时命令：SCHEDULE SCHEDULE.LIST UNSCHEDULE
+	任务到期后在所属的数据库中执行，执行完成后在aof中写入 UNSCHEDULE，避免重启后重复执行
+	MultiDB 层面的命令中只有 PUBLISH 可以延时执行，直接发送到共享的 hub
+*/
+
+// scheduledJob 一个待执行的命令
+type scheduledJob struct {
+	id      string
+	at      time.Time
+	cmdLine CmdLine
+}
+
+// toCmdLine 返回注册该任务的 SCHEDULE 命令
+func (job *scheduledJob) toCmdLine() CmdLine {
+	line := utils.ToCmdLine("schedule", job.id, strconv.FormatInt(job.at.Unix(), 10))
+	return append(line, job.cmdLine...)
+}
+
+// scheduler 保存单个数据库中待执行的任务
+type scheduler struct {
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob // id --> job
+}
+
+func makeScheduler() *scheduler {
+	return &scheduler{
+		jobs: make(map[string]*scheduledJob),
+	}
+}
+
+// sortedJobs 按照执行时间排序，时间相同时按照id排序
+func (s *scheduler) sortedJobs() []*scheduledJob {
+	s.mu.Lock()
+	jobs := make([]*scheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].at.Equal(jobs[j].at) {
+			return jobs[i].id < jobs[j].id
+		}
+		return jobs[i].at.Before(jobs[j].at)
+	})
+	return jobs
+}
+
+// unschedulable 不允许延时执行的命令
+var unschedulable = map[string]struct{}{
+	"schedule":      {},
+	"schedule.list": {},
+	"unschedule":    {},
+}
+
+// runScheduledJob 任务到期，在当前数据库中执行命令
+func (db *DB) runScheduledJob(job *scheduledJob) {
+	db.schedules.mu.Lock()
+	current, ok := db.schedules.jobs[job.id]
+	if !ok || current != job {
+		db.schedules.mu.Unlock()
+		return // 任务已经被取消或者替换
+	}
+	delete(db.schedules.jobs, job.id)
+	db.schedules.mu.Unlock()
+
+	var result redis.Reply
+	if string(job.cmdLine[0]) == "publish" {
+		result = pubsub.Publish(db.hub, job.cmdLine[1:])
+	} else {
+		result = db.execNormalCommand(nil, job.cmdLine)
+	}
+	if protocol.IsErrorReply(result) {
+		logger.Warn("scheduled job " + job.id + " failed: " + string(result.ToBytes()))
+	}
+	db.addAof(utils.ToCmdLine("unschedule", job.id))
+}
+
+// execSchedule SCHEDULE id unix-time-seconds command [arg ...]
+// 相同id的任务会被替换，执行时间早于当前时间的任务会尽快执行
+func execSchedule(db *DB, args [][]byte) redis.Reply {
+	id := string(args[0])
+	timestamp, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || timestamp < 0 {
+		return protocol.MakeErrReply("ERR invalid timestamp")
+	}
+	cmdLine := args[2:]
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if _, ok := unschedulable[cmdName]; ok {
+		return protocol.MakeErrReply("ERR command '" + cmdName + "' cannot be scheduled")
+	}
+	if cmdName == "publish" {
+		if len(cmdLine) != 3 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+	} else if multiDBCmds[cmdName] {
+		return protocol.MakeErrReply("ERR command '" + cmdName + "' cannot be scheduled")
+	} else {
+		cmd, ok := cmdTable[cmdName]
+		if !ok {
+			return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		}
+		if !validateArity(cmd.arity, cmdLine) {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+	}
+
+	job := &scheduledJob{
+		id:      id,
+		at:      time.Unix(timestamp, 0),
+		cmdLine: utils.ToCmdLine3(cmdName, cmdLine[1:]...),
+	}
+	db.schedules.mu.Lock()
+	db.schedules.jobs[id] = job
+	db.schedules.mu.Unlock()
+	db.scheduleJob(job)
+	db.addAof(utils.ToCmdLine3("schedule", args...))
+	return protocol.MakeOkReply()
+}
+
+// scheduleJob 在时间轮中注册任务，相同的任务key会替换时间轮中已有的任务
+func (db *DB) scheduleJob(job *scheduledJob) {
+	db.delayTask(time.Until(job.at), db.genTaskKey("schedule", job.id), func() {
+		db.runScheduledJob(job)
+	})
+}
+
+// execScheduleList SCHEDULE.LIST 返回 [[id, unix-time-seconds, command, arg ...] ...]
+func execScheduleList(db *DB, args [][]byte) redis.Reply {
+	jobs := db.schedules.sortedJobs()
+	replies := make([]redis.Reply, 0, len(jobs))
+	for _, job := range jobs {
+		line := make([][]byte, 0, 2+len(job.cmdLine))
+		line = append(line, []byte(job.id), []byte(strconv.FormatInt(job.at.Unix(), 10)))
+		line = append(line, job.cmdLine...)
+		replies = append(replies, protocol.MakeMultiBulkReply(line))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execUnschedule UNSCHEDULE id
+func execUnschedule(db *DB, args [][]byte) redis.Reply {
+	id := string(args[0])
+	db.schedules.mu.Lock()
+	_, ok := db.schedules.jobs[id]
+	delete(db.schedules.jobs, id)
+	db.schedules.mu.Unlock()
+	if !ok {
+		return protocol.MakeIntReply(0)
+	}
+	timewheel.Cancel(db.genTaskKey("schedule", id))
+	db.addAof(utils.ToCmdLine3("unschedule", args...))
+	return protocol.MakeIntReply(1)
+}
+
+// getScheduleMetaCmds aof重写时还原待执行的任务
+func (db *DB) getScheduleMetaCmds() []CmdLine {
+	jobs := db.schedules.sortedJobs()
+	cmds := make([]CmdLine, 0, len(jobs))
+	for _, job := range jobs {
+		cmds = append(cmds, job.toCmdLine())
+	}
+	return cmds
+}
+
+// undoSchedule 还原id对应的任务：任务原本不存在时取消，否则重新注册原来的任务
+func undoSchedule(db *DB, args [][]byte) []CmdLine {
+	id := string(args[0])
+	db.schedules.mu.Lock()
+	job, ok := db.schedules.jobs[id]
+	db.schedules.mu.Unlock()
+	if !ok {
+		return []CmdLine{utils.ToCmdLine("unschedule", id)}
+	}
+	return []CmdLine{job.toCmdLine()}
+}
+
+func init() {
+	RegisterCommand("Schedule", execSchedule, noPrepare, undoSchedule, -4, flagWrite)
+	RegisterCommand("Schedule.List", execScheduleList, noPrepare, nil, 1, flagReadOnly)
+	RegisterCommand("Unschedule", execUnschedule, noPrepare, undoSchedule, 2, flagWrite)
+}
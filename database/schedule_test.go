@@ -0,0 +1,123 @@
+package database
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+// waitUntil 等待时间轮执行任务，时间轮的精度为1秒
+func waitUntil(cond func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSchedule(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"schedule", "j1", "4102444800", "set", "a", "1"}, "+OK\r\n"},
+		{[]string{"schedule", "j2", "4102444800", "DEL", "a"}, "+OK\r\n"},
+		{[]string{"schedule", "j0", "4102444801", "publish", "ch", "msg"}, "+OK\r\n"},
+		{[]string{"schedule.list"}, "*3\r\n" +
+			"*5\r\n$2\r\nj1\r\n$10\r\n4102444800\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\n1\r\n" +
+			"*4\r\n$2\r\nj2\r\n$10\r\n4102444800\r\n$3\r\ndel\r\n$1\r\na\r\n" +
+			"*5\r\n$2\r\nj0\r\n$10\r\n4102444801\r\n$7\r\npublish\r\n$2\r\nch\r\n$3\r\nmsg\r\n"},
+		{[]string{"unschedule", "j2"}, ":1\r\n"},
+		{[]string{"unschedule", "j2"}, ":0\r\n"},
+		{[]string{"unschedule", "j0"}, ":1\r\n"},
+		// 相同id的任务会被替换
+		{[]string{"schedule", "j1", "4102444802", "get", "a"}, "+OK\r\n"},
+		{[]string{"schedule.list"}, "*1\r\n*4\r\n$2\r\nj1\r\n$10\r\n4102444802\r\n$3\r\nget\r\n$1\r\na\r\n"},
+
+		{[]string{"schedule", "j", "abc", "set", "a", "1"}, "-ERR invalid timestamp\r\n"},
+		{[]string{"schedule", "j", "-1", "set", "a", "1"}, "-ERR invalid timestamp\r\n"},
+		{[]string{"schedule", "j", "0", "nosuchcmd"}, "-ERR unknown command 'nosuchcmd'\r\n"},
+		{[]string{"schedule", "j", "0", "set", "a"}, "-ERR wrong number of arguments for 'set' command\r\n"},
+		{[]string{"schedule", "j", "0", "publish", "ch"}, "-ERR wrong number of arguments for 'publish' command\r\n"},
+		{[]string{"schedule", "j", "0", "unschedule", "j1"}, "-ERR command 'unschedule' cannot be scheduled\r\n"},
+		{[]string{"schedule", "j", "0", "flushall"}, "-ERR command 'flushall' cannot be scheduled\r\n"},
+		{[]string{"schedule", "j", "0"}, "-ERR wrong number of arguments for 'schedule' command\r\n"},
+		{[]string{"unschedule"}, "-ERR wrong number of arguments for 'unschedule' command\r\n"},
+	})
+
+	// 执行时间早于当前时间的任务尽快执行，执行后从列表中移除
+	execString(db, conn, "schedule", "now", "0", "set", "b", "1")
+	if !waitUntil(func() bool { return execString(db, conn, "get", "b") == "$1\r\n1\r\n" }) {
+		t.Fatal("scheduled job not executed")
+	}
+	if actual := execString(db, conn, "schedule.list"); !strings.HasPrefix(actual, "*1\r\n") {
+		t.Errorf("executed job should be removed: %q", actual)
+	}
+}
+
+func TestSchedulePublish(t *testing.T) {
+	mdb := NewStandaloneServer()
+	server, client := net.Pipe()
+	subscriber := connection.NewConn(server)
+	defer subscriber.Close()
+	received := &pipeReader{}
+	go received.run(client)
+	mdb.Exec(subscriber, utils.ToCmdLine("subscribe", "ch"))
+	subscriber.Flush()
+
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("schedule", "p", "0", "publish", "ch", "hello"))
+	if expected := "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n"; !received.waitFor(expected) {
+		t.Errorf("subscriber did not receive %q", expected)
+	}
+}
+
+func TestScheduleTasksDisabled(t *testing.T) {
+	// aof重写使用的临时数据库只保存任务，不执行
+	basic := makeBasicDB()
+	conn := &connection.FakeConn{}
+	execString(basic, conn, "schedule", "j", "0", "set", "a", "1")
+
+	// 加载aof期间的主数据库推迟到 startTasks 执行，执行结果写入aof
+	db := MakeDB()
+	db.tasksEnabled = false
+	var mu sync.Mutex
+	var aofLines []string
+	db.addAof = func(line CmdLine) {
+		mu.Lock()
+		aofLines = append(aofLines, string(bytes.Join(line, []byte(" "))))
+		mu.Unlock()
+	}
+	execString(db, conn, "schedule", "j", "0", "set", "a", "1")
+
+	time.Sleep(1500 * time.Millisecond)
+	if actual := execString(basic, conn, "schedule.list"); !strings.HasPrefix(actual, "*1\r\n") {
+		t.Errorf("job should be kept on the basic db: %q", actual)
+	}
+	if actual := execString(basic, conn, "get", "a"); actual != "$-1\r\n" {
+		t.Errorf("job should not run on the basic db, get a: %q", actual)
+	}
+	if actual := execString(db, conn, "get", "a"); actual != "$-1\r\n" {
+		t.Errorf("job should not run before startTasks, get a: %q", actual)
+	}
+
+	db.startTasks()
+	if !waitUntil(func() bool { return execString(db, conn, "get", "a") == "$1\r\n1\r\n" }) {
+		t.Fatal("scheduled job not executed after startTasks")
+	}
+	unscheduled := waitUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(aofLines) > 0 && aofLines[len(aofLines)-1] == "unschedule j"
+	})
+	if !unscheduled {
+		t.Error("executed job should be removed from aof")
+	}
+}
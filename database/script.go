@@ -0,0 +1,401 @@
+package database
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/logger"
+	"github.com/HildaM/GoKV/lib/lua"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	服务端脚本：EVAL EVALSHA SCRIPT LOAD|EXISTS|FLUSH
+	脚本使用 lib/lua 中的沙箱解释器执行，语法是 Lua 5.1 的子集
+	1. 声明的 KEYS 在执行前通过 RWLocks 全部加写锁，脚本只能访问声明过的 key；执行器内部自行加锁的命令（selfLocking）会死锁，不允许调用
+	2. redis.call 通过 execWithLock 执行命令，命令自身会写入aof，因此脚本按照执行效果持久化，EVAL 本身不写入aof
+*/
+
+// scriptCache 已经加载的脚本，所有数据库共享
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.Chunk // sha1 --> 编译后的脚本
+}
+
+var scripts = &scriptCache{scripts: make(map[string]*lua.Chunk)}
+
+func sha1Hex(src []byte) string {
+	sum := sha1.Sum(src)
+	return hex.EncodeToString(sum[:])
+}
+
+// load 编译并缓存脚本，返回脚本的sha1
+func (c *scriptCache) load(src []byte) (string, *lua.Chunk, protocol.ErrorReply) {
+	sha := sha1Hex(src)
+	if chunk := c.get(sha); chunk != nil {
+		return sha, chunk, nil
+	}
+	chunk, err := lua.Compile("user_script", string(src))
+	if err != nil {
+		return "", nil, protocol.MakeErrReply("ERR Error compiling script (new function): " + err.Error())
+	}
+	c.mu.Lock()
+	c.scripts[sha] = chunk
+	c.mu.Unlock()
+	return sha, chunk, nil
+}
+
+func (c *scriptCache) get(sha string) *lua.Chunk {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scripts[strings.ToLower(sha)]
+}
+
+func (c *scriptCache) flush() {
+	c.mu.Lock()
+	c.scripts = make(map[string]*lua.Chunk)
+	c.mu.Unlock()
+}
+
+/* ---- 命令 ---- */
+
+// parseNumKeys 解析 numkeys key [key ...] arg [arg ...]
+func parseNumKeys(args [][]byte) ([]string, [][]byte, protocol.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, protocol.MakeErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, protocol.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return keys, args[1+numKeys:], nil
+}
+
+// prepareEval EVAL script numkeys key [key ...] arg [arg ...]，声明的key全部加写锁
+func prepareEval(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseNumKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func undoEval(db *DB, args [][]byte) []CmdLine {
+	keys, _ := prepareEval(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execEval EVAL script numkeys key [key ...] arg [arg ...]
+func execEval(db *DB, args [][]byte) redis.Reply {
+	_, chunk, errReply := scripts.load(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	return db.runScript(chunk, args[1:])
+}
+
+// execEvalSha EVALSHA sha1 numkeys key [key ...] arg [arg ...]
+func execEvalSha(db *DB, args [][]byte) redis.Reply {
+	chunk := scripts.get(string(args[0]))
+	if chunk == nil {
+		return protocol.MakeErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return db.runScript(chunk, args[1:])
+}
+
+// execScript SCRIPT LOAD script | SCRIPT EXISTS sha1 [sha1 ...] | SCRIPT FLUSH [ASYNC|SYNC]
+func execScript(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	switch subCmd {
+	case "LOAD":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("script|load")
+		}
+		sha, _, errReply := scripts.load(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		return protocol.MakeBulkReply([]byte(sha))
+	case "EXISTS":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrReply("script|exists")
+		}
+		replies := make([]redis.Reply, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			exists := int64(0)
+			if scripts.get(string(sha)) != nil {
+				exists = 1
+			}
+			replies = append(replies, protocol.MakeIntReply(exists))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "FLUSH":
+		if len(args) > 2 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		if len(args) == 2 {
+			mode := strings.ToUpper(string(args[1]))
+			if mode != "ASYNC" && mode != "SYNC" {
+				return protocol.MakeSyntaxErrReply()
+			}
+		}
+		scripts.flush()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SCRIPT LOAD, SCRIPT EXISTS, SCRIPT FLUSH.")
+}
+
+/* ---- 执行脚本 ---- */
+
+// 不能在脚本中调用的命令
+var scriptForbidden = map[string]bool{
+	"eval":    true,
+	"evalsha": true,
+	"script":  true,
+}
+
+// runScript 执行脚本，调用者已经对声明的key加锁
+func (db *DB) runScript(chunk *lua.Chunk, args [][]byte) redis.Reply {
+	keys, argv, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	declared := make(map[string]struct{}, len(keys))
+	keysTable := lua.NewTable()
+	for _, key := range keys {
+		declared[key] = struct{}{}
+		keysTable.Append(key)
+	}
+	argvTable := lua.NewTable()
+	for _, arg := range argv {
+		argvTable.Append(string(arg))
+	}
+
+	state := lua.NewState()
+	state.SetGlobal("KEYS", keysTable)
+	state.SetGlobal("ARGV", argvTable)
+	state.SetGlobal("redis", db.makeRedisLib(declared))
+
+	rets, err := state.Run(chunk)
+	if err != nil {
+		if e, ok := err.(*lua.Error); ok {
+			if t, ok := e.Value.(*lua.Table); ok {
+				if msg, ok := t.Get("err").(string); ok {
+					return protocol.MakeErrReply(msg)
+				}
+			}
+		}
+		return protocol.MakeErrReply("ERR Error running script: " + err.Error())
+	}
+	if len(rets) == 0 {
+		return &protocol.NullBulkReply{}
+	}
+	return luaToReply(rets[0])
+}
+
+// makeRedisLib 脚本中的 redis 库
+func (db *DB) makeRedisLib(declared map[string]struct{}) *lua.Table {
+	lib := lua.NewTable()
+	register := func(name string, fn func(s *lua.State, args []lua.Value) ([]lua.Value, error)) {
+		_ = lib.Set(name, &lua.GoFunction{Name: name, Fn: fn})
+	}
+	call := func(name string, raise bool) func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		return func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+			if len(args) == 0 {
+				return nil, s.RuntimeError("Please specify at least one argument for %s()", name)
+			}
+			cmdLine := make(CmdLine, len(args))
+			for i := range args {
+				arg, err := lua.CheckString(args, i, name)
+				if err != nil {
+					return nil, s.RuntimeError("Lua redis lib command arguments must be strings or integers")
+				}
+				cmdLine[i] = []byte(arg)
+			}
+			reply := db.execScriptCommand(declared, cmdLine)
+			if errReply, ok := reply.(protocol.ErrorReply); ok && raise {
+				return nil, &lua.Error{Value: makeLuaStatus("err", errReply.Error())}
+			}
+			return []lua.Value{replyToLua(reply)}, nil
+		}
+	}
+	register("call", call("redis.call", true))
+	register("pcall", call("redis.pcall", false))
+	register("error_reply", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		msg, err := lua.CheckString(args, 0, "error_reply")
+		if err != nil {
+			return nil, err
+		}
+		return []lua.Value{makeLuaStatus("err", msg)}, nil
+	})
+	register("status_reply", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		msg, err := lua.CheckString(args, 0, "status_reply")
+		if err != nil {
+			return nil, err
+		}
+		return []lua.Value{makeLuaStatus("ok", msg)}, nil
+	})
+	register("sha1hex", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		src, err := lua.CheckString(args, 0, "sha1hex")
+		if err != nil {
+			return nil, err
+		}
+		return []lua.Value{sha1Hex([]byte(src))}, nil
+	})
+	register("log", func(s *lua.State, args []lua.Value) ([]lua.Value, error) {
+		msg, err := lua.CheckString(args, 1, "log")
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("script: " + msg)
+		return nil, nil
+	})
+	for i, level := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		_ = lib.Set(level, float64(i))
+	}
+	return lib
+}
+
+// execScriptCommand 执行 redis.call 调用的命令，只能访问声明过的key
+// 没有通过prepare声明key、在执行器内部自行加锁的命令会与脚本持有的锁冲突，直接拒绝
+func (db *DB) execScriptCommand(declared map[string]struct{}, cmdLine CmdLine) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if scriptForbidden[cmdName] || cmd.prepare == nil || cmd.selfLocking {
+		return protocol.MakeErrReply("ERR This Redis command is not allowed from script")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+	write, read := db.relatedKeys(cmd, cmdLine[1:])
+	for _, keys := range [][]string{write, read} {
+		for _, key := range keys {
+			if _, ok := declared[key]; !ok {
+				return protocol.MakeErrReply("ERR Script attempted to access a non declared key: " + key)
+			}
+		}
+	}
+	return db.execWithLock(cmdLine)
+}
+
+func makeLuaStatus(field string, msg string) *lua.Table {
+	t := lua.NewTable()
+	_ = t.Set(field, msg)
+	return t
+}
+
+// replyToLua 将命令的回复转换为脚本中的值
+// 整数 --> number，字符串 --> string，空 --> false，数组 --> table，状态 --> {ok=...}，错误 --> {err=...}
+func replyToLua(reply redis.Reply) lua.Value {
+	switch r := reply.(type) {
+	case *protocol.IntReply:
+		return float64(r.Code)
+	case *protocol.BulkReply:
+		if r.Arg == nil {
+			return false
+		}
+		return string(r.Arg)
+	case *protocol.MultiBulkReply:
+		t := lua.NewTable()
+		for _, arg := range r.Args {
+			if arg == nil {
+				t.Append(false)
+			} else {
+				t.Append(string(arg))
+			}
+		}
+		return t
+	case *protocol.MultiRawReply:
+		t := lua.NewTable()
+		for _, item := range r.Replies {
+			t.Append(replyToLua(item))
+		}
+		return t
+	case *protocol.EmptyMultiBulkReply:
+		return lua.NewTable()
+	case *protocol.NullBulkReply, *protocol.NullMultiBulkReply, *protocol.NullReply:
+		return false
+	// 脚本中按照RESP2处理RESP3类型：map展开为数组，double转为字符串，boolean转为整数
+	case *protocol.MapReply:
+		t := lua.NewTable()
+		for i := range r.Keys {
+			t.Append(replyToLua(r.Keys[i]))
+			t.Append(replyToLua(r.Values[i]))
+		}
+		return t
+	case *protocol.SetReply:
+		return replyToLua(protocol.MakeMultiBulkReply(r.Members))
+	case *protocol.ScoredMembersReply:
+		t := lua.NewTable()
+		for i, member := range r.Members {
+			t.Append(string(member))
+			t.Append(protocol.FormatFloat(r.Scores[i]))
+		}
+		return t
+	case *protocol.DoubleReply:
+		return protocol.FormatFloat(r.Value)
+	case *protocol.BooleanReply:
+		if r.Value {
+			return float64(1)
+		}
+		return float64(0)
+	case protocol.ErrorReply:
+		return makeLuaStatus("err", r.Error())
+	}
+	// 其余的回复都是状态回复，例如 +OK
+	raw := string(reply.ToBytes())
+	return makeLuaStatus("ok", strings.TrimSuffix(strings.TrimPrefix(raw, "+"), protocol.CRLF))
+}
+
+// luaToReply 将脚本的返回值转换为回复
+// number --> 整数（截断小数），string --> 字符串，true --> 1，false/nil --> 空，table --> 数组（遇到nil结束）
+func luaToReply(value lua.Value) redis.Reply {
+	switch v := value.(type) {
+	case float64:
+		return protocol.MakeIntReply(int64(v))
+	case string:
+		return protocol.MakeBulkReply([]byte(v))
+	case bool:
+		if v {
+			return protocol.MakeIntReply(1)
+		}
+		return &protocol.NullBulkReply{}
+	case *lua.Table:
+		if msg, ok := v.Get("err").(string); ok {
+			return protocol.MakeErrReply(msg)
+		}
+		if msg, ok := v.Get("ok").(string); ok {
+			return protocol.MakeStatusReply(msg)
+		}
+		replies := make([]redis.Reply, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.Get(float64(i))
+			if item == nil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	}
+	return &protocol.NullBulkReply{}
+}
+
+func init() {
+	RegisterCommand("Eval", execEval, prepareEval, undoEval, -3, flagWrite)
+	RegisterCommand("EvalSha", execEvalSha, prepareEval, undoEval, -3, flagWrite)
+	RegisterCommand("Script", execScript, noPrepare, nil, -2, flagReadOnly)
+}
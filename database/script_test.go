@@ -0,0 +1,36 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestScriptCommandAccess(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execTimeout(t, db, conn, "hset", "doc:1", "title", "hello")
+	execTimeout(t, db, conn, "ft.create", "idx", "PREFIX", "1", "doc:", "SCHEMA", "title", "TEXT")
+
+	tests := []struct {
+		script   string
+		keys     []string
+		expected string
+	}{
+		{"return redis.call('set', KEYS[1], 'v')", []string{"a"}, "+OK"},
+		{"return redis.call('set', 'b', 'v')", []string{"a"}, "-ERR Script attempted to access a non declared key: b"},
+		{"return redis.call('ft.search', 'idx', 'hello')", nil, "-ERR This Redis command is not allowed from script"},
+		{"return redis.call('bigkeys')", []string{"doc:1"}, "-ERR This Redis command is not allowed from script"},
+		{"return redis.call('eval', 'return 1', '0')", nil, "-ERR This Redis command is not allowed from script"},
+		{"return redis.call('ft.info', 'idx')[2]", nil, "$3\r\nidx"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"eval", tt.script, strconv.Itoa(len(tt.keys))}, tt.keys...)
+		result := string(execTimeout(t, db, conn, args...))
+		if !strings.HasPrefix(result, tt.expected) {
+			t.Errorf("%s: expected %q, actual %q", tt.script, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	Dict "github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/datastruct/ftindex"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	二级索引命令：FT.CREATE FT.SEARCH FT.DROPINDEX FT.INFO
+	所有写命令执行完成后，都会通过 updateIndexes 同步被写入的key
+*/
+
+// indexRegistry 保存当前数据库的全部二级索引
+type indexRegistry struct {
+	mu      sync.RWMutex
+	indexes map[string]*ftindex.Index
+}
+
+func makeIndexRegistry() *indexRegistry {
+	return &indexRegistry{
+		indexes: make(map[string]*ftindex.Index),
+	}
+}
+
+func (r *indexRegistry) get(name string) (*ftindex.Index, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	index, ok := r.indexes[name]
+	return index, ok
+}
+
+// list 按名称排序返回所有索引
+func (r *indexRegistry) list() []*ftindex.Index {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]*ftindex.Index, 0, len(r.indexes))
+	for _, index := range r.indexes {
+		result = append(result, index)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (r *indexRegistry) isEmpty() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.indexes) == 0
+}
+
+// updateIndexes 重新索引给定的key。调用方需要持有这些key的锁
+// key是匹配前缀的hash时写入索引，否则（被删除、类型改变）从索引中移除
+func (db *DB) updateIndexes(keys ...string) {
+	if db.indexes.isEmpty() {
+		return
+	}
+	for _, key := range keys {
+		var values map[string]string
+		if dict, errReply := db.getAsDict(key); errReply == nil && dict != nil {
+			values = hashToStringMap(dict)
+		}
+		for _, index := range db.indexes.list() {
+			if values != nil && index.Match(key) {
+				index.Put(key, values)
+			} else {
+				index.Remove(key)
+			}
+		}
+	}
+}
+
+// removeFromIndexes key被删除时从所有索引中移除
+func (db *DB) removeFromIndexes(key string) {
+	if db.indexes.isEmpty() {
+		return
+	}
+	for _, index := range db.indexes.list() {
+		index.Remove(key)
+	}
+}
+
+// buildIndex 扫描数据库中已有的hash，用于 FT.CREATE 以及从aof加载后的重建
+func (db *DB) buildIndex(index *ftindex.Index) {
+	keys := make([]string, 0)
+	db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+		if _, ok := entity.Data.(Dict.Dict); ok && index.Match(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	// 逐个加读锁读取hash，避免与并发写入冲突
+	for _, key := range keys {
+		db.RWLocks(nil, []string{key})
+		if dict, errReply := db.getAsDict(key); errReply == nil && dict != nil {
+			index.Put(key, hashToStringMap(dict))
+		}
+		db.RWULocks(nil, []string{key})
+	}
+}
+
+// execFtCreate FT.CREATE index [ON HASH] [PREFIX count prefix ...] SCHEMA field type [SEPARATOR sep] [SORTABLE] ...
+func execFtCreate(db *DB, args [][]byte) redis.Reply {
+	name := string(args[0])
+	var prefixes []string
+	i := 1
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "SCHEMA" {
+			break
+		}
+		switch arg {
+		case "ON":
+			if i+1 >= len(args) || strings.ToUpper(string(args[i+1])) != "HASH" {
+				return protocol.MakeErrReply("ERR only HASH index is supported")
+			}
+			i++
+		case "PREFIX":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 0 || i+1+count >= len(args) {
+				return protocol.MakeErrReply("ERR invalid prefix count")
+			}
+			for _, p := range args[i+2 : i+2+count] {
+				prefixes = append(prefixes, string(p))
+			}
+			i += 1 + count
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if i >= len(args) {
+		return protocol.MakeErrReply("ERR SCHEMA is required")
+	}
+
+	// 解析字段定义
+	fields := make([]*ftindex.Field, 0)
+	seen := make(map[string]struct{})
+	rest := args[i+1:]
+	for j := 0; j < len(rest); j++ {
+		if j+1 >= len(rest) {
+			return protocol.MakeErrReply("ERR missing type for field '" + string(rest[j]) + "'")
+		}
+		field := &ftindex.Field{Name: string(rest[j]), Type: strings.ToUpper(string(rest[j+1]))}
+		if field.Type != ftindex.TypeNumeric && field.Type != ftindex.TypeTag && field.Type != ftindex.TypeText {
+			return protocol.MakeErrReply("ERR unknown field type '" + string(rest[j+1]) + "'")
+		}
+		if _, dup := seen[field.Name]; dup {
+			return protocol.MakeErrReply("ERR duplicate field in schema '" + field.Name + "'")
+		}
+		seen[field.Name] = struct{}{}
+		j++
+		for j+1 < len(rest) {
+			opt := strings.ToUpper(string(rest[j+1]))
+			if opt == "SORTABLE" {
+				field.Sortable = true
+				j++
+			} else if opt == "SEPARATOR" && field.Type == ftindex.TypeTag && j+2 < len(rest) {
+				field.Separator = string(rest[j+2])
+				j += 2
+			} else {
+				break
+			}
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return protocol.MakeErrReply("ERR SCHEMA is required")
+	}
+
+	index := ftindex.Make(name, prefixes, fields)
+	db.indexes.mu.Lock()
+	if _, exists := db.indexes.indexes[name]; exists {
+		db.indexes.mu.Unlock()
+		return protocol.MakeErrReply("ERR Index already exists")
+	}
+	db.indexes.indexes[name] = index
+	db.indexes.mu.Unlock()
+
+	db.buildIndex(index)
+	db.addAof(utils.ToCmdLine3("ft.create", args...))
+	return protocol.MakeOkReply()
+}
+
+// execFtDropIndex FT.DROPINDEX index [DD]，DD 同时删除被索引的hash
+func execFtDropIndex(db *DB, args [][]byte) redis.Reply {
+	name := string(args[0])
+	deleteDocs := false
+	if len(args) == 2 {
+		if strings.ToUpper(string(args[1])) != "DD" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		deleteDocs = true
+	} else if len(args) > 2 {
+		return protocol.MakeArgNumErrReply("ft.dropindex")
+	}
+
+	db.indexes.mu.Lock()
+	index, exists := db.indexes.indexes[name]
+	delete(db.indexes.indexes, name)
+	db.indexes.mu.Unlock()
+	if !exists {
+		return protocol.MakeErrReply("ERR Unknown Index name")
+	}
+
+	if deleteDocs {
+		for _, key := range index.DocIDs() {
+			db.RWLocks([]string{key}, nil)
+			db.Remove(key)
+			db.RWULocks([]string{key}, nil)
+			db.addAof(utils.ToCmdLine("del", key))
+		}
+	}
+	db.addAof(utils.ToCmdLine3("ft.dropindex", args[0]))
+	return protocol.MakeOkReply()
+}
+
+// execFtInfo FT.INFO index
+func execFtInfo(db *DB, args [][]byte) redis.Reply {
+	index, exists := db.indexes.get(string(args[0]))
+	if !exists {
+		return protocol.MakeErrReply("ERR Unknown Index name")
+	}
+
+	prefixes := make([][]byte, len(index.Prefixes))
+	for i, p := range index.Prefixes {
+		prefixes[i] = []byte(p)
+	}
+	attributes := make([]redis.Reply, len(index.Fields))
+	for i, f := range index.Fields {
+		attr := utils.ToCmdLine("identifier", f.Name, "type", f.Type)
+		if f.Type == ftindex.TypeTag {
+			attr = append(attr, []byte("SEPARATOR"), []byte(f.Separator))
+		}
+		if f.Sortable {
+			attr = append(attr, []byte("SORTABLE"))
+		}
+		attributes[i] = protocol.MakeMultiBulkReply(attr)
+	}
+
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte("index_name")),
+		protocol.MakeBulkReply([]byte(index.Name)),
+		protocol.MakeBulkReply([]byte("index_definition")),
+		protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("key_type")),
+			protocol.MakeBulkReply([]byte("HASH")),
+			protocol.MakeBulkReply([]byte("prefixes")),
+			protocol.MakeMultiBulkReply(prefixes),
+		}),
+		protocol.MakeBulkReply([]byte("attributes")),
+		protocol.MakeMultiRawReply(attributes),
+		protocol.MakeBulkReply([]byte("num_docs")),
+		protocol.MakeIntReply(int64(index.Len())),
+	})
+}
+
+// execFtList FT._LIST 列出所有索引
+func execFtList(db *DB, args [][]byte) redis.Reply {
+	indexes := db.indexes.list()
+	names := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		names[i] = []byte(index.Name)
+	}
+	return protocol.MakeMultiBulkReply(names)
+}
+
+// execFtSearch FT.SEARCH index query [NOCONTENT] [SORTBY field [ASC|DESC]] [LIMIT offset num]
+func execFtSearch(db *DB, args [][]byte) redis.Reply {
+	index, exists := db.indexes.get(string(args[0]))
+	if !exists {
+		return protocol.MakeErrReply("ERR Unknown Index name")
+	}
+	query, err := ftindex.ParseQuery(string(args[1]))
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+
+	opts := &ftindex.SearchOptions{Limit: 10}
+	noContent := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NOCONTENT":
+			noContent = true
+		case "SORTBY":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			opts.SortBy = string(args[i+1])
+			i++
+			if i+1 < len(args) {
+				order := strings.ToUpper(string(args[i+1]))
+				if order == "ASC" || order == "DESC" {
+					opts.Desc = order == "DESC"
+					i++
+				}
+			}
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			offset, err1 := strconv.Atoi(string(args[i+1]))
+			limit, err2 := strconv.Atoi(string(args[i+2]))
+			if err1 != nil || err2 != nil || offset < 0 || limit < 0 {
+				return protocol.MakeErrReply("ERR invalid LIMIT")
+			}
+			opts.Offset, opts.Limit = offset, limit
+			i += 2
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	total, docs, err := index.Search(query, opts)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+
+	replies := []redis.Reply{protocol.MakeIntReply(int64(total))}
+	for _, doc := range docs {
+		replies = append(replies, protocol.MakeBulkReply([]byte(doc.ID)))
+		if noContent {
+			continue
+		}
+		replies = append(replies, db.readDocContent(doc))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// readDocContent 加读锁读取文档对应hash的完整内容
+func (db *DB) readDocContent(doc *ftindex.Document) redis.Reply {
+	db.RWLocks(nil, []string{doc.ID})
+	defer db.RWULocks(nil, []string{doc.ID})
+
+	content := make([][]byte, 0)
+	if dict, errReply := db.getAsDict(doc.ID); errReply == nil && dict != nil {
+		values := hashToStringMap(dict)
+		fields := make([]string, 0, len(values))
+		for field := range values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			content = append(content, []byte(field), []byte(values[field]))
+		}
+	}
+	return protocol.MakeMultiBulkReply(content)
+}
+
+// getIndexMetaCmds 返回重建全部索引所需的命令，用于aof重写
+func (db *DB) getIndexMetaCmds() []CmdLine {
+	cmds := make([]CmdLine, 0)
+	for _, index := range db.indexes.list() {
+		cmds = append(cmds, indexToCmd(index))
+	}
+	return cmds
+}
+
+// indexToCmd 返回创建索引的 FT.CREATE 命令
+func indexToCmd(index *ftindex.Index) CmdLine {
+	cmd := utils.ToCmdLine("FT.CREATE", index.Name, "ON", "HASH")
+	if len(index.Prefixes) > 0 {
+		cmd = append(cmd, []byte("PREFIX"), []byte(strconv.Itoa(len(index.Prefixes))))
+		for _, p := range index.Prefixes {
+			cmd = append(cmd, []byte(p))
+		}
+	}
+	cmd = append(cmd, []byte("SCHEMA"))
+	for _, f := range index.Fields {
+		cmd = append(cmd, []byte(f.Name), []byte(f.Type))
+		if f.Type == ftindex.TypeTag {
+			cmd = append(cmd, []byte("SEPARATOR"), []byte(f.Separator))
+		}
+		if f.Sortable {
+			cmd = append(cmd, []byte("SORTABLE"))
+		}
+	}
+	return cmd
+}
+
+// undoFtCreate 索引不存在时，回滚命令为删除索引
+func undoFtCreate(db *DB, args [][]byte) []CmdLine {
+	if _, exists := db.indexes.get(string(args[0])); exists {
+		return nil // 索引已经存在，FT.CREATE 会失败
+	}
+	return []CmdLine{utils.ToCmdLine("FT.DROPINDEX", string(args[0]))}
+}
+
+// undoFtDropIndex 重新创建索引，DD 选项还需要还原被删除的文档
+func undoFtDropIndex(db *DB, args [][]byte) []CmdLine {
+	index, exists := db.indexes.get(string(args[0]))
+	if !exists {
+		return nil
+	}
+	var undoCmdLines []CmdLine
+	if len(args) == 2 {
+		undoCmdLines = append(undoCmdLines, rollbackGivenKeys(db, index.DocIDs()...)...)
+	}
+	return append(undoCmdLines, indexToCmd(index))
+}
+
+func init() {
+	RegisterCommand("FT.Create", execFtCreate, noPrepare, undoFtCreate, -4, flagWrite)
+	RegisterCommand("FT.DropIndex", execFtDropIndex, noPrepare, undoFtDropIndex, -2, flagWrite)
+	RegisterCommand("FT.Info", execFtInfo, noPrepare, nil, 2, flagReadOnly)
+	RegisterCommand("FT._List", execFtList, noPrepare, nil, 1, flagReadOnly)
+	RegisterCommand("FT.Search", execFtSearch, noPrepare, nil, -3, flagReadOnly)
+	// 扫描或者删除的文档由索引内容决定，执行时逐个加锁
+	registerSelfLocking("FT.Create", "FT.DropIndex", "FT.Search")
+}
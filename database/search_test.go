@@ -0,0 +1,75 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// execTimeout 执行命令，超时视为死锁
+func execTimeout(t *testing.T, db *DB, conn *connection.FakeConn, args ...string) []byte {
+	done := make(chan []byte, 1)
+	go func() {
+		done <- db.Exec(conn, utils.ToCmdLine(args...)).ToBytes()
+	}()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(3 * time.Second):
+		t.Fatalf("%v: deadlock", args)
+	}
+	return nil
+}
+
+func TestFtRejectedWhileLocked(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	execTimeout(t, db, conn, "hset", "doc:1", "title", "hello")
+	execTimeout(t, db, conn, "ft.create", "idx", "PREFIX", "1", "doc:", "SCHEMA", "title", "TEXT")
+
+	// MULTI 中入队失败，EXEC 放弃整个事务
+	execTimeout(t, db, conn, "multi")
+	execTimeout(t, db, conn, "hset", "doc:2", "title", "world")
+	for _, line := range [][]string{
+		{"ft.search", "idx", "hello"},
+		{"ft.create", "idx2", "SCHEMA", "title", "TEXT"},
+		{"ft.dropindex", "idx", "DD"},
+	} {
+		result := execTimeout(t, db, conn, line...)
+		if !strings.HasPrefix(string(result), "-ERR command '"+line[0]+"' cannot be used in MULTI") {
+			t.Errorf("%v: unexpected reply %q", line, result)
+		}
+	}
+	result := execTimeout(t, db, conn, "exec")
+	if !strings.HasPrefix(string(result), "-EXECABORT") {
+		t.Errorf("expected EXECABORT, actual %q", result)
+	}
+
+	// 脚本中同样拒绝
+	result = execTimeout(t, db, conn, "eval", "return redis.call('ft.search', 'idx', 'hello')", "0")
+	if !strings.Contains(string(result), "not allowed from script") {
+		t.Errorf("unexpected script reply %q", result)
+	}
+
+	// CASEXEC 中同样拒绝
+	result = execTimeout(t, db, conn, "casexec", "doc:1", "1", "ft.dropindex", "idx", "DD")
+	if !strings.Contains(string(result), "cannot be used in CASEXEC") {
+		t.Errorf("unexpected casexec reply %q", result)
+	}
+
+	// 正常执行不受影响
+	result = execTimeout(t, db, conn, "ft.search", "idx", "hello")
+	expected := protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(1),
+		protocol.MakeBulkReply([]byte("doc:1")),
+		protocol.MakeMultiBulkReply(utils.ToCmdLine("title", "hello")),
+	}).ToBytes()
+	if string(result) != string(expected) {
+		t.Errorf("expected %q, actual %q", expected, result)
+	}
+}
@@ -1,12 +1,16 @@
 package database
 
 import (
+	"fmt"
 	"github.com/HildaM/GoKV/datastruct/dict"
 	"github.com/HildaM/GoKV/datastruct/lock"
+	"github.com/HildaM/GoKV/datastruct/topk"
 	"github.com/HildaM/GoKV/interface/database"
 	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/pubsub"
 	"github.com/HildaM/GoKV/redis/protocol"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,10 +30,35 @@ type DB struct {
 	ttlMap dict.Dict
 	// key --> verison版本
 	versionMap dict.Dict
+	// 不存在版本记录的key的版本号。FLUSHDB 替换db时设置为旧db的最大版本号+1，保证WATCH能够发现清空操作
+	versionBase uint32
+	// 所有key中最大的版本号
+	maxVersion uint32
 
 	// 某些复杂操作下，需要对多个key上锁，例如（rpush、incr...）
 	locker *lock.Locks
 
+	// 二级索引
+	indexes *indexRegistry
+
+	// 延时执行的命令
+	schedules *scheduler
+
+	// 热点key统计
+	hotKeys *topk.TopK
+
+	// 估算的内存占用，所有DataEntity.Size之和
+	usedMemory int64
+
+	// 客户端缓存的追踪表，所有db共享
+	tracking *trackingTable
+
+	// 发布订阅，所有db共享，延时执行的 PUBLISH 使用
+	hub *pubsub.Hub
+
+	// 是否向时间轮注册定时任务，aof重写使用的临时数据库以及加载aof期间的主数据库不注册
+	tasksEnabled bool
+
 	// aof
 	addAof func(CmdLine)
 }
@@ -42,6 +71,10 @@ type ExecFunc func(db *DB, args [][]byte) redis.Reply
 // returns related write keys and read keys
 type PreFunc func(args [][]byte) ([]string, []string)
 
+// DynPreFunc 返回只有读取数据库才能确定的额外写入key，例如时间序列降采样规则的目标序列
+// 持有 PreFunc 返回的key的锁之后结果必须保持不变，以便上锁后重新校验
+type DynPreFunc func(db *DB, args [][]byte) []string
+
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
 
@@ -51,11 +84,15 @@ type UndoFunc func(db *DB, args [][]byte) []CmdLine
 
 func MakeDB() *DB {
 	return &DB{
-		data:       dict.MakeConcurrent(dataDictSize),
-		ttlMap:     dict.MakeConcurrent(ttlDictSize),
-		versionMap: dict.MakeConcurrent(dataDictSize),
-		locker:     lock.Make(lockerSize),
-		addAof:     func(line CmdLine) {},
+		data:         dict.MakeConcurrent(dataDictSize),
+		ttlMap:       dict.MakeConcurrent(ttlDictSize),
+		versionMap:   dict.MakeConcurrent(dataDictSize),
+		locker:       lock.Make(lockerSize),
+		indexes:      makeIndexRegistry(),
+		schedules:    makeScheduler(),
+		hotKeys:      makeHotKeys(),
+		tasksEnabled: true,
+		addAof:       func(line CmdLine) {},
 	}
 }
 
@@ -66,6 +103,8 @@ func makeBasicDB() *DB {
 		ttlMap:     dict.MakeSimple(),
 		versionMap: dict.MakeSimple(),
 		locker:     lock.Make(1),
+		indexes:    makeIndexRegistry(),
+		schedules:  makeScheduler(),
 		addAof:     func(line CmdLine) {},
 	}
 }
@@ -94,18 +133,33 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 			return protocol.MakeArgNumErrReply(cmdName)
 		}
 		return Watch(db, c, cmdLine[1:])
+	} else if cmdName == "unwatch" {
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return UnWatch(c)
+	} else if cmdName == "setifversion" {
+		if !validateArity(-4, cmdLine) {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return SetIfVersion(db, c, cmdLine[1:])
+	} else if cmdName == "casexec" {
+		if !validateArity(-4, cmdLine) {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return CasExec(db, c, cmdLine[1:])
 	}
 
-	// 判断是否执行pipeline命令
-	//if c != nil && c.InMultiState() {
-	//	return EnqueueCmd(c, cmdLine)
-	//}
+	// MULTI状态下命令进入队列，等待EXEC
+	if c != nil && c.InMultiState() {
+		return EnqueueCmd(c, cmdLine)
+	}
 
-	return db.execNormalCommand(cmdLine)
+	return db.execNormalCommand(c, cmdLine)
 }
 
-// execNormalCommand 执行普通命令
-func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
+// execNormalCommand 执行普通命令，c 为发起命令的客户端，可以为nil
+func (db *DB) execNormalCommand(c redis.Connection, cmdLine [][]byte) redis.Reply {
 	// 1. 获取命令
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
@@ -118,18 +172,26 @@ func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 		return protocol.MakeArgNumErrReply(cmdName)
 	}
 
-	// 2. 命令预处理
-	prepare := cmd.prepare
-	write, read := prepare(cmdLine[1:])
-
-	// 3. 对将要操作的key加锁
-	db.addVersion(write...) // 对将要写入的key版本号自增
-	db.RWLocks(write, read)
+	// 2. 命令预处理，并对将要操作的key加锁
+	write, read := db.lockRelatedKeys(cmd.dynPrepare != nil, func() ([]string, []string) {
+		return db.relatedKeys(cmd, cmdLine[1:])
+	})
 	defer db.RWULocks(write, read)
+	db.addVersion(c, write...) // 对将要写入的key版本号自增
 
-	// 4. 执行命令
+	// 3. 执行命令
 	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+
+	// 4. 同步二级索引和内存统计
+	db.updateIndexes(write...)
+	db.updateMemory(write...)
+
+	// 5. 客户端缓存记录读取的key
+	if cmd.flags == flagReadOnly {
+		db.tracking.remember(c, read)
+	}
+	return result
 }
 
 // execWithLock 在已经上锁场景下执行命令。
@@ -148,7 +210,13 @@ func (db *DB) execWithLock(cmdLine [][]byte) redis.Reply {
 
 	// 执行命令
 	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+
+	// 同步二级索引和内存统计
+	write, _ := db.relatedKeys(cmd, cmdLine[1:])
+	db.updateIndexes(write...)
+	db.updateMemory(write...)
+	return result
 }
 
 // validateArity 检查参数是否正确
@@ -161,31 +229,50 @@ func validateArity(arity int, cmdArgs [][]byte) bool {
 	return argNum >= -arity
 }
 
-func EnqueueCmd(c redis.Connection, line [][]byte) redis.Reply {
-	return nil
-}
-
-func Watch(db *DB, c redis.Connection, i [][]byte) redis.Reply {
-	return nil
-}
+/* ------- 数据库操作 --------- */
 
-func execMulti(db *DB, c redis.Connection) redis.Reply {
-	return nil
+// RWLocks 对读写key上锁
+func (db *DB) RWLocks(write []string, read []string) {
+	db.locker.RWLocks(write, read)
 }
 
-func DiscardMulti(c redis.Connection) redis.Reply {
-	return nil
+// relatedKeys 返回命令涉及的读写key，包括依赖数据库状态的动态key
+func (db *DB) relatedKeys(cmd *command, args [][]byte) ([]string, []string) {
+	write, read := cmd.prepare(args)
+	if cmd.dynPrepare != nil {
+		write = append(write, cmd.dynPrepare(db, args)...)
+	}
+	return write, read
 }
 
-func StartMulti(c redis.Connection) redis.Reply {
-	return nil
+// lockRelatedKeys 对keysOf返回的key上锁并返回这些key
+// 存在动态key时上锁后重新计算一次，结果变化说明计算期间被并发修改，解锁后重试
+func (db *DB) lockRelatedKeys(dynamic bool, keysOf func() ([]string, []string)) ([]string, []string) {
+	for {
+		write, read := keysOf()
+		db.RWLocks(write, read)
+		if !dynamic {
+			return write, read
+		}
+		lockedWrite, lockedRead := keysOf()
+		if sameKeys(write, lockedWrite) && sameKeys(read, lockedRead) {
+			return write, read
+		}
+		db.RWULocks(write, read)
+	}
 }
 
-/* ------- 数据库操作 --------- */
-
-// RWLocks 对读写key上锁
-func (db *DB) RWLocks(write []string, read []string) {
-	db.locker.RWLocks(write, read)
+// sameKeys 判断两组key是否完全一致（包括顺序）
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // RWULocks 解锁
@@ -204,28 +291,57 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 		return nil, false
 	}
 	entity, _ := val.(*database.DataEntity)
+	touchEntity(entity)
+	db.recordAccess(key)
+	return entity, true
+}
+
+// getRawEntity 返回指定key的数据实例，不检查过期，也不更新访问时间
+func (db *DB) getRawEntity(key string) (*database.DataEntity, bool) {
+	val, ok := db.data.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entity, _ := val.(*database.DataEntity)
 	return entity, true
 }
 
 // PutEntity a DataEntity into DB
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	replaced, _ := db.getRawEntity(key)
+	result := db.data.Put(key, entity)
+	db.trackEntity(key, entity, replaced)
+	return result
 }
 
 // PutIfExists edit an existing DataEntity
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	replaced, _ := db.getRawEntity(key)
+	result := db.data.PutIfExists(key, entity)
+	if result > 0 {
+		db.trackEntity(key, entity, replaced)
+	}
+	return result
 }
 
 // PutIfAbsent insert an DataEntity only if the key not exists
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.trackEntity(key, entity, nil)
+	}
+	return result
 }
 
 // Remove 移除指定key
 func (db *DB) Remove(key string) {
-	db.data.Remove(key)
+	// 过期的key可能被多个读命令同时删除，只有真正删除了key的一方更新内存统计
+	entity, _ := db.getRawEntity(key)
+	if db.data.Remove(key) > 0 && entity != nil {
+		db.untrackEntity(entity)
+	}
 	db.ttlMap.Remove(key)
+	db.removeFromIndexes(key)
 	// TODO 原子事务实现
 }
 
@@ -249,27 +365,34 @@ func (db *DB) ForEach(cb func(key string, data *database.DataEntity, expiration
 
 /* ------- redis键值对版本控制 --------- */
 
-// addVersion 版本号自增
-func (db *DB) addVersion(keys ...string) {
+// addVersion 版本号自增，同时通知追踪了这些key的客户端。c 为修改key的客户端，可以为nil
+func (db *DB) addVersion(c redis.Connection, keys ...string) {
 	// 更新keys的版本号
 	for _, key := range keys {
-		version := db.GetVersion(key)
-		db.versionMap.Put(key, version+1)
+		version := db.GetVersion(key) + 1
+		db.versionMap.Put(key, version)
+		for {
+			max := atomic.LoadUint32(&db.maxVersion)
+			if version <= max || atomic.CompareAndSwapUint32(&db.maxVersion, max, version) {
+				break
+			}
+		}
 	}
+	db.tracking.invalidate(c, keys)
 }
 
 // GetVersion 返回给定key的版本号
 func (db *DB) GetVersion(key string) uint32 {
 	version, ok := db.versionMap.Get(key)
 	if !ok {
-		return 0
+		return db.versionBase
 	}
 	return version.(uint32)
 }
 
 /* ------- TTL功能 --------- */
 
-// IsExpired 判断当前key是否过期
+// IsExpired 判断当前key是否过期，过期的key被删除，同时通知追踪了该key的客户端
 func (db *DB) IsExpired(key string) bool {
 	rawExpiredTime, ok := db.ttlMap.Get(key)
 	if !ok {
@@ -280,6 +403,7 @@ func (db *DB) IsExpired(key string) bool {
 	expired := time.Now().After(expiredTime)
 	if expired {
 		db.Remove(key)
+		db.tracking.invalidate(nil, []string{key})
 	}
 	return expired
 }
@@ -300,3 +424,9 @@ func (db *DB) Persist(key string) {
 func genExpireTask(key string) string {
 	return "expire:" + key
 }
+
+// genTaskKey 生成时间轮任务的key
+// key中包含db实例的地址，避免aof重写时加载的临时数据库覆盖当前数据库的任务
+func (db *DB) genTaskKey(kind string, parts ...string) string {
+	return fmt.Sprintf("%s:%p:%s", kind, db, strings.Join(parts, ":"))
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/HildaM/GoKV/lib/utils"
 	"github.com/HildaM/GoKV/redis/protocol"
 	"strconv"
+	"strings"
 )
 
 // getAsSortedSet 获取跳表数据
@@ -95,6 +96,118 @@ func undoZAdd(db *DB, args [][]byte) []CmdLine {
 	return rollbackZSetFields(db, key, fields...)
 }
 
+// zrem key member [member ...]，zset为空时删除key
+func execZRem(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return protocol.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		if sortedSet.Remove(string(field)) {
+			deleted++
+		}
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("zrem", args...))
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+func undoZRem(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	for i, field := range args[1:] {
+		fields[i] = string(field)
+	}
+	return rollbackZSetFields(db, key, fields...)
+}
+
+// zscore key member
+func execZScore(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	element, exists := sortedSet.Get(string(args[1]))
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeDoubleReply(element.Score)
+}
+
+// zrange key start stop [REV] [WITHSCORES]，start和stop为排名，支持负数
+func execZRange(db *DB, args [][]byte) redis.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	desc, withScores := false, false
+	for _, arg := range args[3:] {
+		switch strings.ToLower(string(arg)) {
+		case "rev":
+			desc = true
+		case "withscores":
+			withScores = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	// 负数表示倒数第几个，转换为 [start, stop) 区间
+	size := sortedSet.Len()
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+
+	elements := sortedSet.Range(start, stop+1, desc)
+	members := make([][]byte, len(elements))
+	scores := make([]float64, len(elements))
+	for i, element := range elements {
+		members[i] = []byte(element.Member)
+		scores[i] = element.Score
+	}
+	if withScores {
+		return protocol.MakeScoredMembersReply(members, scores)
+	}
+	return protocol.MakeMultiBulkReply(members)
+}
+
 func init() {
 	RegisterCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4, flagWrite)
+	RegisterCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3, flagWrite)
+	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3, flagReadOnly)
+	RegisterCommand("ZRange", execZRange, readFirstKey, nil, -4, flagReadOnly)
 }
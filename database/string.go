@@ -157,16 +157,14 @@ func prepareMSet(args [][]byte) ([]string, []string) {
 	n := len(args) / 2
 	keys := make([]string, n)
 	for i := 0; i < n; i++ {
-		keys = append(keys, string(args[2*i]))
+		keys[i] = string(args[2*i])
 	}
 	return keys, nil
 }
 
-// TODO undoMSet
 func undoMSet(db *DB, args [][]byte) []CmdLine {
-	//writeKeys, _ := prepareMSet(args)
-	//return rollbackGivenKeys(db, writeKeys...)
-	return nil
+	writeKeys, _ := prepareMSet(args)
+	return rollbackGivenKeys(db, writeKeys...)
 }
 
 // execMSetNX 只有当这组key都不存在的时候，才能添加成功
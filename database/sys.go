@@ -1,8 +1,14 @@
 package database
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/HildaM/GoKV/config"
 	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/lib/wildcard"
+	"github.com/HildaM/GoKV/pubsub"
 	"github.com/HildaM/GoKV/redis/protocol"
 )
 
@@ -29,6 +35,138 @@ func Auth(c redis.Connection, args [][]byte) redis.Reply {
 	return &protocol.OkReply{}
 }
 
+// serverVersion HELLO 返回的服务器版本
+const serverVersion = "7.0.0"
+
+// Hello HELLO [protover [AUTH username password] [SETNAME clientname]]
+// 切换连接的协议版本，同时可以完成认证和设置客户端名称
+func Hello(c redis.Connection, args [][]byte) redis.Reply {
+	version := c.GetProtocol()
+	if len(args) > 0 {
+		v, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return protocol.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if v != protocol.RESP2 && v != protocol.RESP3 {
+			return protocol.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		version = v
+	}
+
+	var password, name string
+	var hasAuth, hasName bool
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			if i+2 >= len(args) {
+				return protocol.MakeErrReply("ERR Syntax error in HELLO option 'auth'")
+			}
+			// 没有ACL，用户名只能是default
+			if string(args[i+1]) != "default" {
+				return protocol.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			password = string(args[i+2])
+			hasAuth = true
+			i += 2
+		case "setname":
+			if i+1 >= len(args) {
+				return protocol.MakeErrReply("ERR Syntax error in HELLO option 'setname'")
+			}
+			name = string(args[i+1])
+			if errReply := checkClientName(name); errReply != nil {
+				return errReply
+			}
+			hasName = true
+			i++
+		default:
+			return protocol.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+
+	// 认证失败时不修改连接的任何状态
+	if hasAuth {
+		if config.Properties.RequirePass == "" || config.Properties.RequirePass != password {
+			return protocol.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+		}
+		c.SetPassword(password)
+	}
+	if !isAuthenticated(c) {
+		return protocol.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if hasName {
+		c.SetName(name)
+	}
+	c.SetProtocol(version)
+
+	reply := protocol.MakeMapReply(nil, nil)
+	reply.Add(protocol.MakeBulkReply([]byte("server")), protocol.MakeBulkReply([]byte("redis")))
+	reply.Add(protocol.MakeBulkReply([]byte("version")), protocol.MakeBulkReply([]byte(serverVersion)))
+	reply.Add(protocol.MakeBulkReply([]byte("proto")), protocol.MakeIntReply(int64(version)))
+	reply.Add(protocol.MakeBulkReply([]byte("id")), protocol.MakeIntReply(int64(c.GetID())))
+	reply.Add(protocol.MakeBulkReply([]byte("mode")), protocol.MakeBulkReply([]byte("standalone")))
+	reply.Add(protocol.MakeBulkReply([]byte("role")), protocol.MakeBulkReply([]byte("master")))
+	reply.Add(protocol.MakeBulkReply([]byte("modules")), protocol.MakeEmptyMultiBulkReply())
+	return reply
+}
+
+// execQuit QUIT 回复OK之后关闭连接
+func execQuit(c redis.Connection) redis.Reply {
+	c.CloseAfterReply()
+	return protocol.MakeOkReply()
+}
+
+// execReset RESET 将连接恢复到刚建立时的状态：
+// 放弃事务和WATCH、取消所有订阅、关闭客户端缓存追踪、恢复RESP2、选择0号db、取消认证、恢复 CLIENT REPLY 和 NO-EVICT，客户端名称保持不变
+func execReset(mdb *MultiDB, c redis.Connection) redis.Reply {
+	c.ClearQueuedCmds()
+	c.SetMultiState(false)
+	pubsub.UnsubscribeAll(mdb.hub, c)
+	mdb.tracking.disable(c)
+	c.SetProtocol(protocol.RESP2)
+	c.SelectDB(0)
+	c.SetReplyMode(redis.ReplyOn)
+	c.SetNoEvict(false)
+	c.SetPassword("")
+	return protocol.MakeStatusReply("RESET")
+}
+
+var configHelp = []string{
+	"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET <pattern>",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"HELP",
+	"    Print this help.",
+}
+
+// execConfig CONFIG GET pattern [pattern ...]
+func execConfig(args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("config")
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "help":
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(configHelp...))
+	case "get":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrReply("config|get")
+		}
+		names, values := config.Properties.Lookup(func(name string) bool {
+			for _, pattern := range args[1:] {
+				if wildcard.Match(strings.ToLower(string(pattern)), name) {
+					return true
+				}
+			}
+			return false
+		})
+		reply := protocol.MakeMapReply(nil, nil)
+		for i, name := range names {
+			reply.Add(protocol.MakeBulkReply([]byte(name)), protocol.MakeBulkReply([]byte(values[i])))
+		}
+		return reply
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CONFIG HELP.")
+}
+
 // isAuthenticated 确认是否认证通过
 func isAuthenticated(c redis.Connection) bool {
 	if config.Properties.RequirePass == "" {
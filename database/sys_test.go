@@ -0,0 +1,148 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// writeReply 执行命令，并按照连接当前的协议版本序列化回复
+func writeReply(mdb *MultiDB, conn *connection.FakeConn, args ...string) string {
+	result := mdb.Exec(conn, utils.ToCmdLine(args...))
+	conn.Clean()
+	_ = conn.WriteReply(result)
+	return string(conn.Bytes())
+}
+
+func TestHello(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	if conn.GetProtocol() != protocol.RESP2 {
+		t.Fatalf("default protocol should be RESP2, actual %d", conn.GetProtocol())
+	}
+
+	result := writeReply(mdb, conn, "hello", "3")
+	if !strings.HasPrefix(result, "%7\r\n$6\r\nserver\r\n") || !strings.Contains(result, "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("unexpected HELLO 3 reply %q", result)
+	}
+	if conn.GetProtocol() != protocol.RESP3 {
+		t.Errorf("expected RESP3, actual %d", conn.GetProtocol())
+	}
+	// 不带版本号时保持当前版本
+	if result = writeReply(mdb, conn, "hello"); !strings.Contains(result, "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("HELLO without version should keep RESP3, actual %q", result)
+	}
+
+	result = writeReply(mdb, conn, "hello", "2")
+	if !strings.HasPrefix(result, "*14\r\n$6\r\nserver\r\n") || !strings.Contains(result, "$5\r\nproto\r\n:2\r\n") {
+		t.Errorf("unexpected HELLO 2 reply %q", result)
+	}
+	if conn.GetProtocol() != protocol.RESP2 {
+		t.Errorf("expected RESP2, actual %d", conn.GetProtocol())
+	}
+
+	for _, c := range []replyCase{
+		{[]string{"hello", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+		{[]string{"hello", "1"}, "-NOPROTO unsupported protocol version\r\n"},
+		{[]string{"hello", "three"}, "-ERR Protocol version is not an integer or out of range\r\n"},
+		{[]string{"hello", "3", "foo"}, "-ERR Syntax error in HELLO option 'foo'\r\n"},
+	} {
+		if actual := writeReply(mdb, conn, c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+	if conn.GetProtocol() != protocol.RESP2 {
+		t.Errorf("failed HELLO should not change protocol, actual %d", conn.GetProtocol())
+	}
+}
+
+func TestHelloAuth(t *testing.T) {
+	requirePass := config.Properties.RequirePass
+	config.Properties.RequirePass = "secret"
+	defer func() {
+		config.Properties.RequirePass = requirePass
+	}()
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+
+	wrongPass := "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+	for _, c := range []replyCase{
+		{[]string{"hello", "3", "auth", "default", "wrong"}, wrongPass},
+		{[]string{"hello", "3", "auth", "admin", "secret"}, wrongPass},
+		{[]string{"hello", "3", "auth", "default"}, "-ERR Syntax error in HELLO option 'auth'\r\n"},
+	} {
+		if actual := writeReply(mdb, conn, c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+	if result := writeReply(mdb, conn, "hello", "3"); !strings.HasPrefix(result, "-NOAUTH") {
+		t.Errorf("expected NOAUTH, actual %q", result)
+	}
+	if conn.GetProtocol() != protocol.RESP2 || conn.GetPassword() != "" {
+		t.Fatal("failed HELLO should not change connection state")
+	}
+
+	result := writeReply(mdb, conn, "hello", "3", "auth", "default", "secret", "setname", "app")
+	if !strings.HasPrefix(result, "%7\r\n") {
+		t.Errorf("unexpected reply %q", result)
+	}
+	if conn.GetProtocol() != protocol.RESP3 || conn.GetName() != "app" {
+		t.Errorf("expected RESP3 client 'app', actual %d %q", conn.GetProtocol(), conn.GetName())
+	}
+	if result = writeReply(mdb, conn, "set", "a", "1"); result != "+OK\r\n" {
+		t.Errorf("expected authenticated, actual %q", result)
+	}
+}
+
+func TestResp3Replies(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := &connection.FakeConn{}
+	mdb.Exec(conn, utils.ToCmdLine("hset", "h", "f", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("zadd", "z", "1.5", "m"))
+
+	cases := []struct {
+		args  []string
+		resp2 string
+		resp3 string
+	}{
+		{[]string{"hgetall", "h"}, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"hgetall", "none"}, "*0\r\n", "%0\r\n"},
+		{[]string{"zscore", "z", "m"}, "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{[]string{"zrange", "z", "0", "-1", "withscores"}, "*2\r\n$1\r\nm\r\n$3\r\n1.5\r\n", "*1\r\n*2\r\n$1\r\nm\r\n,1.5\r\n"},
+		{[]string{"get", "none"}, "$-1\r\n", "_\r\n"},
+	}
+	// 同一个连接切换协议后，回复的格式随之改变
+	for _, version := range []string{"2", "3", "2"} {
+		mdb.Exec(conn, utils.ToCmdLine("hello", version))
+		for _, c := range cases {
+			expected := c.resp2
+			if version == "3" {
+				expected = c.resp3
+			}
+			if actual := writeReply(mdb, conn, c.args...); actual != expected {
+				t.Errorf("RESP%s %v: expected %q, actual %q", version, c.args, expected, actual)
+			}
+		}
+	}
+
+	// 数据库命令中没有返回set的，直接检查序列化结果
+	set := protocol.MakeSetReply(utils.ToCmdLine("a", "b"))
+	for _, c := range []struct {
+		version  int
+		expected string
+	}{
+		{protocol.RESP2, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{protocol.RESP3, "~2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+	} {
+		conn.SetProtocol(c.version)
+		conn.Clean()
+		_ = conn.WriteReply(set)
+		if actual := string(conn.Bytes()); actual != c.expected {
+			t.Errorf("RESP%d set: expected %q, actual %q", c.version, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"time"
+
+	"github.com/HildaM/GoKV/datastruct/lease"
+	"github.com/HildaM/GoKV/datastruct/queue"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/lib/timewheel"
+)
+
+/*
+	时间轮中的定时任务：延时命令、锁的租约、时间序列的清理、队列消息的租约
+	aof重写使用的临时数据库只保存数据，不注册任务；主数据库加载aof期间同样不注册，
+	否则到期的任务会在aof写入尚未开启时执行，加载完成后再由 startTasks 统一注册
+*/
+
+// delayTask 向时间轮注册任务，未开启定时任务的db只保存数据，不注册任务
+func (db *DB) delayTask(delay time.Duration, taskKey string, job func()) {
+	if !db.tasksEnabled {
+		return
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	timewheel.Delay(delay, taskKey, job)
+}
+
+// startTasks 加载aof完成后开启定时任务，为已经加载的延时命令、锁的租约、时间序列的清理、队列消息的租约注册任务
+func (db *DB) startTasks() {
+	db.tasksEnabled = true
+	for _, job := range db.schedules.sortedJobs() {
+		db.scheduleJob(job)
+	}
+	db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+		switch val := entity.Data.(type) {
+		case *lease.Lease:
+			db.scheduleLeaseExpire(key, val)
+		case *timeseries.TimeSeries:
+			db.scheduleTsTrim(key, val)
+		case *queue.Queue:
+			val.ForEach(func(msg queue.Message) bool {
+				if msg.Leased() {
+					db.scheduleLease(key, val, msg.ID, msg.Deadline)
+				}
+				return true
+			})
+		}
+		return true
+	})
+}
+
+// cancelTasks 取消key在时间轮中的定时任务：锁的租约、时间序列的清理、队列消息的租约
+func (db *DB) cancelTasks(key string, entity *database.DataEntity) {
+	switch val := entity.Data.(type) {
+	case *lease.Lease:
+		timewheel.Cancel(db.genTaskKey("lock", key))
+	case *timeseries.TimeSeries:
+		timewheel.Cancel(db.genTaskKey("ts", key))
+	case *queue.Queue:
+		val.ForEach(func(msg queue.Message) bool {
+			if msg.Leased() {
+				db.cancelLease(key, msg.ID)
+			}
+			return true
+		})
+	}
+}
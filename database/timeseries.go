@@ -0,0 +1,705 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HildaM/GoKV/aof"
+	"github.com/HildaM/GoKV/datastruct/timeseries"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	时间序列命令：TS.CREATE TS.ADD TS.MADD TS.INCRBY TS.RANGE TS.MRANGE TS.CREATERULE ...
+*/
+
+// getAsTimeSeries 获取时间序列数据
+func (db *DB) getAsTimeSeries(key string) (*timeseries.TimeSeries, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	series, ok := entity.Data.(*timeseries.TimeSeries)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return series, nil
+}
+
+// tsOptions TS.CREATE / TS.ADD 共用的可选参数
+type tsOptions struct {
+	retention   int64
+	labels      map[string]string
+	policy      string // DUPLICATE_POLICY：序列默认策略
+	onDuplicate string // ON_DUPLICATE：仅本次写入生效
+	timestamp   string // TIMESTAMP：TS.INCRBY 使用
+}
+
+// parseTsOptions 解析可选参数
+func parseTsOptions(args [][]byte) (*tsOptions, protocol.ErrorReply) {
+	opts := &tsOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "RETENTION":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			retention, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || retention < 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: invalid retention value")
+			}
+			opts.retention = retention
+			i++
+		case "DUPLICATE_POLICY", "ON_DUPLICATE":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			policy := strings.ToLower(string(args[i+1]))
+			if !timeseries.IsValidPolicy(policy) {
+				return nil, protocol.MakeErrReply("ERR TSDB: unknown duplicate policy")
+			}
+			if arg == "DUPLICATE_POLICY" {
+				opts.policy = policy
+			} else {
+				opts.onDuplicate = policy
+			}
+			i++
+		case "TIMESTAMP":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.timestamp = string(args[i+1])
+			i++
+		case "LABELS":
+			rest := args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: invalid labels")
+			}
+			opts.labels = make(map[string]string, len(rest)/2)
+			for j := 0; j+1 < len(rest); j += 2 {
+				opts.labels[string(rest[j])] = string(rest[j+1])
+			}
+			i = len(args)
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// parseTsTimestamp 解析写入时间戳，* 表示当前时间
+func parseTsTimestamp(raw string) (int64, protocol.ErrorReply) {
+	if raw == "*" || raw == "" {
+		return time.Now().UnixMilli(), nil
+	}
+	timestamp, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || timestamp < 0 {
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid timestamp")
+	}
+	return timestamp, nil
+}
+
+// parseTsRangeBorder 解析范围边界，- 和 + 分别表示最小、最大时间戳
+func parseTsRangeBorder(raw string) (int64, protocol.ErrorReply) {
+	switch raw {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	timestamp, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, protocol.MakeErrReply("ERR TSDB: invalid timestamp")
+	}
+	return timestamp, nil
+}
+
+func formatTsValue(value float64) []byte {
+	return []byte(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// createTimeSeries 按照选项创建时间序列，并放入数据库
+func (db *DB) createTimeSeries(key string, opts *tsOptions) *timeseries.TimeSeries {
+	series := timeseries.Make(opts.retention, opts.labels, opts.policy)
+	db.PutEntity(key, &database.DataEntity{Data: series})
+	return series
+}
+
+/* ---- 保留时长 ---- */
+
+// scheduleTsTrim 在最旧样本过期时，通过时间轮触发一次清理
+func (db *DB) scheduleTsTrim(key string, series *timeseries.TimeSeries) {
+	if series.Retention() <= 0 {
+		return
+	}
+	first, ok := series.First()
+	if !ok {
+		return
+	}
+	delay := time.Until(time.UnixMilli(first.Timestamp + series.Retention()))
+	db.delayTask(delay, db.genTaskKey("ts", key), func() {
+		db.trimTimeSeries(key, series)
+	})
+}
+
+// trimTimeSeries 删除超出保留时长的样本，然后为下一个最旧样本安排清理
+func (db *DB) trimTimeSeries(key string, series *timeseries.TimeSeries) {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWULocks([]string{key}, nil)
+
+	current, errReply := db.getAsTimeSeries(key)
+	if errReply != nil || current != series {
+		return // key已经被删除或者覆盖
+	}
+	series.Trim(time.Now().UnixMilli() - series.Retention())
+	db.scheduleTsTrim(key, series)
+}
+
+// visibleRange 将查询范围收缩到保留时长之内
+func visibleRange(series *timeseries.TimeSeries, from, to int64) []timeseries.Sample {
+	if series.Retention() > 0 {
+		minTimestamp := time.Now().UnixMilli() - series.Retention()
+		if from < minTimestamp {
+			from = minTimestamp
+		}
+	}
+	return series.Range(from, to)
+}
+
+// addTsSample 写入样本，同时执行降采样规则并安排保留时长清理
+func (db *DB) addTsSample(key string, series *timeseries.TimeSeries, timestamp int64, value float64, policy string) (float64, error) {
+	first, hasFirst := series.First()
+	result, err := series.Add(timestamp, value, policy)
+	if err != nil {
+		return 0, err
+	}
+	if !hasFirst || timestamp < first.Timestamp {
+		db.scheduleTsTrim(key, series)
+	}
+
+	for _, rule := range series.Rules() {
+		dest, errReply := db.getAsTimeSeries(rule.DestKey)
+		if errReply != nil || dest == nil {
+			continue
+		}
+		destFirst, destHasFirst := dest.First()
+		series.Compact(rule, timestamp, dest)
+		bucketStart := timeseries.BucketStart(timestamp, rule.Bucket)
+		if !destHasFirst || bucketStart < destFirst.Timestamp {
+			db.scheduleTsTrim(rule.DestKey, dest)
+		}
+	}
+	return result, nil
+}
+
+/* ---- 写入命令 ---- */
+
+// execTsCreate TS.CREATE key [RETENTION ms] [DUPLICATE_POLICY policy] [LABELS label value ...]
+func execTsCreate(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR TSDB: key already exists")
+	}
+	opts, errReply := parseTsOptions(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	db.createTimeSeries(key, opts)
+	db.addAof(utils.ToCmdLine3("ts.create", args...))
+	return protocol.MakeOkReply()
+}
+
+// execTsAdd TS.ADD key timestamp value [RETENTION ms] [ON_DUPLICATE policy] [LABELS ...]
+// key不存在时按照可选参数自动创建
+func execTsAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	timestamp, errReply := parseTsTimestamp(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	value, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR TSDB: invalid value")
+	}
+	opts, errReply := parseTsOptions(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+
+	series, errReply := db.getAsTimeSeries(key)
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		series = db.createTimeSeries(key, opts)
+	}
+	if _, err = db.addTsSample(key, series, timestamp, value, opts.onDuplicate); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+
+	// aof 中写入实际时间戳，避免重放时 * 被解析为加载时间
+	tsBytes := []byte(strconv.FormatInt(timestamp, 10))
+	db.addAof(utils.ToCmdLine3("ts.add", append([][]byte{args[0], tsBytes}, args[2:]...)...))
+	return protocol.MakeIntReply(timestamp)
+}
+
+// execTsMAdd TS.MADD key timestamp value [key timestamp value ...]
+func execTsMAdd(db *DB, args [][]byte) redis.Reply {
+	if len(args)%3 != 0 {
+		return protocol.MakeArgNumErrReply("ts.madd")
+	}
+
+	replies := make([]redis.Reply, 0, len(args)/3)
+	aofArgs := make([][]byte, 0, len(args))
+	for i := 0; i+2 < len(args); i += 3 {
+		key := string(args[i])
+		series, errReply := db.getAsTimeSeries(key)
+		if errReply == nil && series == nil {
+			errReply = protocol.MakeErrReply("ERR TSDB: the key does not exist")
+		}
+		if errReply != nil {
+			replies = append(replies, errReply)
+			continue
+		}
+		timestamp, errReply := parseTsTimestamp(string(args[i+1]))
+		if errReply != nil {
+			replies = append(replies, errReply)
+			continue
+		}
+		value, err := strconv.ParseFloat(string(args[i+2]), 64)
+		if err != nil {
+			replies = append(replies, protocol.MakeErrReply("ERR TSDB: invalid value"))
+			continue
+		}
+		if _, err = db.addTsSample(key, series, timestamp, value, ""); err != nil {
+			replies = append(replies, protocol.MakeErrReply(err.Error()))
+			continue
+		}
+		replies = append(replies, protocol.MakeIntReply(timestamp))
+		aofArgs = append(aofArgs, args[i], []byte(strconv.FormatInt(timestamp, 10)), args[i+2])
+	}
+
+	if len(aofArgs) > 0 {
+		db.addAof(utils.ToCmdLine3("ts.madd", aofArgs...))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func prepareTsMAdd(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// execTsIncrBy TS.INCRBY key value [TIMESTAMP ts] [RETENTION ms] [LABELS ...]
+func execTsIncrBy(db *DB, args [][]byte) redis.Reply {
+	return tsIncrBy(db, args, 1)
+}
+
+// execTsDecrBy TS.DECRBY key value [TIMESTAMP ts] [RETENTION ms] [LABELS ...]
+func execTsDecrBy(db *DB, args [][]byte) redis.Reply {
+	return tsIncrBy(db, args, -1)
+}
+
+func tsIncrBy(db *DB, args [][]byte, sign float64) redis.Reply {
+	key := string(args[0])
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR TSDB: invalid value")
+	}
+	opts, errReply := parseTsOptions(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	timestamp, errReply := parseTsTimestamp(opts.timestamp)
+	if errReply != nil {
+		return errReply
+	}
+
+	series, errReply := db.getAsTimeSeries(key)
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		series = db.createTimeSeries(key, opts)
+		db.addAof(aof.MakeTsCreateCmd(key, series).Args)
+	}
+
+	// 只允许在最新样本上累加
+	value := sign * delta
+	if last, ok := series.Last(); ok {
+		if timestamp < last.Timestamp {
+			return protocol.MakeErrReply("ERR TSDB: timestamp must be equal to or higher than the maxLastTimestamp")
+		}
+		value += last.Value
+	}
+	if _, err = db.addTsSample(key, series, timestamp, value, timeseries.PolicyLast); err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+
+	db.addAof(utils.ToCmdLine("ts.add", key, strconv.FormatInt(timestamp, 10),
+		string(formatTsValue(value)), "ON_DUPLICATE", timeseries.PolicyLast))
+	return protocol.MakeIntReply(timestamp)
+}
+
+// execTsCreateRule TS.CREATERULE sourceKey destKey AGGREGATION aggregator bucketDuration
+func execTsCreateRule(db *DB, args [][]byte) redis.Reply {
+	srcKey, destKey := string(args[0]), string(args[1])
+	if strings.ToUpper(string(args[2])) != "AGGREGATION" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	agg := strings.ToLower(string(args[3]))
+	if !timeseries.IsValidAggregation(agg) {
+		return protocol.MakeErrReply("ERR TSDB: unknown aggregation type")
+	}
+	bucket, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil || bucket <= 0 {
+		return protocol.MakeErrReply("ERR TSDB: invalid bucket duration")
+	}
+	if srcKey == destKey {
+		return protocol.MakeErrReply("ERR TSDB: the source key and destination key should be different")
+	}
+
+	src, errReply := db.getAsTimeSeries(srcKey)
+	if errReply != nil {
+		return errReply
+	}
+	dest, errReply := db.getAsTimeSeries(destKey)
+	if errReply != nil {
+		return errReply
+	}
+	if src == nil || dest == nil {
+		return protocol.MakeErrReply("ERR TSDB: the key does not exist")
+	}
+	if dest.SourceKey() != "" {
+		return protocol.MakeErrReply("ERR TSDB: the destination key already has a src rule")
+	}
+	if src.SourceKey() != "" {
+		return protocol.MakeErrReply("ERR TSDB: the source key already has a src rule")
+	}
+	if !src.AddRule(&timeseries.Rule{DestKey: destKey, Aggregation: agg, Bucket: bucket}) {
+		return protocol.MakeErrReply("ERR TSDB: the rule already exists")
+	}
+	dest.SetSourceKey(srcKey)
+
+	db.addAof(utils.ToCmdLine3("ts.createrule", args...))
+	return protocol.MakeOkReply()
+}
+
+// execTsDeleteRule TS.DELETERULE sourceKey destKey
+func execTsDeleteRule(db *DB, args [][]byte) redis.Reply {
+	srcKey, destKey := string(args[0]), string(args[1])
+	src, errReply := db.getAsTimeSeries(srcKey)
+	if errReply != nil {
+		return errReply
+	}
+	if src == nil || !src.RemoveRule(destKey) {
+		return protocol.MakeErrReply("ERR TSDB: compaction rule does not exist")
+	}
+	if dest, _ := db.getAsTimeSeries(destKey); dest != nil {
+		dest.SetSourceKey("")
+	}
+
+	db.addAof(utils.ToCmdLine3("ts.deleterule", args...))
+	return protocol.MakeOkReply()
+}
+
+func prepareTsRule(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// tsCompactionKeys 写入样本时会同时写入降采样规则的目标序列，需要和源序列一起加写锁
+// 规则只在持有源序列写锁时修改，因此源序列上锁后结果不变
+func tsCompactionKeys(db *DB, keys []string) []string {
+	var destKeys []string
+	for _, key := range keys {
+		entity, ok := db.getRawEntity(key)
+		if !ok {
+			continue
+		}
+		if series, ok := entity.Data.(*timeseries.TimeSeries); ok {
+			for _, rule := range series.Rules() {
+				destKeys = append(destKeys, rule.DestKey)
+			}
+		}
+	}
+	return destKeys
+}
+
+func dynPrepareTsWrite(db *DB, args [][]byte) []string {
+	return tsCompactionKeys(db, []string{string(args[0])})
+}
+
+func dynPrepareTsMAdd(db *DB, args [][]byte) []string {
+	keys, _ := prepareTsMAdd(args)
+	return tsCompactionKeys(db, keys)
+}
+
+/* ---- 回滚 ---- */
+
+// tsRelatedKeys 返回与key存在降采样规则关联的全部key
+// 还原源序列时会重建它的所有规则，因此目标序列也需要一起还原；目标序列则需要连同它的源序列一起还原
+func (db *DB) tsRelatedKeys(key string) []string {
+	series, _ := db.getAsTimeSeries(key)
+	if series == nil {
+		return []string{key}
+	}
+	if src := series.SourceKey(); src != "" {
+		if srcSeries, _ := db.getAsTimeSeries(src); srcSeries != nil {
+			key, series = src, srcSeries
+		}
+	}
+	keys := []string{key}
+	for _, rule := range series.Rules() {
+		keys = append(keys, rule.DestKey)
+	}
+	return keys
+}
+
+// rollbackTsKeys 还原时间序列以及与其关联的序列
+func rollbackTsKeys(db *DB, keys ...string) []CmdLine {
+	related := make([]string, 0, len(keys))
+	for _, key := range keys {
+		related = append(related, db.tsRelatedKeys(key)...)
+	}
+	return rollbackGivenKeys(db, related...)
+}
+
+func undoTsWrite(db *DB, args [][]byte) []CmdLine {
+	return rollbackTsKeys(db, string(args[0]))
+}
+
+func undoTsMAdd(db *DB, args [][]byte) []CmdLine {
+	keys, _ := prepareTsMAdd(args)
+	return rollbackTsKeys(db, keys...)
+}
+
+func undoTsRule(db *DB, args [][]byte) []CmdLine {
+	return rollbackTsKeys(db, string(args[0]), string(args[1]))
+}
+
+/* ---- 查询命令 ---- */
+
+// tsRangeOptions TS.RANGE / TS.MRANGE 的查询参数
+type tsRangeOptions struct {
+	from, to   int64
+	count      int64 // <0 表示不限制
+	agg        string
+	bucket     int64
+	withLabels bool
+	filters    []*timeseries.Filter
+}
+
+// parseTsRangeOptions 解析 from to [COUNT n] [AGGREGATION agg bucket] [WITHLABELS] [FILTER ...]
+func parseTsRangeOptions(args [][]byte, multi bool) (*tsRangeOptions, protocol.ErrorReply) {
+	opts := &tsRangeOptions{count: -1}
+	var errReply protocol.ErrorReply
+	if opts.from, errReply = parseTsRangeBorder(string(args[0])); errReply != nil {
+		return nil, errReply
+	}
+	if opts.to, errReply = parseTsRangeBorder(string(args[1])); errReply != nil {
+		return nil, errReply
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || count < 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: invalid count")
+			}
+			opts.count = count
+			i++
+		case "AGGREGATION":
+			if i+2 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.agg = strings.ToLower(string(args[i+1]))
+			if !timeseries.IsValidAggregation(opts.agg) {
+				return nil, protocol.MakeErrReply("ERR TSDB: unknown aggregation type")
+			}
+			bucket, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil || bucket <= 0 {
+				return nil, protocol.MakeErrReply("ERR TSDB: invalid bucket duration")
+			}
+			opts.bucket = bucket
+			i += 2
+		case "WITHLABELS":
+			if !multi {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.withLabels = true
+		case "FILTER":
+			if !multi {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			for _, raw := range args[i+1:] {
+				filter, err := timeseries.ParseFilter(string(raw))
+				if err != nil {
+					return nil, protocol.MakeErrReply(err.Error())
+				}
+				opts.filters = append(opts.filters, filter)
+			}
+			i = len(args)
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	if multi && len(opts.filters) == 0 {
+		return nil, protocol.MakeErrReply("ERR TSDB: missing FILTER argument")
+	}
+	return opts, nil
+}
+
+// querySeries 按查询参数获取样本：先聚合，再按方向截取 count 个
+func querySeries(series *timeseries.TimeSeries, opts *tsRangeOptions, desc bool) []timeseries.Sample {
+	samples := visibleRange(series, opts.from, opts.to)
+	if opts.agg != "" {
+		samples = timeseries.Downsample(samples, opts.agg, opts.bucket)
+	}
+	if desc {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if opts.count >= 0 && int64(len(samples)) > opts.count {
+		samples = samples[:opts.count]
+	}
+	return samples
+}
+
+func makeSamplesReply(samples []timeseries.Sample) redis.Reply {
+	replies := make([]redis.Reply, len(samples))
+	for i, s := range samples {
+		replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(s.Timestamp),
+			protocol.MakeBulkReply(formatTsValue(s.Value)),
+		})
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTsRange TS.RANGE key from to [COUNT n] [AGGREGATION agg bucket]
+func execTsRange(db *DB, args [][]byte) redis.Reply {
+	return tsRange(db, args, false)
+}
+
+// execTsRevRange TS.REVRANGE key from to [COUNT n] [AGGREGATION agg bucket]
+func execTsRevRange(db *DB, args [][]byte) redis.Reply {
+	return tsRange(db, args, true)
+}
+
+func tsRange(db *DB, args [][]byte, desc bool) redis.Reply {
+	series, errReply := db.getAsTimeSeries(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		return protocol.MakeErrReply("ERR TSDB: the key does not exist")
+	}
+	opts, errReply := parseTsRangeOptions(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	return makeSamplesReply(querySeries(series, opts, desc))
+}
+
+// execTsMRange TS.MRANGE from to [COUNT n] [AGGREGATION agg bucket] [WITHLABELS] FILTER filter...
+func execTsMRange(db *DB, args [][]byte) redis.Reply {
+	return tsMRange(db, args, false)
+}
+
+// execTsMRevRange TS.MREVRANGE from to [COUNT n] [AGGREGATION agg bucket] [WITHLABELS] FILTER filter...
+func execTsMRevRange(db *DB, args [][]byte) redis.Reply {
+	return tsMRange(db, args, true)
+}
+
+func tsMRange(db *DB, args [][]byte, desc bool) redis.Reply {
+	opts, errReply := parseTsRangeOptions(args, true)
+	if errReply != nil {
+		return errReply
+	}
+
+	// 找出所有标签匹配的序列
+	matched := make(map[string]*timeseries.TimeSeries)
+	keys := make([]string, 0)
+	db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+		series, ok := entity.Data.(*timeseries.TimeSeries)
+		if ok && series.MatchLabels(opts.filters) {
+			matched[key] = series
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+
+	replies := make([]redis.Reply, 0, len(keys))
+	for _, key := range keys {
+		series := matched[key]
+		labelReplies := make([]redis.Reply, 0)
+		if opts.withLabels {
+			labels := series.Labels()
+			for _, name := range series.SortedLabelNames() {
+				labelReplies = append(labelReplies, protocol.MakeMultiBulkReply(
+					[][]byte{[]byte(name), []byte(labels[name])}))
+			}
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			protocol.MakeMultiRawReply(labelReplies),
+			makeSamplesReply(querySeries(series, opts, desc)),
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execTsGet TS.GET key 返回最新样本
+func execTsGet(db *DB, args [][]byte) redis.Reply {
+	series, errReply := db.getAsTimeSeries(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if series == nil {
+		return protocol.MakeErrReply("ERR TSDB: the key does not exist")
+	}
+	samples := visibleRange(series, 0, math.MaxInt64)
+	if len(samples) == 0 {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	last := samples[len(samples)-1]
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(last.Timestamp),
+		protocol.MakeBulkReply(formatTsValue(last.Value)),
+	})
+}
+
+func init() {
+	RegisterCommand("TS.Create", execTsCreate, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	RegisterCommand("TS.Add", execTsAdd, writeFirstKey, undoTsWrite, -4, flagWrite)
+	RegisterCommand("TS.MAdd", execTsMAdd, prepareTsMAdd, undoTsMAdd, -4, flagWrite)
+	RegisterCommand("TS.IncrBy", execTsIncrBy, writeFirstKey, undoTsWrite, -3, flagWrite)
+	RegisterCommand("TS.DecrBy", execTsDecrBy, writeFirstKey, undoTsWrite, -3, flagWrite)
+	RegisterCommand("TS.CreateRule", execTsCreateRule, prepareTsRule, undoTsRule, 6, flagWrite)
+	RegisterCommand("TS.DeleteRule", execTsDeleteRule, prepareTsRule, undoTsRule, 3, flagWrite)
+	registerDynPrepare("TS.Add", dynPrepareTsWrite)
+	registerDynPrepare("TS.MAdd", dynPrepareTsMAdd)
+	registerDynPrepare("TS.IncrBy", dynPrepareTsWrite)
+	registerDynPrepare("TS.DecrBy", dynPrepareTsWrite)
+	RegisterCommand("TS.Range", execTsRange, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("TS.RevRange", execTsRevRange, readFirstKey, nil, -4, flagReadOnly)
+	RegisterCommand("TS.MRange", execTsMRange, noPrepare, nil, -5, flagReadOnly)
+	RegisterCommand("TS.MRevRange", execTsMRevRange, noPrepare, nil, -5, flagReadOnly)
+	RegisterCommand("TS.Get", execTsGet, readFirstKey, nil, 2, flagReadOnly)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+func TestTsAddLocksCompactionDest(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	for _, line := range [][]string{
+		{"ts.create", "src"},
+		{"ts.create", "dest"},
+		{"ts.createrule", "src", "dest", "AGGREGATION", "sum", "10"},
+	} {
+		if result := db.Exec(conn, utils.ToCmdLine(line...)); protocol.IsErrorReply(result) {
+			t.Fatalf("%v: %s", line, result.ToBytes())
+		}
+	}
+
+	for _, line := range [][]string{
+		{"ts.add", "src", "1", "1"},
+		{"ts.madd", "src", "2", "1"},
+		{"ts.incrby", "src", "1", "TIMESTAMP", "3"},
+	} {
+		write, _ := db.relatedKeys(cmdTable[line[0]], utils.ToCmdLine(line[1:]...))
+		if len(write) != 2 || write[0] != "src" || write[1] != "dest" {
+			t.Errorf("%v: expected write keys [src dest], actual %v", line, write)
+		}
+		version := db.GetVersion("dest")
+		if result := db.Exec(conn, utils.ToCmdLine(line...)); protocol.IsErrorReply(result) {
+			t.Fatalf("%v: %s", line, result.ToBytes())
+		}
+		if db.GetVersion("dest") == version {
+			t.Errorf("%v: version of dest not changed", line)
+		}
+	}
+
+	// WATCH 目标序列的事务能够发现降采样写入
+	watching := map[string]uint32{"dest": db.GetVersion("dest")}
+	db.Exec(conn, utils.ToCmdLine("ts.add", "src", "20", "1"))
+	result := db.ExecMulti(conn, watching, []CmdLine{utils.ToCmdLine("ts.get", "dest")})
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expected null multi bulk reply, actual %s", result.ToBytes())
+	}
+
+	// 事务中的 TS.ADD 同样对目标序列加锁
+	result = db.ExecMulti(conn, nil, []CmdLine{
+		utils.ToCmdLine("ts.add", "src", "30", "1"),
+		utils.ToCmdLine("ts.range", "dest", "-", "+"),
+	})
+	if protocol.IsErrorReply(result) {
+		t.Errorf("unexpected error: %s", result.ToBytes())
+	}
+}
@@ -0,0 +1,479 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	客户端缓存：CLIENT TRACKING ON|OFF [REDIRECT id] [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+	1. 默认模式下记录每个客户端读取过的key，key被修改时向读取过它的客户端发送一次失效消息，之后需要重新读取才会再次记录
+	2. BCAST 模式不记录读取的key，key被修改时通知所有前缀匹配的客户端，没有指定前缀时匹配所有key
+	3. OPTIN 模式只记录 CLIENT CACHING YES 之后的下一条命令读取的key，OPTOUT 模式不记录 CLIENT CACHING NO 之后的下一条命令
+	4. NOLOOP 模式下客户端自己修改的key不会通知自己
+	5. 失效消息 ["invalidate", [key ...]] 以RESP3 push类型发送给开启追踪的连接，key为nil时表示所有key失效（FLUSHDB、FLUSHALL）
+	   RESP2不能在请求和回复之间插入推送，只能通过 REDIRECT 以 __redis__:invalidate 频道消息发送给处于订阅模式的连接，否则不发送
+	6. 失效消息在修改key的命令持有的锁之外，由每个接收方各自的发送协程按顺序写出，写入较慢的客户端不会阻塞修改key的命令
+	追踪表不区分db，与redis一致
+*/
+
+// trackingChannel REDIRECT 到RESP2连接时，失效消息所在的频道
+const trackingChannel = "__redis__:invalidate"
+
+const (
+	cachingDefault = iota
+	cachingYes
+	cachingNo
+)
+
+// trackingClient 一个开启了追踪的客户端
+type trackingClient struct {
+	conn     redis.Connection // 关闭追踪后置为nil，追踪表中残留的记录随之失效
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+	redirect uint64 // 接收失效消息的连接id，0表示发送给自己
+	prefixes []string
+	caching  int // CLIENT CACHING 设置的状态，只对下一条命令有效
+}
+
+// pushQueue 一个连接等待发送的失效消息
+type pushQueue struct {
+	msgs [][]byte
+}
+
+// trackingTable 记录所有开启追踪的客户端以及它们读取过的key
+type trackingTable struct {
+	mu      sync.Mutex
+	clients map[redis.Connection]*trackingClient
+	// 默认模式：key --> 读取过该key的客户端
+	keys map[string]map[*trackingClient]struct{}
+	// BCAST模式：前缀 --> 订阅该前缀的客户端
+	prefixes map[string]map[*trackingClient]struct{}
+	// 开启追踪的客户端数量，没有客户端时读写命令不需要加锁
+	count int32
+
+	// 接收方 --> 等待发送的失效消息，存在时说明该接收方的发送协程正在运行
+	queueMu sync.Mutex
+	queues  map[redis.Connection]*pushQueue
+}
+
+func makeTrackingTable() *trackingTable {
+	return &trackingTable{
+		clients:  make(map[redis.Connection]*trackingClient),
+		keys:     make(map[string]map[*trackingClient]struct{}),
+		prefixes: make(map[string]map[*trackingClient]struct{}),
+		queues:   make(map[redis.Connection]*pushQueue),
+	}
+}
+
+// enabled 判断是否有客户端开启了追踪
+func (t *trackingTable) enabled() bool {
+	return t != nil && atomic.LoadInt32(&t.count) > 0
+}
+
+// enable 开启追踪，已经开启时只能追加前缀以及修改NOLOOP
+func (t *trackingTable) enable(c redis.Connection, options *trackingClient) protocol.ErrorReply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tc, ok := t.clients[c]
+	if ok {
+		if tc.bcast != options.bcast || tc.optIn != options.optIn || tc.optOut != options.optOut {
+			return protocol.MakeErrReply("ERR You can't switch BCAST mode on/off or OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		tc.noLoop = options.noLoop
+		tc.redirect = options.redirect
+	} else {
+		tc = options
+		tc.conn = c
+		t.clients[c] = tc
+		atomic.AddInt32(&t.count, 1)
+	}
+	if tc.bcast && len(options.prefixes) == 0 && len(tc.prefixes) == 0 {
+		options.prefixes = []string{""}
+	}
+	for _, prefix := range options.prefixes {
+		subscribers, ok := t.prefixes[prefix]
+		if !ok {
+			subscribers = make(map[*trackingClient]struct{})
+			t.prefixes[prefix] = subscribers
+		}
+		if _, ok := subscribers[tc]; !ok {
+			subscribers[tc] = struct{}{}
+			if tc != options {
+				tc.prefixes = append(tc.prefixes, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// disable 关闭追踪
+func (t *trackingTable) disable(c redis.Connection) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tc, ok := t.clients[c]
+	if !ok {
+		return
+	}
+	for _, prefix := range tc.prefixes {
+		subscribers := t.prefixes[prefix]
+		delete(subscribers, tc)
+		if len(subscribers) == 0 {
+			delete(t.prefixes, prefix)
+		}
+	}
+	tc.conn = nil
+	delete(t.clients, c)
+	if atomic.AddInt32(&t.count, -1) == 0 {
+		// 默认模式的记录只在key被修改时清理，没有客户端时一次性清空
+		t.keys = make(map[string]map[*trackingClient]struct{})
+	}
+}
+
+// info 返回客户端的追踪选项、重定向的连接id和前缀，没有开启追踪时返回false
+func (t *trackingTable) info(c redis.Connection) ([]string, uint64, []string, bool) {
+	if !t.enabled() {
+		return nil, 0, nil, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tc, ok := t.clients[c]
+	if !ok {
+		return nil, 0, nil, false
+	}
+	flags := []string{"on"}
+	if tc.redirect != 0 {
+		if _, ok := connection.Lookup(tc.redirect); !ok {
+			flags = append(flags, "broken_redirect")
+		}
+	}
+	if tc.bcast {
+		flags = append(flags, "bcast")
+	}
+	if tc.optIn {
+		flags = append(flags, "optin")
+	}
+	if tc.optOut {
+		flags = append(flags, "optout")
+	}
+	if tc.noLoop {
+		flags = append(flags, "noloop")
+	}
+	if tc.caching == cachingYes {
+		flags = append(flags, "caching-yes")
+	} else if tc.caching == cachingNo {
+		flags = append(flags, "caching-no")
+	}
+	prefixes := make([]string, len(tc.prefixes))
+	copy(prefixes, tc.prefixes)
+	return flags, tc.redirect, prefixes, true
+}
+
+// setCaching CLIENT CACHING YES|NO
+func (t *trackingTable) setCaching(c redis.Connection, yes bool) protocol.ErrorReply {
+	if t == nil {
+		return protocol.MakeErrReply("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tc, ok := t.clients[c]
+	if !ok || !(tc.optIn || tc.optOut) {
+		return protocol.MakeErrReply("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	if yes && !tc.optIn {
+		return protocol.MakeErrReply("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	}
+	if !yes && !tc.optOut {
+		return protocol.MakeErrReply("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+	if yes {
+		tc.caching = cachingYes
+	} else {
+		tc.caching = cachingNo
+	}
+	return nil
+}
+
+// afterCommand 命令执行完毕后清除 CLIENT CACHING 的状态，事务中的命令共用EXEC之前的状态
+func (t *trackingTable) afterCommand(c redis.Connection, cmdLine [][]byte) {
+	if !t.enabled() || c.InMultiState() {
+		return
+	}
+	if len(cmdLine) >= 2 && strings.ToLower(string(cmdLine[0])) == "client" &&
+		strings.ToLower(string(cmdLine[1])) == "caching" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tc, ok := t.clients[c]; ok {
+		tc.caching = cachingDefault
+	}
+}
+
+// remember 记录客户端读取过的key
+func (t *trackingTable) remember(c redis.Connection, keys []string) {
+	if !t.enabled() || c == nil || len(keys) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tc, ok := t.clients[c]
+	if !ok || tc.bcast {
+		return
+	}
+	if (tc.optIn && tc.caching != cachingYes) || (tc.optOut && tc.caching == cachingNo) {
+		return
+	}
+	for _, key := range keys {
+		readers, ok := t.keys[key]
+		if !ok {
+			readers = make(map[*trackingClient]struct{})
+			t.keys[key] = readers
+		}
+		readers[tc] = struct{}{}
+	}
+}
+
+// invalidate 向追踪了keys的客户端发送失效消息，caller为修改key的客户端
+// 调用方可能持有key的锁，消息只放入发送队列，不在调用方的协程中写入
+func (t *trackingTable) invalidate(caller redis.Connection, keys []string) {
+	if !t.enabled() || len(keys) == 0 {
+		return
+	}
+	t.mu.Lock()
+	pending := make(map[*trackingClient][][]byte)
+	notify := func(tc *trackingClient, key string) {
+		if tc.conn == nil || (tc.noLoop && tc.conn == caller) {
+			return
+		}
+		pending[tc] = append(pending[tc], []byte(key))
+	}
+	for _, key := range keys {
+		if readers, ok := t.keys[key]; ok {
+			delete(t.keys, key)
+			for tc := range readers {
+				notify(tc, key)
+			}
+		}
+		for prefix, subscribers := range t.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for tc := range subscribers {
+				notify(tc, key)
+			}
+		}
+	}
+	for tc, invalidated := range pending {
+		t.push(tc, invalidated)
+	}
+	t.mu.Unlock()
+}
+
+// invalidateAll 清空db后通知所有开启追踪的客户端
+func (t *trackingTable) invalidateAll() {
+	if !t.enabled() {
+		return
+	}
+	t.mu.Lock()
+	t.keys = make(map[string]map[*trackingClient]struct{})
+	for _, tc := range t.clients {
+		t.push(tc, nil)
+	}
+	t.mu.Unlock()
+}
+
+// target 返回接收失效消息的连接
+// RESP3连接直接接收push消息；RESP2连接只能通过 REDIRECT 到订阅了 __redis__:invalidate 的连接接收频道消息，否则不发送
+func (t *trackingClient) target() (redis.Connection, bool) {
+	if t.redirect == 0 {
+		return t.conn, t.conn.GetProtocol() >= protocol.RESP3
+	}
+	target, ok := connection.Lookup(t.redirect)
+	if !ok {
+		return nil, false
+	}
+	if target.GetProtocol() >= protocol.RESP3 {
+		return target, true
+	}
+	for _, channel := range target.GetChannels() {
+		if channel == trackingChannel {
+			return target, true
+		}
+	}
+	return target, false
+}
+
+// push 将失效消息放入接收方的发送队列，接收方没有正在运行的发送协程时启动一个，调用方需要持有 t.mu
+func (t *trackingTable) push(tc *trackingClient, keys [][]byte) {
+	target, ok := tc.target()
+	if !ok {
+		return
+	}
+	version := target.GetProtocol()
+	msg := protocol.Marshal(makeInvalidateMessage(keys, version), version)
+
+	t.queueMu.Lock()
+	defer t.queueMu.Unlock()
+	queue, running := t.queues[target]
+	if !running {
+		queue = &pushQueue{}
+		t.queues[target] = queue
+		go t.flushQueue(target, queue)
+	}
+	queue.msgs = append(queue.msgs, msg)
+}
+
+// flushQueue 按顺序写出接收方的失效消息，队列为空时退出
+func (t *trackingTable) flushQueue(target redis.Connection, queue *pushQueue) {
+	for {
+		t.queueMu.Lock()
+		msgs := queue.msgs
+		queue.msgs = nil
+		if len(msgs) == 0 {
+			delete(t.queues, target)
+			t.queueMu.Unlock()
+			return
+		}
+		t.queueMu.Unlock()
+
+		for _, msg := range msgs {
+			_ = target.Write(msg)
+		}
+	}
+}
+
+// makeInvalidateMessage 失效消息，keys为nil时表示所有key失效
+// RESP3下以push类型发送，RESP2下以 __redis__:invalidate 频道的消息发送
+func makeInvalidateMessage(keys [][]byte, version int) redis.Reply {
+	var keysReply redis.Reply = protocol.MakeNullMultiBulkReply()
+	if keys != nil {
+		keysReply = protocol.MakeMultiBulkReply(keys)
+	}
+	if version < protocol.RESP3 {
+		return protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("message")),
+			protocol.MakeBulkReply([]byte(trackingChannel)),
+			keysReply,
+		})
+	}
+	return protocol.MakePushReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte("invalidate")),
+		keysReply,
+	})
+}
+
+// execClientTracking CLIENT TRACKING ON|OFF [REDIRECT id] [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func execClientTracking(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("client|tracking")
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "off":
+		if len(args) != 1 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		mdb.tracking.disable(c)
+		return protocol.MakeOkReply()
+	case "on":
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+
+	options := &trackingClient{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "bcast":
+			options.bcast = true
+		case "optin":
+			options.optIn = true
+		case "optout":
+			options.optOut = true
+		case "noloop":
+			options.noLoop = true
+		case "prefix":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			options.prefixes = append(options.prefixes, string(args[i+1]))
+			i++
+		case "redirect":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			id, err := strconv.ParseUint(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR Invalid client ID")
+			}
+			if _, ok := connection.Lookup(id); !ok && id != c.GetID() {
+				return protocol.MakeErrReply("ERR The client ID you want redirect to does not exist")
+			}
+			if id != c.GetID() {
+				options.redirect = id
+			}
+			i++
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if len(options.prefixes) > 0 && !options.bcast {
+		return protocol.MakeErrReply("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if options.optIn && options.optOut {
+		return protocol.MakeErrReply("ERR You can't use OPTIN and OPTOUT at the same time")
+	}
+	if options.bcast && (options.optIn || options.optOut) {
+		return protocol.MakeErrReply("ERR OPTIN and OPTOUT are not compatible with BCAST")
+	}
+	if errReply := mdb.tracking.enable(c, options); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+// execClientCaching CLIENT CACHING YES|NO
+func execClientCaching(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 1 {
+		return protocol.MakeArgNumErrReply("client|caching")
+	}
+	var yes bool
+	switch strings.ToLower(string(args[0])) {
+	case "yes":
+		yes = true
+	case "no":
+		yes = false
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+	if errReply := mdb.tracking.setCaching(c, yes); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+// execClientTrackingInfo CLIENT TRACKINGINFO
+func execClientTrackingInfo(mdb *MultiDB, c redis.Connection) redis.Reply {
+	flags, redirectID, prefixes, ok := mdb.tracking.info(c)
+	redirect := int64(redirectID)
+	if !ok {
+		flags = []string{"off"}
+		redirect = -1
+	}
+	return protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte("flags")), protocol.MakeMultiBulkReply(utils.ToCmdLine(flags...)),
+		protocol.MakeBulkReply([]byte("redirect")), protocol.MakeIntReply(redirect),
+		protocol.MakeBulkReply([]byte("prefixes")), protocol.MakeMultiBulkReply(utils.ToCmdLine(prefixes...)),
+	})
+}
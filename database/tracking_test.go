@@ -0,0 +1,290 @@
+package database
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// waitPushed 等待所有失效消息发送完成
+func waitPushed(t *trackingTable) {
+	for {
+		t.queueMu.Lock()
+		n := len(t.queues)
+		t.queueMu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// takePushed 返回并清空连接收到的失效消息
+func takePushed(mdb *MultiDB, conn *connection.FakeConn) string {
+	waitPushed(mdb.tracking)
+	result := string(conn.Bytes())
+	conn.Clean()
+	return result
+}
+
+func invalidateMsg(version int, keys ...string) string {
+	var raw [][]byte
+	if keys != nil {
+		raw = utils.ToCmdLine(keys...)
+	}
+	return string(protocol.Marshal(makeInvalidateMessage(raw, version), version))
+}
+
+// makeTrackingConn 创建开启了追踪的RESP3连接
+func makeTrackingConn(t *testing.T, mdb *MultiDB, options ...string) *connection.FakeConn {
+	conn := &connection.FakeConn{}
+	conn.SetProtocol(protocol.RESP3)
+	args := append([]string{"client", "tracking", "on"}, options...)
+	if result := mdb.Exec(conn, utils.ToCmdLine(args...)); protocol.IsErrorReply(result) {
+		t.Fatalf("%v: %s", args, result.ToBytes())
+	}
+	return conn
+}
+
+func TestTrackingDefault(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	reader := makeTrackingConn(t, mdb)
+	mdb.Exec(reader, utils.ToCmdLine("mget", "a", "b"))
+
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "1"))
+	if actual, expected := takePushed(mdb, reader), invalidateMsg(protocol.RESP3, "a"); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+	// 失效之后需要重新读取才会再次记录
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "2"))
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("expected no message, actual %q", actual)
+	}
+	mdb.Exec(writer, utils.ToCmdLine("mset", "a", "3", "b", "3"))
+	if actual, expected := takePushed(mdb, reader), invalidateMsg(protocol.RESP3, "b"); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+
+	// 关闭追踪之后不再接收
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	mdb.Exec(reader, utils.ToCmdLine("client", "tracking", "off"))
+	reader.Clean()
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "4"))
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("expected no message after tracking off, actual %q", actual)
+	}
+}
+
+func TestTrackingResp2(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	reader := &connection.FakeConn{}
+	mdb.Exec(reader, utils.ToCmdLine("client", "tracking", "on"))
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	reader.Clean()
+
+	// RESP2 不能在请求和回复之间插入推送
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "1"))
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("RESP2 connection should not receive push, actual %q", actual)
+	}
+}
+
+func TestTrackingNoLoop(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	reader := makeTrackingConn(t, mdb, "noloop")
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	mdb.Exec(reader, utils.ToCmdLine("set", "a", "1"))
+	reader.Clean()
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("NOLOOP client notified of its own write: %q", actual)
+	}
+
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	reader.Clean()
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "2"))
+	if actual, expected := takePushed(mdb, reader), invalidateMsg(protocol.RESP3, "a"); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
+
+func TestTrackingExpire(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	reader := makeTrackingConn(t, mdb)
+	expireAt := strconv.FormatInt(time.Now().Add(50*time.Millisecond).UnixMilli(), 10)
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "1"))
+	mdb.Exec(writer, utils.ToCmdLine("pexpireat", "a", expireAt))
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	reader.Clean()
+
+	// 读取时发现key已经过期，删除key的同时通知追踪了该key的客户端
+	time.Sleep(100 * time.Millisecond)
+	mdb.Exec(writer, utils.ToCmdLine("get", "a"))
+	if actual, expected := takePushed(mdb, reader), invalidateMsg(protocol.RESP3, "a"); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
+
+func TestTrackingBcast(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	all := makeTrackingConn(t, mdb, "bcast")
+	users := makeTrackingConn(t, mdb, "bcast", "prefix", "user:", "prefix", "session:")
+	all.Clean()
+	users.Clean()
+
+	mdb.Exec(writer, utils.ToCmdLine("set", "user:1", "a"))
+	mdb.Exec(writer, utils.ToCmdLine("set", "other", "b"))
+	mdb.Exec(writer, utils.ToCmdLine("mset", "session:1", "c", "x", "d"))
+	expected := invalidateMsg(protocol.RESP3, "user:1") + invalidateMsg(protocol.RESP3, "other") +
+		invalidateMsg(protocol.RESP3, "session:1", "x")
+	if actual := takePushed(mdb, all); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+	expected = invalidateMsg(protocol.RESP3, "user:1") + invalidateMsg(protocol.RESP3, "session:1")
+	if actual := takePushed(mdb, users); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+
+	// BCAST 模式不需要读取，每次修改都会通知
+	mdb.Exec(writer, utils.ToCmdLine("set", "user:1", "e"))
+	if actual, expected := takePushed(mdb, users), invalidateMsg(protocol.RESP3, "user:1"); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+
+	result := mdb.Exec(writer, utils.ToCmdLine("client", "tracking", "on", "prefix", "a"))
+	if !protocol.IsErrorReply(result) {
+		t.Error("PREFIX without BCAST should be rejected")
+	}
+}
+
+func TestTrackingFlushAll(t *testing.T) {
+	mdb := NewStandaloneServer()
+	writer := &connection.FakeConn{}
+	reader := makeTrackingConn(t, mdb)
+	bcast := makeTrackingConn(t, mdb, "bcast", "prefix", "user:")
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	reader.Clean()
+	bcast.Clean()
+
+	mdb.Exec(writer, utils.ToCmdLine("flushall"))
+	expected := invalidateMsg(protocol.RESP3)
+	for _, conn := range []*connection.FakeConn{reader, bcast} {
+		if actual := takePushed(mdb, conn); actual != expected {
+			t.Errorf("expected %q, actual %q", expected, actual)
+		}
+	}
+	// 清空之后读取记录同样被清除
+	mdb.Exec(writer, utils.ToCmdLine("set", "a", "1"))
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("expected no message, actual %q", actual)
+	}
+}
+
+// pipeReader 在后台读取net.Pipe另一端收到的数据
+type pipeReader struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *pipeReader) run(conn net.Conn) {
+	data := make([]byte, 1024)
+	for {
+		n, err := conn.Read(data)
+		r.mu.Lock()
+		r.buf.Write(data[:n])
+		r.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// waitFor 等待收到的数据以suffix结尾
+func (r *pipeReader) waitFor(suffix string) bool {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		ok := bytes.HasSuffix(r.buf.Bytes(), []byte(suffix))
+		r.mu.Unlock()
+		if ok {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestTrackingRedirect(t *testing.T) {
+	mdb := NewStandaloneServer()
+	server, client := net.Pipe()
+	target := connection.NewConn(server)
+	defer target.Close()
+	received := &pipeReader{}
+	go received.run(client)
+	mdb.Exec(target, utils.ToCmdLine("subscribe", trackingChannel))
+	target.Flush()
+
+	reader := &connection.FakeConn{}
+	id := strconv.FormatUint(target.GetID(), 10)
+	result := mdb.Exec(reader, utils.ToCmdLine("client", "tracking", "on", "redirect", id))
+	if protocol.IsErrorReply(result) {
+		t.Fatalf("redirect: %s", result.ToBytes())
+	}
+	info := string(mdb.Exec(reader, utils.ToCmdLine("client", "trackinginfo")).ToBytes())
+	if !bytes.Contains([]byte(info), []byte("redirect\r\n:"+id+"\r\n")) {
+		t.Errorf("trackinginfo should report redirect %s: %q", id, info)
+	}
+	mdb.Exec(reader, utils.ToCmdLine("get", "a"))
+	reader.Clean()
+
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("set", "a", "1"))
+	if expected := invalidateMsg(protocol.RESP2, "a"); !received.waitFor(expected) {
+		t.Errorf("redirect target did not receive %q", expected)
+	}
+	if actual := takePushed(mdb, reader); actual != "" {
+		t.Errorf("tracking client should not receive messages when redirecting, actual %q", actual)
+	}
+
+	result = mdb.Exec(reader, utils.ToCmdLine("client", "tracking", "on", "redirect", "999999"))
+	if !protocol.IsErrorReply(result) {
+		t.Error("redirect to unknown client should be rejected")
+	}
+}
+
+func TestTrackingRedirectTarget(t *testing.T) {
+	mdb := NewStandaloneServer()
+	server, client := net.Pipe()
+	defer client.Close()
+	target := connection.NewConn(server)
+	defer target.Close()
+	go (&pipeReader{}).run(client)
+	tc := &trackingClient{redirect: target.GetID()}
+
+	// RESP2连接只有订阅了 __redis__:invalidate 才能接收失效消息
+	if _, ok := tc.target(); ok {
+		t.Error("RESP2 target without subscription should not receive messages")
+	}
+	mdb.Exec(target, utils.ToCmdLine("subscribe", "other"))
+	if _, ok := tc.target(); ok {
+		t.Error("RESP2 target subscribed to other channels should not receive messages")
+	}
+	mdb.Exec(target, utils.ToCmdLine("subscribe", trackingChannel))
+	if _, ok := tc.target(); !ok {
+		t.Errorf("RESP2 target subscribed to %s should receive messages", trackingChannel)
+	}
+	mdb.Exec(target, utils.ToCmdLine("unsubscribe", trackingChannel))
+	if _, ok := tc.target(); ok {
+		t.Error("RESP2 target should not receive messages after unsubscribing")
+	}
+}
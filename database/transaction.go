@@ -1,6 +1,10 @@
 package database
 
-import "strings"
+import (
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/redis/protocol"
+	"strings"
+)
 
 /*
 	数据库事务处理
@@ -36,3 +40,166 @@ func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
 	}
 	return undo(db, cmdLine[1:])
 }
+
+// Watch WATCH key [key ...] 记录key当前的版本号，EXEC时版本号变化则放弃执行
+func Watch(db *DB, conn redis.Connection, args [][]byte) redis.Reply {
+	if conn.InMultiState() {
+		return protocol.MakeErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := conn.GetWatching()
+	for _, bkey := range args {
+		key := string(bkey)
+		watching[key] = db.GetVersion(key)
+	}
+	return protocol.MakeOkReply()
+}
+
+// UnWatch UNWATCH 取消所有WATCH的key
+func UnWatch(conn redis.Connection) redis.Reply {
+	if !conn.InMultiState() {
+		conn.SetMultiState(false) // 清空WATCH的key
+	}
+	return protocol.MakeOkReply()
+}
+
+// isWatchingChanged 判断WATCH的key是否被修改过
+func isWatchingChanged(db *DB, watching map[string]uint32) bool {
+	for key, ver := range watching {
+		currentVersion := db.GetVersion(key)
+		if ver != currentVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// StartMulti MULTI 开启事务
+func StartMulti(conn redis.Connection) redis.Reply {
+	if conn.InMultiState() {
+		return protocol.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return protocol.MakeOkReply()
+}
+
+// EnqueueCmd 事务中的命令入队，入队时检查命令是否存在以及参数数量
+// 入队失败的错误会被记录下来，EXEC时直接放弃整个事务
+func EnqueueCmd(conn redis.Connection, cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		err := protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		conn.AddTxError(err)
+		return err
+	}
+	if cmd.prepare == nil || cmd.selfLocking {
+		return rejectInMulti(conn, cmdName)
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		err := protocol.MakeArgNumErrReply(cmdName)
+		conn.AddTxError(err)
+		return err
+	}
+	conn.EnqueueCmd(cmdLine)
+	return protocol.MakeQueuedReply()
+}
+
+// rejectInMulti 拒绝不能在事务中执行的命令，EXEC时放弃整个事务
+func rejectInMulti(conn redis.Connection, cmdName string) redis.Reply {
+	err := protocol.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+	conn.AddTxError(err)
+	return err
+}
+
+// execMulti EXEC 执行事务
+func execMulti(db *DB, conn redis.Connection) redis.Reply {
+	if !conn.InMultiState() {
+		return protocol.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	cmdLines := conn.GetQueuedCmdLine()
+	return db.ExecMulti(conn, conn.GetWatching(), cmdLines)
+}
+
+// ExecMulti 原子地执行一组命令
+// 执行前对所有命令涉及的读写key以及WATCH的key上锁；某条命令执行失败时，按照undo日志回滚已经执行的命令
+func (db *DB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply {
+	// 1. 获取所有命令涉及的key以及WATCH的key，并上锁
+	dynamic := false
+	for _, cmdLine := range cmdLines {
+		if cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]; ok && cmd.dynPrepare != nil {
+			dynamic = true
+		}
+	}
+	watchingKeys := make([]string, 0, len(watching))
+	for key := range watching {
+		watchingKeys = append(watchingKeys, key)
+	}
+	var trackingKeys []string // 只读命令读取的key，用于客户端缓存
+	writeKeys, readKeys := db.lockRelatedKeys(dynamic, func() ([]string, []string) {
+		writeKeys := make([]string, 0)
+		readKeys := make([]string, 0)
+		trackingKeys = make([]string, 0)
+		for _, cmdLine := range cmdLines {
+			cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+			if !ok {
+				continue
+			}
+			write, read := db.relatedKeys(cmd, cmdLine[1:])
+			writeKeys = append(writeKeys, write...)
+			readKeys = append(readKeys, read...)
+			if cmd.flags == flagReadOnly {
+				trackingKeys = append(trackingKeys, read...)
+			}
+		}
+		return writeKeys, append(readKeys, watchingKeys...)
+	})
+	defer db.RWULocks(writeKeys, readKeys)
+
+	// 2. 检查WATCH的key
+	if isWatchingChanged(db, watching) {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	db.addVersion(conn, writeKeys...)
+
+	// 3. 执行命令，同时记录undo日志
+	results := make([]redis.Reply, 0, len(cmdLines))
+	aborted := false
+	undoCmdLines := make([][]CmdLine, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		undoCmdLines = append(undoCmdLines, db.GetUndoLogs(cmdLine))
+		result := db.execWithLock(cmdLine)
+		if protocol.IsErrorReply(result) {
+			aborted = true
+			// 执行失败的命令没有产生修改，不需要回滚
+			undoCmdLines = undoCmdLines[:len(undoCmdLines)-1]
+			break
+		}
+		results = append(results, result)
+	}
+	if !aborted {
+		db.tracking.remember(conn, trackingKeys)
+		return protocol.MakeMultiRawReply(results)
+	}
+
+	// 4. 逆序回滚已经执行的命令
+	for i := len(undoCmdLines) - 1; i >= 0; i-- {
+		for _, cmdLine := range undoCmdLines[i] {
+			db.execWithLock(cmdLine)
+		}
+	}
+	return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+}
+
+// DiscardMulti DISCARD 放弃事务
+func DiscardMulti(conn redis.Connection) redis.Reply {
+	if !conn.InMultiState() {
+		return protocol.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	conn.ClearQueuedCmds()
+	conn.SetMultiState(false)
+	return protocol.MakeOkReply()
+}
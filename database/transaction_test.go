@@ -0,0 +1,155 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+// execString 执行命令并返回序列化后的回复
+func execString(db *DB, conn *connection.FakeConn, args ...string) string {
+	return string(db.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+}
+
+// replyCase 命令及其预期的回复
+type replyCase struct {
+	args     []string
+	expected string
+}
+
+// assertReplies 依次执行命令并检查回复
+func assertReplies(t *testing.T, db *DB, conn *connection.FakeConn, cases []replyCase) {
+	t.Helper()
+	for _, c := range cases {
+		if actual := execString(db, conn, c.args...); actual != c.expected {
+			t.Errorf("%v: expected %q, actual %q", c.args, c.expected, actual)
+		}
+	}
+}
+
+func TestMultiExec(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"multi"}, "-ERR MULTI calls can not be nested\r\n"},
+		{[]string{"set", "a", "1"}, "+QUEUED\r\n"},
+		{[]string{"hset", "h", "f", "v"}, "+QUEUED\r\n"},
+		{[]string{"get", "a"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "*3\r\n+OK\r\n:1\r\n$1\r\n1\r\n"},
+		{[]string{"exec"}, "-ERR EXEC without MULTI\r\n"},
+	})
+	if conn.InMultiState() {
+		t.Error("still in multi state after EXEC")
+	}
+}
+
+func TestMultiQueueError(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "1"}, "+QUEUED\r\n"},
+		{[]string{"nosuchcmd"}, "-ERR unknown command 'nosuchcmd'\r\n"},
+		{[]string{"get"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{[]string{"exec"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"get", "a"}, "$-1\r\n"},
+	})
+}
+
+func TestMultiRuntimeErrorRollback(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"set", "a", "1"}, "+OK\r\n"},
+		{[]string{"set", "s", "str"}, "+OK\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "2"}, "+QUEUED\r\n"},
+		{[]string{"hset", "h", "f", "v"}, "+QUEUED\r\n"},
+		{[]string{"hset", "s", "f", "v"}, "+QUEUED\r\n"}, // 执行时 WRONGTYPE
+		{[]string{"set", "b", "1"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{[]string{"get", "a"}, "$1\r\n1\r\n"},
+		{[]string{"hexists", "h", "f"}, ":0\r\n"},
+		{[]string{"get", "b"}, "$-1\r\n"},
+		{[]string{"get", "s"}, "$3\r\nstr\r\n"},
+	})
+}
+
+func TestWatch(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	other := &connection.FakeConn{}
+
+	// WATCH 的key被修改，EXEC 返回空
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"set", "a", "1"}, "+OK\r\n"},
+		{[]string{"watch", "a", "missing"}, "+OK\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"watch", "a"}, "-ERR WATCH inside MULTI is not allowed\r\n"},
+		{[]string{"set", "b", "1"}, "+QUEUED\r\n"},
+	})
+	execString(db, other, "set", "a", "2")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"exec"}, "*-1\r\n"},
+		{[]string{"get", "b"}, "$-1\r\n"},
+	})
+
+	// EXEC 之后不再WATCH
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "b", "1"}, "+QUEUED\r\n"},
+	})
+	execString(db, other, "set", "a", "3")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"exec"}, "*1\r\n+OK\r\n"},
+	})
+
+	// 不存在的key被创建同样视为修改
+	execString(db, conn, "watch", "missing")
+	execString(db, other, "set", "missing", "1")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "c", "1"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "*-1\r\n"},
+	})
+
+	// UNWATCH 之后修改不影响事务
+	execString(db, conn, "watch", "a")
+	execString(db, conn, "unwatch")
+	execString(db, other, "set", "a", "4")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "c", "1"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "*1\r\n+OK\r\n"},
+	})
+
+	// WATCH 的key被事务自身修改不会中断事务
+	execString(db, conn, "watch", "a")
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "5"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "*1\r\n+OK\r\n"},
+	})
+}
+
+func TestDiscard(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	assertReplies(t, db, conn, []replyCase{
+		{[]string{"discard"}, "-ERR DISCARD without MULTI\r\n"},
+		{[]string{"set", "a", "1"}, "+OK\r\n"},
+		{[]string{"watch", "a"}, "+OK\r\n"},
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"set", "a", "2"}, "+QUEUED\r\n"},
+		{[]string{"discard"}, "+OK\r\n"},
+		{[]string{"get", "a"}, "$1\r\n1\r\n"},
+	})
+	if conn.InMultiState() || len(conn.GetQueuedCmdLine()) != 0 {
+		t.Error("transaction not cleared after DISCARD")
+	}
+	if len(conn.GetWatching()) != 0 {
+		t.Error("DISCARD should unwatch all keys")
+	}
+}
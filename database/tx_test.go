@@ -0,0 +1,144 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/aof"
+	"github.com/HildaM/GoKV/datastruct/dict"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+// dumpKey 序列化key的数据和过期时间，用于比较回滚前后的状态
+func dumpKey(db *DB, key string) []byte {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil
+	}
+	var buf bytes.Buffer
+	if hash, ok := entity.Data.(dict.Dict); ok {
+		// 哈希表的遍历顺序不固定
+		fields := hash.Keys()
+		sort.Strings(fields)
+		for _, field := range fields {
+			val, _ := hash.Get(field)
+			buf.WriteString(field + "=" + string(val.([]byte)) + ";")
+		}
+	} else {
+		cmds, deferred := aof.EntityToCmds(key, entity)
+		for _, cmd := range append(cmds, deferred...) {
+			buf.Write(cmd.ToBytes())
+		}
+	}
+	if raw, ok := db.ttlMap.Get(key); ok {
+		buf.WriteString(raw.(time.Time).String())
+	}
+	return buf.Bytes()
+}
+
+func TestExecMultiRollback(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	setup := [][]string{
+		{"set", "str", "a"},
+		{"hset", "hash", "f1", "v1", "f2", "v2"},
+		{"zadd", "zset", "1", "m1", "2.5", "m2"},
+		{"set", "ttl", "x"},
+		{"pexpireat", "ttl", "99999999999999"},
+		{"set", "wrong", "string"},
+	}
+	for _, line := range setup {
+		if result := db.Exec(conn, utils.ToCmdLine(line...)); protocol.IsErrorReply(result) {
+			t.Fatalf("%v: %s", line, result.ToBytes())
+		}
+	}
+	keys := []string{"str", "hash", "zset", "ttl", "new", "m1", "wrong"}
+	before := make(map[string][]byte)
+	for _, key := range keys {
+		before[key] = dumpKey(db, key)
+	}
+
+	cmdLines := []CmdLine{
+		utils.ToCmdLine("set", "str", "b"),
+		utils.ToCmdLine("hset", "hash", "f1", "changed", "f3", "v3"),
+		utils.ToCmdLine("zadd", "zset", "3", "m1", "4", "m3"),
+		utils.ToCmdLine("zrem", "zset", "m2"),
+		utils.ToCmdLine("persist", "ttl"),
+		utils.ToCmdLine("set", "new", "1"),
+		utils.ToCmdLine("mset", "m1", "1", "str", "c"),
+		utils.ToCmdLine("del", "hash"),
+		utils.ToCmdLine("hset", "wrong", "f", "v"), // WRONGTYPE
+	}
+	result := db.ExecMulti(conn, nil, cmdLines)
+	if !protocol.IsErrorReply(result) {
+		t.Fatalf("expected error reply, actual %s", result.ToBytes())
+	}
+	for _, key := range keys {
+		if after := dumpKey(db, key); !bytes.Equal(before[key], after) {
+			t.Errorf("key %s not restored: expected %q, actual %q", key, before[key], after)
+		}
+	}
+}
+
+func TestExecMultiRollbackTimeSeries(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	setup := [][]string{
+		{"ts.create", "src"},
+		{"ts.create", "dest"},
+		{"ts.createrule", "src", "dest", "AGGREGATION", "sum", "10"},
+		{"ts.add", "src", "1", "1"},
+		{"set", "wrong", "string"},
+	}
+	for _, line := range setup {
+		if result := db.Exec(conn, utils.ToCmdLine(line...)); protocol.IsErrorReply(result) {
+			t.Fatalf("%v: %s", line, result.ToBytes())
+		}
+	}
+	before := map[string][]byte{
+		"src":  dumpKey(db, "src"),
+		"dest": dumpKey(db, "dest"),
+	}
+
+	cmdLines := []CmdLine{
+		utils.ToCmdLine("ts.add", "src", "25", "2"),
+		utils.ToCmdLine("ts.deleterule", "src", "dest"),
+		utils.ToCmdLine("hset", "wrong", "f", "v"),
+	}
+	result := db.ExecMulti(conn, nil, cmdLines)
+	if !protocol.IsErrorReply(result) {
+		t.Fatalf("expected error reply, actual %s", result.ToBytes())
+	}
+	for key, expected := range before {
+		if after := dumpKey(db, key); !bytes.Equal(expected, after) {
+			t.Errorf("key %s not restored: expected %q, actual %q", key, expected, after)
+		}
+	}
+}
+
+func TestGetUndoLogs(t *testing.T) {
+	db := MakeDB()
+	conn := &connection.FakeConn{}
+	db.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+
+	undoLogs := db.GetUndoLogs(utils.ToCmdLine("mset", "a", "2", "b", "2", "a", "3"))
+	// a 和 b 各一条 DEL，a 还需要一条 SET 和一条 PERSIST
+	if len(undoLogs) != 4 {
+		t.Fatalf("expected 4 undo logs, actual %d", len(undoLogs))
+	}
+	db.Exec(conn, utils.ToCmdLine("mset", "a", "2", "b", "2"))
+	for _, line := range undoLogs {
+		db.execWithLock(line)
+	}
+	if _, exists := db.GetEntity("b"); exists {
+		t.Error("b should be removed")
+	}
+	actual := db.Exec(conn, utils.ToCmdLine("get", "a"))
+	if !bytes.Equal(actual.ToBytes(), protocol.MakeBulkReply([]byte("1")).ToBytes()) {
+		t.Errorf("expected a=1, actual %s", actual.ToBytes())
+	}
+}
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"github.com/HildaM/GoKV/aof"
 	"github.com/HildaM/GoKV/lib/utils"
 	"strconv"
+	"time"
 )
 
 /*
@@ -20,10 +22,58 @@ func readFirstKey(args [][]byte) ([]string, []string) {
 	return nil, []string{key}
 }
 
+// noPrepare 不涉及具体key的命令，例如遍历整个数据库的查询
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
 func rollbackFirstKey(db *DB, args [][]byte) []CmdLine {
-	//key := string(args[0])
-	// return rollbackGivenKeys(db, key)
-	return nil
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+// rollbackGivenKeys 记录key当前的值和过期时间，返回将其还原的命令
+// 先删除所有key，再通过aof序列化命令重建数据，最后还原过期时间；不存在的key只需要删除
+// 依赖其他key的命令（例如降采样规则）放在所有数据重建之后执行
+func rollbackGivenKeys(db *DB, keys ...string) []CmdLine {
+	var dels, cmdLines, deferredLines, ttlLines []CmdLine
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		dels = append(dels, utils.ToCmdLine("DEL", key))
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			continue
+		}
+		cmds, deferred := aof.EntityToCmds(key, entity)
+		for _, cmd := range cmds {
+			cmdLines = append(cmdLines, cmd.Args)
+		}
+		for _, cmd := range deferred {
+			deferredLines = append(deferredLines, cmd.Args)
+		}
+		ttlLines = append(ttlLines, toTTLCmd(db, key))
+	}
+
+	undoCmdLines := make([]CmdLine, 0, len(dels)+len(cmdLines)+len(deferredLines)+len(ttlLines))
+	undoCmdLines = append(undoCmdLines, dels...)
+	undoCmdLines = append(undoCmdLines, cmdLines...)
+	undoCmdLines = append(undoCmdLines, deferredLines...)
+	undoCmdLines = append(undoCmdLines, ttlLines...)
+	return undoCmdLines
+}
+
+// toTTLCmd 返回还原key过期时间的命令
+func toTTLCmd(db *DB, key string) CmdLine {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return utils.ToCmdLine("PERSIST", key)
+	}
+	expireTime, _ := raw.(time.Time)
+	return aof.MakeExpireCmd(key, expireTime).Args
 }
 
 /*
@@ -0,0 +1,307 @@
+package database
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/HildaM/GoKV/datastruct/vector"
+	"github.com/HildaM/GoKV/interface/database"
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	向量索引命令：VCREATE VADD VREM VGET VCARD VKNN VINFO
+*/
+
+// getAsVectorIndex 获取向量索引
+func (db *DB) getAsVectorIndex(key string) (*vector.Index, protocol.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	index, ok := entity.Data.(*vector.Index)
+	if !ok {
+		return nil, &protocol.WrongTypeErrReply{}
+	}
+	return index, nil
+}
+
+// parseVector 解析 VALUES f1 ... fn 或者 FP32 blob，返回向量和已消费的参数数量
+func parseVector(args [][]byte, dim int) ([]float32, int, protocol.ErrorReply) {
+	if len(args) < 2 {
+		return nil, 0, protocol.MakeSyntaxErrReply()
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "VALUES":
+		if len(args) < 1+dim {
+			return nil, 0, protocol.MakeErrReply(vector.ErrDimMismatch.Error())
+		}
+		vec := make([]float32, dim)
+		for i := 0; i < dim; i++ {
+			v, err := strconv.ParseFloat(string(args[1+i]), 32)
+			if err != nil {
+				return nil, 0, protocol.MakeErrReply("ERR vector value is not a valid float")
+			}
+			vec[i] = float32(v)
+		}
+		return vec, 1 + dim, nil
+	case "FP32":
+		blob := args[1]
+		if len(blob) != 4*dim {
+			return nil, 0, protocol.MakeErrReply(vector.ErrDimMismatch.Error())
+		}
+		vec := make([]float32, dim)
+		for i := range vec {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+		}
+		return vec, 2, nil
+	}
+	return nil, 0, protocol.MakeSyntaxErrReply()
+}
+
+func formatVectorValue(v float32) []byte {
+	return []byte(strconv.FormatFloat(float64(v), 'g', -1, 32))
+}
+
+// execVCreate VCREATE key DIM n METRIC L2|COSINE|IP [M m] [EF_CONSTRUCTION ef] [FLAT_THRESHOLD n]
+func execVCreate(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); exists {
+		return protocol.MakeErrReply("ERR key already exists")
+	}
+
+	opts := vector.Options{}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		name := strings.ToUpper(string(args[i]))
+		if name == "METRIC" {
+			opts.Metric = strings.ToUpper(string(args[i+1]))
+			continue
+		}
+		value, err := strconv.Atoi(string(args[i+1]))
+		if err != nil || value < 0 {
+			return protocol.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		switch name {
+		case "DIM":
+			opts.Dim = value
+		case "M":
+			opts.M = value
+		case "EF_CONSTRUCTION":
+			opts.EfConstruct = value
+		case "FLAT_THRESHOLD":
+			opts.FlatThreshold = value
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	index, err := vector.Make(opts)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	db.PutEntity(key, &database.DataEntity{Data: index})
+	db.addAof(utils.ToCmdLine3("vcreate", args...))
+	return protocol.MakeOkReply()
+}
+
+// execVAdd VADD key id VALUES f1 ... fn|FP32 blob [ATTRS name value ...]
+func execVAdd(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeErrReply("ERR no such vector index")
+	}
+
+	vec, n, errReply := parseVector(args[2:], index.Options().Dim)
+	if errReply != nil {
+		return errReply
+	}
+	rest := args[2+n:]
+	var attrs map[string]string
+	if len(rest) > 0 {
+		if strings.ToUpper(string(rest[0])) != "ATTRS" || len(rest)%2 != 1 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		attrs = make(map[string]string, len(rest)/2)
+		for i := 1; i+1 < len(rest); i += 2 {
+			attrs[string(rest[i])] = string(rest[i+1])
+		}
+	}
+
+	added, err := index.Add(string(args[1]), vec, attrs)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	db.addAof(utils.ToCmdLine3("vadd", args...))
+	if added {
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeIntReply(0)
+}
+
+// execVRem VREM key id [id ...]
+func execVRem(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := 0
+	for _, id := range args[1:] {
+		if index.Remove(string(id)) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine3("vrem", args...))
+	}
+	return protocol.MakeIntReply(int64(removed))
+}
+
+// execVGet VGET key id 返回原始向量
+func execVGet(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	vec, _, ok := index.Get(string(args[1]))
+	if !ok {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	result := make([][]byte, len(vec))
+	for i, v := range vec {
+		result[i] = formatVectorValue(v)
+	}
+	return protocol.MakeMultiBulkReply(result)
+}
+
+// execVCard VCARD key
+func execVCard(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(index.Len()))
+}
+
+// execVKnn VKNN key k VALUES f1 ... fn|FP32 blob [EF ef] [FILTER name=value ...]
+// 返回 [id, distance, id, distance ...]，按距离升序排列
+func execVKnn(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	k, err := strconv.Atoi(string(args[1]))
+	if err != nil || k < 0 {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	query, n, errReply := parseVector(args[2:], index.Options().Dim)
+	if errReply != nil {
+		return errReply
+	}
+
+	ef := 0
+	filters := make(map[string]string)
+	rest := args[2+n:]
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToUpper(string(rest[i])) {
+		case "EF":
+			if i+1 >= len(rest) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			ef, err = strconv.Atoi(string(rest[i+1]))
+			if err != nil || ef < 0 {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			i++
+		case "FILTER":
+			for _, raw := range rest[i+1:] {
+				pivot := strings.IndexByte(string(raw), '=')
+				if pivot <= 0 {
+					return protocol.MakeErrReply("ERR invalid filter '" + string(raw) + "'")
+				}
+				filters[string(raw[:pivot])] = string(raw[pivot+1:])
+			}
+			i = len(rest)
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	var filter func(attrs map[string]string) bool
+	if len(filters) > 0 {
+		filter = func(attrs map[string]string) bool {
+			for name, value := range filters {
+				if attrs[name] != value {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	results, err := index.KNN(query, k, ef, filter)
+	if err != nil {
+		return protocol.MakeErrReply(err.Error())
+	}
+	reply := make([][]byte, 0, 2*len(results))
+	for _, r := range results {
+		reply = append(reply, []byte(r.ID), formatVectorValue(r.Distance))
+	}
+	return protocol.MakeMultiBulkReply(reply)
+}
+
+// execVInfo VINFO key
+func execVInfo(db *DB, args [][]byte) redis.Reply {
+	index, errReply := db.getAsVectorIndex(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if index == nil {
+		return protocol.MakeErrReply("ERR no such vector index")
+	}
+	opts := index.Options()
+	mode := "FLAT"
+	if index.IsHNSW() {
+		mode = "HNSW"
+	}
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(
+		"dim", strconv.Itoa(opts.Dim),
+		"metric", opts.Metric,
+		"size", strconv.Itoa(index.Len()),
+		"mode", mode,
+		"m", strconv.Itoa(opts.M),
+		"ef_construction", strconv.Itoa(opts.EfConstruct),
+		"flat_threshold", strconv.Itoa(opts.FlatThreshold),
+	))
+}
+
+func init() {
+	RegisterCommand("VCreate", execVCreate, writeFirstKey, rollbackFirstKey, -5, flagWrite)
+	RegisterCommand("VAdd", execVAdd, writeFirstKey, rollbackFirstKey, -5, flagWrite)
+	RegisterCommand("VRem", execVRem, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	RegisterCommand("VGet", execVGet, readFirstKey, nil, 3, flagReadOnly)
+	RegisterCommand("VCard", execVCard, readFirstKey, nil, 2, flagReadOnly)
+	RegisterCommand("VKnn", execVKnn, readFirstKey, nil, -5, flagReadOnly)
+	RegisterCommand("VInfo", execVInfo, readFirstKey, nil, 2, flagReadOnly)
+}
@@ -194,6 +194,42 @@ func (dict *ConcurrentDict) Len() int {
 	return int(atomic.LoadInt32(&dict.count))
 }
 
+// Scan 从cursor指定的分片开始遍历，每次至少返回count个key（以分片为单位），返回下一次遍历的cursor，为0表示遍历结束
+// 每次只锁住一个分片，调用方可以在两次Scan之间处理数据，不会长时间阻塞其他分片
+func (dict *ConcurrentDict) Scan(cursor int, count int) ([]string, int) {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	keys := make([]string, 0, count)
+	for cursor < len(dict.table) && len(keys) < count {
+		shard := dict.table[cursor]
+		shard.mutex.RLock()
+		for key := range shard.m {
+			keys = append(keys, key)
+		}
+		shard.mutex.RUnlock()
+		cursor++
+	}
+	if cursor >= len(dict.table) {
+		cursor = 0
+	}
+	return keys, cursor
+}
+
+// ShardSizes 返回每个分片中的key数量，用于观察数据在分片间的分布
+func (dict *ConcurrentDict) ShardSizes() []int {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	sizes := make([]int, len(dict.table))
+	for i, shard := range dict.table {
+		shard.mutex.RLock()
+		sizes[i] = len(shard.m)
+		shard.mutex.RUnlock()
+	}
+	return sizes
+}
+
 // Remove removes the key and return the number of deleted key-value
 func (dict *ConcurrentDict) Remove(key string) (result int) {
 	if dict == nil {
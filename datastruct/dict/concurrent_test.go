@@ -277,6 +277,52 @@ func TestConcurrentRandomKey(t *testing.T) {
 	}
 }
 
+func TestConcurrentShardSizes(t *testing.T) {
+	d := MakeConcurrent(16)
+	count := 100
+	for i := 0; i < count; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	sizes := d.ShardSizes()
+	if len(sizes) != 16 {
+		t.Errorf("expect 16 shards, actual %d", len(sizes))
+	}
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if total != count {
+		t.Errorf("expect %d keys in shards, actual %d", count, total)
+	}
+}
+
+func TestConcurrentScan(t *testing.T) {
+	d := MakeConcurrent(16)
+	count := 100
+	for i := 0; i < count; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]struct{})
+	cursor, rounds := 0, 0
+	for {
+		var keys []string
+		keys, cursor = d.Scan(cursor, 10)
+		for _, key := range keys {
+			seen[key] = struct{}{}
+		}
+		rounds++
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != count {
+		t.Errorf("expect %d keys, actual %d", count, len(seen))
+	}
+	if rounds < 2 {
+		t.Errorf("scan should return keys in batches")
+	}
+}
+
 //func TestConcurrentDict_Keys(t *testing.T) {
 //	d := MakeConcurrent(0)
 //	size := 10
@@ -67,7 +67,7 @@ func (dict *SimpleDict) ForEach(consumer Consumer) {
 }
 
 func (dict *SimpleDict) Keys() []string {
-	keys := make([]string, len(dict.m))
+	keys := make([]string, 0, len(dict.m))
 	for k := range dict.m {
 		keys = append(keys, k)
 	}
@@ -0,0 +1,407 @@
+package ftindex
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+)
+
+/*
+	二级索引：按照key前缀索引hash，支持 NUMERIC、TAG、TEXT 三种字段
+		NUMERIC: 使用跳表（sortedset）保存 docId --> 数值，支持范围查询
+		TAG:     tag --> docId集合，精确匹配
+		TEXT:    分词后的 term --> docId集合，支持词项和前缀匹配
+*/
+
+// 字段类型
+const (
+	TypeNumeric = "NUMERIC"
+	TypeTag     = "TAG"
+	TypeText    = "TEXT"
+)
+
+const defaultTagSeparator = ","
+
+// Field 索引字段定义
+type Field struct {
+	Name      string
+	Type      string
+	Sortable  bool
+	Separator string // 仅TAG字段使用
+}
+
+// docSet docId集合
+type docSet map[string]struct{}
+
+// Index 一个二级索引
+type Index struct {
+	Name     string
+	Prefixes []string
+	Fields   []*Field
+
+	mu      sync.RWMutex
+	fields  map[string]*Field
+	docs    map[string]map[string]string // docId --> 被索引字段的原始值
+	numeric map[string]*sortedset.SortedSet
+	tags    map[string]map[string]docSet
+	texts   map[string]map[string]docSet
+}
+
+// Make 创建索引
+func Make(name string, prefixes []string, fields []*Field) *Index {
+	index := &Index{
+		Name:     name,
+		Prefixes: prefixes,
+		Fields:   fields,
+		fields:   make(map[string]*Field, len(fields)),
+		docs:     make(map[string]map[string]string),
+		numeric:  make(map[string]*sortedset.SortedSet),
+		tags:     make(map[string]map[string]docSet),
+		texts:    make(map[string]map[string]docSet),
+	}
+	for _, f := range fields {
+		if f.Type == TypeTag && f.Separator == "" {
+			f.Separator = defaultTagSeparator
+		}
+		index.fields[f.Name] = f
+		switch f.Type {
+		case TypeNumeric:
+			index.numeric[f.Name] = sortedset.Make()
+		case TypeTag:
+			index.tags[f.Name] = make(map[string]docSet)
+		case TypeText:
+			index.texts[f.Name] = make(map[string]docSet)
+		}
+	}
+	return index
+}
+
+// Match 判断key是否匹配索引前缀，没有配置前缀时匹配所有key
+func (index *Index) Match(key string) bool {
+	if len(index.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range index.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len 已索引的文档数
+func (index *Index) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return len(index.docs)
+}
+
+// DocIDs 返回所有已索引的文档
+func (index *Index) DocIDs() []string {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	ids := make([]string, 0, len(index.docs))
+	for id := range index.docs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Put 索引（或重新索引）一个文档，values 为 hash 的全部 field --> value
+func (index *Index) Put(docID string, values map[string]string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.remove(docID)
+
+	doc := make(map[string]string)
+	for name, f := range index.fields {
+		raw, ok := values[name]
+		if !ok {
+			continue
+		}
+		switch f.Type {
+		case TypeNumeric:
+			num, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue // 非数值内容不进入数值索引
+			}
+			index.numeric[name].Add(docID, num)
+		case TypeTag:
+			for _, tag := range splitTags(raw, f.Separator) {
+				addToSet(index.tags[name], tag, docID)
+			}
+		case TypeText:
+			for _, term := range Tokenize(raw) {
+				addToSet(index.texts[name], term, docID)
+			}
+		}
+		doc[name] = raw
+	}
+	index.docs[docID] = doc
+}
+
+// Remove 从索引中移除文档
+func (index *Index) Remove(docID string) bool {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	return index.remove(docID)
+}
+
+func (index *Index) remove(docID string) bool {
+	doc, ok := index.docs[docID]
+	if !ok {
+		return false
+	}
+	for name, raw := range doc {
+		f := index.fields[name]
+		switch f.Type {
+		case TypeNumeric:
+			index.numeric[name].Remove(docID)
+		case TypeTag:
+			for _, tag := range splitTags(raw, f.Separator) {
+				removeFromSet(index.tags[name], tag, docID)
+			}
+		case TypeText:
+			for _, term := range Tokenize(raw) {
+				removeFromSet(index.texts[name], term, docID)
+			}
+		}
+	}
+	delete(index.docs, docID)
+	return true
+}
+
+func addToSet(m map[string]docSet, term, docID string) {
+	set, ok := m[term]
+	if !ok {
+		set = make(docSet)
+		m[term] = set
+	}
+	set[docID] = struct{}{}
+}
+
+func removeFromSet(m map[string]docSet, term, docID string) {
+	set, ok := m[term]
+	if !ok {
+		return
+	}
+	delete(set, docID)
+	if len(set) == 0 {
+		delete(m, term)
+	}
+}
+
+// splitTags 按分隔符切分tag，tag匹配不区分大小写
+func splitTags(raw, separator string) []string {
+	parts := strings.Split(raw, separator)
+	tags := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p != "" {
+			tags = append(tags, p)
+		}
+	}
+	return tags
+}
+
+// Tokenize 将文本切分为小写词项，字母和数字以外的字符均视为分隔符
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	seen := make(map[string]struct{}, len(words))
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if _, ok := seen[w]; !ok {
+			seen[w] = struct{}{}
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+/* ---- 查询 ---- */
+
+// Document 查询结果
+type Document struct {
+	ID     string
+	Fields map[string]string // 被索引字段的值
+}
+
+// SearchOptions 查询选项
+type SearchOptions struct {
+	SortBy string
+	Desc   bool
+	Offset int
+	Limit  int // <0 表示不限制
+}
+
+// Search 执行查询，返回命中总数和分页后的文档
+func (index *Index) Search(query *Query, opts *SearchOptions) (int, []*Document, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var result docSet
+	for _, clause := range query.Clauses {
+		matched, err := index.evalClause(clause)
+		if err != nil {
+			return 0, nil, err
+		}
+		if result == nil {
+			result = matched
+		} else {
+			result = intersect(result, matched)
+		}
+	}
+	if result == nil { // 空查询或者 * 匹配全部
+		result = make(docSet, len(index.docs))
+		for id := range index.docs {
+			result[id] = struct{}{}
+		}
+	}
+
+	ids := make([]string, 0, len(result))
+	for id := range result {
+		ids = append(ids, id)
+	}
+	index.sortDocs(ids, opts)
+
+	total := len(ids)
+	start := opts.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if opts.Limit >= 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	docs := make([]*Document, 0, end-start)
+	for _, id := range ids[start:end] {
+		fields := make(map[string]string, len(index.docs[id]))
+		for k, v := range index.docs[id] {
+			fields[k] = v
+		}
+		docs = append(docs, &Document{ID: id, Fields: fields})
+	}
+	return total, docs, nil
+}
+
+// sortDocs 按SORTBY字段排序，没有指定时按docId排序保证结果稳定
+func (index *Index) sortDocs(ids []string, opts *SearchOptions) {
+	field, ok := index.fields[opts.SortBy]
+	if opts.SortBy == "" || !ok {
+		sort.Strings(ids)
+		return
+	}
+	less := func(a, b string) bool {
+		va, okA := index.docs[a][field.Name]
+		vb, okB := index.docs[b][field.Name]
+		if !okA || !okB {
+			// 缺少该字段的文档总是排在最后
+			if okA != okB {
+				return okA
+			}
+			return a < b
+		}
+		if va == vb {
+			return a < b
+		}
+		if field.Type == TypeNumeric {
+			na, errA := strconv.ParseFloat(va, 64)
+			nb, errB := strconv.ParseFloat(vb, 64)
+			if errA == nil && errB == nil {
+				if opts.Desc {
+					return na > nb
+				}
+				return na < nb
+			}
+		}
+		if opts.Desc {
+			return va > vb
+		}
+		return va < vb
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return less(ids[i], ids[j])
+	})
+}
+
+func (index *Index) evalClause(clause *Clause) (docSet, error) {
+	switch clause.Kind {
+	case clauseNumeric:
+		zset, ok := index.numeric[clause.Field]
+		if !ok {
+			return nil, errUnknownField(clause.Field, TypeNumeric)
+		}
+		result := make(docSet)
+		for _, e := range zset.RangeByScore(clause.Min, clause.Max, 0, -1, false) {
+			result[e.Member] = struct{}{}
+		}
+		return result, nil
+	case clauseTag:
+		tags, ok := index.tags[clause.Field]
+		if !ok {
+			return nil, errUnknownField(clause.Field, TypeTag)
+		}
+		result := make(docSet)
+		for _, tag := range clause.Terms {
+			for id := range tags[tag] {
+				result[id] = struct{}{}
+			}
+		}
+		return result, nil
+	case clauseText:
+		var fields []string
+		if clause.Field != "" {
+			if _, ok := index.texts[clause.Field]; !ok {
+				return nil, errUnknownField(clause.Field, TypeText)
+			}
+			fields = []string{clause.Field}
+		} else {
+			for name := range index.texts {
+				fields = append(fields, name)
+			}
+		}
+		result := make(docSet)
+		for _, name := range fields {
+			terms := index.texts[name]
+			for _, term := range clause.Terms {
+				if clause.Prefix {
+					for t, set := range terms {
+						if strings.HasPrefix(t, term) {
+							union(result, set)
+						}
+					}
+				} else {
+					union(result, terms[term])
+				}
+			}
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+func union(dest, src docSet) {
+	for id := range src {
+		dest[id] = struct{}{}
+	}
+}
+
+func intersect(a, b docSet) docSet {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	result := make(docSet)
+	for id := range a {
+		if _, ok := b[id]; ok {
+			result[id] = struct{}{}
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package ftindex
+
+import "testing"
+
+func makeTestIndex() *Index {
+	index := Make("idx", []string{"item:"}, []*Field{
+		{Name: "price", Type: TypeNumeric, Sortable: true},
+		{Name: "color", Type: TypeTag},
+		{Name: "title", Type: TypeText},
+	})
+	index.Put("item:1", map[string]string{"price": "10", "color": "red", "title": "Red apple"})
+	index.Put("item:2", map[string]string{"price": "25", "color": "green,red", "title": "Green apple pie"})
+	index.Put("item:3", map[string]string{"price": "40", "color": "blue", "title": "Blueberry"})
+	return index
+}
+
+func search(t *testing.T, index *Index, raw string, opts *SearchOptions) []string {
+	query, err := ParseQuery(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts == nil {
+		opts = &SearchOptions{Limit: -1}
+	}
+	_, docs, err := index.Search(query, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, query string, actual []string, expected ...string) {
+	if len(actual) != len(expected) {
+		t.Errorf("%s: expect %v, got %v", query, expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("%s: expect %v, got %v", query, expected, actual)
+			return
+		}
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := makeTestIndex()
+	cases := map[string][]string{
+		"*":                          {"item:1", "item:2", "item:3"},
+		"@price:[10 (40]":            {"item:1", "item:2"},
+		"@price:[(10 +inf]":          {"item:2", "item:3"},
+		"@color:{red}":               {"item:1", "item:2"},
+		"@color:{blue | green}":      {"item:2", "item:3"},
+		"apple":                      {"item:1", "item:2"},
+		"@title:blue*":               {"item:3"},
+		"apple @price:[20 30]":       {"item:2"},
+		"@color:{red} @title:pie":    {"item:2"},
+		"@color:{red} @title:banana": {},
+	}
+	for query, expected := range cases {
+		assertIDs(t, query, search(t, index, query, nil), expected...)
+	}
+}
+
+func TestIndex_SortAndLimit(t *testing.T) {
+	index := makeTestIndex()
+	ids := search(t, index, "*", &SearchOptions{SortBy: "price", Desc: true, Offset: 1, Limit: 1})
+	assertIDs(t, "sort desc", ids, "item:2")
+}
+
+func TestIndex_Reindex(t *testing.T) {
+	index := makeTestIndex()
+	index.Put("item:1", map[string]string{"price": "99", "color": "black"})
+	assertIDs(t, "old tag", search(t, index, "@color:{red}", nil), "item:2")
+	assertIDs(t, "new price", search(t, index, "@price:[90 100]", nil), "item:1")
+	index.Remove("item:2")
+	assertIDs(t, "removed", search(t, index, "apple", nil))
+}
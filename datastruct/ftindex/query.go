@@ -0,0 +1,137 @@
+package ftindex
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/HildaM/GoKV/datastruct/sortedset"
+)
+
+/*
+	查询语法（RediSearch子集），多个子句之间为AND关系：
+		*                    匹配全部文档
+		@price:[10 (100]     数值范围，( 表示开区间，支持 -inf +inf
+		@tag:{red | blue}    tag匹配，| 表示或
+		@title:hello         指定TEXT字段的词项匹配
+		hel*                 所有TEXT字段上的前缀匹配
+*/
+
+const (
+	clauseNumeric = iota
+	clauseTag
+	clauseText
+)
+
+// Clause 查询子句
+type Clause struct {
+	Kind   int
+	Field  string
+	Min    *sortedset.ScoreBorder
+	Max    *sortedset.ScoreBorder
+	Terms  []string
+	Prefix bool
+}
+
+// Query 解析后的查询
+type Query struct {
+	Clauses []*Clause
+}
+
+func errUnknownField(name, fieldType string) error {
+	return errors.New("ERR unknown " + strings.ToLower(fieldType) + " field '" + name + "'")
+}
+
+var errSyntax = errors.New("ERR syntax error in query")
+
+// ParseQuery 解析查询字符串
+func ParseQuery(raw string) (*Query, error) {
+	query := &Query{}
+	s := strings.TrimSpace(raw)
+	for len(s) > 0 {
+		var clause *Clause
+		var err error
+		if s[0] == '@' {
+			clause, s, err = parseFieldClause(s[1:])
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			word := s[:end]
+			s = s[end:]
+			if word != "*" {
+				clause, err = parseTextClause("", word)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if clause != nil {
+			query.Clauses = append(query.Clauses, clause)
+		}
+		s = strings.TrimSpace(s)
+	}
+	return query, nil
+}
+
+// parseFieldClause 解析 @field:... 形式的子句，返回剩余未解析的字符串
+func parseFieldClause(s string) (*Clause, string, error) {
+	colon := strings.IndexByte(s, ':')
+	if colon <= 0 || colon == len(s)-1 {
+		return nil, "", errSyntax
+	}
+	field := s[:colon]
+	s = s[colon+1:]
+
+	switch s[0] {
+	case '[':
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, "", errSyntax
+		}
+		parts := strings.Fields(s[1:end])
+		if len(parts) != 2 {
+			return nil, "", errSyntax
+		}
+		min, err := sortedset.ParseScoreBorder(parts[0])
+		if err != nil {
+			return nil, "", err
+		}
+		max, err := sortedset.ParseScoreBorder(parts[1])
+		if err != nil {
+			return nil, "", err
+		}
+		return &Clause{Kind: clauseNumeric, Field: field, Min: min, Max: max}, s[end+1:], nil
+	case '{':
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return nil, "", errSyntax
+		}
+		clause := &Clause{Kind: clauseTag, Field: field}
+		for _, tag := range strings.Split(s[1:end], "|") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" {
+				clause.Terms = append(clause.Terms, tag)
+			}
+		}
+		return clause, s[end+1:], nil
+	}
+
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		end = len(s)
+	}
+	clause, err := parseTextClause(field, s[:end])
+	return clause, s[end:], err
+}
+
+// parseTextClause 解析词项，以 * 结尾表示前缀匹配
+func parseTextClause(field, word string) (*Clause, error) {
+	prefix := strings.HasSuffix(word, "*")
+	word = strings.TrimSuffix(word, "*")
+	terms := Tokenize(word)
+	if len(terms) != 1 {
+		return nil, errSyntax
+	}
+	return &Clause{Kind: clauseText, Field: field, Terms: terms, Prefix: prefix}, nil
+}
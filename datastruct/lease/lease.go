@@ -0,0 +1,37 @@
+package lease
+
+import "time"
+
+/*
+	带租约的分布式锁：持有者需要在租约到期前续约，否则锁会被自动释放
+	每次获取锁都会分配一个单调递增的fencing token，存储服务可以据此拒绝过期持有者的写入
+*/
+
+// Lease 锁的持有状态
+type Lease struct {
+	Owner    string
+	Token    int64
+	Deadline time.Time
+}
+
+// Make 创建租约
+func Make(owner string, token int64, deadline time.Time) *Lease {
+	return &Lease{
+		Owner:    owner,
+		Token:    token,
+		Deadline: deadline,
+	}
+}
+
+// Expired 租约是否已经到期
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.Deadline)
+}
+
+// Remaining 返回剩余的租约时长
+func (l *Lease) Remaining(now time.Time) time.Duration {
+	if l.Expired(now) {
+		return 0
+	}
+	return l.Deadline.Sub(now)
+}
@@ -0,0 +1,25 @@
+package lease
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	now := time.Now()
+	l := Make("a", 1, now.Add(time.Second))
+	if l.Expired(now) {
+		t.Error("lease should not expire before deadline")
+	}
+	if remaining := l.Remaining(now); remaining != time.Second {
+		t.Errorf("expected 1s remaining, actual %v", remaining)
+	}
+
+	// 到达截止时间即视为到期
+	if !l.Expired(l.Deadline) || !l.Expired(now.Add(2*time.Second)) {
+		t.Error("lease should expire at deadline")
+	}
+	if remaining := l.Remaining(now.Add(2 * time.Second)); remaining != 0 {
+		t.Errorf("expired lease should have no remaining time, actual %v", remaining)
+	}
+}
@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	可靠队列：消息被取出后进入租约（lease）状态，消费者需要在租约到期前确认（ack），
+	否则消息会重新回到队列中。投递次数超过上限的消息会被转移到死信队列
+*/
+
+// Message 队列中的一条消息
+type Message struct {
+	ID         string
+	Payload    []byte
+	Deliveries int       // 已投递次数
+	Deadline   time.Time // 租约到期时间，零值表示消息处于就绪状态
+}
+
+// Leased 消息是否处于租约中
+func (msg *Message) Leased() bool {
+	return !msg.Deadline.IsZero()
+}
+
+// Queue 可靠队列，内部持有互斥锁，死信转移等跨key操作不依赖数据库的key锁
+type Queue struct {
+	mu            sync.Mutex
+	ready         *list.List               // 就绪消息，按入队顺序排列
+	readyIndex    map[string]*list.Element // id --> ready中的元素
+	leased        map[string]*Message      // id --> 租约中的消息
+	maxDeliveries int                      // 0 表示不限制投递次数
+	deadLetter    string                   // 死信队列的key，为空表示直接丢弃
+}
+
+// Make 创建队列
+func Make(maxDeliveries int, deadLetter string) *Queue {
+	return &Queue{
+		ready:         list.New(),
+		readyIndex:    make(map[string]*list.Element),
+		leased:        make(map[string]*Message),
+		maxDeliveries: maxDeliveries,
+		deadLetter:    deadLetter,
+	}
+}
+
+// MaxDeliveries 返回最大投递次数
+func (q *Queue) MaxDeliveries() int {
+	return q.maxDeliveries
+}
+
+// DeadLetter 返回死信队列的key
+func (q *Queue) DeadLetter() string {
+	return q.deadLetter
+}
+
+// Len 返回就绪消息数量
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.ready.Len()
+}
+
+// LeasedLen 返回租约中的消息数量
+func (q *Queue) LeasedLen() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.leased)
+}
+
+// Contains 消息是否存在（就绪或者租约中）
+func (q *Queue) Contains(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.contains(id)
+}
+
+func (q *Queue) contains(id string) bool {
+	if _, ok := q.readyIndex[id]; ok {
+		return true
+	}
+	_, ok := q.leased[id]
+	return ok
+}
+
+// Push 将消息追加到队尾，id已存在时返回false
+func (q *Queue) Push(msg *Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.contains(msg.ID) {
+		return false
+	}
+	if msg.Leased() {
+		q.leased[msg.ID] = msg
+	} else {
+		q.readyIndex[msg.ID] = q.ready.PushBack(msg)
+	}
+	return true
+}
+
+// Pop 从队首取出至多count条消息并设置租约，投递次数加一
+func (q *Queue) Pop(count int, deadline time.Time) []*Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	result := make([]*Message, 0, count)
+	for len(result) < count && q.ready.Len() > 0 {
+		msg := q.ready.Remove(q.ready.Front()).(*Message)
+		delete(q.readyIndex, msg.ID)
+		msg.Deliveries++
+		msg.Deadline = deadline
+		q.leased[msg.ID] = msg
+		result = append(result, msg)
+	}
+	return result
+}
+
+// Lease 为指定的就绪消息设置租约，用于aof重放
+func (q *Queue) Lease(id string, deadline time.Time) (*Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.readyIndex[id]
+	if !ok {
+		return nil, false
+	}
+	msg := q.ready.Remove(e).(*Message)
+	delete(q.readyIndex, id)
+	msg.Deliveries++
+	msg.Deadline = deadline
+	q.leased[id] = msg
+	return msg, true
+}
+
+// Ack 确认并删除租约中的消息
+func (q *Queue) Ack(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.leased[id]; !ok {
+		return false
+	}
+	delete(q.leased, id)
+	return true
+}
+
+// Nack 结束消息的租约。
+// 投递次数未达到上限时消息回到队尾，返回 (msg, false)；
+// 否则消息从队列中移除，返回 (msg, true)，由调用方转移到死信队列
+func (q *Queue) Nack(id string) (*Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msg, ok := q.leased[id]
+	if !ok {
+		return nil, false
+	}
+	delete(q.leased, id)
+	msg.Deadline = time.Time{}
+	if q.maxDeliveries > 0 && msg.Deliveries >= q.maxDeliveries {
+		return msg, true
+	}
+	q.readyIndex[id] = q.ready.PushBack(msg)
+	return msg, false
+}
+
+// Deadline 返回租约到期时间，消息不在租约中时返回false
+func (q *Queue) Deadline(id string) (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msg, ok := q.leased[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return msg.Deadline, true
+}
+
+// ForEach 遍历全部消息：先按顺序遍历就绪消息，再遍历租约中的消息
+// consumer 得到的是消息的拷贝
+func (q *Queue) ForEach(consumer func(msg Message) bool) {
+	q.mu.Lock()
+	messages := make([]Message, 0, q.ready.Len()+len(q.leased))
+	for e := q.ready.Front(); e != nil; e = e.Next() {
+		messages = append(messages, *e.Value.(*Message))
+	}
+	leased := make([]Message, 0, len(q.leased))
+	for _, msg := range q.leased {
+		leased = append(leased, *msg)
+	}
+	q.mu.Unlock()
+	sort.Slice(leased, func(i, j int) bool {
+		return leased[i].ID < leased[j].ID
+	})
+	messages = append(messages, leased...)
+
+	for _, msg := range messages {
+		if !consumer(msg) {
+			break
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQueue_PopAck(t *testing.T) {
+	q := Make(0, "")
+	for i := 0; i < 5; i++ {
+		q.Push(&Message{ID: strconv.Itoa(i), Payload: []byte("m" + strconv.Itoa(i))})
+	}
+	if q.Push(&Message{ID: "0"}) {
+		t.Error("duplicate id should be rejected")
+	}
+	deadline := time.Now().Add(time.Minute)
+	msgs := q.Pop(2, deadline)
+	if len(msgs) != 2 || msgs[0].ID != "0" || msgs[1].ID != "1" {
+		t.Fatalf("wrong pop result: %v", msgs)
+	}
+	if msgs[0].Deliveries != 1 || !msgs[0].Deadline.Equal(deadline) {
+		t.Error("lease not set")
+	}
+	if q.Len() != 3 || q.LeasedLen() != 2 {
+		t.Errorf("expected 3 ready 2 leased, got %d %d", q.Len(), q.LeasedLen())
+	}
+	if !q.Ack("0") || q.Ack("0") {
+		t.Error("ack should succeed exactly once")
+	}
+	if q.Ack("2") {
+		t.Error("ready message cannot be acked")
+	}
+	if q.Contains("0") {
+		t.Error("acked message should be removed")
+	}
+}
+
+func TestQueue_NackDeadLetter(t *testing.T) {
+	q := Make(2, "dlq")
+	q.Push(&Message{ID: "a"})
+	q.Push(&Message{ID: "b"})
+
+	q.Pop(1, time.Now())
+	msg, dead := q.Nack("a")
+	if msg == nil || dead {
+		t.Fatal("first nack should requeue")
+	}
+	if msg.Leased() {
+		t.Error("requeued message should not be leased")
+	}
+	// 回到队尾
+	msgs := q.Pop(2, time.Now())
+	if len(msgs) != 2 || msgs[0].ID != "b" || msgs[1].ID != "a" {
+		t.Fatalf("wrong order after nack: %v", msgs)
+	}
+	msg, dead = q.Nack("a")
+	if msg == nil || !dead || msg.Deliveries != 2 {
+		t.Fatal("message should be dead lettered after max deliveries")
+	}
+	if q.Contains("a") {
+		t.Error("dead lettered message should be removed")
+	}
+	if _, ok := q.Nack("a"); ok {
+		t.Error("nack of unknown message should fail")
+	}
+}
+
+func TestQueue_LeaseAndForEach(t *testing.T) {
+	q := Make(0, "")
+	q.Push(&Message{ID: "1"})
+	q.Push(&Message{ID: "2"})
+	q.Push(&Message{ID: "3", Deliveries: 4, Deadline: time.Now().Add(time.Hour)})
+	if _, ok := q.Lease("2", time.Now().Add(time.Hour)); !ok {
+		t.Fatal("lease ready message failed")
+	}
+	if _, ok := q.Lease("2", time.Now()); ok {
+		t.Error("leased message cannot be leased again")
+	}
+	ids := make([]string, 0)
+	q.ForEach(func(msg Message) bool {
+		ids = append(ids, msg.ID)
+		return true
+	})
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "2" || ids[2] != "3" {
+		t.Errorf("wrong foreach order: %v", ids)
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import "time"
+
+/*
+	GCRA (Generic Cell Rate Algorithm) 限流，与 redis-cell 的语义保持一致
+	只需要保存一个理论到达时间（TAT），每次请求都是 O(1) 的
+*/
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int64         // 允许的突发数量
+	Remaining  int64         // 当前还可以通过的请求数
+	RetryAfter time.Duration // 被限流时，需要等待多久才能重试；允许通过时为-1
+	ResetAfter time.Duration // 多久之后限流器恢复到初始状态
+}
+
+// GCRA 根据上一次保存的TAT判断本次请求是否可以通过，返回判断结果和新的TAT
+// 每 period 时间允许 count 个请求，允许额外突发 maxBurst 个请求
+func GCRA(tat, now time.Time, maxBurst, count int64, period time.Duration, quantity int64) (*Result, time.Time) {
+	emission := period / time.Duration(count)
+	tolerance := emission * time.Duration(maxBurst+1)
+	increment := emission * time.Duration(quantity)
+
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(increment)
+	allowAt := newTat.Add(-tolerance)
+	diff := now.Sub(allowAt)
+
+	result := &Result{
+		Limit:      maxBurst + 1,
+		RetryAfter: -1,
+	}
+	var ttl time.Duration
+	if diff < 0 {
+		// 被限流，TAT保持不变
+		if increment <= tolerance {
+			result.RetryAfter = -diff
+		}
+		ttl = tat.Sub(now)
+		newTat = tat
+	} else {
+		result.Allowed = true
+		ttl = newTat.Sub(now)
+	}
+
+	next := tolerance - ttl
+	if next > -emission {
+		result.Remaining = int64(next / emission)
+	}
+	result.ResetAfter = ttl
+	return result, newTat
+}
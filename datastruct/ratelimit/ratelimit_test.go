@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var tat time.Time
+	// 每秒1个请求，允许突发4个，共5个
+	for i := 0; i < 5; i++ {
+		var result *Result
+		result, tat = GCRA(tat, now, 4, 1, time.Second, 1)
+		if !result.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+		if result.Limit != 5 || result.Remaining != int64(4-i) {
+			t.Errorf("request %d: wrong limit/remaining %d/%d", i, result.Limit, result.Remaining)
+		}
+		if result.RetryAfter != -1 {
+			t.Errorf("request %d: retry after should be -1", i)
+		}
+	}
+	result, next := GCRA(tat, now, 4, 1, time.Second, 1)
+	if result.Allowed || !next.Equal(tat) {
+		t.Fatal("request should be limited without changing tat")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("expected retry after 1s, got %v", result.RetryAfter)
+	}
+	if result.ResetAfter != 5*time.Second {
+		t.Errorf("expected reset after 5s, got %v", result.ResetAfter)
+	}
+
+	// 一秒后恢复一个配额
+	result, _ = GCRA(tat, now.Add(time.Second), 4, 1, time.Second, 1)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected allowed with 0 remaining, got %v %d", result.Allowed, result.Remaining)
+	}
+
+	// 请求数量超过突发上限，永远不会通过
+	result, _ = GCRA(time.Time{}, now, 4, 1, time.Second, 6)
+	if result.Allowed || result.RetryAfter != -1 {
+		t.Error("quantity larger than limit should never be allowed")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := MakeSlidingWindow(10 * time.Second)
+	for i := int64(0); i < 3; i++ {
+		result := w.Allow(1000+i*1000, 3, 1)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, result)
+		}
+	}
+	result := w.Allow(5000, 3, 1)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("request should be limited: %+v", result)
+	}
+	// 第一个请求在 11000 滑出窗口
+	if result.RetryAfter != 6*time.Second {
+		t.Errorf("expected retry after 6s, got %v", result.RetryAfter)
+	}
+	if result.ResetAfter != 8*time.Second {
+		t.Errorf("expected reset after 8s, got %v", result.ResetAfter)
+	}
+	result = w.Allow(11000, 3, 1)
+	if !result.Allowed || w.Len() != 3 {
+		t.Errorf("request should be allowed after the oldest one expired: %+v", result)
+	}
+	if result = w.Allow(11000, 3, 4); result.Allowed || result.RetryAfter != -1 {
+		t.Error("quantity larger than limit should never be allowed")
+	}
+	w.Trim(30000)
+	if w.Len() != 0 {
+		t.Error("all entries should be trimmed")
+	}
+}
+
+func TestSlidingWindowLargeQuantity(t *testing.T) {
+	w := MakeSlidingWindow(10 * time.Second)
+	// 同一时刻的请求合并，占用的空间与数量无关
+	if result := w.Allow(1000, math.MaxInt64, 1e12); !result.Allowed {
+		t.Fatalf("request should be allowed: %+v", result)
+	}
+	w.Add(1000, 1e12)
+	w.Add(2000, 1)
+	if w.BucketCount() != 2 || w.Len() != 2e12+1 {
+		t.Errorf("expected 2 buckets with %d requests, actual %d/%d", int64(2e12+1), w.BucketCount(), w.Len())
+	}
+	// 超出 limit 的请求需要等待第一个桶滑出窗口
+	result := w.Allow(3000, 2e12, 1)
+	if result.Allowed || result.RetryAfter != 8*time.Second {
+		t.Errorf("expected retry after 8s, actual %+v", result)
+	}
+	w.Trim(11000)
+	if w.BucketCount() != 1 || w.Len() != 1 {
+		t.Errorf("expected 1 request left, actual %d", w.Len())
+	}
+	if result := w.Allow(11000, math.MaxInt64, math.MaxInt64); result.Allowed {
+		t.Error("overflowing quantity should not be allowed")
+	}
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import "time"
+
+/*
+	滑动窗口日志限流：记录窗口内每一次通过的请求时间，精确但是需要保存窗口内的请求记录
+	同一时刻的请求合并为一个桶，空间与请求的时刻数相关，与请求数量无关
+*/
+
+// Bucket 同一时刻（毫秒）通过的请求数
+type Bucket struct {
+	Timestamp int64
+	Count     int64
+}
+
+// SlidingWindow 按时间升序保存窗口内的请求
+type SlidingWindow struct {
+	window  int64 // 窗口长度（毫秒）
+	buckets []Bucket
+	total   int64 // 窗口内的请求总数
+}
+
+// MakeSlidingWindow 创建滑动窗口
+func MakeSlidingWindow(window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		window: window.Milliseconds(),
+	}
+}
+
+// Window 返回窗口长度
+func (w *SlidingWindow) Window() time.Duration {
+	return time.Duration(w.window) * time.Millisecond
+}
+
+// Len 返回窗口内的请求数
+func (w *SlidingWindow) Len() int64 {
+	return w.total
+}
+
+// BucketCount 返回窗口内不同时刻的数量
+func (w *SlidingWindow) BucketCount() int {
+	return len(w.buckets)
+}
+
+// Buckets 返回窗口内请求记录的拷贝
+func (w *SlidingWindow) Buckets() []Bucket {
+	buckets := make([]Bucket, len(w.buckets))
+	copy(buckets, w.buckets)
+	return buckets
+}
+
+// Trim 删除在now时刻已经滑出窗口的请求
+func (w *SlidingWindow) Trim(now int64) {
+	i := 0
+	for i < len(w.buckets) && w.buckets[i].Timestamp <= now-w.window {
+		w.total -= w.buckets[i].Count
+		i++
+	}
+	if i > 0 {
+		w.buckets = append(w.buckets[:0], w.buckets[i:]...)
+	}
+}
+
+// Add 在timestamp时刻记录quantity个请求，timestamp不能早于已有的请求
+func (w *SlidingWindow) Add(timestamp int64, quantity int64) {
+	if quantity <= 0 {
+		return
+	}
+	if n := len(w.buckets); n > 0 && w.buckets[n-1].Timestamp == timestamp {
+		w.buckets[n-1].Count += quantity
+	} else {
+		w.buckets = append(w.buckets, Bucket{Timestamp: timestamp, Count: quantity})
+	}
+	w.total += quantity
+}
+
+// ExpireAt 返回窗口内所有请求都滑出窗口的时刻，窗口为空时返回false
+func (w *SlidingWindow) ExpireAt() (int64, bool) {
+	if len(w.buckets) == 0 {
+		return 0, false
+	}
+	return w.buckets[len(w.buckets)-1].Timestamp + w.window, true
+}
+
+// nth 返回第n个（从1开始）最旧的请求的时刻
+func (w *SlidingWindow) nth(n int64) int64 {
+	for _, bucket := range w.buckets {
+		if n <= bucket.Count {
+			return bucket.Timestamp
+		}
+		n -= bucket.Count
+	}
+	return w.buckets[len(w.buckets)-1].Timestamp
+}
+
+// Allow 判断now时刻的quantity个请求是否可以通过，可以通过时记录请求
+func (w *SlidingWindow) Allow(now int64, limit int64, quantity int64) *Result {
+	w.Trim(now)
+	result := &Result{
+		Limit:      limit,
+		RetryAfter: -1,
+	}
+	used := w.total
+	// 使用减法比较，避免 used+quantity 溢出
+	if quantity <= limit-used {
+		result.Allowed = true
+		w.Add(now, quantity)
+		used += quantity
+	} else if quantity <= limit {
+		// 需要等待最旧的 used+quantity-limit 个请求滑出窗口
+		oldest := w.nth(quantity - (limit - used))
+		result.RetryAfter = time.Duration(oldest+w.window-now) * time.Millisecond
+	}
+	result.Remaining = limit - used
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if expireAt, ok := w.ExpireAt(); ok {
+		result.ResetAfter = time.Duration(expireAt-now) * time.Millisecond
+	}
+	return result
+}
@@ -1,5 +1,10 @@
 package sortedset
 
+import (
+	"errors"
+	"strconv"
+)
+
 /*
 ScoreBorder 是一个封装类。用以在ZRangeByScore命令中表示min、max等范围
 支持的范围：
@@ -54,3 +59,27 @@ var positiveInfBorder = &ScoreBorder{
 var negativeInfBorder = &ScoreBorder{
 	Inf: negativeInf,
 }
+
+// ParseScoreBorder 解析范围字符串，支持 +inf、-inf 以及 "(" 开头的开区间
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	if s == "inf" || s == "+inf" {
+		return positiveInfBorder, nil
+	}
+	if s == "-inf" {
+		return negativeInfBorder, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, errors.New("ERR min or max is not a float")
+	}
+	return &ScoreBorder{
+		Inf:     0,
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
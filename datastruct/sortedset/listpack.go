@@ -0,0 +1,160 @@
+package sortedset
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+)
+
+/*
+	listpack 紧凑编码：元素较少的有序集合按照 (score, member) 升序依次保存在一段连续的内存中
+	每个元素的格式： member长度(uvarint) | member | score(8字节，大端序的float64)
+	查找、插入、删除都是线性扫描，元素数量受 zset-max-listpack-entries 限制，扫描的开销很小
+	相比 map + 跳表 省去了每个元素的节点、层级指针和哈希表项
+*/
+
+const (
+	EncodingListpack = "listpack"
+	EncodingSkiplist = "skiplist"
+
+	defaultListpackMaxEntries = 128
+	defaultListpackMaxValue   = 64
+
+	scoreSize = 8
+)
+
+var (
+	listpackMaxEntries int64 = defaultListpackMaxEntries // 超过此数量的元素后转换为跳表
+	listpackMaxValue   int64 = defaultListpackMaxValue   // member长度超过此值后转换为跳表
+)
+
+// SetListpackLimits 设置使用紧凑编码的阈值，0表示使用默认值，负数表示不使用紧凑编码
+// 只影响之后的写入，已经转换为跳表的集合不会转换回来
+func SetListpackLimits(maxEntries, maxValue int) {
+	if maxEntries == 0 {
+		maxEntries = defaultListpackMaxEntries
+	}
+	if maxValue == 0 {
+		maxValue = defaultListpackMaxValue
+	}
+	atomic.StoreInt64(&listpackMaxEntries, int64(maxEntries))
+	atomic.StoreInt64(&listpackMaxValue, int64(maxValue))
+}
+
+// fitsListpack 判断包含length个元素、其中有member的集合能否使用紧凑编码
+func fitsListpack(length int64, member string) bool {
+	return length <= atomic.LoadInt64(&listpackMaxEntries) &&
+		int64(len(member)) <= atomic.LoadInt64(&listpackMaxValue)
+}
+
+type listpack struct {
+	buf    []byte
+	length int64
+}
+
+// entry 解码offset处的元素，返回member、score以及下一个元素的位置。member引用buf中的内存
+func (lp *listpack) entry(offset int) ([]byte, float64, int) {
+	size, n := binary.Uvarint(lp.buf[offset:])
+	start := offset + n
+	end := start + int(size)
+	score := math.Float64frombits(binary.BigEndian.Uint64(lp.buf[end:]))
+	return lp.buf[start:end], score, end + scoreSize
+}
+
+// element 解码offset处的元素
+func (lp *listpack) element(offset int) *Element {
+	member, score, _ := lp.entry(offset)
+	return &Element{Member: string(member), Score: score}
+}
+
+// offsets 返回所有元素的起始位置，用于按照排名访问
+func (lp *listpack) offsets() []int {
+	result := make([]int, 0, lp.length)
+	for offset := 0; offset < len(lp.buf); {
+		result = append(result, offset)
+		_, _, offset = lp.entry(offset)
+	}
+	return result
+}
+
+// find 查找member，返回其位置、排名（从0开始）和score
+func (lp *listpack) find(member string) (offset int, rank int64, score float64, ok bool) {
+	for offset < len(lp.buf) {
+		m, s, next := lp.entry(offset)
+		if string(m) == member {
+			return offset, rank, s, true
+		}
+		offset = next
+		rank++
+	}
+	return 0, -1, 0, false
+}
+
+// insert 按照 (score, member) 的顺序插入新元素，调用者保证member不存在
+func (lp *listpack) insert(member string, score float64) {
+	offset := 0
+	for offset < len(lp.buf) {
+		m, s, next := lp.entry(offset)
+		if s > score || (s == score && string(m) > member) {
+			break
+		}
+		offset = next
+	}
+
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(member)))
+	size := n + len(member) + scoreSize
+
+	lp.buf = append(lp.buf, make([]byte, size)...)
+	copy(lp.buf[offset+size:], lp.buf[offset:len(lp.buf)-size])
+	copy(lp.buf[offset:], header[:n])
+	copy(lp.buf[offset+n:], member)
+	binary.BigEndian.PutUint64(lp.buf[offset+n+len(member):], math.Float64bits(score))
+	lp.length++
+}
+
+// removeRange 删除[from, to)字节范围内的元素，返回被删除的元素
+func (lp *listpack) removeRange(from, to int) []*Element {
+	removed := make([]*Element, 0)
+	for offset := from; offset < to; {
+		member, score, next := lp.entry(offset)
+		removed = append(removed, &Element{Member: string(member), Score: score})
+		offset = next
+	}
+	lp.buf = append(lp.buf[:from], lp.buf[to:]...)
+	lp.length -= int64(len(removed))
+	return removed
+}
+
+// scoreRange 返回score在[min, max]范围内的元素所在的字节范围
+func (lp *listpack) scoreRange(min, max *ScoreBorder) (from, to int) {
+	from, to = -1, -1
+	for offset := 0; offset < len(lp.buf); {
+		_, score, next := lp.entry(offset)
+		if !max.greater(score) {
+			break
+		}
+		if min.less(score) {
+			if from < 0 {
+				from = offset
+			}
+			to = next
+		}
+		offset = next
+	}
+	return from, to
+}
+
+// toSkiplist 转换为 map + 跳表 编码
+func (lp *listpack) toSkiplist() (map[string]*Element, *skiplist) {
+	dict := make(map[string]*Element, lp.length)
+	sl := makeSkiplist()
+	for offset := 0; offset < len(lp.buf); {
+		member, score, next := lp.entry(offset)
+		element := &Element{Member: string(member), Score: score}
+		dict[element.Member] = element
+		sl.insert(element.Member, score)
+		offset = next
+	}
+	return dict, sl
+}
@@ -0,0 +1,143 @@
+package sortedset
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// makeSkiplistSet 创建一个始终使用跳表编码的有序集合
+func makeSkiplistSet() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+func elementsToString(elements []*Element) string {
+	var sb strings.Builder
+	for _, e := range elements {
+		sb.WriteString(e.Member)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.FormatFloat(e.Score, 'f', -1, 64))
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+func TestListpackEncoding(t *testing.T) {
+	set := Make()
+	if set.Encoding() != EncodingListpack {
+		t.Fatalf("expected listpack, actual %s", set.Encoding())
+	}
+	for i := 0; i < defaultListpackMaxEntries; i++ {
+		set.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	if set.Encoding() != EncodingListpack {
+		t.Fatalf("expected listpack with %d entries, actual %s", set.Len(), set.Encoding())
+	}
+	set.Add("overflow", 0)
+	if set.Encoding() != EncodingSkiplist || set.Len() != defaultListpackMaxEntries+1 {
+		t.Fatalf("expected skiplist after exceeding entries, actual %s %d", set.Encoding(), set.Len())
+	}
+	if e, ok := set.Get("m5"); !ok || e.Score != 5 {
+		t.Errorf("element lost during conversion")
+	}
+
+	set = Make()
+	set.Add("a", 1)
+	set.Add(strings.Repeat("x", defaultListpackMaxValue+1), 2)
+	if set.Encoding() != EncodingSkiplist {
+		t.Errorf("expected skiplist after exceeding value size, actual %s", set.Encoding())
+	}
+
+	SetListpackLimits(-1, 0)
+	defer SetListpackLimits(0, 0)
+	if Make().Encoding() != EncodingSkiplist {
+		t.Errorf("expected skiplist when listpack is disabled")
+	}
+}
+
+// TestListpackConsistency 随机操作两种编码的集合，结果必须一致
+func TestListpackConsistency(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lp := Make()
+	sl := makeSkiplistSet()
+	member := func() string {
+		return "m" + strconv.Itoa(r.Intn(40))
+	}
+	score := func() float64 {
+		return float64(r.Intn(20))
+	}
+	border := func() *ScoreBorder {
+		switch r.Intn(6) {
+		case 0:
+			return negativeInfBorder
+		case 1:
+			return positiveInfBorder
+		}
+		return &ScoreBorder{Value: score(), Exclude: r.Intn(2) == 0}
+	}
+
+	for i := 0; i < 5000; i++ {
+		var got, expected string
+		switch r.Intn(9) {
+		case 0, 1, 2:
+			m, s := member(), score()
+			got = strconv.FormatBool(lp.Add(m, s))
+			expected = strconv.FormatBool(sl.Add(m, s))
+		case 3:
+			m := member()
+			got = strconv.FormatBool(lp.Remove(m))
+			expected = strconv.FormatBool(sl.Remove(m))
+		case 4:
+			m, desc := member(), r.Intn(2) == 0
+			got = strconv.FormatInt(lp.GetRank(m, desc), 10)
+			expected = strconv.FormatInt(sl.GetRank(m, desc), 10)
+		case 5:
+			min, max := border(), border()
+			got = strconv.FormatInt(lp.Count(min, max), 10)
+			expected = strconv.FormatInt(sl.Count(min, max), 10)
+		case 6:
+			min, max := border(), border()
+			offset, limit, desc := int64(r.Intn(3)), int64(r.Intn(5)-1), r.Intn(2) == 0
+			got = elementsToString(lp.RangeByScore(min, max, offset, limit, desc))
+			expected = elementsToString(sl.RangeByScore(min, max, offset, limit, desc))
+		case 7:
+			if r.Intn(4) == 0 {
+				min, max := border(), border()
+				got = strconv.FormatInt(lp.RemoveByScore(min, max), 10)
+				expected = strconv.FormatInt(sl.RemoveByScore(min, max), 10)
+			} else if size := lp.Len(); size > 0 {
+				start := r.Int63n(size)
+				end := start + r.Int63n(size-start) + 1
+				if r.Intn(2) == 0 {
+					got = strconv.FormatInt(lp.RemoveByRank(start, end), 10)
+					expected = strconv.FormatInt(sl.RemoveByRank(start, end), 10)
+				} else {
+					count := r.Intn(3) + 1
+					got = elementsToString(lp.PopMin(count))
+					expected = elementsToString(sl.PopMin(count))
+				}
+			}
+		case 8:
+			if size := lp.Len(); size > 0 {
+				start := r.Int63n(size)
+				end := start + r.Int63n(size-start) + 1
+				desc := r.Intn(2) == 0
+				got = elementsToString(lp.Range(start, end, desc))
+				expected = elementsToString(sl.Range(start, end, desc))
+			}
+		}
+		if got != expected {
+			t.Fatalf("step %d: listpack %q, skiplist %q", i, got, expected)
+		}
+		if lp.Len() != sl.Len() {
+			t.Fatalf("step %d: listpack len %d, skiplist len %d", i, lp.Len(), sl.Len())
+		}
+	}
+	if lp.Encoding() != EncodingListpack {
+		t.Errorf("expected listpack, actual %s", lp.Encoding())
+	}
+}
@@ -65,7 +65,7 @@ func (skiplist *skiplist) getRank(member string, score float64) int64 {
 	for i := skiplist.level - 1; i >= 0; i-- {
 		for node.level[i].forward != nil &&
 			(node.level[i].forward.Score < score ||
-				(node.level[i].forward.Score == score && node.level[i].forward.Member < member)) {
+				(node.level[i].forward.Score == score && node.level[i].forward.Member <= member)) {
 			rank += node.level[i].span
 			node = node.level[i].forward
 		}
@@ -144,8 +144,12 @@ func (skiplist *skiplist) getLastInScoreRange(min *ScoreBorder, max *ScoreBorder
 
 // hasInRange 判断当前范围是否可以覆盖zset数值范围
 func (skiplist *skiplist) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
-	// 异常判断
-	if (min.Value > max.Value) || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+	// 异常判断：无穷边界不参与数值比较
+	if min.Inf == positiveInf || max.Inf == negativeInf {
+		return false
+	}
+	if min.Inf == 0 && max.Inf == 0 &&
+		((min.Value > max.Value) || (min.Value == max.Value && (min.Exclude || max.Exclude))) {
 		return false
 	}
 
@@ -388,7 +392,8 @@ func (skiplist *skiplist) remove(member string, score float64) bool {
 	node := skiplist.header
 	for level := skiplist.level - 1; level >= 0; level-- {
 		for node.level[level].forward != nil &&
-			(node.level[level].forward.Score < score) || (node.level[level].forward.Score == score && node.level[level].forward.Member < member) {
+			(node.level[level].forward.Score < score ||
+				(node.level[level].forward.Score == score && node.level[level].forward.Member < member)) {
 			node = node.level[level].forward
 		}
 
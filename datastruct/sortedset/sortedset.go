@@ -3,20 +3,66 @@ package sortedset
 import "strconv"
 
 // SortedSet 对外提供的操作接口，封装skiplist的方法对外服务
+// 元素较少时使用listpack紧凑编码，此时dict和skiplist为nil；超过阈值后自动转换为 map + 跳表
 type SortedSet struct {
+	listpack *listpack
 	dict     map[string]*Element
 	skiplist *skiplist
 }
 
 func Make() *SortedSet {
+	if fitsListpack(0, "") {
+		return &SortedSet{
+			listpack: &listpack{},
+		}
+	}
 	return &SortedSet{
 		dict:     make(map[string]*Element),
 		skiplist: makeSkiplist(),
 	}
 }
 
+// Encoding 返回当前的编码方式
+func (sortedSet *SortedSet) Encoding() string {
+	if sortedSet.listpack != nil {
+		return EncodingListpack
+	}
+	return EncodingSkiplist
+}
+
+// ListpackBytes 返回紧凑编码占用的字节数，跳表编码时返回0
+func (sortedSet *SortedSet) ListpackBytes() int64 {
+	if sortedSet.listpack == nil {
+		return 0
+	}
+	return int64(cap(sortedSet.listpack.buf))
+}
+
+// convert 从紧凑编码转换为跳表编码
+func (sortedSet *SortedSet) convert() {
+	sortedSet.dict, sortedSet.skiplist = sortedSet.listpack.toSkiplist()
+	sortedSet.listpack = nil
+}
+
 // Add 增加元素。如果已经存在member，则返回false
 func (sortedSet *SortedSet) Add(member string, score float64) bool {
+	if lp := sortedSet.listpack; lp != nil {
+		offset, _, oldScore, ok := lp.find(member)
+		if ok {
+			if score != oldScore {
+				_, _, next := lp.entry(offset)
+				lp.removeRange(offset, next)
+				lp.insert(member, score)
+			}
+			return false
+		}
+		if fitsListpack(lp.length+1, member) {
+			lp.insert(member, score)
+			return true
+		}
+		sortedSet.convert()
+	}
+
 	element, ok := sortedSet.dict[member]
 	sortedSet.dict[member] = &Element{ // 更新member的值
 		Member: member,
@@ -37,6 +83,13 @@ func (sortedSet *SortedSet) Add(member string, score float64) bool {
 
 // Get 获取指定元素
 func (sortedSet *SortedSet) Get(member string) (*Element, bool) {
+	if lp := sortedSet.listpack; lp != nil {
+		_, _, score, ok := lp.find(member)
+		if !ok {
+			return nil, false
+		}
+		return &Element{Member: member, Score: score}, true
+	}
 	element, ok := sortedSet.dict[member]
 	if !ok {
 		return nil, false
@@ -46,6 +99,15 @@ func (sortedSet *SortedSet) Get(member string) (*Element, bool) {
 
 // Remove 删除指定的member
 func (sortedSet *SortedSet) Remove(member string) bool {
+	if lp := sortedSet.listpack; lp != nil {
+		offset, _, _, ok := lp.find(member)
+		if !ok {
+			return false
+		}
+		_, _, next := lp.entry(offset)
+		lp.removeRange(offset, next)
+		return true
+	}
 	v, ok := sortedSet.dict[member]
 	if !ok {
 		return false
@@ -58,11 +120,24 @@ func (sortedSet *SortedSet) Remove(member string) bool {
 
 // Len
 func (sortedSet *SortedSet) Len() int64 {
+	if sortedSet.listpack != nil {
+		return sortedSet.listpack.length
+	}
 	return int64(len(sortedSet.dict))
 }
 
 // GetRank 获取指定member的排序，默认按照升序排列，从0开始
 func (sortedSet *SortedSet) GetRank(member string, desc bool) int64 {
+	if lp := sortedSet.listpack; lp != nil {
+		_, rank, _, ok := lp.find(member)
+		if !ok {
+			return -1
+		}
+		if desc {
+			rank = lp.length - 1 - rank
+		}
+		return rank
+	}
 	v, ok := sortedSet.dict[member]
 	if !ok {
 		return -1
@@ -87,6 +162,20 @@ func (sortedSet *SortedSet) ForEach(start, end int64, desc bool, consumer func(e
 		panic("illegal end " + strconv.FormatInt(end, 10))
 	}
 
+	if lp := sortedSet.listpack; lp != nil {
+		offsets := lp.offsets()
+		for i := start; i < end; i++ {
+			rank := i
+			if desc {
+				rank = size - 1 - i
+			}
+			if !consumer(lp.element(offsets[rank])) {
+				break
+			}
+		}
+		return
+	}
+
 	// 1. 寻找开头的节点
 	var node *node
 	if desc {
@@ -95,7 +184,7 @@ func (sortedSet *SortedSet) ForEach(start, end int64, desc bool, consumer func(e
 			node = sortedSet.skiplist.getByRank(int64(size - start)) // 寻找倒序开头（即end元素）
 		}
 	} else {
-		node = sortedSet.skiplist.header
+		node = sortedSet.skiplist.header.level[0].forward // 跳过头节点
 		if start > 0 {
 			node = sortedSet.skiplist.getByRank(int64(start + 1))
 		}
@@ -133,6 +222,9 @@ func (sortedSet *SortedSet) Range(start, end int64, desc bool) []*Element {
 // Count 记录在指定范围内的元素数量
 func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
 	var count int64 = 0
+	if sortedSet.Len() == 0 {
+		return 0
+	}
 
 	// 按升序遍历
 	sortedSet.ForEach(0, sortedSet.Len(), false, func(element *Element) bool {
@@ -154,6 +246,29 @@ func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
 
 // ForEachByScore 遍历在范围内的元素
 func (sortedSet *SortedSet) ForEachByScore(min, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	if lp := sortedSet.listpack; lp != nil {
+		from, to := lp.scoreRange(min, max)
+		if from < 0 {
+			return
+		}
+		elements := make([]*Element, 0)
+		for pos := from; pos < to; {
+			member, score, next := lp.entry(pos)
+			elements = append(elements, &Element{Member: string(member), Score: score})
+			pos = next
+		}
+		for i := offset; i < int64(len(elements)) && (i-offset < limit || limit < 0); i++ {
+			element := elements[i]
+			if desc {
+				element = elements[int64(len(elements))-1-i]
+			}
+			if !consumer(element) {
+				break
+			}
+		}
+		return
+	}
+
 	// 1. 寻找遍历起点
 	var node *node
 	if desc {
@@ -171,6 +286,10 @@ func (sortedSet *SortedSet) ForEachByScore(min, max *ScoreBorder, offset int64,
 		}
 		offset--
 	}
+	// 跳过offset后可能已经离开了范围
+	if node == nil || !min.less(node.Element.Score) || !max.greater(node.Element.Score) {
+		return
+	}
 
 	// 3. 获取数据
 	// 如果limit<0，则将获取所有数据
@@ -214,6 +333,13 @@ func (sortedSet *SortedSet) RangeByScore(min, max *ScoreBorder, offset, limit in
 
 // RemoveByScore 删除指定范围内的元素
 func (sortedSet *SortedSet) RemoveByScore(min, max *ScoreBorder) int64 {
+	if lp := sortedSet.listpack; lp != nil {
+		from, to := lp.scoreRange(min, max)
+		if from < 0 {
+			return 0
+		}
+		return int64(len(lp.removeRange(from, to)))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByScore(min, max, 0)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
@@ -224,6 +350,16 @@ func (sortedSet *SortedSet) RemoveByScore(min, max *ScoreBorder) int64 {
 // RemoveByRank 删除指定rank的元素
 // [start, end) 从0开始计数
 func (sortedSet *SortedSet) RemoveByRank(start, end int64) int64 {
+	if lp := sortedSet.listpack; lp != nil {
+		if end > lp.length {
+			end = lp.length
+		}
+		if start < 0 || start >= end {
+			return 0
+		}
+		offsets := append(lp.offsets(), len(lp.buf))
+		return int64(len(lp.removeRange(offsets[start], offsets[end])))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByRank(start+1, end+1)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
@@ -233,6 +369,17 @@ func (sortedSet *SortedSet) RemoveByRank(start, end int64) int64 {
 
 // PopMin 弹出count个最小值
 func (sortedSet *SortedSet) PopMin(count int) []*Element {
+	if sortedSet.Len() == 0 {
+		return make([]*Element, 0)
+	}
+	if lp := sortedSet.listpack; lp != nil {
+		to := len(lp.buf)
+		if count > 0 && int64(count) < lp.length {
+			to = lp.offsets()[count]
+		}
+		return lp.removeRange(0, to)
+	}
+
 	// 寻找全局最小值
 	first := sortedSet.skiplist.getFirstInScoreRange(negativeInfBorder, positiveInfBorder)
 	startBorder := &ScoreBorder{
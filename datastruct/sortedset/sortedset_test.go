@@ -14,3 +14,22 @@ func TestSortedSet_PopMin(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestSortedSet_Remove(t *testing.T) {
+	var set = Make()
+	set.Add("s1", 1)
+	set.Add("s2", 2)
+	set.Add("s3", 3)
+
+	// 删除分数最大的元素时，查找先驱节点不能越过链表尾部
+	if !set.Remove("s3") || set.Remove("s3") {
+		t.Fail()
+	}
+	set.Add("s1", 5)
+	if !set.Remove("s1") || set.Len() != 1 {
+		t.Fail()
+	}
+	if results := set.Range(0, 1, false); len(results) != 1 || results[0].Member != "s2" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,428 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	时间序列结构：按时间戳升序存储的(timestamp, value)样本
+	支持保留时长、标签、重复时间戳策略以及降采样规则
+*/
+
+// 重复时间戳处理策略
+const (
+	PolicyBlock = "block" // 拒绝写入
+	PolicyFirst = "first" // 保留旧值
+	PolicyLast  = "last"  // 覆盖为新值
+	PolicyMin   = "min"   // 保留较小值
+	PolicyMax   = "max"   // 保留较大值
+	PolicySum   = "sum"   // 累加
+)
+
+// 聚合方式
+const (
+	AggAvg   = "avg"
+	AggSum   = "sum"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggCount = "count"
+	AggFirst = "first"
+	AggLast  = "last"
+)
+
+// ErrDuplicateSample 重复时间戳，并且策略为block
+var ErrDuplicateSample = errors.New("ERR TSDB: duplicate sample blocked by policy")
+
+// Sample 一个样本点
+type Sample struct {
+	Timestamp int64 // 毫秒时间戳
+	Value     float64
+}
+
+// Rule 降采样规则：将本序列聚合后写入目标序列
+type Rule struct {
+	DestKey     string
+	Aggregation string
+	Bucket      int64 // 桶大小（毫秒）
+}
+
+// TimeSeries 时间序列，内部自带互斥锁，允许降采样时跨key写入
+type TimeSeries struct {
+	mu              sync.RWMutex
+	samples         []Sample
+	retention       int64 // 保留时长（毫秒），0表示永久保留
+	labels          map[string]string
+	duplicatePolicy string
+	rules           []*Rule
+	sourceKey       string // 如果本序列是降采样目标，记录源序列
+}
+
+// Make 创建时间序列
+func Make(retention int64, labels map[string]string, policy string) *TimeSeries {
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if policy == "" {
+		policy = PolicyBlock
+	}
+	return &TimeSeries{
+		retention:       retention,
+		labels:          labels,
+		duplicatePolicy: policy,
+	}
+}
+
+// IsValidPolicy 检查重复策略名称是否合法
+func IsValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyBlock, PolicyFirst, PolicyLast, PolicyMin, PolicyMax, PolicySum:
+		return true
+	}
+	return false
+}
+
+// IsValidAggregation 检查聚合方式是否合法
+func IsValidAggregation(agg string) bool {
+	switch agg {
+	case AggAvg, AggSum, AggMin, AggMax, AggCount, AggFirst, AggLast:
+		return true
+	}
+	return false
+}
+
+// search 返回第一个时间戳 >= ts 的下标
+func (ts *TimeSeries) search(timestamp int64) int {
+	return sort.Search(len(ts.samples), func(i int) bool {
+		return ts.samples[i].Timestamp >= timestamp
+	})
+}
+
+// Add 写入一个样本，policy为空时使用序列默认的重复策略
+// 返回最终写入的值
+func (ts *TimeSeries) Add(timestamp int64, value float64, policy string) (float64, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.add(timestamp, value, policy)
+}
+
+func (ts *TimeSeries) add(timestamp int64, value float64, policy string) (float64, error) {
+	if policy == "" {
+		policy = ts.duplicatePolicy
+	}
+
+	i := ts.search(timestamp)
+	if i < len(ts.samples) && ts.samples[i].Timestamp == timestamp {
+		// 时间戳已经存在，按照策略处理
+		old := ts.samples[i].Value
+		switch policy {
+		case PolicyBlock:
+			return old, ErrDuplicateSample
+		case PolicyFirst:
+			value = old
+		case PolicyMin:
+			value = math.Min(old, value)
+		case PolicyMax:
+			value = math.Max(old, value)
+		case PolicySum:
+			value = old + value
+		}
+		ts.samples[i].Value = value
+		return value, nil
+	}
+
+	// 插入到合适位置，绝大多数情况是追加到末尾
+	ts.samples = append(ts.samples, Sample{})
+	copy(ts.samples[i+1:], ts.samples[i:])
+	ts.samples[i] = Sample{Timestamp: timestamp, Value: value}
+	return value, nil
+}
+
+// Last 返回最新的样本
+func (ts *TimeSeries) Last() (Sample, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if len(ts.samples) == 0 {
+		return Sample{}, false
+	}
+	return ts.samples[len(ts.samples)-1], true
+}
+
+// First 返回最旧的样本
+func (ts *TimeSeries) First() (Sample, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if len(ts.samples) == 0 {
+		return Sample{}, false
+	}
+	return ts.samples[0], true
+}
+
+// Len 样本数量
+func (ts *TimeSeries) Len() int {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return len(ts.samples)
+}
+
+// Range 返回 [from, to] 范围内的样本拷贝，升序排列
+func (ts *TimeSeries) Range(from, to int64) []Sample {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if from > to {
+		return nil
+	}
+	start := ts.search(from)
+	end := ts.search(to + 1)
+	if to == math.MaxInt64 {
+		end = len(ts.samples)
+	}
+	result := make([]Sample, end-start)
+	copy(result, ts.samples[start:end])
+	return result
+}
+
+// Trim 删除时间戳早于 minTimestamp 的样本，返回删除数量
+func (ts *TimeSeries) Trim(minTimestamp int64) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	i := ts.search(minTimestamp)
+	if i == 0 {
+		return 0
+	}
+	ts.samples = append(ts.samples[:0], ts.samples[i:]...)
+	return i
+}
+
+// Retention 保留时长（毫秒）
+func (ts *TimeSeries) Retention() int64 {
+	return ts.retention
+}
+
+// DuplicatePolicy 重复时间戳策略
+func (ts *TimeSeries) DuplicatePolicy() string {
+	return ts.duplicatePolicy
+}
+
+// Labels 返回标签的拷贝
+func (ts *TimeSeries) Labels() map[string]string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	labels := make(map[string]string, len(ts.labels))
+	for k, v := range ts.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// SortedLabelNames 按字典序返回标签名，保证输出稳定
+func (ts *TimeSeries) SortedLabelNames() []string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	names := make([]string, 0, len(ts.labels))
+	for k := range ts.labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddRule 添加降采样规则
+func (ts *TimeSeries) AddRule(rule *Rule) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, r := range ts.rules {
+		if r.DestKey == rule.DestKey {
+			return false
+		}
+	}
+	ts.rules = append(ts.rules, rule)
+	return true
+}
+
+// RemoveRule 删除指向 destKey 的规则
+func (ts *TimeSeries) RemoveRule(destKey string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for i, r := range ts.rules {
+		if r.DestKey == destKey {
+			ts.rules = append(ts.rules[:i], ts.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rules 返回规则列表的拷贝
+func (ts *TimeSeries) Rules() []*Rule {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	rules := make([]*Rule, len(ts.rules))
+	copy(rules, ts.rules)
+	return rules
+}
+
+// SourceKey 返回降采样源序列的key，不是降采样目标时返回空串
+func (ts *TimeSeries) SourceKey() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.sourceKey
+}
+
+// SetSourceKey 标记本序列为降采样目标
+func (ts *TimeSeries) SetSourceKey(key string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.sourceKey = key
+}
+
+// Compact 按规则重新计算 timestamp 所在桶的聚合值，并写入目标序列
+// 目标序列的同一个桶总是被最新的聚合结果覆盖
+func (ts *TimeSeries) Compact(rule *Rule, timestamp int64, dest *TimeSeries) {
+	bucketStart := BucketStart(timestamp, rule.Bucket)
+	samples := ts.Range(bucketStart, bucketStart+rule.Bucket-1)
+	if len(samples) == 0 {
+		return
+	}
+	value := Aggregate(samples, rule.Aggregation)
+	_, _ = dest.Add(bucketStart, value, PolicyLast)
+}
+
+// MatchLabels 判断标签是否满足全部过滤条件
+func (ts *TimeSeries) MatchLabels(filters []*Filter) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, f := range filters {
+		if !f.match(ts.labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// BucketStart 返回时间戳所在桶的起点（与0对齐）
+func BucketStart(timestamp, bucket int64) int64 {
+	if bucket <= 0 {
+		return timestamp
+	}
+	start := timestamp - timestamp%bucket
+	if timestamp < 0 && timestamp%bucket != 0 {
+		start -= bucket
+	}
+	return start
+}
+
+// Aggregate 对一组样本做聚合
+func Aggregate(samples []Sample, agg string) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	switch agg {
+	case AggSum, AggAvg:
+		sum := 0.0
+		for _, s := range samples {
+			sum += s.Value
+		}
+		if agg == AggAvg {
+			return sum / float64(len(samples))
+		}
+		return sum
+	case AggMin:
+		min := samples[0].Value
+		for _, s := range samples[1:] {
+			min = math.Min(min, s.Value)
+		}
+		return min
+	case AggMax:
+		max := samples[0].Value
+		for _, s := range samples[1:] {
+			max = math.Max(max, s.Value)
+		}
+		return max
+	case AggCount:
+		return float64(len(samples))
+	case AggFirst:
+		return samples[0].Value
+	case AggLast:
+		return samples[len(samples)-1].Value
+	}
+	return 0
+}
+
+// Downsample 将升序样本按桶聚合，返回每个桶一个样本
+func Downsample(samples []Sample, agg string, bucket int64) []Sample {
+	result := make([]Sample, 0)
+	for i := 0; i < len(samples); {
+		start := BucketStart(samples[i].Timestamp, bucket)
+		j := i
+		for j < len(samples) && samples[j].Timestamp < start+bucket {
+			j++
+		}
+		result = append(result, Sample{
+			Timestamp: start,
+			Value:     Aggregate(samples[i:j], agg),
+		})
+		i = j
+	}
+	return result
+}
+
+/* ---- 标签过滤 ---- */
+
+// Filter 标签过滤条件，例如 label=value, label!=value, label=(a,b)
+type Filter struct {
+	Label  string
+	Values []string // 为空表示 label= 即不存在该标签
+	Negate bool
+}
+
+// ParseFilter 解析过滤表达式
+func ParseFilter(expr string) (*Filter, error) {
+	negate := false
+	pivot := strings.Index(expr, "!=")
+	if pivot >= 0 {
+		negate = true
+	} else {
+		pivot = strings.Index(expr, "=")
+	}
+	if pivot <= 0 {
+		return nil, errors.New("ERR TSDB: failed parsing labels filter " + expr)
+	}
+
+	filter := &Filter{Label: expr[:pivot], Negate: negate}
+	raw := expr[pivot+1:]
+	if negate {
+		raw = expr[pivot+2:]
+	}
+	if strings.HasPrefix(raw, "(") && strings.HasSuffix(raw, ")") {
+		for _, v := range strings.Split(raw[1:len(raw)-1], ",") {
+			filter.Values = append(filter.Values, strings.TrimSpace(v))
+		}
+	} else if raw != "" {
+		filter.Values = []string{raw}
+	}
+	return filter, nil
+}
+
+func (f *Filter) match(labels map[string]string) bool {
+	value, ok := labels[f.Label]
+	matched := false
+	if len(f.Values) == 0 {
+		// label= 表示不包含该标签；label!= 表示包含该标签
+		matched = !ok
+	} else if ok {
+		for _, v := range f.Values {
+			if v == value {
+				matched = true
+				break
+			}
+		}
+	}
+	if f.Negate {
+		return !matched
+	}
+	return matched
+}
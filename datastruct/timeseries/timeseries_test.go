@@ -0,0 +1,95 @@
+package timeseries
+
+import "testing"
+
+func TestTimeSeries_AddAndRange(t *testing.T) {
+	ts := Make(0, nil, "")
+	for _, timestamp := range []int64{30, 10, 20} {
+		if _, err := ts.Add(timestamp, float64(timestamp), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples := ts.Range(0, 25)
+	if len(samples) != 2 || samples[0].Timestamp != 10 || samples[1].Timestamp != 20 {
+		t.Errorf("wrong range result: %v", samples)
+	}
+
+	if _, err := ts.Add(10, 1, ""); err != ErrDuplicateSample {
+		t.Error("duplicate sample should be blocked")
+	}
+	if v, _ := ts.Add(10, 5, PolicySum); v != 15 {
+		t.Errorf("sum policy failed: %v", v)
+	}
+	if v, _ := ts.Add(10, 1, PolicyMax); v != 15 {
+		t.Errorf("max policy failed: %v", v)
+	}
+}
+
+func TestTimeSeries_Trim(t *testing.T) {
+	ts := Make(0, nil, "")
+	for i := int64(1); i <= 5; i++ {
+		_, _ = ts.Add(i, 0, "")
+	}
+	if n := ts.Trim(3); n != 2 {
+		t.Errorf("expect 2 samples trimmed, got %d", n)
+	}
+	if first, _ := ts.First(); first.Timestamp != 3 {
+		t.Errorf("wrong first sample: %v", first)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	samples := []Sample{{0, 1}, {5, 3}, {10, 10}, {19, 20}, {25, 7}}
+	result := Downsample(samples, AggAvg, 10)
+	expected := []Sample{{0, 2}, {10, 15}, {20, 7}}
+	if len(result) != len(expected) {
+		t.Fatalf("wrong bucket count: %v", result)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("bucket %d: expect %v, got %v", i, expected[i], result[i])
+		}
+	}
+
+	if v := Aggregate(samples, AggCount); v != 5 {
+		t.Errorf("count: %v", v)
+	}
+	if v := Aggregate(samples, AggMin); v != 1 {
+		t.Errorf("min: %v", v)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	src := Make(0, nil, "")
+	dest := Make(0, nil, "")
+	rule := &Rule{DestKey: "dest", Aggregation: AggSum, Bucket: 10}
+	for _, timestamp := range []int64{1, 2, 12} {
+		_, _ = src.Add(timestamp, 1, "")
+		src.Compact(rule, timestamp, dest)
+	}
+	samples := dest.Range(0, 100)
+	if len(samples) != 2 || samples[0].Value != 2 || samples[1].Value != 1 {
+		t.Errorf("wrong compaction result: %v", samples)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	ts := Make(0, map[string]string{"host": "a", "dc": "east"}, "")
+	cases := map[string]bool{
+		"host=a":      true,
+		"host!=a":     false,
+		"host=(a,b)":  true,
+		"region=":     true,
+		"dc!=":        true,
+		"dc=(west,x)": false,
+	}
+	for expr, expected := range cases {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts.MatchLabels([]*Filter{f}) != expected {
+			t.Errorf("filter %s: expect %v", expr, expected)
+		}
+	}
+}
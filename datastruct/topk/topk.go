@@ -0,0 +1,182 @@
+package topk
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	热点key统计：Count-Min Sketch 估算每个key的访问次数，最小堆保存访问次数最多的k个key
+	1. 计数器使用原子操作更新，访问次数低于堆中最小值的key不需要加锁，冷数据的访问几乎没有额外开销
+	2. 每经过一个衰减周期，所有计数减半，统计结果反映的是最近一段时间的访问频率
+*/
+
+// Item 热点key及其估算的访问次数
+type Item struct {
+	Key   string
+	Count uint32
+}
+
+type entry struct {
+	key   string
+	count uint32
+	pos   int // 在堆中的位置
+}
+
+// minHeap 按照访问次数排序的最小堆
+type minHeap []*entry
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h minHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+func (h *minHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// TopK 统计访问次数最多的k个key，并发安全
+type TopK struct {
+	k        int
+	width    uint64
+	depth    int
+	counters []uint32 // depth 行 width 列
+
+	decayPeriod int64 // 衰减周期（纳秒）
+	lastDecay   int64 // 上一次衰减的时间（纳秒）
+
+	mu        sync.Mutex
+	heap      minHeap
+	index     map[string]*entry
+	threshold uint32 // 堆满时堆中的最小访问次数，低于此值的key不会进入堆
+}
+
+// Make 创建TopK，width 和 depth 为 Count-Min Sketch 的列数和行数
+func Make(k int, width int, depth int, decayPeriod time.Duration) *TopK {
+	return &TopK{
+		k:           k,
+		width:       uint64(width),
+		depth:       depth,
+		counters:    make([]uint32, width*depth),
+		decayPeriod: int64(decayPeriod),
+		lastDecay:   time.Now().UnixNano(),
+		index:       make(map[string]*entry, k),
+	}
+}
+
+// hash64 FNV-1a
+func hash64(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// incr 增加key的计数并返回估算的访问次数（各行计数的最小值）
+func (t *TopK) incr(key string) uint32 {
+	hash := hash64(key)
+	// 使用两个哈希值的线性组合模拟多个独立的哈希函数
+	h1, h2 := hash&0xffffffff, hash>>32
+	var min uint32
+	for i := 0; i < t.depth; i++ {
+		col := (h1 + uint64(i)*h2) % t.width
+		count := atomic.AddUint32(&t.counters[uint64(i)*t.width+col], 1)
+		if i == 0 || count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// Record 记录一次对key的访问
+func (t *TopK) Record(key string) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&t.lastDecay)
+	if t.decayPeriod > 0 && now-last >= t.decayPeriod && atomic.CompareAndSwapInt64(&t.lastDecay, last, now) {
+		t.Decay()
+	}
+
+	count := t.incr(key)
+	if count <= atomic.LoadUint32(&t.threshold) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.index[key]; ok {
+		e.count = count
+		heap.Fix(&t.heap, e.pos)
+	} else if len(t.heap) < t.k {
+		e = &entry{key: key, count: count}
+		heap.Push(&t.heap, e)
+		t.index[key] = e
+	} else if count > t.heap[0].count {
+		// 替换堆中访问次数最少的key
+		e = t.heap[0]
+		delete(t.index, e.key)
+		e.key = key
+		e.count = count
+		t.index[key] = e
+		heap.Fix(&t.heap, 0)
+	}
+	t.updateThreshold()
+}
+
+func (t *TopK) updateThreshold() {
+	var threshold uint32
+	if len(t.heap) >= t.k {
+		threshold = t.heap[0].count
+	}
+	atomic.StoreUint32(&t.threshold, threshold)
+}
+
+// Decay 所有计数减半
+func (t *TopK) Decay() {
+	for i := range t.counters {
+		// 与并发的自增产生竞争时最多丢失一次计数，对估算结果没有影响
+		atomic.StoreUint32(&t.counters[i], atomic.LoadUint32(&t.counters[i])/2)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.heap {
+		e.count /= 2
+	}
+	// 所有计数同时减半，堆的顺序不变
+	t.updateThreshold()
+}
+
+// List 按照访问次数降序返回最多n个热点key
+func (t *TopK) List(n int) []Item {
+	t.mu.Lock()
+	items := make([]Item, 0, len(t.heap))
+	for _, e := range t.heap {
+		items = append(items, Item{Key: e.key, Count: e.count})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	if n >= 0 && n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
@@ -0,0 +1,66 @@
+package topk
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	topK := Make(3, 1024, 4, 0)
+	// key i 访问 i*10 次
+	for i := 1; i <= 10; i++ {
+		key := "k" + strconv.Itoa(i)
+		for j := 0; j < i*10; j++ {
+			topK.Record(key)
+		}
+	}
+	items := topK.List(10)
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, actual %d", len(items))
+	}
+	expected := []string{"k10", "k9", "k8"}
+	for i, item := range items {
+		if item.Key != expected[i] {
+			t.Errorf("item %d: expected %s, actual %s", i, expected[i], item.Key)
+		}
+	}
+	if items[0].Count < 100 {
+		t.Errorf("count should not be underestimated: %d", items[0].Count)
+	}
+	if len(topK.List(1)) != 1 {
+		t.Error("list should be truncated")
+	}
+
+	topK.Decay()
+	if items = topK.List(1); items[0].Count != 50 {
+		t.Errorf("expected count 50 after decay, actual %d", items[0].Count)
+	}
+	// 衰减后新的热点key可以进入统计
+	for j := 0; j < 200; j++ {
+		topK.Record("hot")
+	}
+	if items = topK.List(1); items[0].Key != "hot" {
+		t.Errorf("expected hot key, actual %s", items[0].Key)
+	}
+}
+
+func TestTopKConcurrent(t *testing.T) {
+	topK := Make(5, 1024, 4, 0)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				topK.Record("hot")
+				topK.Record("cold" + strconv.Itoa(g*1000+j))
+			}
+		}(g)
+	}
+	wg.Wait()
+	items := topK.List(1)
+	if items[0].Key != "hot" || items[0].Count < 8000 {
+		t.Errorf("unexpected top item: %+v", items[0])
+	}
+}
@@ -0,0 +1,293 @@
+package vector
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+)
+
+/*
+	HNSW (Hierarchical Navigable Small World) 近似最近邻图
+	论文：Malkov & Yashunin, https://arxiv.org/abs/1603.09320
+*/
+
+type hnswNode struct {
+	item      *item
+	level     int
+	neighbors [][]*hnswNode // neighbors[l] 为第l层的邻居
+	deleted   bool          // 已删除的节点可能仍被单向边引用，只能作为跳板，不能出现在结果中
+}
+
+type hnsw struct {
+	m           int
+	mMax0       int // 第0层允许的最大邻居数
+	efConstruct int
+	levelMult   float64
+
+	nodes    map[string]*hnswNode
+	entry    *hnswNode
+	maxLevel int
+
+	rng  *rand.Rand
+	dist func(a, b []float32) float32
+}
+
+func newHNSW(m, efConstruct int, dist func(a, b []float32) float32) *hnsw {
+	return &hnsw{
+		m:           m,
+		mMax0:       2 * m,
+		efConstruct: efConstruct,
+		levelMult:   1 / math.Log(float64(m)),
+		nodes:       make(map[string]*hnswNode),
+		rng:         rand.New(rand.NewSource(1)),
+		dist:        dist,
+	}
+}
+
+// randomLevel 按照指数分布随机生成节点层数
+func (g *hnsw) randomLevel() int {
+	return int(math.Floor(-math.Log(1-g.rng.Float64()) * g.levelMult))
+}
+
+func (g *hnsw) maxConn(level int) int {
+	if level == 0 {
+		return g.mMax0
+	}
+	return g.m
+}
+
+// candidate 搜索过程中的候选节点
+type candidate struct {
+	node *hnswNode
+	dist float32
+}
+
+// candidateHeap max为true时是大顶堆
+type candidateHeap struct {
+	items []candidate
+	max   bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+func (h *candidateHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x interface{}) { h.items = append(h.items, x.(candidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
+
+// searchLayer 在指定层上做贪心搜索，返回按距离升序排列的至多ef个节点
+// filter 不为nil时只有满足条件的节点进入结果集，但所有节点都可以作为跳板
+func (g *hnsw) searchLayer(query []float32, entry *hnswNode, ef int, level int, filter func(attrs map[string]string) bool) []candidate {
+	visited := map[*hnswNode]struct{}{entry: {}}
+	d := g.dist(query, entry.item.vec)
+	candidates := &candidateHeap{items: []candidate{{entry, d}}}
+	results := &candidateHeap{max: true}
+	if g.accept(entry, filter) {
+		heap.Push(results, candidate{entry, d})
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && current.dist > results.items[0].dist {
+			break // 所有候选都比结果集中最差的更远
+		}
+		for _, nb := range current.node.neighbors[level] {
+			if _, ok := visited[nb]; ok {
+				continue
+			}
+			visited[nb] = struct{}{}
+			d := g.dist(query, nb.item.vec)
+			if results.Len() < ef || d < results.items[0].dist {
+				heap.Push(candidates, candidate{nb, d})
+				if g.accept(nb, filter) {
+					heap.Push(results, candidate{nb, d})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	sorted := make([]candidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(candidate)
+	}
+	return sorted
+}
+
+// accept 判断节点能否进入结果集
+func (g *hnsw) accept(node *hnswNode, filter func(attrs map[string]string) bool) bool {
+	if node.deleted {
+		return false
+	}
+	return filter == nil || filter(node.item.attrs)
+}
+
+// greedyClosest 在上层只寻找一个最近节点作为下一层的入口
+func (g *hnsw) greedyClosest(query []float32, entry *hnswNode, level int) *hnswNode {
+	current := entry
+	currentDist := g.dist(query, entry.item.vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range current.neighbors[level] {
+			if d := g.dist(query, nb.item.vec); d < currentDist {
+				current, currentDist = nb, d
+				changed = true
+			}
+		}
+	}
+	return current
+}
+
+// insert 插入节点
+func (g *hnsw) insert(it *item) {
+	level := g.randomLevel()
+	node := &hnswNode{
+		item:      it,
+		level:     level,
+		neighbors: make([][]*hnswNode, level+1),
+	}
+	g.nodes[it.id] = node
+	if g.entry == nil {
+		g.entry = node
+		g.maxLevel = level
+		return
+	}
+
+	ep := g.entry
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.greedyClosest(it.vec, ep, l)
+	}
+	top := level
+	if g.maxLevel < top {
+		top = g.maxLevel
+	}
+	for l := top; l >= 0; l-- {
+		found := g.searchLayer(it.vec, ep, g.efConstruct, l, nil)
+		neighbors := make([]*hnswNode, 0, g.m)
+		for _, c := range found {
+			if len(neighbors) >= g.m {
+				break
+			}
+			neighbors = append(neighbors, c.node)
+		}
+		node.neighbors[l] = neighbors
+		for _, nb := range neighbors {
+			nb.neighbors[l] = append(nb.neighbors[l], node)
+			g.shrink(nb, l)
+		}
+		ep = found[0].node
+	}
+
+	if level > g.maxLevel {
+		g.maxLevel = level
+		g.entry = node
+	}
+}
+
+// shrink 邻居数量超过上限时，只保留最近的邻居
+func (g *hnsw) shrink(node *hnswNode, level int) {
+	limit := g.maxConn(level)
+	if len(node.neighbors[level]) <= limit {
+		return
+	}
+	h := &candidateHeap{max: true}
+	for _, nb := range node.neighbors[level] {
+		heap.Push(h, candidate{nb, g.dist(node.item.vec, nb.item.vec)})
+		if h.Len() > limit {
+			heap.Pop(h)
+		}
+	}
+	kept := make([]*hnswNode, h.Len())
+	for i := range kept {
+		kept[i] = h.items[i].node
+	}
+	node.neighbors[level] = kept
+}
+
+// remove 删除节点，并把原邻居互相连接以修复图的连通性
+func (g *hnsw) remove(id string) {
+	node, ok := g.nodes[id]
+	if !ok {
+		return
+	}
+	delete(g.nodes, id)
+	node.deleted = true
+
+	for l := 0; l <= node.level; l++ {
+		former := node.neighbors[l]
+		for _, nb := range former {
+			nb.neighbors[l] = removeNode(nb.neighbors[l], node)
+		}
+		for _, nb := range former {
+			if nb.deleted {
+				continue
+			}
+			for _, other := range former {
+				if other != nb && !other.deleted && !containsNode(nb.neighbors[l], other) {
+					nb.neighbors[l] = append(nb.neighbors[l], other)
+				}
+			}
+			g.shrink(nb, l)
+		}
+	}
+
+	if g.entry == node {
+		g.entry = nil
+		g.maxLevel = 0
+		for _, n := range g.nodes {
+			if g.entry == nil || n.level > g.maxLevel {
+				g.entry = n
+				g.maxLevel = n.level
+			}
+		}
+	}
+}
+
+// search KNN 查询
+func (g *hnsw) search(query []float32, k int, ef int, filter func(attrs map[string]string) bool) []*Result {
+	if g.entry == nil {
+		return []*Result{}
+	}
+	ep := g.entry
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.greedyClosest(query, ep, l)
+	}
+	found := g.searchLayer(query, ep, ef, 0, filter)
+	if len(found) > k {
+		found = found[:k]
+	}
+	results := make([]*Result, len(found))
+	for i, c := range found {
+		results[i] = &Result{ID: c.node.item.id, Distance: c.dist}
+	}
+	return results
+}
+
+func removeNode(nodes []*hnswNode, target *hnswNode) []*hnswNode {
+	for i, n := range nodes {
+		if n == target {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+func containsNode(nodes []*hnswNode, target *hnswNode) bool {
+	for _, n := range nodes {
+		if n == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+package vector
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+)
+
+/*
+	向量索引：保存 member --> float32 向量，支持 KNN 查询
+	数据量较小时直接暴力（flat）搜索，超过阈值后自动构建 HNSW 图加速查询
+*/
+
+// 距离度量
+const (
+	MetricL2     = "L2"
+	MetricCosine = "COSINE"
+	MetricIP     = "IP"
+)
+
+const (
+	// DefaultFlatThreshold 元素数量达到该值后切换为HNSW
+	DefaultFlatThreshold = 1024
+	DefaultM             = 16
+	DefaultEfConstruct   = 200
+	DefaultEfRuntime     = 100
+)
+
+var (
+	ErrDimMismatch   = errors.New("ERR vector dimension mismatch")
+	ErrUnknownMetric = errors.New("ERR unknown distance metric")
+)
+
+// Options 索引参数
+type Options struct {
+	Dim           int
+	Metric        string
+	M             int // HNSW 每个节点的最大邻居数
+	EfConstruct   int // HNSW 构建时的候选集大小
+	FlatThreshold int
+}
+
+// item 一个向量元素
+type item struct {
+	id    string
+	vec   []float32 // COSINE 度量下保存的是归一化后的向量
+	raw   []float32 // 原始向量
+	attrs map[string]string
+}
+
+// Index 向量索引
+type Index struct {
+	opts  Options
+	items map[string]*item
+	graph *hnsw // 为nil时使用flat搜索
+}
+
+// Make 创建向量索引
+func Make(opts Options) (*Index, error) {
+	if opts.Dim <= 0 {
+		return nil, errors.New("ERR invalid vector dimension")
+	}
+	switch opts.Metric {
+	case MetricL2, MetricCosine, MetricIP:
+	default:
+		return nil, ErrUnknownMetric
+	}
+	if opts.M <= 0 {
+		opts.M = DefaultM
+	}
+	if opts.EfConstruct <= 0 {
+		opts.EfConstruct = DefaultEfConstruct
+	}
+	if opts.FlatThreshold <= 0 {
+		opts.FlatThreshold = DefaultFlatThreshold
+	}
+	return &Index{
+		opts:  opts,
+		items: make(map[string]*item),
+	}, nil
+}
+
+// Options 返回索引参数
+func (index *Index) Options() Options {
+	return index.opts
+}
+
+// Len 元素数量
+func (index *Index) Len() int {
+	return len(index.items)
+}
+
+// IsHNSW 当前是否使用HNSW图
+func (index *Index) IsHNSW() bool {
+	return index.graph != nil
+}
+
+// Add 添加或者覆盖一个向量，返回是否为新元素
+func (index *Index) Add(id string, vec []float32, attrs map[string]string) (bool, error) {
+	if len(vec) != index.opts.Dim {
+		return false, ErrDimMismatch
+	}
+	raw := make([]float32, len(vec))
+	copy(raw, vec)
+	it := &item{id: id, vec: raw, raw: raw, attrs: attrs}
+	if index.opts.Metric == MetricCosine {
+		it.vec = normalize(raw)
+	}
+
+	_, exists := index.items[id]
+	if exists {
+		index.Remove(id)
+	}
+	index.items[id] = it
+
+	if index.graph != nil {
+		index.graph.insert(it)
+	} else if len(index.items) >= index.opts.FlatThreshold {
+		index.buildGraph()
+	}
+	return !exists, nil
+}
+
+// buildGraph 数据量超过阈值，将所有元素插入HNSW图
+func (index *Index) buildGraph() {
+	index.graph = newHNSW(index.opts.M, index.opts.EfConstruct, index.distance)
+	ids := make([]string, 0, len(index.items))
+	for id := range index.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids) // 固定插入顺序，保证结果可复现
+	for _, id := range ids {
+		index.graph.insert(index.items[id])
+	}
+}
+
+// Remove 删除元素
+func (index *Index) Remove(id string) bool {
+	if _, ok := index.items[id]; !ok {
+		return false
+	}
+	delete(index.items, id)
+	if index.graph != nil {
+		index.graph.remove(id)
+	}
+	return true
+}
+
+// Get 返回元素的原始向量和属性
+func (index *Index) Get(id string) ([]float32, map[string]string, bool) {
+	it, ok := index.items[id]
+	if !ok {
+		return nil, nil, false
+	}
+	return it.raw, it.attrs, true
+}
+
+// ForEach 遍历全部元素
+func (index *Index) ForEach(consumer func(id string, vec []float32, attrs map[string]string) bool) {
+	for id, it := range index.items {
+		if !consumer(id, it.raw, it.attrs) {
+			break
+		}
+	}
+}
+
+// Result KNN 查询结果
+type Result struct {
+	ID       string
+	Distance float32
+}
+
+// KNN 返回与query最近的k个元素，filter为nil表示不过滤
+func (index *Index) KNN(query []float32, k int, ef int, filter func(attrs map[string]string) bool) ([]*Result, error) {
+	if len(query) != index.opts.Dim {
+		return nil, ErrDimMismatch
+	}
+	if k <= 0 || len(index.items) == 0 {
+		return []*Result{}, nil
+	}
+	if index.opts.Metric == MetricCosine {
+		query = normalize(query)
+	}
+	if ef < k {
+		ef = k
+	}
+	if ef < DefaultEfRuntime {
+		ef = DefaultEfRuntime
+	}
+
+	if index.graph != nil {
+		results := index.graph.search(query, k, ef, filter)
+		if len(results) >= k || filter == nil {
+			return index.finish(results), nil
+		}
+		// 过滤条件过于严格，图搜索召回不足，回退到暴力搜索
+	}
+	return index.finish(index.flatSearch(query, k, filter)), nil
+}
+
+// flatSearch 暴力搜索，使用大顶堆保留最近的k个
+func (index *Index) flatSearch(query []float32, k int, filter func(attrs map[string]string) bool) []*Result {
+	h := &resultHeap{max: true}
+	for _, it := range index.items {
+		if filter != nil && !filter(it.attrs) {
+			continue
+		}
+		d := index.distance(query, it.vec)
+		if h.Len() < k {
+			heap.Push(h, &Result{ID: it.id, Distance: d})
+		} else if d < h.items[0].Distance {
+			h.items[0] = &Result{ID: it.id, Distance: d}
+			heap.Fix(h, 0)
+		}
+	}
+	return h.items
+}
+
+// finish 排序并将内部距离转换为对外的距离
+func (index *Index) finish(results []*Result) []*Result {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance == results[j].Distance {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Distance < results[j].Distance
+	})
+	for _, r := range results {
+		if index.opts.Metric == MetricL2 {
+			r.Distance = float32(math.Sqrt(float64(r.Distance)))
+		}
+	}
+	return results
+}
+
+// distance 内部距离，越小越相似
+//
+//	L2:     欧式距离的平方
+//	COSINE: 1 - cos（向量已归一化）
+//	IP:     1 - 内积
+func (index *Index) distance(a, b []float32) float32 {
+	if index.opts.Metric == MetricL2 {
+		var sum float32
+		for i := range a {
+			d := a[i] - b[i]
+			sum += d * d
+		}
+		return sum
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+func normalize(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	result := make([]float32, len(vec))
+	if norm == 0 {
+		return result
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vec {
+		result[i] = float32(float64(v) / norm)
+	}
+	return result
+}
+
+/* ---- 堆 ---- */
+
+// resultHeap max为true时是大顶堆（堆顶距离最大）
+type resultHeap struct {
+	items []*Result
+	max   bool
+}
+
+func (h *resultHeap) Len() int { return len(h.items) }
+func (h *resultHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].Distance > h.items[j].Distance
+	}
+	return h.items[i].Distance < h.items[j].Distance
+}
+func (h *resultHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *resultHeap) Push(x interface{}) { h.items = append(h.items, x.(*Result)) }
+func (h *resultHeap) Pop() interface{} {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
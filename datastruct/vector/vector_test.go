@@ -0,0 +1,97 @@
+package vector
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestIndex_FlatKNN(t *testing.T) {
+	index, err := Make(Options{Dim: 2, Metric: MetricL2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = index.Add("a", []float32{0, 0}, map[string]string{"color": "red"})
+	_, _ = index.Add("b", []float32{3, 4}, map[string]string{"color": "blue"})
+	_, _ = index.Add("c", []float32{1, 1}, map[string]string{"color": "blue"})
+
+	results, _ := index.KNN([]float32{0, 0}, 2, 0, nil)
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "c" {
+		t.Errorf("wrong knn result: %v %v", results[0], results[1])
+	}
+
+	results, _ = index.KNN([]float32{0, 0}, 1, 0, func(attrs map[string]string) bool {
+		return attrs["color"] == "blue"
+	})
+	if len(results) != 1 || results[0].ID != "c" {
+		t.Errorf("wrong filtered result: %v", results)
+	}
+
+	results, _ = index.KNN([]float32{0, 0}, 3, 0, nil)
+	if results[2].Distance != 5 {
+		t.Errorf("expect euclidean distance 5, got %v", results[2].Distance)
+	}
+
+	if _, err = index.Add("d", []float32{1}, nil); err != ErrDimMismatch {
+		t.Error("expect dimension mismatch")
+	}
+}
+
+func TestIndex_Cosine(t *testing.T) {
+	index, _ := Make(Options{Dim: 2, Metric: MetricCosine})
+	_, _ = index.Add("x", []float32{10, 0}, nil)
+	_, _ = index.Add("y", []float32{0, 3}, nil)
+	results, _ := index.KNN([]float32{1, 0.1}, 1, 0, nil)
+	if results[0].ID != "x" {
+		t.Errorf("wrong cosine result: %v", results[0])
+	}
+}
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = rng.Float32()
+	}
+	return vec
+}
+
+func TestIndex_HNSWRecall(t *testing.T) {
+	const dim, n, k = 16, 1000, 10
+	rng := rand.New(rand.NewSource(42))
+	flat, _ := Make(Options{Dim: dim, Metric: MetricL2, FlatThreshold: n * 10})
+	graph, _ := Make(Options{Dim: dim, Metric: MetricL2, FlatThreshold: 100})
+	for i := 0; i < n; i++ {
+		vec := randomVector(rng, dim)
+		_, _ = flat.Add(strconv.Itoa(i), vec, nil)
+		_, _ = graph.Add(strconv.Itoa(i), vec, nil)
+	}
+	if !graph.IsHNSW() || flat.IsHNSW() {
+		t.Fatal("wrong index mode")
+	}
+	// 删除一部分元素，检查图修复后的召回率
+	for i := 0; i < n; i += 10 {
+		flat.Remove(strconv.Itoa(i))
+		graph.Remove(strconv.Itoa(i))
+	}
+
+	hit, total := 0, 0
+	for q := 0; q < 50; q++ {
+		query := randomVector(rng, dim)
+		expected, _ := flat.KNN(query, k, 0, nil)
+		actual, _ := graph.KNN(query, k, 0, nil)
+		set := make(map[string]struct{})
+		for _, r := range expected {
+			set[r.ID] = struct{}{}
+		}
+		for _, r := range actual {
+			if _, ok := set[r.ID]; ok {
+				hit++
+			}
+		}
+		total += k
+	}
+	recall := float64(hit) / float64(total)
+	if recall < 0.9 {
+		t.Errorf("hnsw recall too low: %f", recall)
+	}
+}
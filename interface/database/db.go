@@ -22,6 +22,7 @@ type EmbedDB interface {
 	//ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply
 	GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine
 	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
+	GetMetaCmds(dbIndex int) []CmdLine
 	RWLocks(dbIndex int, writeKeys []string, readKeys []string)
 	RWUnLocks(dbIndex int, writeKeys []string, readKeys []string)
 	//GetDBSize(dbIndex int) (int, int)
@@ -30,4 +31,9 @@ type EmbedDB interface {
 // DataEntity stores data bound to a key, including a string, list, hash, set and so on
 type DataEntity struct {
 	Data interface{}
+
+	// 以下字段由数据库维护，用于 maxmemory 内存统计和淘汰，需要使用原子操作读写
+	Size        int64  // 估算的内存占用（字节），包括key本身
+	AccessClock uint32 // 最近一次访问的时间（秒），用于LRU
+	LFUCounter  uint32 // 对数访问计数器（0~255），用于LFU
 }
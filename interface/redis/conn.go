@@ -1,30 +1,65 @@
 package redis
 
+import (
+	"net"
+	"time"
+)
+
 /*
 	redis Connection 接口
 */
 
+// CLIENT REPLY 模式
+const (
+	ReplyOn       = iota
+	ReplyOff      // 不发送任何回复
+	ReplySkipNext // 跳过下一条命令的回复
+	ReplySkip     // 跳过当前命令的回复
+)
+
 // Connection represents a connection with redis client
 type Connection interface {
 	Write([]byte) error
 	SetPassword(string)
 	GetPassword() string
+	SetName(string)
+	GetName() string
+
+	// client information, used by `CLIENT` command
+	GetID() uint64
+	RemoteAddr() net.Addr
+	CreatedAt() time.Time
+	IdleTime() time.Duration
+	LastCommand() string
+	SetNoEvict(bool)
+	IsNoEvict() bool
+	SetReplyMode(int)
+	GetReplyMode() int
+	CloseAfterReply()
+
+	// protocol version negotiated by HELLO, 2 for RESP2 and 3 for RESP3
+	SetProtocol(int)
+	GetProtocol() int
 
 	// client should keep its subscribing channels
-	// Subscribe(channel string)
-	// UnSubscribe(channel string)
-	// SubsCount() int
-	// GetChannels() []string
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	SubsCount() int
+	GetChannels() []string
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	PSubsCount() int
+	GetPatterns() []string
 
 	// used for `Multi` command
-	// InMultiState() bool
-	// SetMultiState(bool)
-	// GetQueuedCmdLine() [][][]byte
-	// EnqueueCmd([][]byte)
-	// ClearQueuedCmds()
-	// GetWatching() map[string]uint32
-	// AddTxError(err error)
-	// GetTxErrors() []error
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	GetWatching() map[string]uint32
+	AddTxError(err error)
+	GetTxErrors() []error
 
 	// used for multi database
 	GetDBIndex() int
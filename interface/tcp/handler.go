@@ -12,3 +12,8 @@ type Handler interface {
 	Handle(ctx context.Context, conn net.Conn)
 	Close() error
 }
+
+// Rejecter 连接数达到上限时，由Handler决定如何拒绝新连接（例如回复错误信息）
+type Rejecter interface {
+	Reject(conn net.Conn)
+}
@@ -0,0 +1,136 @@
+package lua
+
+/*
+	语法树：解释器直接遍历语法树执行
+*/
+
+type expr interface{}
+
+type stmt interface{}
+
+type (
+	nilExpr    struct{}
+	trueExpr   struct{}
+	falseExpr  struct{}
+	varargExpr struct{}
+
+	numberExpr struct {
+		value float64
+	}
+	stringExpr struct {
+		value string
+	}
+
+	// nameExpr 变量引用
+	nameExpr struct {
+		name string
+	}
+	// indexExpr obj[key] 或者 obj.key
+	indexExpr struct {
+		obj  expr
+		key  expr
+		line int
+	}
+	// callExpr fn(args)
+	callExpr struct {
+		fn   expr
+		args []expr
+		line int
+	}
+	// methodCallExpr obj:name(args)
+	methodCallExpr struct {
+		obj  expr
+		name string
+		args []expr
+		line int
+	}
+	// parenExpr 括号会把多返回值截断为一个
+	parenExpr struct {
+		inner expr
+	}
+	binaryExpr struct {
+		op    string
+		left  expr
+		right expr
+		line  int
+	}
+	unaryExpr struct {
+		op      string
+		operand expr
+		line    int
+	}
+	tableExpr struct {
+		arrayItems []expr // 没有指定key的元素，按顺序存入 1..n
+		keys       []expr
+		values     []expr
+	}
+	functionExpr struct {
+		proto *funcProto
+	}
+)
+
+// funcProto 函数原型
+type funcProto struct {
+	name     string
+	params   []string
+	isVararg bool
+	body     []stmt
+}
+
+type (
+	localStmt struct {
+		names []string
+		exprs []expr
+		line  int
+	}
+	assignStmt struct {
+		targets []expr // nameExpr 或者 indexExpr
+		exprs   []expr
+		line    int
+	}
+	callStmt struct {
+		call expr
+		line int
+	}
+	doStmt struct {
+		body []stmt
+	}
+	whileStmt struct {
+		cond expr
+		body []stmt
+		line int
+	}
+	repeatStmt struct {
+		body []stmt
+		cond expr
+		line int
+	}
+	ifStmt struct {
+		conds    []expr
+		blocks   [][]stmt
+		elseBody []stmt // 没有else分支时为nil
+		line     int
+	}
+	numericForStmt struct {
+		name               string
+		start, limit, step expr // step 可能为nil
+		body               []stmt
+		line               int
+	}
+	genericForStmt struct {
+		names []string
+		exprs []expr
+		body  []stmt
+		line  int
+	}
+	localFunctionStmt struct {
+		name  string
+		proto *funcProto
+		line  int
+	}
+	returnStmt struct {
+		exprs []expr
+		line  int
+	}
+	breakStmt struct{}
+)
@@ -0,0 +1,345 @@
+package lua
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	词法分析：将脚本切分为 token
+	支持 Lua 5.1 的全部 token：关键字、名字、数字（十进制/十六进制）、短字符串、长字符串以及注释
+*/
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokNumber
+	tokString
+	tokKeyword
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string  // 名字、关键字、符号或者字符串内容
+	num  float64 // 数字的值
+	line int
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "if": true,
+	"in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true, "until": true,
+	"while": true,
+}
+
+// 按长度从长到短排列，优先匹配长符号
+var symbols = []string{
+	"...", "..", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// SyntaxError 脚本编译错误
+type SyntaxError struct {
+	Chunk string
+	Line  int
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Chunk, e.Line, e.Msg)
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: l.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// tokenize 一次性切分整个脚本
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+	tokens := make([]token, 0, len(src)/4)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// skipSpaceAndComments 跳过空白和注释
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "--"):
+			l.pos += 2
+			if level := l.longBracketLevel(); level >= 0 {
+				if _, err := l.readLongString(level); err != nil {
+					return err
+				}
+				continue
+			}
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// longBracketLevel 判断当前位置是否是长括号 [[ 或 [==[，返回等号的数量，不是长括号时返回-1
+func (l *lexer) longBracketLevel() int {
+	if l.pos >= len(l.src) || l.src[l.pos] != '[' {
+		return -1
+	}
+	i := l.pos + 1
+	for i < len(l.src) && l.src[i] == '=' {
+		i++
+	}
+	if i < len(l.src) && l.src[i] == '[' {
+		return i - l.pos - 1
+	}
+	return -1
+}
+
+// readLongString 读取长字符串，紧跟开括号的换行符会被忽略
+func (l *lexer) readLongString(level int) (string, error) {
+	startLine := l.line
+	l.pos += level + 2
+	if strings.HasPrefix(l.src[l.pos:], "\r\n") {
+		l.pos += 2
+		l.line++
+	} else if l.pos < len(l.src) && l.src[l.pos] == '\n' {
+		l.pos++
+		l.line++
+	}
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(l.src[l.pos:], closing)
+	if end < 0 {
+		return "", &SyntaxError{Line: startLine, Msg: "unfinished long string"}
+	}
+	s := l.src[l.pos : l.pos+end]
+	l.line += strings.Count(s, "\n")
+	l.pos += end + len(closing)
+	return s, nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case isNameStart(c):
+		start := l.pos
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		word := l.src[start:l.pos]
+		if keywords[word] {
+			return token{kind: tokKeyword, text: word, line: l.line}, nil
+		}
+		return token{kind: tokName, text: word, line: l.line}, nil
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		return l.readNumber()
+	case c == '"' || c == '\'':
+		return l.readString(c)
+	case c == '[':
+		if level := l.longBracketLevel(); level >= 0 {
+			line := l.line
+			s, err := l.readLongString(level)
+			if err != nil {
+				return token{}, err
+			}
+			return token{kind: tokString, text: s, line: line}, nil
+		}
+	}
+	for _, sym := range symbols {
+		if strings.HasPrefix(l.src[l.pos:], sym) {
+			l.pos += len(sym)
+			return token{kind: tokSymbol, text: sym, line: l.line}, nil
+		}
+	}
+	return token{}, l.errorf("unexpected symbol near '%c'", c)
+}
+
+func (l *lexer) readNumber() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], "0x") || strings.HasPrefix(l.src[l.pos:], "0X") {
+		l.pos += 2
+		for l.pos < len(l.src) && isHexDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	} else {
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if isDigit(c) || c == '.' {
+				l.pos++
+			} else if (c == 'e' || c == 'E') && l.pos+1 < len(l.src) {
+				l.pos++
+				if l.src[l.pos] == '+' || l.src[l.pos] == '-' {
+					l.pos++
+				}
+			} else {
+				break
+			}
+		}
+	}
+	// 数字后面不能直接跟名字，例如 3x
+	for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	num, ok := parseNumber(text)
+	if !ok {
+		return token{}, l.errorf("malformed number near '%s'", text)
+	}
+	return token{kind: tokNumber, num: num, line: l.line}, nil
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// parseNumber 解析十进制或者十六进制数字，允许前后有空白（与 tonumber 一致）
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	neg := false
+	body := s
+	if body[0] == '-' || body[0] == '+' {
+		neg = body[0] == '-'
+		body = body[1:]
+	}
+	if strings.HasPrefix(body, "0x") || strings.HasPrefix(body, "0X") {
+		n, err := strconv.ParseUint(body[2:], 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		if neg {
+			return -float64(n), true
+		}
+		return float64(n), true
+	}
+	// 排除 Go 额外支持的格式，例如 inf、nan、下划线分隔符
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if !isDigit(c) && c != '.' && c != 'e' && c != 'E' && c != '+' && c != '-' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func (l *lexer) readString(quote byte) (token, error) {
+	line := l.line
+	l.pos++
+	var sb strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			return token{}, l.errorf("unfinished string")
+		}
+		c := l.src[l.pos]
+		if c == quote {
+			l.pos++
+			break
+		}
+		if c == '\n' {
+			return token{}, l.errorf("unfinished string")
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			l.pos++
+			continue
+		}
+		l.pos++
+		if l.pos >= len(l.src) {
+			return token{}, l.errorf("unfinished string")
+		}
+		c = l.src[l.pos]
+		switch c {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '"', '\'':
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteByte('\n')
+			l.line++
+		case 'x':
+			if l.pos+2 >= len(l.src) || !isHexDigit(l.src[l.pos+1]) || !isHexDigit(l.src[l.pos+2]) {
+				return token{}, l.errorf("hexadecimal digit expected")
+			}
+			n, _ := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+			sb.WriteByte(byte(n))
+			l.pos += 2
+		default:
+			if !isDigit(c) {
+				return token{}, l.errorf("invalid escape sequence '\\%c'", c)
+			}
+			// \ddd 最多三位十进制数字
+			end := l.pos
+			for end < len(l.src) && end < l.pos+3 && isDigit(l.src[end]) {
+				end++
+			}
+			n, _ := strconv.Atoi(l.src[l.pos:end])
+			if n > 255 {
+				return token{}, l.errorf("escape sequence too large")
+			}
+			sb.WriteByte(byte(n))
+			l.pos = end - 1
+		}
+		l.pos++
+	}
+	return token{kind: tokString, text: sb.String(), line: line}, nil
+}
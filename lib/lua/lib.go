@@ -0,0 +1,802 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	标准库：只提供没有副作用的函数
+	base:   assert error ipairs next pairs pcall rawequal rawget rawset select tonumber tostring type unpack
+	string: byte char find(仅支持普通字符串) format len lower rep reverse sub upper
+	table:  concat getn insert remove sort
+	math:   abs ceil exp floor fmod huge log log10 max min modf pi pow sqrt
+*/
+
+func openLibs(s *State) {
+	register := func(t *Table, name string, fn func(s *State, args []Value) ([]Value, error)) {
+		_ = t.Set(name, &GoFunction{Name: name, Fn: fn})
+	}
+
+	g := s.globals
+	register(g, "assert", baseAssert)
+	register(g, "error", baseError)
+	register(g, "ipairs", baseIpairs)
+	_ = g.Set("next", nextFunction)
+	register(g, "pairs", basePairs)
+	register(g, "pcall", basePcall)
+	register(g, "rawequal", baseRawEqual)
+	register(g, "rawget", baseRawGet)
+	register(g, "rawset", baseRawSet)
+	register(g, "select", baseSelect)
+	register(g, "tonumber", baseToNumber)
+	register(g, "tostring", baseToString)
+	register(g, "type", baseType)
+	register(g, "unpack", tableUnpack)
+
+	str := NewTable()
+	register(str, "byte", strByte)
+	register(str, "char", strChar)
+	register(str, "find", strFind)
+	register(str, "format", strFormat)
+	register(str, "len", strLen)
+	register(str, "lower", strLower)
+	register(str, "rep", strRep)
+	register(str, "reverse", strReverse)
+	register(str, "sub", strSub)
+	register(str, "upper", strUpper)
+	s.SetGlobal("string", str)
+	s.stringLib = str
+
+	table := NewTable()
+	register(table, "concat", tableConcat)
+	register(table, "getn", tableGetn)
+	register(table, "insert", tableInsert)
+	register(table, "remove", tableRemove)
+	register(table, "sort", tableSort)
+	register(table, "unpack", tableUnpack)
+	s.SetGlobal("table", table)
+
+	m := NewTable()
+	register(m, "abs", mathFunc(math.Abs))
+	register(m, "ceil", mathFunc(math.Ceil))
+	register(m, "exp", mathFunc(math.Exp))
+	register(m, "floor", mathFunc(math.Floor))
+	register(m, "log", mathFunc(math.Log))
+	register(m, "log10", mathFunc(math.Log10))
+	register(m, "sqrt", mathFunc(math.Sqrt))
+	register(m, "fmod", mathFunc2(math.Mod))
+	register(m, "pow", mathFunc2(math.Pow))
+	register(m, "max", mathMax)
+	register(m, "min", mathMin)
+	register(m, "modf", mathModf)
+	_ = m.Set("huge", math.Inf(1))
+	_ = m.Set("pi", math.Pi)
+	s.SetGlobal("math", m)
+}
+
+/* ---- 参数检查 ---- */
+
+func argError(i int, fname string, msg string) error {
+	return fmt.Errorf("bad argument #%d to '%s' (%s)", i+1, fname, msg)
+}
+
+func arg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// CheckNumber 检查第i个参数是否是数字，可以转换为数字的字符串也可以
+func CheckNumber(args []Value, i int, fname string) (float64, error) {
+	n, ok := ToNumber(arg(args, i))
+	if !ok {
+		return 0, argError(i, fname, "number expected, got "+TypeName(arg(args, i)))
+	}
+	return n, nil
+}
+
+// CheckString 检查第i个参数是否是字符串，数字会被转换为字符串
+func CheckString(args []Value, i int, fname string) (string, error) {
+	switch v := arg(args, i).(type) {
+	case string:
+		return v, nil
+	case float64:
+		return formatNumber(v), nil
+	}
+	return "", argError(i, fname, "string expected, got "+TypeName(arg(args, i)))
+}
+
+func checkTable(args []Value, i int, fname string) (*Table, error) {
+	t, ok := arg(args, i).(*Table)
+	if !ok {
+		return nil, argError(i, fname, "table expected, got "+TypeName(arg(args, i)))
+	}
+	return t, nil
+}
+
+func optInt(args []Value, i int, fname string, def int) (int, error) {
+	if arg(args, i) == nil {
+		return def, nil
+	}
+	n, err := CheckNumber(args, i, fname)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+/* ---- base ---- */
+
+func baseAssert(s *State, args []Value) ([]Value, error) {
+	if !Truthy(arg(args, 0)) {
+		if msg := arg(args, 1); msg != nil {
+			return nil, &Error{Value: msg}
+		}
+		return nil, s.RuntimeError("assertion failed!")
+	}
+	return args, nil
+}
+
+// baseError error(message [, level])，level 不为0时字符串消息前面会加上出错位置
+func baseError(s *State, args []Value) ([]Value, error) {
+	msg := arg(args, 0)
+	level, err := optInt(args, 1, "error", 1)
+	if err != nil {
+		return nil, err
+	}
+	if str, ok := msg.(string); ok && level > 0 {
+		msg = s.where() + str
+	}
+	return nil, &Error{Value: msg}
+}
+
+func baseIpairs(s *State, args []Value) ([]Value, error) {
+	if _, err := checkTable(args, 0, "ipairs"); err != nil {
+		return nil, err
+	}
+	return []Value{ipairsIterator, args[0], 0.0}, nil
+}
+
+var ipairsIterator = &GoFunction{Name: "ipairs_iterator", Fn: func(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "ipairs_iterator")
+	if err != nil {
+		return nil, err
+	}
+	i, err := CheckNumber(args, 1, "ipairs_iterator")
+	if err != nil {
+		return nil, err
+	}
+	v := t.Get(i + 1)
+	if v == nil {
+		return []Value{nil}, nil
+	}
+	return []Value{i + 1, v}, nil
+}}
+
+// nextFunction pairs 返回的迭代函数，不受脚本修改全局变量 next 的影响
+var nextFunction = &GoFunction{Name: "next", Fn: baseNext}
+
+func baseNext(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "next")
+	if err != nil {
+		return nil, err
+	}
+	k, v, err := t.Next(arg(args, 1))
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return []Value{nil}, nil
+	}
+	return []Value{k, v}, nil
+}
+
+func basePairs(s *State, args []Value) ([]Value, error) {
+	if _, err := checkTable(args, 0, "pairs"); err != nil {
+		return nil, err
+	}
+	return []Value{nextFunction, args[0], nil}, nil
+}
+
+// basePcall pcall(f, ...) 捕获运行时错误，超出沙箱限制的错误无法捕获
+func basePcall(s *State, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(0, "pcall", "value expected")
+	}
+	rets, err := s.Call(args[0], args[1:]...)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return []Value{false, e.Value}, nil
+		}
+		return nil, err
+	}
+	return append([]Value{true}, rets...), nil
+}
+
+func baseRawEqual(s *State, args []Value) ([]Value, error) {
+	return []Value{RawEquals(arg(args, 0), arg(args, 1))}, nil
+}
+
+func baseRawGet(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "rawget")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{t.Get(arg(args, 1))}, nil
+}
+
+func baseRawSet(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "rawset")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Set(arg(args, 1), arg(args, 2)); err != nil {
+		return nil, err
+	}
+	return []Value{t}, nil
+}
+
+func baseSelect(s *State, args []Value) ([]Value, error) {
+	if str, ok := arg(args, 0).(string); ok && str == "#" {
+		return []Value{float64(len(args) - 1)}, nil
+	}
+	n, err := CheckNumber(args, 0, "select")
+	if err != nil {
+		return nil, err
+	}
+	i := int(n)
+	if i < 0 {
+		i = len(args) + i
+	}
+	if i < 1 {
+		return nil, argError(0, "select", "index out of range")
+	}
+	if i >= len(args) {
+		return nil, nil
+	}
+	return args[i:], nil
+}
+
+func baseToNumber(s *State, args []Value) ([]Value, error) {
+	base, err := optInt(args, 1, "tonumber", 10)
+	if err != nil {
+		return nil, err
+	}
+	if base == 10 {
+		n, ok := ToNumber(arg(args, 0))
+		if !ok {
+			return []Value{nil}, nil
+		}
+		return []Value{n}, nil
+	}
+	if base < 2 || base > 36 {
+		return nil, argError(1, "tonumber", "base out of range")
+	}
+	str, err := CheckString(args, 0, "tonumber")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(str), base, 64)
+	if err != nil {
+		return []Value{nil}, nil
+	}
+	return []Value{float64(n)}, nil
+}
+
+func baseToString(s *State, args []Value) ([]Value, error) {
+	return []Value{ToString(arg(args, 0))}, nil
+}
+
+func baseType(s *State, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(0, "type", "value expected")
+	}
+	return []Value{TypeName(args[0])}, nil
+}
+
+/* ---- string ---- */
+
+// strRange 将 Lua 的字符串下标（从1开始，负数表示从末尾开始）转换为 [start, end)
+func strRange(length int, i, j int) (int, int) {
+	if i < 0 {
+		i = length + i + 1
+	}
+	if j < 0 {
+		j = length + j + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	if j > length {
+		j = length
+	}
+	if i > j {
+		return 0, 0
+	}
+	return i - 1, j
+}
+
+func strByte(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "byte")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(args, 1, "byte", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(args, 2, "byte", i)
+	if err != nil {
+		return nil, err
+	}
+	start, end := strRange(len(str), i, j)
+	rets := make([]Value, 0, end-start)
+	for k := start; k < end; k++ {
+		rets = append(rets, float64(str[k]))
+	}
+	return rets, nil
+}
+
+func strChar(s *State, args []Value) ([]Value, error) {
+	buf := make([]byte, len(args))
+	for i := range args {
+		n, err := CheckNumber(args, i, "char")
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > 255 {
+			return nil, argError(i, "char", "invalid value")
+		}
+		buf[i] = byte(n)
+	}
+	return []Value{string(buf)}, nil
+}
+
+// strFind string.find(s, pattern [, init [, plain]])，不支持模式匹配，只能查找普通字符串
+func strFind(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "find")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := CheckString(args, 1, "find")
+	if err != nil {
+		return nil, err
+	}
+	init, err := optInt(args, 2, "find", 1)
+	if err != nil {
+		return nil, err
+	}
+	if !Truthy(arg(args, 3)) && strings.ContainsAny(pattern, "^$*+?.([%-") {
+		return nil, s.RuntimeError("pattern matching is not supported, use string.find(s, pattern, init, true)")
+	}
+	if init < 0 {
+		init = len(str) + init + 1
+	}
+	if init < 1 {
+		init = 1
+	}
+	if init > len(str)+1 {
+		return []Value{nil}, nil
+	}
+	idx := strings.Index(str[init-1:], pattern)
+	if idx < 0 {
+		return []Value{nil}, nil
+	}
+	start := init + idx
+	return []Value{float64(start), float64(start + len(pattern) - 1)}, nil
+}
+
+func strLen(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "len")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(len(str))}, nil
+}
+
+func strLower(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "lower")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToLower(str)}, nil
+}
+
+func strUpper(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "upper")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToUpper(str)}, nil
+}
+
+func strRep(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "rep")
+	if err != nil {
+		return nil, err
+	}
+	n, err := CheckNumber(args, 1, "rep")
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || str == "" {
+		return []Value{""}, nil
+	}
+	if float64(len(str))*n > MaxStringLen {
+		return nil, &LimitError{Msg: "string length overflow"}
+	}
+	return []Value{strings.Repeat(str, int(n))}, nil
+}
+
+func strReverse(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "reverse")
+	if err != nil {
+		return nil, err
+	}
+	buf := []byte(str)
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return []Value{string(buf)}, nil
+}
+
+func strSub(s *State, args []Value) ([]Value, error) {
+	str, err := CheckString(args, 0, "sub")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(args, 1, "sub", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(args, 2, "sub", -1)
+	if err != nil {
+		return nil, err
+	}
+	start, end := strRange(len(str), i, j)
+	return []Value{str[start:end]}, nil
+}
+
+// strFormat string.format，支持 %d %i %u %c %x %X %o %e %E %f %g %G %q %s %%
+func strFormat(s *State, args []Value) ([]Value, error) {
+	format, err := CheckString(args, 0, "format")
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	argIndex := 1
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		// %[flags][width][.precision]verb
+		start := i
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && isDigit(format[i]) {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && isDigit(format[i]) {
+				i++
+			}
+		}
+		if i >= len(format) {
+			return nil, s.RuntimeError("invalid option '%%' to 'format'")
+		}
+		spec := "%" + format[start:i]
+		verb := format[i]
+		if argIndex >= len(args) {
+			return nil, argError(argIndex, "format", "no value")
+		}
+		switch verb {
+		case 'd', 'i', 'u', 'c', 'x', 'X', 'o':
+			n, err := CheckNumber(args, argIndex, "format")
+			if err != nil {
+				return nil, err
+			}
+			switch verb {
+			case 'c':
+				sb.WriteByte(byte(n))
+			case 'i', 'u':
+				sb.WriteString(fmt.Sprintf(spec+"d", int64(n)))
+			default:
+				sb.WriteString(fmt.Sprintf(spec+string(verb), int64(n)))
+			}
+		case 'e', 'E', 'f', 'g', 'G':
+			n, err := CheckNumber(args, argIndex, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(fmt.Sprintf(spec+string(verb), n))
+		case 'q':
+			str, err := CheckString(args, argIndex, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(quoteString(str))
+		case 's':
+			sb.WriteString(fmt.Sprintf(spec+"s", ToString(args[argIndex])))
+		default:
+			return nil, s.RuntimeError("invalid option '%%%c' to 'format'", verb)
+		}
+		argIndex++
+		if sb.Len() > MaxStringLen {
+			return nil, &LimitError{Msg: "string length overflow"}
+		}
+	}
+	return []Value{sb.String()}, nil
+}
+
+// quoteString 与 Lua 的 %q 一致，结果可以被解释器重新读取
+func quoteString(str string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString("\\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case 0:
+			sb.WriteString("\\000")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+/* ---- table ---- */
+
+func tableConcat(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "concat")
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if arg(args, 1) != nil {
+		if sep, err = CheckString(args, 1, "concat"); err != nil {
+			return nil, err
+		}
+	}
+	i, err := optInt(args, 2, "concat", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(args, 3, "concat", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for k := i; k <= j; k++ {
+		switch v := t.Get(float64(k)).(type) {
+		case string:
+			sb.WriteString(v)
+		case float64:
+			sb.WriteString(formatNumber(v))
+		default:
+			return nil, s.RuntimeError("invalid value (at index %d) in table for 'concat'", k)
+		}
+		if k < j {
+			sb.WriteString(sep)
+		}
+		if sb.Len() > MaxStringLen {
+			return nil, &LimitError{Msg: "string length overflow"}
+		}
+	}
+	return []Value{sb.String()}, nil
+}
+
+func tableGetn(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "getn")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(t.Len())}, nil
+}
+
+// tableInsert table.insert(t, [pos,] value)
+func tableInsert(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "insert")
+	if err != nil {
+		return nil, err
+	}
+	n := t.Len()
+	switch len(args) {
+	case 2:
+		t.Append(args[1])
+	case 3:
+		pos, err := CheckNumber(args, 1, "insert")
+		if err != nil {
+			return nil, err
+		}
+		p := int(pos)
+		if p < 1 || p > n+1 {
+			return nil, argError(1, "insert", "position out of bounds")
+		}
+		for k := n; k >= p; k-- {
+			_ = t.Set(float64(k+1), t.Get(float64(k)))
+		}
+		_ = t.Set(float64(p), args[2])
+	default:
+		return nil, s.RuntimeError("wrong number of arguments to 'insert'")
+	}
+	return nil, nil
+}
+
+// tableRemove table.remove(t [, pos])，返回被删除的元素
+func tableRemove(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "remove")
+	if err != nil {
+		return nil, err
+	}
+	n := t.Len()
+	p, err := optInt(args, 1, "remove", n)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if p < 1 || p > n {
+		return nil, argError(1, "remove", "position out of bounds")
+	}
+	removed := t.Get(float64(p))
+	for k := p; k < n; k++ {
+		_ = t.Set(float64(k), t.Get(float64(k+1)))
+	}
+	_ = t.Set(float64(n), nil)
+	return []Value{removed}, nil
+}
+
+// tableSort table.sort(t [, comp])
+func tableSort(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "sort")
+	if err != nil {
+		return nil, err
+	}
+	comp := arg(args, 1)
+	items := make([]Value, t.Len())
+	for i := range items {
+		items[i] = t.Get(float64(i + 1))
+	}
+	var sortErr error
+	less := func(a, b Value) bool {
+		if sortErr != nil {
+			return false
+		}
+		var result Value
+		if comp != nil {
+			rets, err := s.Call(comp, a, b)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+			result = arg(rets, 0)
+		} else {
+			result, sortErr = s.compare("<", a, b)
+		}
+		return Truthy(result)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	for i, item := range items {
+		_ = t.Set(float64(i+1), item)
+	}
+	return nil, nil
+}
+
+// tableUnpack unpack(t [, i [, j]])
+func tableUnpack(s *State, args []Value) ([]Value, error) {
+	t, err := checkTable(args, 0, "unpack")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(args, 1, "unpack", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(args, 2, "unpack", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	if i > j {
+		return nil, nil
+	}
+	if j-i >= 1<<20 {
+		return nil, s.RuntimeError("too many results to unpack")
+	}
+	rets := make([]Value, 0, j-i+1)
+	for k := i; k <= j; k++ {
+		rets = append(rets, t.Get(float64(k)))
+	}
+	return rets, nil
+}
+
+/* ---- math ---- */
+
+func mathFunc(fn func(float64) float64) func(s *State, args []Value) ([]Value, error) {
+	return func(s *State, args []Value) ([]Value, error) {
+		n, err := CheckNumber(args, 0, "math")
+		if err != nil {
+			return nil, err
+		}
+		return []Value{fn(n)}, nil
+	}
+}
+
+func mathFunc2(fn func(float64, float64) float64) func(s *State, args []Value) ([]Value, error) {
+	return func(s *State, args []Value) ([]Value, error) {
+		a, err := CheckNumber(args, 0, "math")
+		if err != nil {
+			return nil, err
+		}
+		b, err := CheckNumber(args, 1, "math")
+		if err != nil {
+			return nil, err
+		}
+		return []Value{fn(a, b)}, nil
+	}
+}
+
+func mathMax(s *State, args []Value) ([]Value, error) {
+	result, err := CheckNumber(args, 0, "max")
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		n, err := CheckNumber(args, i, "max")
+		if err != nil {
+			return nil, err
+		}
+		result = math.Max(result, n)
+	}
+	return []Value{result}, nil
+}
+
+func mathMin(s *State, args []Value) ([]Value, error) {
+	result, err := CheckNumber(args, 0, "min")
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		n, err := CheckNumber(args, i, "min")
+		if err != nil {
+			return nil, err
+		}
+		result = math.Min(result, n)
+	}
+	return []Value{result}, nil
+}
+
+func mathModf(s *State, args []Value) ([]Value, error) {
+	n, err := CheckNumber(args, 0, "modf")
+	if err != nil {
+		return nil, err
+	}
+	intPart, frac := math.Modf(n)
+	return []Value{intPart, frac}, nil
+}
@@ -0,0 +1,240 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, src string) []Value {
+	t.Helper()
+	chunk, err := Compile("test", src)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	rets, err := NewState().Run(chunk)
+	if err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	return rets
+}
+
+func runError(t *testing.T, src string) error {
+	t.Helper()
+	chunk, err := Compile("test", src)
+	if err != nil {
+		return err
+	}
+	_, err = NewState().Run(chunk)
+	if err == nil {
+		t.Fatalf("expected error: %s", src)
+	}
+	return err
+}
+
+func TestExpressions(t *testing.T) {
+	cases := map[string]string{
+		"return 1 + 2 * 3":                "7",
+		"return (1 + 2) * 3":              "9",
+		"return 2 ^ 3 ^ 2":                "512",
+		"return -2 ^ 2":                   "-4",
+		"return 7 % 3, -7 % 3":            "1,2",
+		"return 7 / 2":                    "3.5",
+		"return 'a' .. 'b' .. 1":          "ab1",
+		"return '10' + 1":                 "11",
+		"return 1 == 1.0, 'a' < 'b'":      "true,true",
+		"return nil or false, 1 and 2":    "false,2",
+		"return not nil, #'abc', #{1, 2}": "true,3,2",
+		"return 0x10, 1e2, .5":            "16,100,0.5",
+		"return 1/3":                      "0.33333333333333",
+		"return [[a\nb]], '\\65\\t'":      "a\nb,A\t",
+	}
+	for src, expected := range cases {
+		rets := run(t, src)
+		actual := make([]string, len(rets))
+		for i, v := range rets {
+			actual[i] = ToString(v)
+		}
+		if strings.Join(actual, ",") != expected {
+			t.Errorf("%s: expected %q, actual %q", src, expected, strings.Join(actual, ","))
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	rets := run(t, `
+		local sum = 0
+		for i = 1, 10 do
+			if i % 2 == 0 then
+				sum = sum + i
+			elseif i == 5 then
+				break
+			end
+		end
+		local n = 0
+		while true do
+			n = n + 1
+			if n >= 3 then break end
+		end
+		local m = 0
+		repeat
+			local done = m >= 4
+			m = m + 2
+		until done
+		local keys = {}
+		for k, v in pairs({a = 1, b = 2, 10, 20}) do
+			keys[#keys + 1] = k .. "=" .. v
+		end
+		local desc = {}
+		for i = 3, 1, -1 do desc[#desc + 1] = i end
+		return sum, n, m, table.concat(keys, ","), table.concat(desc)
+	`)
+	expected := []string{"6", "3", "6", "1=10,2=20,a=1,b=2", "321"}
+	for i, v := range rets {
+		if ToString(v) != expected[i] {
+			t.Errorf("result %d: expected %s, actual %s", i, expected[i], ToString(v))
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	rets := run(t, `
+		local function fib(n)
+			if n < 2 then return n end
+			return fib(n - 1) + fib(n - 2)
+		end
+		local function counter()
+			local c = 0
+			return function() c = c + 1; return c end
+		end
+		local next1 = counter()
+		next1(); next1()
+		local x = 1
+		local get = function() return x end
+		local x = 2
+		local function sum(...)
+			local total = 0
+			for _, v in ipairs({...}) do total = total + v end
+			return total, select('#', ...)
+		end
+		local obj = {n = 5}
+		function obj:add(d) self.n = self.n + d; return self.n end
+		return fib(15), next1(), get(), sum(1, 2, 3), obj:add(2), ("abc"):upper()
+	`)
+	// 不是最后一个表达式的多返回值只保留第一个
+	expected := []string{"610", "3", "1", "6", "7", "ABC"}
+	if len(rets) != len(expected) {
+		t.Fatalf("expected %d results, actual %d", len(expected), len(rets))
+	}
+	for i, v := range rets {
+		if ToString(v) != expected[i] {
+			t.Errorf("result %d: expected %s, actual %s", i, expected[i], ToString(v))
+		}
+	}
+}
+
+func TestLibs(t *testing.T) {
+	rets := run(t, `
+		local t = {5, 2, 8, 1}
+		table.sort(t)
+		table.insert(t, 1, 0)
+		local removed = table.remove(t)
+		table.sort(t, function(a, b) return a > b end)
+		return table.concat(t, " "), removed,
+			string.format("%d|%5.2f|%s|%q|%x", 42, 3.14159, "s", 'a"b', 255),
+			string.sub("hello", 2, -2), string.find("hello", "ll"), string.rep("ab", 3),
+			tonumber("0x1f"), tonumber("z", 36), tonumber("abc"), math.max(1, 5, 3), math.floor(-1.5),
+			string.byte("A"), string.char(104, 105), select(-1, "a", "b")
+	`)
+	expected := []string{"5 2 1 0", "8", `42| 3.14|s|"a\"b"|ff`, "ell", "3", "ababab",
+		"31", "35", "nil", "5", "-2", "65", "hi", "b"}
+	if len(rets) != len(expected) {
+		t.Fatalf("expected %d results, actual %d", len(expected), len(rets))
+	}
+	for i, v := range rets {
+		if ToString(v) != expected[i] {
+			t.Errorf("result %d: expected %s, actual %s", i, expected[i], ToString(v))
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	rets := run(t, `
+		local ok, err = pcall(function() error("boom") end)
+		local ok2, err2 = pcall(error, {code = 1})
+		local ok3, err3 = pcall(function() return nil + 1 end)
+		return ok, err, ok2, err2.code, err3
+	`)
+	if rets[0] != false || rets[1] != "test:2: boom" || rets[2] != false || rets[3] != 1.0 ||
+		rets[4] != "test:4: attempt to perform arithmetic on a nil value" {
+		t.Errorf("unexpected results: %v", rets)
+	}
+
+	err := runError(t, "local t = nil\nreturn t.x")
+	if err.Error() != "test:2: attempt to index a nil value" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = runError(t, "undefined()")
+	if err.Error() != "test:1: attempt to call 'undefined' (a nil value)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = runError(t, "local x = = 1")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected syntax error, actual %v", err)
+	}
+	err = runError(t, "return 'unfinished")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected syntax error, actual %v", err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	// 死循环会被执行步数限制终止，并且 pcall 无法捕获
+	chunk, err := Compile("test", "pcall(function() while true do end end)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewState()
+	s.SetStepLimit(10000)
+	if _, err := s.Run(chunk); err == nil {
+		t.Error("expected step limit error")
+	} else if _, ok := err.(*LimitError); !ok {
+		t.Errorf("expected limit error, actual %v", err)
+	}
+
+	err = runError(t, "local function f() return f() + 1 end return f()")
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("expected stack overflow, actual %v", err)
+	}
+	err = runError(t, "local s = 'x' while true do s = s .. s end")
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("expected string length error, actual %v", err)
+	}
+
+	for _, name := range []string{"os", "io", "load", "loadstring", "dofile", "require", "setmetatable"} {
+		if NewState().GetGlobal(name) != nil {
+			t.Errorf("%s should not be available", name)
+		}
+	}
+}
+
+func TestTableNext(t *testing.T) {
+	tbl := NewTable()
+	for i := 1; i <= 3; i++ {
+		tbl.Append(float64(i))
+	}
+	_ = tbl.Set("k", "v")
+	_ = tbl.Set(5.0, "five")
+	_ = tbl.Set(4.0, "four") // 5 会被转移到数组部分
+	if tbl.Len() != 5 {
+		t.Errorf("expected len 5, actual %d", tbl.Len())
+	}
+	count := 0
+	for k, _, _ := tbl.Next(nil); k != nil; k, _, _ = tbl.Next(k) {
+		// 遍历时删除元素
+		_ = tbl.Set(k, nil)
+		count++
+	}
+	if count != 6 || tbl.Len() != 0 {
+		t.Errorf("expected 6 entries, actual %d, len %d", count, tbl.Len())
+	}
+}
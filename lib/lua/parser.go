@@ -0,0 +1,722 @@
+package lua
+
+import "fmt"
+
+/*
+	语法分析：递归下降，运算符优先级与 Lua 5.1 一致
+*/
+
+type parser struct {
+	tokens []token
+	pos    int
+	// 当前函数是否接受可变参数，决定 ... 是否合法
+	vararg bool
+}
+
+// Chunk 编译后的脚本，可以被多次执行
+type Chunk struct {
+	name  string
+	proto *funcProto
+}
+
+// Compile 编译脚本，name 用于错误信息
+func Compile(name string, src string) (chunk *Chunk, err error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		err.(*SyntaxError).Chunk = name
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vararg: true}
+	body, err := p.block()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("'<eof>' expected near '%s'", p.peek().describe())
+	}
+	if err != nil {
+		err.(*SyntaxError).Chunk = name
+		return nil, err
+	}
+	return &Chunk{
+		name:  name,
+		proto: &funcProto{name: "main chunk", isVararg: true, body: body},
+	}, nil
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "<eof>"
+	case tokNumber:
+		return formatNumber(t.num)
+	default:
+		return t.text
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.peek().line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// check 当前 token 是否是指定的关键字或符号
+func (p *parser) check(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokKeyword || tok.kind == tokSymbol) && tok.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.check(text) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("'%s' expected near '%s'", text, p.peek().describe())
+	}
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokName {
+		return "", p.errorf("<name> expected near '%s'", tok.describe())
+	}
+	p.advance()
+	return tok.text, nil
+}
+
+// blockEnd 判断代码块是否结束
+func (p *parser) blockEnd() bool {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return true
+	}
+	if tok.kind != tokKeyword {
+		return false
+	}
+	switch tok.text {
+	case "end", "else", "elseif", "until":
+		return true
+	}
+	return false
+}
+
+func (p *parser) block() ([]stmt, error) {
+	stmts := make([]stmt, 0)
+	for !p.blockEnd() {
+		if p.check("return") {
+			s, err := p.returnStatement()
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, s)
+			// return 必须是代码块的最后一条语句
+			if !p.blockEnd() {
+				return nil, p.errorf("'end' expected near '%s'", p.peek().describe())
+			}
+			break
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts, nil
+}
+
+func (p *parser) returnStatement() (stmt, error) {
+	line := p.advance().line
+	s := &returnStmt{line: line}
+	if p.blockEnd() || p.check(";") {
+		p.accept(";")
+		return s, nil
+	}
+	exprs, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	s.exprs = exprs
+	return s, nil
+}
+
+func (p *parser) statement() (stmt, error) {
+	tok := p.peek()
+	if tok.kind == tokSymbol && tok.text == ";" {
+		p.advance()
+		return nil, nil
+	}
+	if tok.kind == tokKeyword {
+		switch tok.text {
+		case "if":
+			return p.ifStatement()
+		case "while":
+			p.advance()
+			cond, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			body, err := p.doBlock()
+			if err != nil {
+				return nil, err
+			}
+			return &whileStmt{cond: cond, body: body, line: tok.line}, nil
+		case "do":
+			body, err := p.doBlock()
+			if err != nil {
+				return nil, err
+			}
+			return &doStmt{body: body}, nil
+		case "for":
+			return p.forStatement()
+		case "repeat":
+			p.advance()
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("until"); err != nil {
+				return nil, err
+			}
+			cond, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return &repeatStmt{body: body, cond: cond, line: tok.line}, nil
+		case "function":
+			return p.functionStatement()
+		case "local":
+			p.advance()
+			if p.accept("function") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				proto, err := p.funcBody(name, false)
+				if err != nil {
+					return nil, err
+				}
+				return &localFunctionStmt{name: name, proto: proto, line: tok.line}, nil
+			}
+			return p.localStatement(tok.line)
+		case "break":
+			p.advance()
+			return &breakStmt{}, nil
+		}
+	}
+	return p.exprStatement()
+}
+
+// doBlock do block end
+func (p *parser) doBlock() ([]stmt, error) {
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (p *parser) ifStatement() (stmt, error) {
+	s := &ifStmt{line: p.advance().line}
+	for {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.conds = append(s.conds, cond)
+		s.blocks = append(s.blocks, body)
+		if p.accept("elseif") {
+			continue
+		}
+		if p.accept("else") {
+			s.elseBody, err = p.block()
+			if err != nil {
+				return nil, err
+			}
+			if s.elseBody == nil {
+				s.elseBody = []stmt{}
+			}
+		}
+		if err := p.expect("end"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+func (p *parser) forStatement() (stmt, error) {
+	line := p.advance().line
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("=") {
+		s := &numericForStmt{name: name, line: line}
+		if s.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if s.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if s.body, err = p.doBlock(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	s := &genericForStmt{names: []string{name}, line: line}
+	for p.accept(",") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if s.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if s.body, err = p.doBlock(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// functionStatement function a.b.c:d() end
+func (p *parser) functionStatement() (stmt, error) {
+	line := p.advance().line
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	fullName := name
+	var target expr = &nameExpr{name: name}
+	isMethod := false
+	for p.check(".") || p.check(":") {
+		isMethod = p.advance().text == ":"
+		key, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		fullName += "." + key
+		target = &indexExpr{obj: target, key: &stringExpr{value: key}, line: line}
+		if isMethod {
+			break
+		}
+	}
+	proto, err := p.funcBody(fullName, isMethod)
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{
+		targets: []expr{target},
+		exprs:   []expr{&functionExpr{proto: proto}},
+		line:    line,
+	}, nil
+}
+
+func (p *parser) localStatement(line int) (stmt, error) {
+	s := &localStmt{line: line}
+	for {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("=") {
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		s.exprs = exprs
+	}
+	return s, nil
+}
+
+// exprStatement 函数调用或者赋值语句
+func (p *parser) exprStatement() (stmt, error) {
+	line := p.peek().line
+	first, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.check("=") || p.check(",") {
+		targets := []expr{first}
+		for p.accept(",") {
+			target, err := p.suffixedExpr()
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+		for _, target := range targets {
+			switch target.(type) {
+			case *nameExpr, *indexExpr:
+			default:
+				return nil, p.errorf("syntax error near '%s'", p.peek().describe())
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &assignStmt{targets: targets, exprs: exprs, line: line}, nil
+	}
+	switch first.(type) {
+	case *callExpr, *methodCallExpr:
+		return &callStmt{call: first, line: line}, nil
+	}
+	return nil, p.errorf("syntax error near '%s'", p.peek().describe())
+}
+
+func (p *parser) funcBody(name string, isMethod bool) (*funcProto, error) {
+	proto := &funcProto{name: name}
+	if isMethod {
+		proto.params = append(proto.params, "self")
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if !p.check(")") {
+		for {
+			if p.accept("...") {
+				proto.isVararg = true
+				break
+			}
+			param, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			proto.params = append(proto.params, param)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	outerVararg := p.vararg
+	p.vararg = proto.isVararg
+	body, err := p.block()
+	p.vararg = outerVararg
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	proto.body = body
+	return proto, nil
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	exprs := make([]expr, 0, 1)
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+/* ---- 表达式 ---- */
+
+// 二元运算符的左右优先级，右结合的运算符右优先级更低
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4},
+	"+":  {6, 6}, "-": {6, 6},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+const unaryPriority = 8
+
+func (p *parser) expr() (expr, error) {
+	return p.subExpr(0)
+}
+
+func (p *parser) binaryOp() (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokSymbol && tok.kind != tokKeyword {
+		return "", false
+	}
+	_, ok := binaryPriority[tok.text]
+	return tok.text, ok
+}
+
+// subExpr 解析优先级高于 limit 的表达式
+func (p *parser) subExpr(limit int) (expr, error) {
+	var left expr
+	var err error
+	tok := p.peek()
+	if (tok.kind == tokKeyword && tok.text == "not") || (tok.kind == tokSymbol && (tok.text == "-" || tok.text == "#")) {
+		p.advance()
+		operand, err := p.subExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		left = &unaryExpr{op: tok.text, operand: operand, line: tok.line}
+	} else {
+		left, err = p.simpleExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for {
+		op, ok := p.binaryOp()
+		if !ok || binaryPriority[op][0] <= limit {
+			return left, nil
+		}
+		line := p.advance().line
+		right, err := p.subExpr(binaryPriority[op][1])
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right, line: line}
+	}
+}
+
+func (p *parser) simpleExpr() (expr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.advance()
+		return &numberExpr{value: tok.num}, nil
+	case tokString:
+		p.advance()
+		return &stringExpr{value: tok.text}, nil
+	case tokKeyword:
+		switch tok.text {
+		case "nil":
+			p.advance()
+			return &nilExpr{}, nil
+		case "true":
+			p.advance()
+			return &trueExpr{}, nil
+		case "false":
+			p.advance()
+			return &falseExpr{}, nil
+		case "function":
+			p.advance()
+			proto, err := p.funcBody("anonymous", false)
+			if err != nil {
+				return nil, err
+			}
+			return &functionExpr{proto: proto}, nil
+		}
+	case tokSymbol:
+		switch tok.text {
+		case "...":
+			if !p.vararg {
+				return nil, p.errorf("cannot use '...' outside a vararg function")
+			}
+			p.advance()
+			return &varargExpr{}, nil
+		case "{":
+			return p.tableConstructor()
+		}
+	}
+	return p.suffixedExpr()
+}
+
+func (p *parser) primaryExpr() (expr, error) {
+	tok := p.peek()
+	if tok.kind == tokName {
+		p.advance()
+		return &nameExpr{name: tok.text}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &parenExpr{inner: inner}, nil
+	}
+	return nil, p.errorf("unexpected symbol near '%s'", tok.describe())
+}
+
+// suffixedExpr primaryExpr { .name | [expr] | :name args | args }
+func (p *parser) suffixedExpr() (expr, error) {
+	e, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.check("."):
+			p.advance()
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &stringExpr{value: name}, line: tok.line}
+		case p.check("["):
+			p.advance()
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key, line: tok.line}
+		case p.check(":"):
+			p.advance()
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodCallExpr{obj: e, name: name, args: args, line: tok.line}
+		case p.check("(") || p.check("{") || tok.kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: tok.line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// callArgs (args) | {table} | "string"
+func (p *parser) callArgs() ([]expr, error) {
+	tok := p.peek()
+	if tok.kind == tokString {
+		p.advance()
+		return []expr{&stringExpr{value: tok.text}}, nil
+	}
+	if p.check("{") {
+		table, err := p.tableConstructor()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{table}, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if p.accept(")") {
+		return nil, nil
+	}
+	args, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func (p *parser) tableConstructor() (expr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	t := &tableExpr{}
+	for !p.check("}") {
+		switch {
+		case p.check("["):
+			p.advance()
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			t.keys = append(t.keys, key)
+			t.values = append(t.values, value)
+		case p.peek().kind == tokName && p.tokens[p.pos+1].kind == tokSymbol && p.tokens[p.pos+1].text == "=":
+			name := p.advance().text
+			p.advance()
+			value, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			t.keys = append(t.keys, &stringExpr{value: name})
+			t.values = append(t.values, value)
+		default:
+			value, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			t.arrayItems = append(t.arrayItems, value)
+		}
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,771 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+	解释器：直接遍历语法树执行
+	沙箱限制：
+	1. 只提供 SetGlobal 注入的函数以及 base/string/table/math 库中的纯函数，没有 io、os、load 等
+	2. 执行步数有上限，超出后脚本被终止，pcall 无法捕获
+	3. 函数调用深度、字符串长度有上限
+*/
+
+const (
+	// DefaultStepLimit 默认的最大执行步数
+	DefaultStepLimit = 10_000_000
+	// MaxCallDepth 最大的函数调用深度
+	MaxCallDepth = 200
+	// MaxStringLen 脚本中字符串的最大长度
+	MaxStringLen = 64 << 20
+)
+
+// Error 脚本运行时错误，Value 是传给 error() 的值
+type Error struct {
+	Value Value
+}
+
+func (e *Error) Error() string {
+	return ToString(e.Value)
+}
+
+// LimitError 脚本超出了沙箱限制，pcall 无法捕获
+type LimitError struct {
+	Msg string
+}
+
+func (e *LimitError) Error() string {
+	return e.Msg
+}
+
+// State 脚本执行环境，不能并发使用
+type State struct {
+	globals   *Table
+	stringLib *Table
+	chunk     string // 当前执行的脚本名，用于错误信息
+	line      int    // 当前执行的行号
+	steps     int
+	stepLimit int
+	depth     int
+}
+
+// NewState 创建带有标准库的执行环境
+func NewState() *State {
+	s := &State{
+		globals:   NewTable(),
+		stepLimit: DefaultStepLimit,
+	}
+	openLibs(s)
+	return s
+}
+
+// SetGlobal 设置全局变量
+func (s *State) SetGlobal(name string, value Value) {
+	_ = s.globals.Set(name, value)
+}
+
+// GetGlobal 读取全局变量
+func (s *State) GetGlobal(name string) Value {
+	return s.globals.Get(name)
+}
+
+// SetStepLimit 设置最大执行步数，小于等于0表示不限制
+func (s *State) SetStepLimit(limit int) {
+	s.stepLimit = limit
+}
+
+// Run 执行编译后的脚本，返回 return 语句的返回值
+func (s *State) Run(chunk *Chunk, args ...Value) ([]Value, error) {
+	s.chunk = chunk.name
+	s.steps = 0
+	s.depth = 0
+	fn := &Function{proto: chunk.proto}
+	return s.Call(fn, args...)
+}
+
+// RuntimeError 生成带有当前位置信息的运行时错误
+func (s *State) RuntimeError(format string, args ...interface{}) error {
+	return &Error{Value: s.where() + fmt.Sprintf(format, args...)}
+}
+
+func (s *State) where() string {
+	return fmt.Sprintf("%s:%d: ", s.chunk, s.line)
+}
+
+func (s *State) tick() error {
+	s.steps++
+	if s.stepLimit > 0 && s.steps > s.stepLimit {
+		return &LimitError{Msg: "script exceeded the maximum number of execution steps"}
+	}
+	return nil
+}
+
+/* ---- 作用域 ---- */
+
+// scope 每条 local 语句都创建一个新的作用域，闭包捕获的是定义时的作用域链
+type scope struct {
+	names    []string
+	values   []Value
+	parent   *scope
+	funcRoot bool    // 是否是函数的最外层作用域
+	varargs  []Value // 函数的可变参数，只在 funcRoot 中有效
+}
+
+func (sc *scope) lookup(name string) (*scope, int) {
+	for cur := sc; cur != nil; cur = cur.parent {
+		for i := len(cur.names) - 1; i >= 0; i-- {
+			if cur.names[i] == name {
+				return cur, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (sc *scope) getVarargs() []Value {
+	for cur := sc; cur != nil; cur = cur.parent {
+		if cur.funcRoot {
+			return cur.varargs
+		}
+	}
+	return nil
+}
+
+/* ---- 函数调用 ---- */
+
+// Call 调用函数
+func (s *State) Call(fn Value, args ...Value) ([]Value, error) {
+	switch f := fn.(type) {
+	case *GoFunction:
+		rets, err := f.Fn(s, args)
+		if err != nil {
+			switch err.(type) {
+			case *Error, *LimitError:
+				return nil, err
+			}
+			return nil, &Error{Value: s.where() + err.Error()}
+		}
+		return rets, nil
+	case *Function:
+		if s.depth >= MaxCallDepth {
+			return nil, &LimitError{Msg: "stack overflow"}
+		}
+		s.depth++
+		line := s.line
+		defer func() {
+			s.depth--
+			s.line = line
+		}()
+
+		proto := f.proto
+		sc := &scope{
+			names:    proto.params,
+			values:   make([]Value, len(proto.params)),
+			parent:   f.env,
+			funcRoot: true,
+		}
+		copy(sc.values, args)
+		if proto.isVararg && len(args) > len(proto.params) {
+			sc.varargs = args[len(proto.params):]
+		}
+		flow, rets, err := s.execBlock(proto.body, sc)
+		if err != nil {
+			return nil, err
+		}
+		if flow == flowReturn {
+			return rets, nil
+		}
+		return nil, nil
+	}
+	return nil, s.RuntimeError("attempt to call a %s value", TypeName(fn))
+}
+
+/* ---- 语句 ---- */
+
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowReturn
+)
+
+func (s *State) execBlock(stmts []stmt, sc *scope) (flow, []Value, error) {
+	f, rets, _, err := s.execStmts(stmts, sc)
+	return f, rets, err
+}
+
+// execStmts 执行语句列表，同时返回执行结束时的作用域（包含代码块中声明的局部变量）
+func (s *State) execStmts(stmts []stmt, sc *scope) (flow, []Value, *scope, error) {
+	for _, st := range stmts {
+		if err := s.tick(); err != nil {
+			return flowNormal, nil, sc, err
+		}
+		switch st := st.(type) {
+		case *localStmt:
+			// 新的局部变量在新的作用域中，初始化表达式看不到它们
+			s.line = st.line
+			values, err := s.evalList(st.exprs, sc)
+			if err != nil {
+				return flowNormal, nil, sc, err
+			}
+			next := &scope{names: st.names, values: make([]Value, len(st.names)), parent: sc}
+			copy(next.values, values)
+			sc = next
+		case *localFunctionStmt:
+			// 局部函数可以递归调用自身
+			s.line = st.line
+			next := &scope{names: []string{st.name}, values: make([]Value, 1), parent: sc}
+			next.values[0] = &Function{proto: st.proto, env: next}
+			sc = next
+		default:
+			f, rets, err := s.exec(st, sc)
+			if err != nil || f != flowNormal {
+				return f, rets, sc, err
+			}
+		}
+	}
+	return flowNormal, nil, sc, nil
+}
+
+func (s *State) exec(st stmt, sc *scope) (flow, []Value, error) {
+	switch st := st.(type) {
+	case *assignStmt:
+		s.line = st.line
+		return flowNormal, nil, s.assign(st, sc)
+	case *callStmt:
+		s.line = st.line
+		_, err := s.evalMulti(st.call, sc)
+		return flowNormal, nil, err
+	case *doStmt:
+		return s.execBlock(st.body, &scope{parent: sc})
+	case *whileStmt:
+		for {
+			if err := s.tick(); err != nil {
+				return flowNormal, nil, err
+			}
+			s.line = st.line
+			cond, err := s.eval(st.cond, sc)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if !Truthy(cond) {
+				return flowNormal, nil, nil
+			}
+			f, rets, err := s.execBlock(st.body, &scope{parent: sc})
+			if err != nil || f == flowReturn {
+				return f, rets, err
+			}
+			if f == flowBreak {
+				return flowNormal, nil, nil
+			}
+		}
+	case *repeatStmt:
+		for {
+			if err := s.tick(); err != nil {
+				return flowNormal, nil, err
+			}
+			// until 中的条件可以访问循环体中的局部变量
+			f, rets, body, err := s.execStmts(st.body, &scope{parent: sc})
+			if err != nil || f == flowReturn {
+				return f, rets, err
+			}
+			if f == flowBreak {
+				return flowNormal, nil, nil
+			}
+			s.line = st.line
+			cond, err := s.eval(st.cond, body)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if Truthy(cond) {
+				return flowNormal, nil, nil
+			}
+		}
+	case *ifStmt:
+		s.line = st.line
+		for i, condExpr := range st.conds {
+			cond, err := s.eval(condExpr, sc)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if Truthy(cond) {
+				return s.execBlock(st.blocks[i], &scope{parent: sc})
+			}
+		}
+		if st.elseBody != nil {
+			return s.execBlock(st.elseBody, &scope{parent: sc})
+		}
+		return flowNormal, nil, nil
+	case *numericForStmt:
+		return s.execNumericFor(st, sc)
+	case *genericForStmt:
+		return s.execGenericFor(st, sc)
+	case *returnStmt:
+		s.line = st.line
+		rets, err := s.evalList(st.exprs, sc)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		return flowReturn, rets, nil
+	case *breakStmt:
+		return flowBreak, nil, nil
+	}
+	return flowNormal, nil, s.RuntimeError("unknown statement %T", st)
+}
+
+func (s *State) execNumericFor(st *numericForStmt, sc *scope) (flow, []Value, error) {
+	s.line = st.line
+	start, err := s.evalNumber(st.start, sc, "'for' initial value must be a number")
+	if err != nil {
+		return flowNormal, nil, err
+	}
+	limit, err := s.evalNumber(st.limit, sc, "'for' limit must be a number")
+	if err != nil {
+		return flowNormal, nil, err
+	}
+	step := 1.0
+	if st.step != nil {
+		step, err = s.evalNumber(st.step, sc, "'for' step must be a number")
+		if err != nil {
+			return flowNormal, nil, err
+		}
+	}
+	for i := start; (step > 0 && i <= limit) || (step <= 0 && i >= limit); i += step {
+		if err := s.tick(); err != nil {
+			return flowNormal, nil, err
+		}
+		body := &scope{names: []string{st.name}, values: []Value{i}, parent: sc}
+		f, rets, err := s.execBlock(st.body, body)
+		if err != nil || f == flowReturn {
+			return f, rets, err
+		}
+		if f == flowBreak {
+			break
+		}
+	}
+	return flowNormal, nil, nil
+}
+
+func (s *State) evalNumber(e expr, sc *scope, msg string) (float64, error) {
+	v, err := s.eval(e, sc)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := ToNumber(v)
+	if !ok {
+		return 0, s.RuntimeError(msg)
+	}
+	return n, nil
+}
+
+func (s *State) execGenericFor(st *genericForStmt, sc *scope) (flow, []Value, error) {
+	s.line = st.line
+	values, err := s.evalList(st.exprs, sc)
+	if err != nil {
+		return flowNormal, nil, err
+	}
+	values = adjust(values, 3)
+	fn, state, control := values[0], values[1], values[2]
+	for {
+		if err := s.tick(); err != nil {
+			return flowNormal, nil, err
+		}
+		rets, err := s.Call(fn, state, control)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		rets = adjust(rets, len(st.names))
+		if rets[0] == nil {
+			return flowNormal, nil, nil
+		}
+		control = rets[0]
+		body := &scope{names: st.names, values: rets, parent: sc}
+		f, rets, err := s.execBlock(st.body, body)
+		if err != nil || f == flowReturn {
+			return f, rets, err
+		}
+		if f == flowBreak {
+			return flowNormal, nil, nil
+		}
+	}
+}
+
+// adjust 将值列表调整为n个，不足的补nil
+func adjust(values []Value, n int) []Value {
+	if len(values) == n {
+		return values
+	}
+	result := make([]Value, n)
+	copy(result, values)
+	return result
+}
+
+func (s *State) assign(st *assignStmt, sc *scope) error {
+	// 先计算所有表达式，再依次赋值
+	type indexTarget struct {
+		table *Table
+		key   Value
+	}
+	targets := make([]interface{}, len(st.targets))
+	for i, target := range st.targets {
+		if index, ok := target.(*indexExpr); ok {
+			obj, err := s.eval(index.obj, sc)
+			if err != nil {
+				return err
+			}
+			key, err := s.eval(index.key, sc)
+			if err != nil {
+				return err
+			}
+			table, ok := obj.(*Table)
+			if !ok {
+				return s.RuntimeError("attempt to index a %s value", TypeName(obj))
+			}
+			targets[i] = indexTarget{table: table, key: key}
+		}
+	}
+	values, err := s.evalList(st.exprs, sc)
+	if err != nil {
+		return err
+	}
+	values = adjust(values, len(st.targets))
+	for i, target := range st.targets {
+		switch t := targets[i].(type) {
+		case indexTarget:
+			if err := t.table.Set(t.key, values[i]); err != nil {
+				return s.RuntimeError("%s", err.Error())
+			}
+		default:
+			name := target.(*nameExpr).name
+			if owner, idx := sc.lookup(name); owner != nil {
+				owner.values[idx] = values[i]
+			} else {
+				_ = s.globals.Set(name, values[i])
+			}
+		}
+	}
+	return nil
+}
+
+/* ---- 表达式 ---- */
+
+// evalList 计算表达式列表，只有最后一个表达式会展开多返回值
+func (s *State) evalList(exprs []expr, sc *scope) ([]Value, error) {
+	values := make([]Value, 0, len(exprs))
+	for i, e := range exprs {
+		if i == len(exprs)-1 {
+			rets, err := s.evalMulti(e, sc)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, rets...)
+			break
+		}
+		v, err := s.eval(e, sc)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// evalMulti 计算可能返回多个值的表达式（函数调用和 ...）
+func (s *State) evalMulti(e expr, sc *scope) ([]Value, error) {
+	switch e := e.(type) {
+	case *callExpr:
+		fn, err := s.eval(e.fn, sc)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalList(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		s.line = e.line
+		if _, ok := fn.(*Function); !ok {
+			if _, ok := fn.(*GoFunction); !ok {
+				return nil, s.RuntimeError("attempt to call %s (a %s value)", describeExpr(e.fn), TypeName(fn))
+			}
+		}
+		return s.Call(fn, args...)
+	case *methodCallExpr:
+		obj, err := s.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		s.line = e.line
+		fn, err := s.index(obj, e.name)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalList(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		s.line = e.line
+		if fn == nil {
+			return nil, s.RuntimeError("attempt to call method '%s' (a nil value)", e.name)
+		}
+		return s.Call(fn, append([]Value{obj}, args...)...)
+	case *varargExpr:
+		return sc.getVarargs(), nil
+	}
+	v, err := s.eval(e, sc)
+	if err != nil {
+		return nil, err
+	}
+	return []Value{v}, nil
+}
+
+// describeExpr 用于错误信息，例如 attempt to call global 'foo' (a nil value)
+func describeExpr(e expr) string {
+	switch e := e.(type) {
+	case *nameExpr:
+		return "'" + e.name + "'"
+	case *indexExpr:
+		if key, ok := e.key.(*stringExpr); ok {
+			return "field '" + key.value + "'"
+		}
+	}
+	return "a value"
+}
+
+func (s *State) eval(e expr, sc *scope) (Value, error) {
+	switch e := e.(type) {
+	case *nilExpr:
+		return nil, nil
+	case *trueExpr:
+		return true, nil
+	case *falseExpr:
+		return false, nil
+	case *numberExpr:
+		return e.value, nil
+	case *stringExpr:
+		return e.value, nil
+	case *nameExpr:
+		if owner, idx := sc.lookup(e.name); owner != nil {
+			return owner.values[idx], nil
+		}
+		return s.globals.Get(e.name), nil
+	case *indexExpr:
+		obj, err := s.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.eval(e.key, sc)
+		if err != nil {
+			return nil, err
+		}
+		s.line = e.line
+		return s.index(obj, key)
+	case *callExpr, *methodCallExpr, *varargExpr:
+		values, err := s.evalMulti(e, sc)
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+		return values[0], nil
+	case *parenExpr:
+		return s.eval(e.inner, sc)
+	case *functionExpr:
+		return &Function{proto: e.proto, env: sc}, nil
+	case *tableExpr:
+		return s.evalTable(e, sc)
+	case *unaryExpr:
+		operand, err := s.eval(e.operand, sc)
+		if err != nil {
+			return nil, err
+		}
+		s.line = e.line
+		return s.unaryOp(e.op, operand)
+	case *binaryExpr:
+		return s.evalBinary(e, sc)
+	}
+	return nil, s.RuntimeError("unknown expression %T", e)
+}
+
+func (s *State) index(obj Value, key Value) (Value, error) {
+	switch o := obj.(type) {
+	case *Table:
+		return o.Get(key), nil
+	case string:
+		// 字符串可以使用 string 库中的方法，例如 s:upper()
+		return s.stringLib.Get(key), nil
+	}
+	return nil, s.RuntimeError("attempt to index a %s value", TypeName(obj))
+}
+
+func (s *State) evalTable(e *tableExpr, sc *scope) (Value, error) {
+	t := NewTable()
+	for i := range e.keys {
+		key, err := s.eval(e.keys[i], sc)
+		if err != nil {
+			return nil, err
+		}
+		value, err := s.eval(e.values[i], sc)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.Set(key, value); err != nil {
+			return nil, s.RuntimeError("%s", err.Error())
+		}
+	}
+	items, err := s.evalList(e.arrayItems, sc)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		_ = t.Set(float64(i+1), item)
+	}
+	return t, nil
+}
+
+func (s *State) unaryOp(op string, operand Value) (Value, error) {
+	switch op {
+	case "not":
+		return !Truthy(operand), nil
+	case "-":
+		n, ok := ToNumber(operand)
+		if !ok {
+			return nil, s.RuntimeError("attempt to perform arithmetic on a %s value", TypeName(operand))
+		}
+		return -n, nil
+	case "#":
+		switch v := operand.(type) {
+		case string:
+			return float64(len(v)), nil
+		case *Table:
+			return float64(v.Len()), nil
+		}
+		return nil, s.RuntimeError("attempt to get length of a %s value", TypeName(operand))
+	}
+	return nil, s.RuntimeError("unknown operator %s", op)
+}
+
+func (s *State) evalBinary(e *binaryExpr, sc *scope) (Value, error) {
+	left, err := s.eval(e.left, sc)
+	if err != nil {
+		return nil, err
+	}
+	// 短路求值
+	switch e.op {
+	case "and":
+		if !Truthy(left) {
+			return left, nil
+		}
+		return s.eval(e.right, sc)
+	case "or":
+		if Truthy(left) {
+			return left, nil
+		}
+		return s.eval(e.right, sc)
+	}
+	right, err := s.eval(e.right, sc)
+	if err != nil {
+		return nil, err
+	}
+	s.line = e.line
+	return s.Arith(e.op, left, right)
+}
+
+// Arith 计算二元运算
+func (s *State) Arith(op string, left, right Value) (Value, error) {
+	switch op {
+	case "==":
+		return RawEquals(left, right), nil
+	case "~=":
+		return !RawEquals(left, right), nil
+	case "<", "<=", ">", ">=":
+		return s.compare(op, left, right)
+	case "..":
+		return s.concat(left, right)
+	}
+	a, ok1 := ToNumber(left)
+	b, ok2 := ToNumber(right)
+	if !ok1 || !ok2 {
+		bad := left
+		if ok1 {
+			bad = right
+		}
+		return nil, s.RuntimeError("attempt to perform arithmetic on a %s value", TypeName(bad))
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		return a - math.Floor(a/b)*b, nil
+	case "^":
+		return math.Pow(a, b), nil
+	}
+	return nil, s.RuntimeError("unknown operator %s", op)
+}
+
+// RawEquals 相同类型并且值相等，table 和函数比较引用
+func RawEquals(a, b Value) bool {
+	return a == b
+}
+
+func (s *State) compare(op string, left, right Value) (Value, error) {
+	var less, equal bool
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, s.compareError(left, right)
+		}
+		less, equal = l < r, l == r
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, s.compareError(left, right)
+		}
+		less, equal = l < r, l == r
+	default:
+		return nil, s.compareError(left, right)
+	}
+	switch op {
+	case "<":
+		return less, nil
+	case "<=":
+		return less || equal, nil
+	case ">":
+		return !less && !equal, nil
+	default:
+		return !less, nil
+	}
+}
+
+func (s *State) compareError(left, right Value) error {
+	if TypeName(left) == TypeName(right) {
+		return s.RuntimeError("attempt to compare two %s values", TypeName(left))
+	}
+	return s.RuntimeError("attempt to compare %s with %s", TypeName(left), TypeName(right))
+}
+
+func (s *State) concat(left, right Value) (Value, error) {
+	parts := [2]string{}
+	for i, v := range []Value{left, right} {
+		switch val := v.(type) {
+		case string:
+			parts[i] = val
+		case float64:
+			parts[i] = formatNumber(val)
+		default:
+			return nil, s.RuntimeError("attempt to concatenate a %s value", TypeName(v))
+		}
+	}
+	if len(parts[0])+len(parts[1]) > MaxStringLen {
+		return nil, &LimitError{Msg: "string length overflow"}
+	}
+	return strings.Join(parts[:], ""), nil
+}
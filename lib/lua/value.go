@@ -0,0 +1,278 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+/*
+	脚本中的值：
+	nil --> nil，boolean --> bool，number --> float64，string --> string
+	table --> *Table，function --> *Function 或者 *GoFunction
+*/
+
+// Value 脚本中的值
+type Value interface{}
+
+// GoFunction 由 Go 实现的函数
+type GoFunction struct {
+	Name string
+	Fn   func(s *State, args []Value) ([]Value, error)
+}
+
+// Function 脚本中定义的函数（闭包）
+type Function struct {
+	proto *funcProto
+	env   *scope // 定义函数时的作用域
+}
+
+// TypeName 返回值的类型名，与 type() 的结果一致
+func TypeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *Function, *GoFunction:
+		return "function"
+	}
+	return "userdata"
+}
+
+// Truthy 只有 nil 和 false 为假
+func Truthy(v Value) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	}
+	return true
+}
+
+// formatNumber 与 Lua 5.1 的 "%.14g" 一致
+func formatNumber(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	case math.IsNaN(n):
+		return "nan"
+	case n == math.Trunc(n) && math.Abs(n) < 1e15:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+// ToString 与 tostring() 一致
+func ToString(v Value) string {
+	switch val := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatNumber(val)
+	case string:
+		return val
+	case *Table:
+		return fmt.Sprintf("table: %p", val)
+	case *Function:
+		return fmt.Sprintf("function: %p", val)
+	case *GoFunction:
+		return fmt.Sprintf("function: builtin: %s", val.Name)
+	}
+	return fmt.Sprintf("userdata: %v", v)
+}
+
+// ToNumber 数字或者可以转换为数字的字符串
+func ToNumber(v Value) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		return parseNumber(val)
+	}
+	return 0, false
+}
+
+/* ---- table ---- */
+
+type tableEntry struct {
+	key   Value
+	value Value
+}
+
+// Table 由数组部分和哈希部分组成，哈希部分按照插入顺序遍历，保证脚本的执行结果是确定的
+type Table struct {
+	array   []Value       // 下标 1..n
+	index   map[Value]int // key --> entries 中的位置
+	entries []tableEntry  // value 为 nil 表示已经被删除
+}
+
+// NewTable 创建空表
+func NewTable() *Table {
+	return &Table{}
+}
+
+// arrayIndex 整数值的 float64 作为数组下标
+func arrayIndex(key Value) (int, bool) {
+	n, ok := key.(float64)
+	if !ok || n != math.Trunc(n) || n < 1 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// Get 读取 t[key]
+func (t *Table) Get(key Value) Value {
+	if i, ok := arrayIndex(key); ok && i <= len(t.array) {
+		return t.array[i-1]
+	}
+	if t.index == nil {
+		return nil
+	}
+	if pos, ok := t.index[key]; ok {
+		return t.entries[pos].value
+	}
+	return nil
+}
+
+// Set 写入 t[key] = value，value 为 nil 时删除
+func (t *Table) Set(key Value, value Value) error {
+	switch k := key.(type) {
+	case nil:
+		return fmt.Errorf("table index is nil")
+	case float64:
+		if math.IsNaN(k) {
+			return fmt.Errorf("table index is NaN")
+		}
+	}
+	if i, ok := arrayIndex(key); ok {
+		if i <= len(t.array) {
+			t.array[i-1] = value
+			if i == len(t.array) && value == nil {
+				t.trimArray()
+			}
+			return nil
+		}
+		if i == len(t.array)+1 && value != nil {
+			t.array = append(t.array, value)
+			t.moveOutOfHash(key)
+			t.migrate()
+			return nil
+		}
+	}
+	if value == nil {
+		t.deleteHash(key)
+		return nil
+	}
+	if t.index == nil {
+		t.index = make(map[Value]int)
+	}
+	if pos, ok := t.index[key]; ok {
+		t.entries[pos].value = value
+		return nil
+	}
+	t.index[key] = len(t.entries)
+	t.entries = append(t.entries, tableEntry{key: key, value: value})
+	return nil
+}
+
+// moveOutOfHash key 转移到了数组部分，从哈希部分中彻底删除
+func (t *Table) moveOutOfHash(key Value) {
+	if t.index == nil {
+		return
+	}
+	if pos, ok := t.index[key]; ok {
+		t.entries[pos] = tableEntry{}
+		delete(t.index, key)
+	}
+}
+
+// deleteHash 删除后保留位置，保证遍历过程中可以删除元素
+func (t *Table) deleteHash(key Value) {
+	if t.index == nil {
+		return
+	}
+	if pos, ok := t.index[key]; ok {
+		t.entries[pos].value = nil
+	}
+}
+
+// trimArray 去掉数组末尾的 nil
+func (t *Table) trimArray() {
+	n := len(t.array)
+	for n > 0 && t.array[n-1] == nil {
+		n--
+	}
+	t.array = t.array[:n]
+}
+
+// migrate 数组增长后，将哈希部分中紧接着的整数下标转移到数组部分
+func (t *Table) migrate() {
+	if t.index == nil {
+		return
+	}
+	for {
+		key := float64(len(t.array) + 1)
+		pos, ok := t.index[key]
+		if !ok || t.entries[pos].value == nil {
+			return
+		}
+		t.array = append(t.array, t.entries[pos].value)
+		t.moveOutOfHash(key)
+	}
+}
+
+// Len 与 # 运算符一致，返回数组部分的长度
+func (t *Table) Len() int {
+	return len(t.array)
+}
+
+// Append 在数组末尾追加元素
+func (t *Table) Append(value Value) {
+	_ = t.Set(float64(len(t.array)+1), value)
+}
+
+// Next 遍历表，key 为 nil 时返回第一个元素，遍历结束时返回的 key 为 nil
+func (t *Table) Next(key Value) (Value, Value, error) {
+	start := 0 // entries 中开始查找的位置
+	if key != nil {
+		if i, ok := arrayIndex(key); ok && i <= len(t.array) {
+			for j := i; j < len(t.array); j++ {
+				if t.array[j] != nil {
+					return float64(j + 1), t.array[j], nil
+				}
+			}
+		} else if pos, ok := t.index[key]; ok {
+			start = pos + 1
+		} else if _, isIndex := arrayIndex(key); !isIndex {
+			return nil, nil, fmt.Errorf("invalid key to 'next'")
+		}
+		// 数组部分遍历完毕，或者遍历过程中数组末尾被删除，都从哈希部分的开头继续
+	} else {
+		for j := 0; j < len(t.array); j++ {
+			if t.array[j] != nil {
+				return float64(j + 1), t.array[j], nil
+			}
+		}
+	}
+	for pos := start; pos < len(t.entries); pos++ {
+		if t.entries[pos].value != nil {
+			return t.entries[pos].key, t.entries[pos].value, nil
+		}
+	}
+	return nil, nil, nil
+}
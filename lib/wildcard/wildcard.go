@@ -0,0 +1,105 @@
+package wildcard
+
+/*
+	redis风格的glob匹配，用于 PSUBSCRIBE、PUBSUB CHANNELS 等命令
+	*      匹配任意长度的字符串
+	?      匹配任意一个字符
+	[abc]  匹配括号中的任意一个字符，[^abc] 取反，[a-z] 匹配范围
+	\x     匹配字符x本身
+*/
+
+// Match 判断str是否与pattern匹配
+func Match(pattern string, str string) bool {
+	p, s := 0, 0
+	// 最近一个 * 的位置以及它当前匹配到的位置，用于回溯
+	starP, starS := -1, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// 连续的 * 等价于一个
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+				starP, starS = p, s
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				if next, ok := matchClass(pattern, p, str[s]); ok {
+					p = next
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == str[s] {
+					p += 2
+					s++
+					continue
+				}
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+		// 当前字符不匹配，让上一个 * 多匹配一个字符
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass 匹配从pattern[start]开始的 [...]，返回 ] 之后的位置
+func matchClass(pattern string, start int, c byte) (int, bool) {
+	p := start + 1
+	negate := false
+	if p < len(pattern) && pattern[p] == '^' {
+		negate = true
+		p++
+	}
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			if pattern[p+1] == c {
+				matched = true
+			}
+			p += 2
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			p += 3
+		default:
+			if pattern[p] == c {
+				matched = true
+			}
+			p++
+		}
+	}
+	if p < len(pattern) {
+		p++ // 跳过 ]
+	}
+	if negate {
+		matched = !matched
+	}
+	return p, matched
+}
@@ -0,0 +1,36 @@
+package wildcard
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		matched bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"news.*", "news.sport", true},
+		{"news.*", "new.sport", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hellox", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b", "xxaxxbxxc", false},
+		{"a**", "a", true},
+	}
+	for _, c := range cases {
+		if Match(c.pattern, c.str) != c.matched {
+			t.Errorf("match %q with %q: expected %v", c.pattern, c.str, c.matched)
+		}
+	}
+}
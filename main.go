@@ -7,6 +7,7 @@ import (
 	"github.com/HildaM/GoKV/redis/server"
 	"github.com/HildaM/GoKV/tcp"
 	"os"
+	"time"
 )
 
 var banner = `
@@ -23,6 +24,7 @@ var defaultProperties = &config.ServerProperties{
 	AppendOnly:     false,
 	AppendFilename: "",
 	MaxClients:     1000,
+	TCPKeepalive:   config.DefaultTCPKeepalive,
 }
 
 func fileExists(filename string) bool {
@@ -50,8 +52,12 @@ func main() {
 		config.SetupConfig(configFilename)
 	}
 
+	// tcp-keepalive：0表示关闭
+	keepAlive := time.Duration(config.Properties.TCPKeepalive) * time.Second
 	err := tcp.ListenAndServerWithSignal(&tcp.Config{
-		Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
+		Address:    fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
+		MaxConnect: uint32(config.Properties.MaxClients),
+		KeepAlive:  keepAlive,
 	}, server.MakeHandler())
 	if err != nil {
 		logger.Fatal(err)
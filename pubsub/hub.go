@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
+// Hub 保存所有的订阅关系
+type Hub struct {
+	mu sync.RWMutex
+	// channel --> 订阅该频道的连接
+	channels map[string]map[redis.Connection]struct{}
+	// pattern --> 订阅该模式的连接
+	patterns map[string]map[redis.Connection]struct{}
+}
+
+// MakeHub 创建 Hub
+func MakeHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[redis.Connection]struct{}),
+		patterns: make(map[string]map[redis.Connection]struct{}),
+	}
+}
+
+// add 在subs中记录订阅关系，已经订阅过时返回false
+func add(subs map[string]map[redis.Connection]struct{}, name string, c redis.Connection) bool {
+	subscribers, ok := subs[name]
+	if !ok {
+		subscribers = make(map[redis.Connection]struct{})
+		subs[name] = subscribers
+	}
+	if _, ok := subscribers[c]; ok {
+		return false
+	}
+	subscribers[c] = struct{}{}
+	return true
+}
+
+// remove 从subs中删除订阅关系，没有订阅者的频道随之删除
+func remove(subs map[string]map[redis.Connection]struct{}, name string, c redis.Connection) bool {
+	subscribers, ok := subs[name]
+	if !ok {
+		return false
+	}
+	if _, ok := subscribers[c]; !ok {
+		return false
+	}
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(subs, name)
+	}
+	return true
+}
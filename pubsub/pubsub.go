@@ -0,0 +1,253 @@
+package pubsub
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/lib/wildcard"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	发布订阅：SUBSCRIBE UNSUBSCRIBE PSUBSCRIBE PUNSUBSCRIBE PUBLISH PUBSUB
+	订阅类命令对每个频道各回复一条消息，因此直接写入连接，命令本身返回 NoReply
+*/
+
+// makeSubReply 订阅和取消订阅的回复：[kind, name, 订阅总数]，name为nil时表示没有任何订阅
+// RESP3下以push类型发送，与普通回复区分
+func makeSubReply(c redis.Connection, kind string, name *string, count int) []byte {
+	var nameReply redis.Reply = protocol.MakeNullBulkReply()
+	if name != nil {
+		nameReply = protocol.MakeBulkReply([]byte(*name))
+	}
+	return protocol.Marshal(protocol.MakePushReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(kind)),
+		nameReply,
+		protocol.MakeIntReply(int64(count)),
+	}), c.GetProtocol())
+}
+
+// pushMessage 按照订阅者的协议版本编码推送的消息，两种编码各只生成一次
+type pushMessage struct {
+	reply   *protocol.PushReply
+	encoded [2][]byte
+}
+
+func makePushMessage(args ...[]byte) *pushMessage {
+	replies := make([]redis.Reply, len(args))
+	for i, arg := range args {
+		replies[i] = protocol.MakeBulkReply(arg)
+	}
+	return &pushMessage{reply: protocol.MakePushReply(replies)}
+}
+
+func (m *pushMessage) writeTo(c redis.Connection) {
+	version := c.GetProtocol()
+	i := 0
+	if version == protocol.RESP3 {
+		i = 1
+	}
+	if m.encoded[i] == nil {
+		m.encoded[i] = protocol.Marshal(m.reply, version)
+	}
+	_ = c.Write(m.encoded[i])
+}
+
+// subsCount 连接订阅的频道和模式总数
+func subsCount(c redis.Connection) int {
+	return c.SubsCount() + c.PSubsCount()
+}
+
+// Subscribe SUBSCRIBE channel [channel ...]
+func Subscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("subscribe")
+	}
+	for _, arg := range args {
+		channel := string(arg)
+		hub.mu.Lock()
+		add(hub.channels, channel, c)
+		hub.mu.Unlock()
+		c.Subscribe(channel)
+		_ = c.Write(makeSubReply(c, "subscribe", &channel, subsCount(c)))
+	}
+	return &protocol.NoReply{}
+}
+
+// UnSubscribe UNSUBSCRIBE [channel ...] 没有参数时取消订阅所有频道
+func UnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var channels []string
+	if len(args) == 0 {
+		channels = c.GetChannels()
+		sort.Strings(channels)
+	} else {
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	}
+	if len(channels) == 0 {
+		_ = c.Write(makeSubReply(c, "unsubscribe", nil, subsCount(c)))
+		return &protocol.NoReply{}
+	}
+	for i := range channels {
+		channel := channels[i]
+		hub.mu.Lock()
+		remove(hub.channels, channel, c)
+		hub.mu.Unlock()
+		c.UnSubscribe(channel)
+		_ = c.Write(makeSubReply(c, "unsubscribe", &channel, subsCount(c)))
+	}
+	return &protocol.NoReply{}
+}
+
+// PSubscribe PSUBSCRIBE pattern [pattern ...]
+func PSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("psubscribe")
+	}
+	for _, arg := range args {
+		pattern := string(arg)
+		hub.mu.Lock()
+		add(hub.patterns, pattern, c)
+		hub.mu.Unlock()
+		c.PSubscribe(pattern)
+		_ = c.Write(makeSubReply(c, "psubscribe", &pattern, subsCount(c)))
+	}
+	return &protocol.NoReply{}
+}
+
+// PUnSubscribe PUNSUBSCRIBE [pattern ...] 没有参数时取消订阅所有模式
+func PUnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var patterns []string
+	if len(args) == 0 {
+		patterns = c.GetPatterns()
+		sort.Strings(patterns)
+	} else {
+		patterns = make([]string, len(args))
+		for i, arg := range args {
+			patterns[i] = string(arg)
+		}
+	}
+	if len(patterns) == 0 {
+		_ = c.Write(makeSubReply(c, "punsubscribe", nil, subsCount(c)))
+		return &protocol.NoReply{}
+	}
+	for i := range patterns {
+		pattern := patterns[i]
+		hub.mu.Lock()
+		remove(hub.patterns, pattern, c)
+		hub.mu.Unlock()
+		c.PUnSubscribe(pattern)
+		_ = c.Write(makeSubReply(c, "punsubscribe", &pattern, subsCount(c)))
+	}
+	return &protocol.NoReply{}
+}
+
+// UnsubscribeAll 连接关闭时取消所有订阅
+func UnsubscribeAll(hub *Hub, c redis.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, channel := range c.GetChannels() {
+		remove(hub.channels, channel, c)
+		c.UnSubscribe(channel)
+	}
+	for _, pattern := range c.GetPatterns() {
+		remove(hub.patterns, pattern, c)
+		c.PUnSubscribe(pattern)
+	}
+}
+
+// delivery 一条待发送的消息
+type delivery struct {
+	msg *pushMessage
+	c   redis.Connection
+}
+
+// Publish PUBLISH channel message，返回收到消息的订阅者数量
+// 加锁期间只收集订阅者，释放锁之后再写入，避免慢订阅者阻塞其他订阅操作
+func Publish(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("publish")
+	}
+	channel := string(args[0])
+	message := args[1]
+
+	var deliveries []delivery
+	hub.mu.RLock()
+	if subscribers, ok := hub.channels[channel]; ok {
+		msg := makePushMessage([]byte("message"), args[0], message)
+		for c := range subscribers {
+			deliveries = append(deliveries, delivery{msg: msg, c: c})
+		}
+	}
+	for pattern, subscribers := range hub.patterns {
+		if !wildcard.Match(pattern, channel) {
+			continue
+		}
+		msg := makePushMessage([]byte("pmessage"), []byte(pattern), args[0], message)
+		for c := range subscribers {
+			deliveries = append(deliveries, delivery{msg: msg, c: c})
+		}
+	}
+	hub.mu.RUnlock()
+
+	for _, d := range deliveries {
+		d.msg.writeTo(d.c)
+	}
+	return protocol.MakeIntReply(int64(len(deliveries)))
+}
+
+var pubSubHelp = []string{
+	"PUBSUB <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CHANNELS [<pattern>]",
+	"    Return the currently active channels matching a <pattern> (default: '*').",
+	"NUMPAT",
+	"    Return number of subscriptions to patterns.",
+	"NUMSUB [<channel> ...]",
+	"    Return the number of subscribers for the specified channels, excluding",
+	"    pattern subscriptions(default: no channels).",
+	"HELP",
+	"    Print this help.",
+}
+
+// PubSub PUBSUB CHANNELS|NUMSUB|NUMPAT 查看订阅状态
+func PubSub(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("pubsub")
+	}
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "help":
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(pubSubHelp...))
+	case "channels":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrReply("pubsub|channels")
+		}
+		channels := make([]string, 0, len(hub.channels))
+		for channel := range hub.channels {
+			if len(args) == 1 || wildcard.Match(string(args[1]), channel) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine(channels...))
+	case "numsub":
+		result := make([]redis.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			count := len(hub.channels[string(arg)])
+			result = append(result, protocol.MakeBulkReply(arg), protocol.MakeIntReply(int64(count)))
+		}
+		return protocol.MakeMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("pubsub|numpat")
+		}
+		return protocol.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
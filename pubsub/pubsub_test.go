@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/connection"
+)
+
+func TestPublish(t *testing.T) {
+	hub := MakeHub()
+	c1 := &connection.FakeConn{}
+	c2 := &connection.FakeConn{}
+	Subscribe(hub, c1, utils.ToCmdLine("news", "sport"))
+	PSubscribe(hub, c2, utils.ToCmdLine("n*"))
+	if c1.SubsCount() != 2 || c2.PSubsCount() != 1 {
+		t.Fatalf("unexpected subscription count: %d %d", c1.SubsCount(), c2.PSubsCount())
+	}
+	c1.Clean()
+	c2.Clean()
+
+	reply := Publish(hub, utils.ToCmdLine("news", "hello"))
+	if string(reply.ToBytes()) != ":2\r\n" {
+		t.Errorf("expected 2 receivers, actual %q", reply.ToBytes())
+	}
+	expected := "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	if string(c1.Bytes()) != expected {
+		t.Errorf("expected %q, actual %q", expected, c1.Bytes())
+	}
+	expected = "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	if string(c2.Bytes()) != expected {
+		t.Errorf("expected %q, actual %q", expected, c2.Bytes())
+	}
+
+	reply = Publish(hub, utils.ToCmdLine("weather", "sunny"))
+	if string(reply.ToBytes()) != ":0\r\n" {
+		t.Errorf("expected 0 receivers, actual %q", reply.ToBytes())
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	hub := MakeHub()
+	c := &connection.FakeConn{}
+	Subscribe(hub, c, utils.ToCmdLine("a", "b"))
+	c.Clean()
+	UnSubscribe(hub, c, utils.ToCmdLine("a"))
+	expected := "*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:1\r\n"
+	if string(c.Bytes()) != expected {
+		t.Errorf("expected %q, actual %q", expected, c.Bytes())
+	}
+	reply := PubSub(hub, utils.ToCmdLine("channels"))
+	if string(reply.ToBytes()) != "*1\r\n$1\r\nb\r\n" {
+		t.Errorf("unexpected channels %q", reply.ToBytes())
+	}
+
+	// 连接关闭后所有订阅被清理
+	PSubscribe(hub, c, utils.ToCmdLine("x*"))
+	UnsubscribeAll(hub, c)
+	if c.SubsCount() != 0 || c.PSubsCount() != 0 {
+		t.Errorf("subscriptions remain after UnsubscribeAll")
+	}
+	if len(hub.channels) != 0 || len(hub.patterns) != 0 {
+		t.Errorf("hub not empty after UnsubscribeAll")
+	}
+
+	c.Clean()
+	UnSubscribe(hub, c, nil)
+	expected = "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n"
+	if string(c.Bytes()) != expected {
+		t.Errorf("expected %q, actual %q", expected, c.Bytes())
+	}
+}
+
+func TestPubSubNumSub(t *testing.T) {
+	hub := MakeHub()
+	c1 := &connection.FakeConn{}
+	c2 := &connection.FakeConn{}
+	Subscribe(hub, c1, utils.ToCmdLine("a"))
+	Subscribe(hub, c2, utils.ToCmdLine("a"))
+	PSubscribe(hub, c1, utils.ToCmdLine("a*", "b*"))
+	PSubscribe(hub, c2, utils.ToCmdLine("a*"))
+
+	reply := PubSub(hub, utils.ToCmdLine("numsub", "a", "b"))
+	expected := "*4\r\n$1\r\na\r\n:2\r\n$1\r\nb\r\n:0\r\n"
+	if string(reply.ToBytes()) != expected {
+		t.Errorf("expected %q, actual %q", expected, reply.ToBytes())
+	}
+	reply = PubSub(hub, utils.ToCmdLine("numpat"))
+	if string(reply.ToBytes()) != ":2\r\n" {
+		t.Errorf("expected 2 patterns, actual %q", reply.ToBytes())
+	}
+}
+
+// blockingConn 设置 release 之后写入时阻塞，模拟网络拥塞的订阅者
+type blockingConn struct {
+	connection.FakeConn
+	writing chan struct{} // 开始阻塞时通知
+	release chan struct{}
+}
+
+func (c *blockingConn) Write(b []byte) error {
+	if c.release != nil {
+		c.writing <- struct{}{}
+		<-c.release
+	}
+	return c.FakeConn.Write(b)
+}
+
+func TestPublishSlowSubscriber(t *testing.T) {
+	hub := MakeHub()
+	slow := &blockingConn{}
+	Subscribe(hub, slow, utils.ToCmdLine("news"))
+	slow.writing = make(chan struct{}, 1)
+	slow.release = make(chan struct{})
+
+	published := make(chan struct{})
+	go func() {
+		Publish(hub, utils.ToCmdLine("news", "hello"))
+		close(published)
+	}()
+	<-slow.writing
+
+	// PUBLISH 阻塞在写入时，其他连接仍然可以订阅和取消订阅
+	done := make(chan struct{})
+	go func() {
+		c := &connection.FakeConn{}
+		Subscribe(hub, c, utils.ToCmdLine("news"))
+		UnSubscribe(hub, c, utils.ToCmdLine("news"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("SUBSCRIBE blocked by slow subscriber")
+	}
+
+	close(slow.release)
+	select {
+	case <-published:
+	case <-time.After(3 * time.Second):
+		t.Fatal("PUBLISH not finished")
+	}
+}
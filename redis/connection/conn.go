@@ -1,10 +1,14 @@
 package connection
 
 import (
+	"bufio"
 	"bytes"
+	"github.com/HildaM/GoKV/interface/redis"
 	"github.com/HildaM/GoKV/lib/sync/wait"
+	"github.com/HildaM/GoKV/redis/protocol"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,34 +19,106 @@ type Connection struct {
 	// 消息等待 —— 让信息完整地发送
 	waittingReply wait.Wait
 
-	// 并发锁，确保server完整处理消息
+	// 写缓冲区：命令的回复先写入缓冲区，等到输入中的命令全部处理完成后统一发送
+	// 发布订阅等消息会在其他协程中写入，需要加锁
+	writeMu sync.Mutex
+	writer  *bufio.Writer
+
+	// 并发锁，保护订阅信息以及客户端名称、最后执行的命令
 	mu sync.Mutex
 
+	// 订阅的频道和模式
+	subs  map[string]bool
+	psubs map[string]bool
+
 	// password may be changed by CONFIG command during runtime, so store the password
 	password string
 
 	// 该连接的db信息
 	selectedDB int
 	role       int32
+
+	// 客户端信息，CLIENT LIST 等命令会在其他协程中读取
+	id        uint64
+	name      string // 客户端名称，由 HELLO SETNAME 或 CLIENT SETNAME 设置
+	createdAt time.Time
+	lastCmd   string
+	// 协议版本，0表示默认的RESP2。发布订阅等消息在其他协程中写入，使用原子操作
+	protocol int32
+
+	// 最后一次收到命令的时间（UnixNano），用于回收空闲连接
+	lastActive int64
+	closed     int32
+
+	noEvict         int32 // CLIENT NO-EVICT
+	replyMode       int32 // CLIENT REPLY
+	closeAfterReply int32 // 发送完当前命令的回复后关闭连接，用于 QUIT 和 CLIENT KILL 自身
+
+	// 事务相关：MULTI之后的命令进入队列，EXEC时统一执行
+	multiState bool
+	queue      [][][]byte
+	watching   map[string]uint32 // WATCH的key --> WATCH时的版本号
+	txErrors   []error           // 命令入队时发生的错误
+}
+
+// writeBufferSize 写缓冲区大小，超过后自动发送
+const writeBufferSize = 16 * 1024
+
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, writeBufferSize)
+	},
 }
 
 func NewConn(conn net.Conn) *Connection {
-	return &Connection{
-		conn: conn,
+	writer := writerPool.Get().(*bufio.Writer)
+	writer.Reset(conn)
+	atomic.AddInt64(&connectedClients, 1)
+	atomic.AddInt64(&totalConnections, 1)
+	now := time.Now()
+	c := &Connection{
+		conn:       conn,
+		writer:     writer,
+		id:         atomic.AddUint64(&nextID, 1),
+		createdAt:  now,
+		lastActive: now.UnixNano(),
 	}
+	clients.Store(c.id, c)
+	return c
 }
 
 // RemoteAddr returns the remote network address
 func (c *Connection) RemoteAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.RemoteAddr()
 }
 
+// Close 关闭连接，可以重复调用
 func (c *Connection) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	atomic.AddInt64(&connectedClients, -1)
+	clients.Delete(c.id)
 	c.waittingReply.WaitWithTimeout(10 * time.Second)
+
+	// 发送缓冲区中剩余的回复，之后的写入直接发送到已经关闭的连接上
+	c.writeMu.Lock()
+	if c.writer != nil {
+		_ = c.writer.Flush()
+		c.writer.Reset(nil)
+		writerPool.Put(c.writer)
+		c.writer = nil
+	}
+	c.writeMu.Unlock()
+
 	c.conn.Close()
 	return nil
 }
 
+// Write 立即发送数据，缓冲区中尚未发送的回复会一同发送，保证顺序
 func (c *Connection) Write(msg []byte) error {
 	if len(msg) == 0 {
 		return nil
@@ -51,10 +127,53 @@ func (c *Connection) Write(msg []byte) error {
 	c.waittingReply.Add(1)
 	defer c.waittingReply.Done()
 
-	_, err := c.conn.Write(msg)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writer == nil {
+		_, err := c.conn.Write(msg)
+		return err
+	}
+	if _, err := c.writer.Write(msg); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+// WriteReply 按照连接的协议版本将回复写入缓冲区，需要调用 Flush 发送
+func (c *Connection) WriteReply(reply redis.Reply) error {
+	c.waittingReply.Add(1)
+	defer c.waittingReply.Done()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writer == nil {
+		_, err := protocol.Write(c.conn, reply, c.GetProtocol())
+		return err
+	}
+	_, err := protocol.Write(c.writer, reply, c.GetProtocol())
 	return err
 }
 
+// Flush 发送缓冲区中的回复
+func (c *Connection) Flush() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writer == nil {
+		return nil
+	}
+	return c.writer.Flush()
+}
+
+// Touch 记录收到命令的时间
+func (c *Connection) Touch() {
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+// IdleTime 距离上一次收到命令的时间
+func (c *Connection) IdleTime() time.Duration {
+	return time.Duration(time.Now().UnixNano() - atomic.LoadInt64(&c.lastActive))
+}
+
 // SetPassword stores password for authentication
 func (c *Connection) SetPassword(password string) {
 	c.password = password
@@ -65,6 +184,180 @@ func (c *Connection) GetPassword() string {
 	return c.password
 }
 
+// SetName 设置客户端名称
+func (c *Connection) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// GetName 返回客户端名称
+func (c *Connection) GetName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// GetID 返回连接的唯一id，从1开始递增
+func (c *Connection) GetID() uint64 {
+	return c.id
+}
+
+// CreatedAt 返回连接建立的时间
+func (c *Connection) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+// SetLastCommand 记录最后执行的命令
+func (c *Connection) SetLastCommand(cmd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCmd = cmd
+}
+
+// LastCommand 返回最后执行的命令
+func (c *Connection) LastCommand() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCmd
+}
+
+// SetNoEvict 设置 CLIENT NO-EVICT
+func (c *Connection) SetNoEvict(noEvict bool) {
+	var v int32
+	if noEvict {
+		v = 1
+	}
+	atomic.StoreInt32(&c.noEvict, v)
+}
+
+// IsNoEvict 是否开启了 CLIENT NO-EVICT
+func (c *Connection) IsNoEvict() bool {
+	return atomic.LoadInt32(&c.noEvict) == 1
+}
+
+// SetReplyMode 设置 CLIENT REPLY 模式
+func (c *Connection) SetReplyMode(mode int) {
+	atomic.StoreInt32(&c.replyMode, int32(mode))
+}
+
+// GetReplyMode 返回 CLIENT REPLY 模式
+func (c *Connection) GetReplyMode() int {
+	return int(atomic.LoadInt32(&c.replyMode))
+}
+
+// ShouldReply 当前命令的回复是否需要发送，每条命令执行后调用一次
+// SKIP 跳过的是 CLIENT REPLY SKIP 之后的那一条命令的回复
+func (c *Connection) ShouldReply() bool {
+	switch c.GetReplyMode() {
+	case redis.ReplyOff:
+		return false
+	case redis.ReplySkipNext:
+		c.SetReplyMode(redis.ReplySkip)
+		return false
+	case redis.ReplySkip:
+		c.SetReplyMode(redis.ReplyOn)
+		return false
+	}
+	return true
+}
+
+// CloseAfterReply 发送完当前命令的回复后关闭连接
+func (c *Connection) CloseAfterReply() {
+	atomic.StoreInt32(&c.closeAfterReply, 1)
+}
+
+// IsCloseAfterReply 是否需要在回复后关闭连接
+func (c *Connection) IsCloseAfterReply() bool {
+	return atomic.LoadInt32(&c.closeAfterReply) == 1
+}
+
+// SetProtocol 设置协议版本（2或3）
+func (c *Connection) SetProtocol(version int) {
+	atomic.StoreInt32(&c.protocol, int32(version))
+}
+
+// GetProtocol 返回协议版本，默认为RESP2
+func (c *Connection) GetProtocol() int {
+	version := atomic.LoadInt32(&c.protocol)
+	if version == 0 {
+		return protocol.RESP2
+	}
+	return int(version)
+}
+
+/* -------- 用于处理发布订阅 --------*/
+
+// Subscribe 订阅频道
+func (c *Connection) Subscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[string]bool)
+	}
+	c.subs[channel] = true
+}
+
+// UnSubscribe 取消订阅频道
+func (c *Connection) UnSubscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subs, channel)
+}
+
+// SubsCount 返回订阅的频道数量
+func (c *Connection) SubsCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.subs)
+}
+
+// GetChannels 返回订阅的所有频道
+func (c *Connection) GetChannels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// PSubscribe 订阅模式
+func (c *Connection) PSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+}
+
+// PUnSubscribe 取消订阅模式
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.psubs, pattern)
+}
+
+// PSubsCount 返回订阅的模式数量
+func (c *Connection) PSubsCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.psubs)
+}
+
+// GetPatterns 返回订阅的所有模式
+func (c *Connection) GetPatterns() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
 /* -------- 用于处理多数据库 --------*/
 
 // SelectDB 选择数据库
@@ -76,6 +369,56 @@ func (c *Connection) GetDBIndex() int {
 	return c.selectedDB
 }
 
+/* -------- 用于处理事务 --------*/
+
+// InMultiState 是否处于MULTI状态
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// SetMultiState 进入或者退出MULTI状态，退出时清空命令队列、WATCH的key和入队错误
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+}
+
+// GetQueuedCmdLine 返回已经入队的命令
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd 命令入队
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// ClearQueuedCmds 清空命令队列
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+}
+
+// GetWatching 返回WATCH的key及其版本号
+func (c *Connection) GetWatching() map[string]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[string]uint32)
+	}
+	return c.watching
+}
+
+// AddTxError 记录入队时发生的错误
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors 返回入队时发生的错误
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
 // TEST：测试用
 // FakeConn implements redis.Connection for test
 type FakeConn struct {
@@ -89,6 +432,17 @@ func (c *FakeConn) Write(b []byte) error {
 	return nil
 }
 
+// WriteReply writes reply to buffer
+func (c *FakeConn) WriteReply(reply redis.Reply) error {
+	_, err := protocol.Write(&c.buf, reply, c.GetProtocol())
+	return err
+}
+
+// Flush does nothing
+func (c *FakeConn) Flush() error {
+	return nil
+}
+
 // Clean resets the buffer
 func (c *FakeConn) Clean() {
 	c.buf.Reset()
@@ -0,0 +1,56 @@
+package connection
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	连接统计和所有活跃连接的注册表
+	由服务端在建立、关闭和拒绝连接时更新，INFO、CLIENT LIST、CLIENT KILL 等命令读取
+*/
+
+var (
+	nextID  uint64   // 上一个分配的连接id
+	clients sync.Map // id --> *Connection
+
+	connectedClients    int64 // 当前连接数
+	totalConnections    int64 // 累计接受的连接数
+	rejectedConnections int64 // 因为超过 maxclients 被拒绝的连接数
+)
+
+// ConnectedClients 当前的连接数
+func ConnectedClients() int64 {
+	return atomic.LoadInt64(&connectedClients)
+}
+
+// TotalConnections 累计接受的连接数
+func TotalConnections() int64 {
+	return atomic.LoadInt64(&totalConnections)
+}
+
+// RejectedConnections 因为超过 maxclients 被拒绝的连接数
+func RejectedConnections() int64 {
+	return atomic.LoadInt64(&rejectedConnections)
+}
+
+// AddRejected 记录一次被拒绝的连接
+func AddRejected() {
+	atomic.AddInt64(&rejectedConnections, 1)
+}
+
+// ForEachClient 遍历所有活跃的连接，fn返回false时停止
+func ForEachClient(fn func(c *Connection) bool) {
+	clients.Range(func(key, value interface{}) bool {
+		return fn(value.(*Connection))
+	})
+}
+
+// Lookup 返回id对应的活跃连接
+func Lookup(id uint64) (*Connection, bool) {
+	value, ok := clients.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Connection), true
+}
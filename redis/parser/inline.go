@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"bytes"
+
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	内联命令（inline command）
+	不以类型前缀开头的一行数据，参数之间以空白分隔，例如通过 telnet 输入的 PING 或者 SET "a b" 'c'
+	1. 双引号中支持转义：\n \r \t \b \a \" \\ 以及十六进制 \xHH
+	2. 单引号中只支持 \' 转义
+	3. 右引号之后必须是空白或者行尾
+	4. 允许只以 \n 结尾，空行直接忽略
+*/
+
+// maxInlineSize 内联命令的最大长度
+const maxInlineSize = 64 * 1024
+
+var (
+	errUnbalancedQuotes = &ProtocolError{msg: "unbalanced quotes in request"}
+	errInlineTooBig     = &ProtocolError{msg: "too big inline request"}
+)
+
+// isTypePrefix 是否为RESP的类型前缀
+func isTypePrefix(b byte) bool {
+	switch b {
+	case '+', '-', ':', '$', '*', '_', '#', ',', '(', '=', '!', '%', '~', '>':
+		return true
+	}
+	return false
+}
+
+// parseInline 解析一行内联命令，line 包含结尾的换行符，空行返回 nil
+func parseInline(line []byte) (*protocol.MultiBulkReply, error) {
+	if len(line) > maxInlineSize {
+		return nil, errInlineTooBig
+	}
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	args, err := splitArgs(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return protocol.MakeMultiBulkReply(args), nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func hexDigit(b byte) (byte, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return b - '0', true
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 10, true
+	case b >= 'A' && b <= 'F':
+		return b - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// hexEscape 解析 \xHH 形式的转义
+func hexEscape(s []byte) (byte, bool) {
+	if len(s) < 4 || s[0] != '\\' || s[1] != 'x' {
+		return 0, false
+	}
+	hi, ok1 := hexDigit(s[2])
+	lo, ok2 := hexDigit(s[3])
+	return hi<<4 | lo, ok1 && ok2
+}
+
+// splitArgs 按照redis-cli的规则拆分参数
+func splitArgs(line []byte) ([][]byte, error) {
+	args := make([][]byte, 0)
+	i, n := 0, len(line)
+	for {
+		for i < n && isSpace(line[i]) {
+			i++
+		}
+		if i == n {
+			return args, nil
+		}
+
+		var (
+			arg  = make([]byte, 0)
+			inDQ bool // 在双引号中
+			inSQ bool // 在单引号中
+			done bool
+		)
+		for !done {
+			if i == n {
+				if inDQ || inSQ {
+					return nil, errUnbalancedQuotes
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDQ:
+				if b, ok := hexEscape(line[i:]); ok {
+					arg = append(arg, b)
+					i += 3
+				} else if c == '\\' && i+1 < n {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// 右引号之后必须是空白或者行尾
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case inSQ:
+				if c == '\\' && i+1 < n && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			default:
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDQ = true
+				case c == '\'':
+					inSQ = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			i++
+		}
+		args = append(args, arg)
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		line string
+		args []string
+		err  error
+	}{
+		{"PING", []string{"PING"}, nil},
+		{"  set  a   b ", []string{"set", "a", "b"}, nil},
+		{"", []string{}, nil},
+		{"set \"a b\" 'c d'", []string{"set", "a b", "c d"}, nil},
+		{"set k \"\\n\\r\\t\\\"\\\\\"", []string{"set", "k", "\n\r\t\"\\"}, nil},
+		{"set k \"\\x41\\x4a\\xzz\"", []string{"set", "k", "AJxzz"}, nil},
+		{"set k 'it\\'s' \"\"", []string{"set", "k", "it's", ""}, nil},
+		{"set k 'a\\nb'", []string{"set", "k", "a\\nb"}, nil},
+		{"set k \"abc", nil, errUnbalancedQuotes},
+		{"set k 'abc", nil, errUnbalancedQuotes},
+		{"set k \"abc\"d", nil, errUnbalancedQuotes},
+	}
+	for _, c := range cases {
+		args, err := splitArgs([]byte(c.line))
+		if err != c.err {
+			t.Errorf("%q: expect err %v, actual %v", c.line, c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(args) != len(c.args) {
+			t.Errorf("%q: expect %q, actual %q", c.line, c.args, args)
+			continue
+		}
+		for i := range args {
+			if string(args[i]) != c.args[i] {
+				t.Errorf("%q: expect %q, actual %q", c.line, c.args, args)
+				break
+			}
+		}
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	input := "PING\r\n\r\nset a 'b c'\n*2\r\n$3\r\nget\r\n$1\r\na\r\nget \"a\r\n" +
+		"set k " + strings.Repeat("x", maxInlineSize) + "\r\necho ok\n"
+	expected := []interface{}{
+		utils.ToCmdLine("PING"),
+		utils.ToCmdLine("set", "a", "b c"),
+		utils.ToCmdLine("get", "a"),
+		errUnbalancedQuotes,
+		errInlineTooBig,
+		utils.ToCmdLine("echo", "ok"),
+	}
+
+	ch := ParseStream(bytes.NewReader([]byte(input)))
+	for i, exp := range expected {
+		payload := <-ch
+		if err, ok := exp.(error); ok {
+			if payload.Err != err {
+				t.Errorf("payload %d: expect err %v, actual %v", i, err, payload.Err)
+			}
+			continue
+		}
+		if payload.Err != nil {
+			t.Errorf("payload %d: unexpected err %v", i, payload.Err)
+			continue
+		}
+		actual := payload.Data.(*protocol.MultiBulkReply).ToBytes()
+		if !bytes.Equal(actual, protocol.MakeMultiBulkReply(exp.([][]byte)).ToBytes()) {
+			t.Errorf("payload %d: expect %q, actual %q", i, exp, actual)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+/*
+	改为 Reader 之前基于channel的解析器，只保留多行字符串命令的解析，用于对比性能
+	解析协程、channel传递以及每条命令 *Payload 的分配都与原来的实现一致
+*/
+
+func legacyParseStream(reader io.Reader) <-chan *Payload {
+	ch := make(chan *Payload)
+	go legacyParse0(reader, ch)
+	return ch
+}
+
+func legacyParse0(rawReader io.Reader, ch chan<- *Payload) {
+	reader := bufio.NewReader(rawReader)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			ch <- &Payload{Err: err}
+			close(ch)
+			return
+		}
+		length := len(line)
+		if length <= 2 || line[length-2] != '\r' || line[0] != '*' {
+			ch <- &Payload{Err: errors.New("Protocol error: " + string(line))}
+			close(ch)
+			return
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r', '\n'})
+		if err = legacyParseArray(line, reader, ch); err != nil {
+			ch <- &Payload{Err: err}
+			close(ch)
+			return
+		}
+	}
+}
+
+func legacyParseArray(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
+	nStrs, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if err != nil || nStrs <= 0 {
+		return errors.New("Protocol error: " + string(header))
+	}
+	bodys := make([][]byte, 0, nStrs)
+	for i := int64(0); i < nStrs; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		length := len(line)
+		if length < 4 || line[length-2] != '\r' || line[0] != '$' {
+			return errors.New("Protocol error: " + string(line))
+		}
+		strLen, err := strconv.ParseInt(string(line[1:length-2]), 10, 64)
+		if err != nil || strLen < 0 {
+			return errors.New("Protocol error: " + string(line))
+		}
+		body := make([]byte, strLen+2)
+		if _, err = io.ReadFull(reader, body); err != nil {
+			return err
+		}
+		bodys = append(bodys, body[:len(body)-2])
+	}
+	ch <- &Payload{Data: protocol.MakeMultiBulkReply(bodys)}
+	return nil
+}
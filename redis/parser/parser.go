@@ -1,16 +1,15 @@
 package parser
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
-	"fmt"
-	"github.com/HildaM/GoKV/interface/redis"
-	"github.com/HildaM/GoKV/lib/logger"
-	"github.com/HildaM/GoKV/redis/protocol"
 	"io"
+	"math/big"
 	"runtime/debug"
 	"strconv"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/logger"
+	"github.com/HildaM/GoKV/redis/protocol"
 )
 
 // Payload 存储redis.Reply或者error
@@ -20,6 +19,7 @@ type Payload struct {
 }
 
 // ParseStream 从io中读取数据，并使用channel放回payload
+// 兼容旧的推送式接口，新代码应直接使用 Reader
 func ParseStream(reader io.Reader) <-chan *Payload {
 	ch := make(chan *Payload)
 	go parse0(reader, ch)
@@ -33,152 +33,182 @@ func parse0(rawReader io.Reader, ch chan<- *Payload) {
 		}
 	}()
 
-	reader := bufio.NewReader(rawReader)
+	reader := NewReader(rawReader)
+	defer reader.Close()
 	for {
-		// 获取命令长度数据
-		line, err := reader.ReadBytes('\n')
+		reply, err := reader.ReadReply()
 		if err != nil {
 			ch <- &Payload{Err: err}
+			// 协议错误之后可以继续读取，io错误则结束
+			if IsProtocolError(err) {
+				continue
+			}
 			close(ch)
 			return
 		}
-		// len <= 2是不合法的，至少有3个以上的字符，毕竟CRLF就已经len=2了
-		length := len(line)
-		if length <= 2 || line[length-2] != '\r' {
-			protocolError(ch, line)
-			continue
+		if reply == nil {
+			continue // 空行
 		}
+		ch <- &Payload{Data: reply}
+	}
+}
 
-		line = bytes.TrimSuffix(line, []byte{'\r', '\n'})
+// ProtocolError 数据格式错误，与io错误不同，出现后连接仍然可以继续使用
+type ProtocolError struct {
+	msg string
+}
 
-		// 根据命令的不同前缀处理
-		switch line[0] {
-		case '+':
-			ch <- &Payload{
-				Data: protocol.MakeStatusReply(string(line[1:])),
-			}
-		case '-':
-			ch <- &Payload{
-				Data: protocol.MakeErrReply(string(line[1:])),
-			}
-		case ':':
-			value, err := strconv.ParseInt(string(line[1:]), 10, 64)
-			if err != nil {
-				protocolError(ch, line)
-				continue
-			}
-			ch <- &Payload{
-				Data: protocol.MakeIntReply(value),
-			}
-		case '$':
-			err = parseBulkString(line, reader, ch)
-			if err != nil {
-				ch <- &Payload{Err: err}
-				close(ch)
-				return
-			}
-		case '*':
-			err = parseArray(line, reader, ch)
-			if err != nil {
-				ch <- &Payload{Err: err}
-				close(ch)
-				return
-			}
-		default:
-			// 非标识字符串
-			args := bytes.Split(line, []byte{' '})
-			ch <- &Payload{
-				Data: protocol.MakeMultiBulkReply(args),
-			}
-		}
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
 
-	}
+// makeProtocolError 格式错误的行
+func makeProtocolError(line []byte) *ProtocolError {
+	return &ProtocolError{msg: strconv.Quote(string(line))}
 }
 
-// parseArray 处理多条命令
-func parseArray(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
-	// 1. 获取命令长度
-	nStrs, err := strconv.ParseInt(string(header[1:]), 10, 64)
-	if err != nil || nStrs < 0 {
-		protocolError(ch, header)
-		return err
-	} else if nStrs == 0 {
-		ch <- &Payload{
-			Data: protocol.MakeEmptyMultiBulkReply(),
-		}
-		return nil
-	}
+// IsProtocolError 判断是否为协议错误
+func IsProtocolError(err error) bool {
+	var perr *ProtocolError
+	return errors.As(err, &perr)
+}
 
-	// 2. 获取接下来的命令
-	bodys := make([][]byte, 0, nStrs)
-	for i := int64(0); i < nStrs; i++ {
-		// 1. 获取命令长度
-		var line []byte
-		line, err = reader.ReadBytes('\n')
+// parseValue 通用的解析方法，支持RESP2和RESP3的所有类型以及任意的嵌套，header为去掉CRLF的首行
+func (r *Reader) parseValue(header []byte) (redis.Reply, error) {
+	body := string(header[1:])
+	switch header[0] {
+	case '+':
+		return protocol.MakeStatusReply(body), nil
+	case '-':
+		return protocol.MakeErrReply(body), nil
+	case ':':
+		value, err := strconv.ParseInt(body, 10, 64)
 		if err != nil {
-			return nil
+			return nil, makeProtocolError(header)
 		}
-
-		length := len(line)
-		if length < 4 || line[length-2] != '\r' || line[0] != '$' {
-			// $(num)CRLF：最低长度为4
-			protocolError(ch, line)
-			return nil
+		return protocol.MakeIntReply(value), nil
+	case '_':
+		return protocol.MakeNullReply(), nil
+	case '#':
+		switch body {
+		case "t":
+			return protocol.MakeBooleanReply(true), nil
+		case "f":
+			return protocol.MakeBooleanReply(false), nil
 		}
-
-		// 2. 获取真实命令，并将其放入bodys中
-		strLen, err := strconv.ParseInt(string(line[1:length-2]), 10, 64)
-		if err != nil || strLen < -1 {
-			protocolError(ch, line)
-			return nil
-		} else if strLen == 0 {
-			bodys = append(bodys, []byte{})
-		} else {
-			body := make([]byte, strLen+2)
-			_, err = io.ReadFull(reader, body) // 读取 $num 后面的真实命令
-			if err != nil {
-				return err
-			}
-			bodys = append(bodys, body[:len(body)-2]) // 减去CRLF
+		return nil, makeProtocolError(header)
+	case ',':
+		value, err := strconv.ParseFloat(body, 64)
+		if err != nil {
+			return nil, makeProtocolError(header)
 		}
+		return protocol.MakeDoubleReply(value), nil
+	case '(':
+		value, ok := new(big.Int).SetString(body, 10)
+		if !ok {
+			return nil, makeProtocolError(header)
+		}
+		return protocol.MakeBigNumberReply(value), nil
 	}
 
-	// 返回最终结果
-	ch <- &Payload{
-		Data: protocol.MakeMultiBulkReply(bodys),
-	}
-	return nil
-}
-
-// parseBulkString 处理字符串数据
-func parseBulkString(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
-	// 1. 获取命令长度
-	cmdLen, err := strconv.ParseInt(string(header[1:]), 10, 64)
-	if err != nil || cmdLen < -1 { // 正常情况：$(num), header[1:]的长度至少为1
-		protocolError(ch, header)
-		return err
-	} else if cmdLen == -1 { // 空命令
-		ch <- &Payload{
-			Data: protocol.MakeNullBulkReply(),
-		}
-		return nil
-	}
-
-	// 2. 获取命令本体
-	body := make([]byte, cmdLen+2) // 加上CRLF
-	_, err = io.ReadFull(reader, body)
-	if err != nil {
-		return err
+	// 剩余的都是带有长度的类型
+	n, err := strconv.ParseInt(body, 10, 64)
+	if err != nil || n < -1 {
+		return nil, makeProtocolError(header)
 	}
-
-	ch <- &Payload{
-		Data: protocol.MakeBulkReply(body[:len(body)-2]), // 减去CRLF
+	switch header[0] {
+	case '$':
+		if n == -1 {
+			return protocol.MakeNullBulkReply(), nil
+		}
+		blob, err := r.readBlob(n)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.MakeBulkReply(blob), nil
+	case '!':
+		if n < 0 {
+			return nil, makeProtocolError(header)
+		}
+		blob, err := r.readBlob(n)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.MakeErrReply(string(blob)), nil
+	case '=':
+		// 格式为 fmt:text，fmt固定为3个字符
+		if n < 4 {
+			return nil, makeProtocolError(header)
+		}
+		blob, err := r.readBlob(n)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.MakeVerbatimReply(string(blob[:3]), blob[4:]), nil
+	case '*':
+		if n == -1 {
+			return protocol.MakeNullMultiBulkReply(), nil
+		} else if n == 0 {
+			return protocol.MakeEmptyMultiBulkReply(), nil
+		}
+		replies, err := r.readValues(n)
+		if err != nil {
+			return nil, err
+		}
+		if args, ok := toBulks(replies); ok {
+			return protocol.MakeMultiBulkReply(args), nil
+		}
+		return protocol.MakeMultiRawReply(replies), nil
+	case '%':
+		if n < 0 {
+			return nil, makeProtocolError(header)
+		}
+		replies, err := r.readValues(2 * n)
+		if err != nil {
+			return nil, err
+		}
+		reply := protocol.MakeMapReply(nil, nil)
+		for i := 0; i+1 < len(replies); i += 2 {
+			reply.Add(replies[i], replies[i+1])
+		}
+		return reply, nil
+	case '~':
+		if n < 0 {
+			return nil, makeProtocolError(header)
+		}
+		replies, err := r.readValues(n)
+		if err != nil {
+			return nil, err
+		}
+		if members, ok := toBulks(replies); ok {
+			return protocol.MakeSetReply(members), nil
+		}
+		return protocol.MakeMultiRawReply(replies), nil
+	case '>':
+		if n < 0 {
+			return nil, makeProtocolError(header)
+		}
+		replies, err := r.readValues(n)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.MakePushReply(replies), nil
 	}
-	return nil
+	return nil, makeProtocolError(header)
 }
 
-// protocolError 协议异常情况处理封装方法
-func protocolError(ch chan<- *Payload, line []byte) {
-	err := errors.New(fmt.Sprintf("Protocol error: %s", string(line[1:])))
-	ch <- &Payload{Err: err}
+// toBulks 如果所有元素都是字符串（包括空字符串），则转换为[][]byte
+func toBulks(replies []redis.Reply) ([][]byte, bool) {
+	args := make([][]byte, len(replies))
+	for i, reply := range replies {
+		switch r := reply.(type) {
+		case *protocol.BulkReply:
+			args[i] = r.Arg
+		case *protocol.NullBulkReply:
+			args[i] = nil
+		default:
+			return nil, false
+		}
+	}
+	return args, true
 }
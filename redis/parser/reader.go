@@ -0,0 +1,362 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
+/*
+	拉取式的协议解析器
+	1. 调用方在自己的协程中逐条读取命令，不再为每个连接启动解析协程，也不再通过channel传递 *Payload
+	2. 按行读取使用 bufio.Reader.ReadSlice，不会为每一行分配内存；数字直接从字节中解析
+	3. Next 返回的参数复用Reader内部的缓冲区，稳定状态下不分配内存，只在下一次读取前有效
+	4. ReadCommand 将参数复制到按照命令大小一次分配的内存中，参数可以被db持有（例如 SET 保存的value）
+	5. Reader 以及其中的缓冲区通过 sync.Pool 复用，连接关闭时调用 Close 归还
+	6. 客户端声明的长度不可信：参数的长度和单条命令的总长度受 SetLimits 限制，较大的参数随着数据的到达逐步扩容
+	   单条命令的长度包括协议头以及每个参数的额外开销，大量空参数同样会超出限制
+*/
+
+const (
+	// readBufferSize 读缓冲区大小，超过该长度的行需要拼接
+	readBufferSize = 16 * 1024
+	// maxPooledBufSize 超过该容量的参数缓冲区不放回池中，避免大命令长期占用内存
+	maxPooledBufSize = 1024 * 1024
+	// maxMultiBulkLen 命令的最大参数数量，与redis一致
+	maxMultiBulkLen = 1024 * 1024
+	// argOverhead 每个参数在 args 和 ends 中占用的内存，计入单条命令的长度
+	argOverhead = 32
+	// growChunkSize 较大的参数每次最多扩容的长度，避免按照声明的长度直接分配内存
+	growChunkSize = 64 * 1024
+)
+
+var (
+	errInvalidMultiBulkLength = &ProtocolError{msg: "invalid multibulk length"}
+	errInvalidBulkLength      = &ProtocolError{msg: "invalid bulk length"}
+	errQueryBufferLimit       = &ProtocolError{msg: "client query buffer limit exceeded"}
+)
+
+// Reader 从连接中逐条读取命令或回复
+type Reader struct {
+	br   *bufio.Reader
+	line []byte   // 超过读缓冲区长度的行的拼接缓存
+	args [][]byte // Next 返回的参数
+	ends []int    // 每个参数在buf中的结束位置
+	buf  []byte   // Next 返回的参数的数据
+
+	maxBulkLen  int64 // 单个参数的最大长度，0表示不限制
+	maxQueryLen int64 // 单条命令的最大长度，0表示不限制
+}
+
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return &Reader{
+			br: bufio.NewReaderSize(nil, readBufferSize),
+		}
+	},
+}
+
+// NewReader 从池中获取一个Reader
+func NewReader(rd io.Reader) *Reader {
+	r := readerPool.Get().(*Reader)
+	r.br.Reset(rd)
+	return r
+}
+
+// SetLimits 设置单个参数和单条命令的最大长度，0表示不限制
+func (r *Reader) SetLimits(maxBulkLen, maxQueryLen int64) {
+	r.maxBulkLen = maxBulkLen
+	r.maxQueryLen = maxQueryLen
+}
+
+// Close 将Reader归还到池中，之后不能再使用
+func (r *Reader) Close() {
+	r.br.Reset(nil)
+	r.maxBulkLen = 0
+	r.maxQueryLen = 0
+	if cap(r.buf) > maxPooledBufSize {
+		r.buf = nil
+	}
+	if cap(r.line) > maxPooledBufSize {
+		r.line = nil
+	}
+	for i := range r.args {
+		r.args[i] = nil
+	}
+	r.args = r.args[:0]
+	readerPool.Put(r)
+}
+
+// Buffered 已经读入但还没有解析的字节数，为0时说明已经处理完客户端发来的所有命令
+func (r *Reader) Buffered() int {
+	return r.br.Buffered()
+}
+
+// readLine 读取一行，返回的数据包含结尾的换行符，只在下一次读取之前有效
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if err == nil {
+		return line, nil
+	}
+	if err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	// 行的长度超过了读缓冲区，拼接到line中
+	r.line = append(r.line[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = r.br.ReadSlice('\n')
+		if len(r.line)+len(line) > maxInlineSize {
+			// 超长的行直接丢弃剩余部分
+			for err == bufio.ErrBufferFull {
+				_, err = r.br.ReadSlice('\n')
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !isTypePrefix(r.line[0]) {
+				return nil, errInlineTooBig
+			}
+			return nil, &ProtocolError{msg: "too big line"}
+		}
+		r.line = append(r.line, line...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.line, nil
+}
+
+// readHeader 读取以CRLF结尾的类型行，返回去掉CRLF的数据
+func (r *Reader) readHeader() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n := len(line)
+	if n <= 2 || line[n-2] != '\r' {
+		return nil, makeProtocolError(line)
+	}
+	return line[:n-2], nil
+}
+
+// parseInt 解析整数，不分配内存
+func parseInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 19 {
+		return 0, false
+	}
+	neg := false
+	if b[0] == '-' {
+		neg = true
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// Next 读取下一条命令，支持数组格式和内联命令
+// 返回的参数复用内部的缓冲区，只在下一次调用 Next 或 ReadCommand 之前有效
+func (r *Reader) Next() ([][]byte, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !isTypePrefix(line[0]) {
+			cmd, err := parseInline(line)
+			if err != nil {
+				return nil, err
+			}
+			if cmd == nil {
+				continue // 空行
+			}
+			return cmd.Args, nil
+		}
+
+		n := len(line)
+		if n <= 2 || line[n-2] != '\r' || line[0] != '*' {
+			return nil, makeProtocolError(line)
+		}
+		count, ok := parseInt(line[1 : n-2])
+		if !ok || count > maxMultiBulkLen {
+			return nil, errInvalidMultiBulkLength
+		}
+		if count <= 0 {
+			continue // 空命令直接忽略
+		}
+		if err := r.readArgs(count, int64(n)); err != nil {
+			return nil, err
+		}
+		return r.args, nil
+	}
+}
+
+// readArgs 读取count个字符串参数到复用的缓冲区中，used 为已经读取的数组头长度
+func (r *Reader) readArgs(count int64, used int64) error {
+	r.buf = r.buf[:0]
+	r.ends = r.ends[:0]
+	for i := int64(0); i < count; i++ {
+		header, err := r.readHeader()
+		if err != nil {
+			return err
+		}
+		if header[0] != '$' {
+			return makeProtocolError(header)
+		}
+		size, ok := parseInt(header[1:])
+		if !ok || size < 0 || (r.maxBulkLen > 0 && size > r.maxBulkLen) {
+			return errInvalidBulkLength
+		}
+		// 协议头、两个CRLF以及参数的额外开销都计入命令长度
+		used += int64(len(header)) + 4 + argOverhead + size
+		if r.maxQueryLen > 0 && used > r.maxQueryLen {
+			return errQueryBufferLimit
+		}
+
+		// 连同CRLF一起读入buf
+		start := len(r.buf)
+		end := start + int(size)
+		if err := r.readFull(end + 2); err != nil {
+			return err
+		}
+		if !bytes.Equal(r.buf[end:], []byte{'\r', '\n'}) {
+			return &ProtocolError{msg: "expected CRLF after bulk string"}
+		}
+		r.buf = r.buf[:end]
+		r.ends = append(r.ends, end)
+	}
+
+	// buf可能在读取过程中扩容，所有参数读取完成后再切分
+	r.args = r.args[:0]
+	start := 0
+	for _, end := range r.ends {
+		r.args = append(r.args, r.buf[start:end:end])
+		start = end
+	}
+	return nil
+}
+
+// readFull 将数据读入buf直到长度为n
+// 每次扩容不超过 growChunkSize，内存随着实际到达的数据增长，而不是按照客户端声明的长度一次分配
+func (r *Reader) readFull(n int) error {
+	for len(r.buf) < n {
+		want := n
+		if want-len(r.buf) > growChunkSize {
+			want = len(r.buf) + growChunkSize
+		}
+		if want > cap(r.buf) {
+			newCap := 2 * cap(r.buf)
+			if newCap < want {
+				newCap = want
+			}
+			if newCap > n {
+				newCap = n
+			}
+			grown := make([]byte, len(r.buf), newCap)
+			copy(grown, r.buf)
+			r.buf = grown
+		}
+		start := len(r.buf)
+		r.buf = r.buf[:want]
+		if _, err := io.ReadFull(r.br, r.buf[start:]); err != nil {
+			r.buf = r.buf[:start]
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCommand 读取下一条命令，返回的参数由调用方持有
+// 所有参数的数据一次分配，参数之间共享同一块内存
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	args, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+	data := make([]byte, size)
+	cmdLine := make([][]byte, len(args))
+	start := 0
+	for i, arg := range args {
+		end := start + copy(data[start:], arg)
+		cmdLine[i] = data[start:end:end]
+		start = end
+	}
+	return cmdLine, nil
+}
+
+// ReadReply 读取任意类型的回复，用于客户端和aof加载，内联命令解析为 MultiBulkReply
+// 空行返回 nil
+func (r *Reader) ReadReply() (redis.Reply, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !isTypePrefix(line[0]) {
+		cmd, err := parseInline(line)
+		if err != nil || cmd == nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
+	n := len(line)
+	if n <= 2 || line[n-2] != '\r' {
+		return nil, makeProtocolError(line)
+	}
+	return r.parseValue(line[:n-2])
+}
+
+// readBlob 读取长度为n的数据以及结尾的CRLF，返回的数据由调用方持有
+func (r *Reader) readBlob(n int64) ([]byte, error) {
+	if r.maxBulkLen > 0 && n > r.maxBulkLen {
+		return nil, errInvalidBulkLength
+	}
+	body := make([]byte, n+2)
+	if _, err := io.ReadFull(r.br, body); err != nil {
+		return nil, err
+	}
+	if body[n] != '\r' || body[n+1] != '\n' {
+		return nil, &ProtocolError{msg: "expected CRLF after bulk string"}
+	}
+	return body[:n:n], nil
+}
+
+// readValues 依次读取n个值
+func (r *Reader) readValues(n int64) ([]redis.Reply, error) {
+	// n由对方声明，预分配的容量不能直接使用
+	capacity := n
+	if capacity > 1024 {
+		capacity = 1024
+	}
+	replies := make([]redis.Reply, 0, capacity)
+	for i := int64(0); i < n; i++ {
+		header, err := r.readHeader()
+		if err != nil {
+			return nil, err
+		}
+		reply, err := r.parseValue(header)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
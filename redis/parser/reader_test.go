@@ -0,0 +1,274 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/HildaM/GoKV/interface/redis"
+	"github.com/HildaM/GoKV/lib/utils"
+	"github.com/HildaM/GoKV/redis/protocol"
+)
+
+func TestReadCommand(t *testing.T) {
+	big := strings.Repeat("v", 3*readBufferSize)
+	var input bytes.Buffer
+	commands := [][][]byte{
+		utils.ToCmdLine("set", "a", "1"),
+		utils.ToCmdLine("set", "b", ""),
+		utils.ToCmdLine("set", "c", big),
+		utils.ToCmdLine("set", "d", "\r\n\x00binary"),
+	}
+	for _, cmd := range commands {
+		input.Write(protocol.MakeMultiBulkReply(cmd).ToBytes())
+	}
+	// 数组中的非字符串元素是协议错误，之后的 $1 同样是错误，a 被当作内联命令
+	input.WriteString("*0\r\nping\r\n*2\r\n:1\r\n$1\r\na\r\n*1\r\n$4\r\nPING\r\n")
+
+	r := NewReader(&input)
+	defer r.Close()
+	var got [][][]byte
+	for {
+		cmdLine, err := r.ReadCommand()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !IsProtocolError(err) {
+				t.Fatal(err)
+			}
+			got = append(got, nil)
+			continue
+		}
+		got = append(got, cmdLine)
+	}
+
+	expected := append(commands, utils.ToCmdLine("ping"), nil, nil, utils.ToCmdLine("a"), utils.ToCmdLine("PING"))
+	if len(got) != len(expected) {
+		t.Fatalf("expect %d commands, actual %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if expected[i] == nil {
+			if got[i] != nil {
+				t.Errorf("command %d: expect protocol error", i)
+			}
+			continue
+		}
+		exp := protocol.MakeMultiBulkReply(expected[i]).ToBytes()
+		act := protocol.MakeMultiBulkReply(got[i]).ToBytes()
+		if !bytes.Equal(exp, act) {
+			t.Errorf("command %d: expect %q, actual %q", i, exp, act)
+		}
+	}
+}
+
+func TestReadCommandOwnership(t *testing.T) {
+	input := "*2\r\n$3\r\nget\r\n$1\r\na\r\n*2\r\n$3\r\nget\r\n$1\r\nb\r\n"
+	r := NewReader(strings.NewReader(input))
+	defer r.Close()
+	first, _ := r.ReadCommand()
+	second, _ := r.ReadCommand()
+	if string(first[1]) != "a" || string(second[1]) != "b" {
+		t.Errorf("commands overwritten: %q %q", first, second)
+	}
+	// 参数的容量不能越界到下一个参数
+	if cap(first[0]) != len(first[0]) {
+		t.Error("argument capacity should equal its length")
+	}
+}
+
+func TestReadCommandLimits(t *testing.T) {
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"*2147483648\r\n", errInvalidMultiBulkLength},
+		{"*1048577\r\n", errInvalidMultiBulkLength},
+		{"*x\r\n", errInvalidMultiBulkLength},
+		{"*1\r\n$17\r\n", errInvalidBulkLength},
+		{"*1\r\n$-1\r\n", errInvalidBulkLength},
+		{"*3\r\n$3\r\nset\r\n$8\r\nkkkkkkkk\r\n$16\r\n", errQueryBufferLimit},
+		{"*1\r\n$16\r\n0123456789abcdef\r\n", nil},
+	}
+	for _, c := range cases {
+		r := NewReader(strings.NewReader(c.input))
+		r.SetLimits(16, 128)
+		_, err := r.ReadCommand()
+		if err != c.err {
+			t.Errorf("%q: expect %v, actual %v", c.input, c.err, err)
+		}
+		r.Close()
+	}
+
+	// 声明的长度很大但是数据没有到达时，不会按照声明的长度分配内存
+	r := NewReader(strings.NewReader("*1\r\n$1000000000\r\nabc"))
+	defer r.Close()
+	if _, err := r.ReadCommand(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expect unexpected EOF, actual %v", err)
+	}
+	if cap(r.buf) > maxPooledBufSize {
+		t.Errorf("buffer grows to %d before data arrives", cap(r.buf))
+	}
+}
+
+// zeroArgFlood 在数组头之后无限发送空参数
+type zeroArgFlood struct {
+	header []byte
+	sent   int64
+}
+
+func (f *zeroArgFlood) Read(p []byte) (int, error) {
+	n := 0
+	for len(f.header) > 0 && n < len(p) {
+		c := copy(p[n:], f.header)
+		f.header = f.header[c:]
+		n += c
+	}
+	const arg = "$0\r\n\r\n"
+	for n < len(p) {
+		c := copy(p[n:], arg[f.sent%int64(len(arg)):])
+		f.sent += int64(c)
+		n += c
+	}
+	return n, nil
+}
+
+func TestReadCommandZeroArgFlood(t *testing.T) {
+	const limit = 1024 * 1024
+	flood := &zeroArgFlood{header: []byte("*1048576\r\n")}
+	r := NewReader(flood)
+	defer r.Close()
+	r.SetLimits(0, limit)
+	if _, err := r.ReadCommand(); err != errQueryBufferLimit {
+		t.Fatalf("expect query buffer limit, actual %v", err)
+	}
+	// 每个空参数至少计入 len("$0\r\n")+2 字节以及切片的开销
+	if maxArgs := limit / (6 + argOverhead); len(r.ends) > maxArgs {
+		t.Errorf("read %d arguments, expect at most %d", len(r.ends), maxArgs)
+	}
+	if flood.sent > limit {
+		t.Errorf("consumed %d bytes after exceeding the limit", flood.sent)
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	replies := []redis.Reply{
+		protocol.MakeStatusReply("OK"),
+		protocol.MakeErrReply("ERR unknown"),
+		protocol.MakeIntReply(-42),
+		protocol.MakeBulkReply([]byte("a\r\nb")),
+		protocol.MakeNullBulkReply(),
+		protocol.MakeEmptyMultiBulkReply(),
+		protocol.MakeMultiBulkReply(utils.ToCmdLine("a", "b")),
+		protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(1),
+			protocol.MakeMultiBulkReply(utils.ToCmdLine("x")),
+		}),
+		protocol.MakeBulkMapReply(utils.ToCmdLine("k", "v")),
+		protocol.MakeDoubleReply(1.5),
+		protocol.MakeBooleanReply(true),
+		protocol.MakeNullReply(),
+		protocol.MakeSetReply(utils.ToCmdLine("m")),
+		protocol.MakePushReply([]redis.Reply{protocol.MakeBulkReply([]byte("message"))}),
+		protocol.MakeVerbatimReply("txt", []byte("hello")),
+	}
+	var input bytes.Buffer
+	for _, reply := range replies {
+		input.Write(protocol.Marshal(reply, protocol.RESP3))
+	}
+
+	i := 0
+	for payload := range ParseStream(&input) {
+		if payload.Err != nil {
+			if payload.Err != io.EOF {
+				t.Error(payload.Err)
+			}
+			break
+		}
+		exp := protocol.Marshal(replies[i], protocol.RESP3)
+		act := protocol.Marshal(payload.Data, protocol.RESP3)
+		if !bytes.Equal(exp, act) {
+			t.Errorf("reply %d: expect %q, actual %q", i, exp, act)
+		}
+		i++
+	}
+	if i != len(replies) {
+		t.Errorf("expect %d replies, actual %d", len(replies), i)
+	}
+}
+
+// makePipeline 生成n条 SET 命令组成的流水线
+func makePipeline(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		key := "key:" + strconv.Itoa(i)
+		buf.Write(protocol.MakeMultiBulkReply(utils.ToCmdLine("SET", key, "value-"+key)).ToBytes())
+	}
+	return buf.Bytes()
+}
+
+const pipelineSize = 1000
+
+// BenchmarkLegacyParseStream 原来基于channel的解析器，作为对比的基准
+func BenchmarkLegacyParseStream(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for payload := range legacyParseStream(bytes.NewReader(data)) {
+			if payload.Err != nil {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkParseStream 基于 Reader 的兼容接口，仍然有channel传递的开销
+func BenchmarkParseStream(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for payload := range ParseStream(bytes.NewReader(data)) {
+			if payload.Err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkReaderReadCommand(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewReader(bytes.NewReader(data))
+		for {
+			if _, err := r.ReadCommand(); err != nil {
+				break
+			}
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkReaderNext(b *testing.B) {
+	data := makePipeline(pipelineSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewReader(bytes.NewReader(data))
+		for {
+			if _, err := r.Next(); err != nil {
+				break
+			}
+		}
+		r.Close()
+	}
+}
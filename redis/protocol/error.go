@@ -77,3 +77,16 @@ func (r *ProtocolErrReply) ToBytes() []byte {
 func (r *ProtocolErrReply) Error() string {
 	return "ERR Protocol error: '" + r.Msg
 }
+
+// OOMErr 内存超过maxmemory并且无法淘汰key时拒绝写命令
+type OOMErrReply struct{}
+
+var oomErrBytes = []byte("-OOM command not allowed when used memory > 'maxmemory'.\r\n")
+
+func (r *OOMErrReply) ToBytes() []byte {
+	return oomErrBytes
+}
+
+func (r *OOMErrReply) Error() string {
+	return "OOM command not allowed when used memory > 'maxmemory'."
+}
@@ -0,0 +1,365 @@
+package protocol
+
+import (
+	"bytes"
+	"math/big"
+	"strconv"
+
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
+/*
+	RESP3 协议
+	连接通过 HELLO 3 切换到RESP3，默认使用RESP2
+	1. ToBytes 始终返回RESP2编码，aof、集群转发、事务等内部流程不受协议版本影响
+	2. 在RESP3下编码不同的回复实现 RESP3Reply，写回客户端时通过 Marshal 按照连接的协议版本编码
+	3. map、set、double、boolean、big number、verbatim string、push 在RESP2下降级为数组、字符串或整数
+*/
+
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// RESP3Reply 在RESP3协议下有不同编码的回复
+type RESP3Reply interface {
+	redis.Reply
+	ToRESP3() []byte
+}
+
+// Marshal 按照协议版本编码回复
+func Marshal(reply redis.Reply, version int) []byte {
+	if version == RESP3 {
+		if r, ok := reply.(RESP3Reply); ok {
+			return r.ToRESP3()
+		}
+	}
+	return reply.ToBytes()
+}
+
+// writeAggregate 写入聚合类型的头部和所有元素
+func writeAggregate(buf *bytes.Buffer, prefix byte, n int, replies []redis.Reply, version int) {
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(n))
+	buf.WriteString(CRLF)
+	for _, reply := range replies {
+		buf.Write(Marshal(reply, version))
+	}
+}
+
+var nullBytes = []byte("_\r\n")
+
+/* ---- Null Reply ---- */
+
+// NullReply RESP3中的null，RESP2下为 $-1
+type NullReply struct{}
+
+// MakeNullReply creates NullReply
+func MakeNullReply() *NullReply {
+	return &NullReply{}
+}
+
+// ToBytes marshal redis.Reply
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *NullReply) ToRESP3() []byte {
+	return nullBytes
+}
+
+// ToRESP3 RESP3中所有的空值都是null
+func (r *NullBulkReply) ToRESP3() []byte {
+	return nullBytes
+}
+
+// ToRESP3 RESP3中所有的空值都是null
+func (r *NullMultiBulkReply) ToRESP3() []byte {
+	return nullBytes
+}
+
+// ToRESP3 RESP3中所有的空值都是null
+func (r *BulkReply) ToRESP3() []byte {
+	if r.Arg == nil {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
+
+// ToRESP3 数组中的空字符串编码为null
+func (r *MultiBulkReply) ToRESP3() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Args)) + CRLF)
+	for _, arg := range r.Args {
+		if arg == nil {
+			buf.Write(nullBytes)
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ToRESP3 数组中的元素按照RESP3编码
+func (r *MultiRawReply) ToRESP3() []byte {
+	var buf bytes.Buffer
+	writeAggregate(&buf, '*', len(r.Replies), r.Replies, RESP3)
+	return buf.Bytes()
+}
+
+/* ---- Map Reply ---- */
+
+// MapReply 键值对，RESP2下展开为 [k1, v1, k2, v2 ...]
+type MapReply struct {
+	Keys   []redis.Reply
+	Values []redis.Reply
+}
+
+// MakeMapReply creates MapReply
+func MakeMapReply(keys []redis.Reply, values []redis.Reply) *MapReply {
+	return &MapReply{
+		Keys:   keys,
+		Values: values,
+	}
+}
+
+// MakeBulkMapReply 使用字符串作为键值创建MapReply
+func MakeBulkMapReply(pairs [][]byte) *MapReply {
+	r := &MapReply{
+		Keys:   make([]redis.Reply, 0, len(pairs)/2),
+		Values: make([]redis.Reply, 0, len(pairs)/2),
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		r.Keys = append(r.Keys, MakeBulkReply(pairs[i]))
+		r.Values = append(r.Values, MakeBulkReply(pairs[i+1]))
+	}
+	return r
+}
+
+// Add 追加一个键值对
+func (r *MapReply) Add(key redis.Reply, value redis.Reply) {
+	r.Keys = append(r.Keys, key)
+	r.Values = append(r.Values, value)
+}
+
+func (r *MapReply) marshal(prefix byte, n int, version int) []byte {
+	replies := make([]redis.Reply, 0, 2*len(r.Keys))
+	for i := range r.Keys {
+		replies = append(replies, r.Keys[i], r.Values[i])
+	}
+	var buf bytes.Buffer
+	writeAggregate(&buf, prefix, n, replies, version)
+	return buf.Bytes()
+}
+
+// ToBytes marshal redis.Reply
+func (r *MapReply) ToBytes() []byte {
+	return r.marshal('*', 2*len(r.Keys), RESP2)
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *MapReply) ToRESP3() []byte {
+	return r.marshal('%', len(r.Keys), RESP3)
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply 无序且不重复的集合，RESP2下为数组
+type SetReply struct {
+	Members [][]byte
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(members [][]byte) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *SetReply) ToBytes() []byte {
+	return MakeMultiBulkReply(r.Members).ToBytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *SetReply) ToRESP3() []byte {
+	raw := MakeMultiBulkReply(r.Members).ToRESP3()
+	raw[0] = '~'
+	return raw
+}
+
+/* ---- Double Reply ---- */
+
+// DoubleReply 浮点数，RESP2下为字符串
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+// FormatFloat 按照redis的格式输出浮点数
+func FormatFloat(value float64) string {
+	return string(appendFloat(nil, value))
+}
+
+// ToBytes marshal redis.Reply
+func (r *DoubleReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(FormatFloat(r.Value))).ToBytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *DoubleReply) ToRESP3() []byte {
+	return []byte("," + FormatFloat(r.Value) + CRLF)
+}
+
+/* ---- Boolean Reply ---- */
+
+// BooleanReply 布尔值，RESP2下为整数1或0
+type BooleanReply struct {
+	Value bool
+}
+
+// MakeBooleanReply creates BooleanReply
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return []byte(":1\r\n")
+	}
+	return []byte(":0\r\n")
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *BooleanReply) ToRESP3() []byte {
+	if r.Value {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumberReply 超出int64范围的整数，RESP2下为字符串
+type BigNumberReply struct {
+	Value *big.Int
+}
+
+// MakeBigNumberReply creates BigNumberReply
+func MakeBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BigNumberReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.Value.String())).ToBytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *BigNumberReply) ToRESP3() []byte {
+	return []byte("(" + r.Value.String() + CRLF)
+}
+
+/* ---- Verbatim String Reply ---- */
+
+// VerbatimReply 带有格式的字符串（txt、mkd），RESP2下为普通字符串
+type VerbatimReply struct {
+	Format string // 3个字符
+	Text   []byte
+}
+
+// MakeVerbatimReply creates VerbatimReply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{
+		Format: format,
+		Text:   text,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *VerbatimReply) ToBytes() []byte {
+	return MakeBulkReply(r.Text).ToBytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *VerbatimReply) ToRESP3() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Text)+4) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply 服务端主动推送的消息（发布订阅、客户端缓存失效），RESP2下为数组
+type PushReply struct {
+	Replies []redis.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(replies []redis.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *PushReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	writeAggregate(&buf, '*', len(r.Replies), r.Replies, RESP2)
+	return buf.Bytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *PushReply) ToRESP3() []byte {
+	var buf bytes.Buffer
+	writeAggregate(&buf, '>', len(r.Replies), r.Replies, RESP3)
+	return buf.Bytes()
+}
+
+/* ---- Scored Members Reply ---- */
+
+// ScoredMembersReply 带有分数的成员列表，例如 ZRANGE WITHSCORES
+// RESP2下展开为 [member1, score1, member2, score2 ...]，RESP3下为 [[member1, score1], [member2, score2] ...]
+type ScoredMembersReply struct {
+	Members [][]byte
+	Scores  []float64
+}
+
+// MakeScoredMembersReply creates ScoredMembersReply
+func MakeScoredMembersReply(members [][]byte, scores []float64) *ScoredMembersReply {
+	return &ScoredMembersReply{
+		Members: members,
+		Scores:  scores,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *ScoredMembersReply) ToBytes() []byte {
+	args := make([][]byte, 0, 2*len(r.Members))
+	for i, member := range r.Members {
+		args = append(args, member, []byte(FormatFloat(r.Scores[i])))
+	}
+	return MakeMultiBulkReply(args).ToBytes()
+}
+
+// ToRESP3 marshal redis.Reply in RESP3
+func (r *ScoredMembersReply) ToRESP3() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Members)) + CRLF)
+	for i, member := range r.Members {
+		buf.WriteString("*2" + CRLF)
+		buf.Write(MakeBulkReply(member).ToBytes())
+		buf.Write(MakeDoubleReply(r.Scores[i]).ToRESP3())
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,217 @@
+package protocol
+
+import (
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
+/*
+	流式编码
+	ToBytes 需要先生成完整的[]byte，较大的数组回复（LRANGE、ZRANGE等）会被复制两次
+	聚合类型的回复实现了 io.WriterTo，直接将各个元素写入 io.Writer（通常是连接的写缓冲区），不生成中间结果
+	Write 按照协议版本写入任意回复，没有实现流式编码的回复退化为 Marshal
+*/
+
+// replyWriter 记录写入的字节数和第一个错误，出错后不再写入
+type replyWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+	num [32]byte // 编码数字的临时空间
+}
+
+func (rw *replyWriter) write(b []byte) {
+	if rw.err != nil {
+		return
+	}
+	n, err := rw.w.Write(b)
+	rw.n += int64(n)
+	rw.err = err
+}
+
+func (rw *replyWriter) writeString(s string) {
+	if rw.err != nil {
+		return
+	}
+	n, err := io.WriteString(rw.w, s)
+	rw.n += int64(n)
+	rw.err = err
+}
+
+// writeHeader 写入类型前缀和长度，例如 *3\r\n
+func (rw *replyWriter) writeHeader(prefix byte, n int) {
+	buf := append(rw.num[:0], prefix)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	buf = append(buf, '\r', '\n')
+	rw.write(buf)
+}
+
+func (rw *replyWriter) writeBulk(arg []byte, version int) {
+	if arg == nil {
+		rw.writeNull(version)
+		return
+	}
+	rw.writeHeader('$', len(arg))
+	rw.write(arg)
+	rw.writeString(CRLF)
+}
+
+func (rw *replyWriter) writeNull(version int) {
+	if version == RESP3 {
+		rw.write(nullBytes)
+	} else {
+		rw.write(nullBulkBytes)
+	}
+}
+
+// writeDouble RESP3下为double类型，RESP2下为字符串
+func (rw *replyWriter) writeDouble(value float64, version int) {
+	if version == RESP3 {
+		buf := append(rw.num[:0], ',')
+		buf = appendFloat(buf, value)
+		buf = append(buf, '\r', '\n')
+		rw.write(buf)
+		return
+	}
+	var digits [32]byte
+	rw.writeBulk(appendFloat(digits[:0], value), version)
+}
+
+// writeReply 写入任意回复
+func (rw *replyWriter) writeReply(reply redis.Reply, version int) {
+	if s, ok := reply.(streamReply); ok {
+		s.writeTo(rw, version)
+		return
+	}
+	rw.write(Marshal(reply, version))
+}
+
+// streamReply 支持流式编码的回复
+type streamReply interface {
+	writeTo(rw *replyWriter, version int)
+}
+
+// Write 按照协议版本将回复写入w
+func Write(w io.Writer, reply redis.Reply, version int) (int64, error) {
+	rw := &replyWriter{w: w}
+	rw.writeReply(reply, version)
+	return rw.n, rw.err
+}
+
+// appendFloat 与 FormatFloat 的格式相同，不分配内存
+func appendFloat(dst []byte, value float64) []byte {
+	switch {
+	case math.IsInf(value, 1):
+		return append(dst, "inf"...)
+	case math.IsInf(value, -1):
+		return append(dst, "-inf"...)
+	case math.IsNaN(value):
+		return append(dst, "nan"...)
+	}
+	return strconv.AppendFloat(dst, value, 'f', -1, 64)
+}
+
+func (r *BulkReply) writeTo(rw *replyWriter, version int) {
+	rw.writeBulk(r.Arg, version)
+}
+
+// WriteTo implements io.WriterTo
+func (r *BulkReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *MultiBulkReply) writeTo(rw *replyWriter, version int) {
+	rw.writeHeader('*', len(r.Args))
+	for _, arg := range r.Args {
+		rw.writeBulk(arg, version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *MultiBulkReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *MultiRawReply) writeTo(rw *replyWriter, version int) {
+	rw.writeHeader('*', len(r.Replies))
+	for _, reply := range r.Replies {
+		rw.writeReply(reply, version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *MultiRawReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *MapReply) writeTo(rw *replyWriter, version int) {
+	if version == RESP3 {
+		rw.writeHeader('%', len(r.Keys))
+	} else {
+		rw.writeHeader('*', 2*len(r.Keys))
+	}
+	for i := range r.Keys {
+		rw.writeReply(r.Keys[i], version)
+		rw.writeReply(r.Values[i], version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *MapReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *SetReply) writeTo(rw *replyWriter, version int) {
+	if version == RESP3 {
+		rw.writeHeader('~', len(r.Members))
+	} else {
+		rw.writeHeader('*', len(r.Members))
+	}
+	for _, member := range r.Members {
+		rw.writeBulk(member, version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *SetReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *PushReply) writeTo(rw *replyWriter, version int) {
+	if version == RESP3 {
+		rw.writeHeader('>', len(r.Replies))
+	} else {
+		rw.writeHeader('*', len(r.Replies))
+	}
+	for _, reply := range r.Replies {
+		rw.writeReply(reply, version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *PushReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
+
+func (r *ScoredMembersReply) writeTo(rw *replyWriter, version int) {
+	if version == RESP3 {
+		rw.writeHeader('*', len(r.Members))
+	} else {
+		rw.writeHeader('*', 2*len(r.Members))
+	}
+	for i, member := range r.Members {
+		if version == RESP3 {
+			rw.writeHeader('*', 2)
+		}
+		rw.writeBulk(member, version)
+		rw.writeDouble(r.Scores[i], version)
+	}
+}
+
+// WriteTo implements io.WriterTo
+func (r *ScoredMembersReply) WriteTo(w io.Writer) (int64, error) {
+	return Write(w, r, RESP2)
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/HildaM/GoKV/interface/redis"
+)
+
+func TestWrite(t *testing.T) {
+	replies := []redis.Reply{
+		MakeOkReply(),
+		MakeIntReply(1),
+		MakeErrReply("ERR x"),
+		MakeBulkReply([]byte("a")),
+		MakeBulkReply(nil),
+		MakeNullBulkReply(),
+		MakeMultiBulkReply([][]byte{[]byte("a"), nil, {}}),
+		MakeEmptyMultiBulkReply(),
+		MakeMultiRawReply([]redis.Reply{
+			MakeIntReply(2),
+			MakeMultiBulkReply([][]byte{[]byte("b")}),
+			MakeDoubleReply(0.5),
+		}),
+		MakeBulkMapReply([][]byte{[]byte("k"), []byte("v")}),
+		MakeSetReply([][]byte{[]byte("m"), nil}),
+		MakePushReply([]redis.Reply{MakeBulkReply([]byte("message")), MakeNullReply()}),
+		MakeScoredMembersReply([][]byte{[]byte("a"), []byte("b")}, []float64{1.5, math.Inf(-1)}),
+	}
+	for _, version := range []int{RESP2, RESP3} {
+		for _, reply := range replies {
+			var buf bytes.Buffer
+			n, err := Write(&buf, reply, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := Marshal(reply, version)
+			if !bytes.Equal(buf.Bytes(), expected) || n != int64(len(expected)) {
+				t.Errorf("RESP%d %T: expect %q, actual %q", version, reply, expected, buf.Bytes())
+			}
+		}
+	}
+}
+
+func makeLargeReply() *MultiBulkReply {
+	args := make([][]byte, 10000)
+	for i := range args {
+		args[i] = []byte("member-" + strconv.Itoa(i))
+	}
+	return MakeMultiBulkReply(args)
+}
+
+func BenchmarkToBytes(b *testing.B) {
+	reply := makeLargeReply()
+	w := bufio.NewWriter(io.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = w.Write(reply.ToBytes())
+	}
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	reply := makeLargeReply()
+	w := bufio.NewWriter(io.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = reply.WriteTo(w)
+	}
+}
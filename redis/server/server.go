@@ -14,6 +14,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -23,12 +24,14 @@ import (
 // 自定义异常情况
 var (
 	unknownErrReplyBytes = []byte("-ERR unknow\r\n")
+	maxClientsReplyBytes = []byte("-ERR max number of clients reached\r\n")
 )
 
 type Handler struct {
-	activeConn sync.Map // 每个连接的映射表关系
-	db         database.DB
-	closing    atomic.AtomicBool // 关闭连接标志，阻止新连接继续访问
+	db       database.DB
+	closing  atomic.AtomicBool // 关闭连接标志，阻止新连接继续访问
+	done     chan struct{}     // 关闭时停止空闲连接回收
+	stopOnce sync.Once
 }
 
 func MakeHandler() *Handler {
@@ -39,15 +42,74 @@ func MakeHandler() *Handler {
 	} else {
 		db = databaseImpl.NewStandaloneServer()
 	}
-	return &Handler{
-		db: db,
+	h := &Handler{
+		db:   db,
+		done: make(chan struct{}),
 	}
+	go h.reapIdleClients()
+	return h
+}
+
+// Reject 连接数达到 maxclients 时回复错误并关闭连接
+func (h *Handler) Reject(conn net.Conn) {
+	connection.AddRejected()
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write(maxClientsReplyBytes)
+	_ = conn.Close()
+	logger.Info("connection rejected, max number of clients reached: " + conn.RemoteAddr().String())
+}
+
+// reapIdleClients 每秒检查一次，关闭空闲时间超过 timeout 的连接
+// 订阅模式下的客户端只接收消息，不会被回收
+func (h *Handler) reapIdleClients() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		if config.Properties.Timeout <= 0 {
+			continue
+		}
+		timeout := time.Duration(config.Properties.Timeout) * time.Second
+		connection.ForEachClient(func(client *connection.Connection) bool {
+			if client.SubsCount()+client.PSubsCount() > 0 || client.IdleTime() < timeout {
+				return true
+			}
+			// 关闭底层连接后，Handle中的读取返回错误，由Handle完成清理
+			logger.Info("closing idle client: " + client.RemoteAddr().String())
+			_ = client.Close()
+			return true
+		})
+	}
+}
+
+const (
+	defaultProtoMaxBulkLen        = 512 * 1024 * 1024
+	defaultClientQueryBufferLimit = 1024 * 1024 * 1024
+)
+
+// protoMaxBulkLen 单个参数的最大长度
+func protoMaxBulkLen() int64 {
+	if config.Properties.ProtoMaxBulkLen > 0 {
+		return int64(config.Properties.ProtoMaxBulkLen)
+	}
+	return defaultProtoMaxBulkLen
+}
+
+// clientQueryBufferLimit 单条命令的最大长度
+func clientQueryBufferLimit() int64 {
+	if config.Properties.ClientQueryBufferLimit > 0 {
+		return int64(config.Properties.ClientQueryBufferLimit)
+	}
+	return defaultClientQueryBufferLimit
 }
 
 func (h *Handler) closeClient(client *connection.Connection) {
 	_ = client.Close()
-	// TODO DB
-	h.activeConn.Delete(client)
+	h.db.AfterClientClose(client)
 }
 
 // Handle 接收并处理redis命令
@@ -57,47 +119,61 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 		return
 	}
 
+	// 连接在创建时注册，关闭时注销，CLIENT LIST 等命令通过注册表访问所有连接
 	client := connection.NewConn(conn)
-	h.activeConn.Store(client, struct{}{}) // 使用空结构体更省内存
-
-	ch := parser.ParseStream(conn) // 发送到协议解析器中处理
-	for payload := range ch {
-		if payload.Err != nil {
-			// 读取到末尾
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				// 关闭连接
+
+	// 在当前协程中逐条读取命令，不再启动单独的解析协程
+	reader := parser.NewReader(conn)
+	defer reader.Close()
+	reader.SetLimits(protoMaxBulkLen(), clientQueryBufferLimit())
+	for {
+		cmdLine, err := reader.ReadCommand()
+		client.Touch()
+		if err != nil {
+			if parser.IsProtocolError(err) {
+				// protocol err（协议错误）：之后的数据已经无法正确解析，回复错误后关闭连接
+				errReply := protocol.MakeErrReply(err.Error())
+				_ = client.Write(errReply.ToBytes())
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
+				logger.Info("connection closed: " + client.RemoteAddr().String() + ", " + err.Error())
 				return
 			}
 
-			// protocol err（协议错误）
-			errReply := protocol.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if err != nil {
+			// 读取到末尾或者连接异常，关闭连接
+			h.closeClient(client)
+			if err == io.EOF ||
+				err == io.ErrUnexpectedEOF ||
+				strings.Contains(err.Error(), "use of closed network connection") {
+				logger.Info("connection closed: " + client.RemoteAddr().String())
+			} else {
+				logger.Error("connection closed: " + client.RemoteAddr().String() + ", " + err.Error())
+			}
+			return
+		}
+
+		client.SetLastCommand(strings.ToLower(string(cmdLine[0])))
+		result := h.db.Exec(client, cmdLine)
+		// CLIENT REPLY OFF|SKIP 时不发送回复
+		if client.ShouldReply() {
+			if result != nil {
+				_ = client.WriteReply(result)
+			} else {
+				_ = client.Write(unknownErrReplyBytes)
+			}
+		}
+		// 流水线中的命令全部处理完成后再发送，多条回复合并为一次系统调用
+		if reader.Buffered() == 0 || client.IsCloseAfterReply() {
+			if err := client.Flush(); err != nil {
 				h.closeClient(client)
 				logger.Error("connection closed: " + client.RemoteAddr().String())
 				return
 			}
-			continue
-		}
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
 		}
-
-		r, ok := payload.Data.(*protocol.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk protocol")
-			continue
-		}
-		result := h.db.Exec(client, r.Args)
-		if result != nil {
-			_ = client.Write(result.ToBytes())
-		} else {
-			_ = client.Write(unknownErrReplyBytes)
+		// QUIT 或者 CLIENT KILL 自身
+		if client.IsCloseAfterReply() {
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
 		}
 	}
 }
@@ -105,9 +181,11 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 func (h *Handler) Close() error {
 	logger.Info("client shuting down...")
 	h.closing.Set(true)
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
 	// TODO: concurrent wait
-	h.activeConn.Range(func(key interface{}, val interface{}) bool {
-		client := key.(*connection.Connection)
+	connection.ForEachClient(func(client *connection.Connection) bool {
 		client.Close()
 		return true
 	})
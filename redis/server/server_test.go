@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/config"
+	"github.com/HildaM/GoKV/lib/logger"
+)
+
+func setupLogger() {
+	logger.Setup(&logger.Settings{
+		Path:       "logs",
+		Name:       "godis",
+		Ext:        "log",
+		TimeFormat: "2006-01-02",
+	})
+}
+
+func TestReject(t *testing.T) {
+	setupLogger()
+	h := MakeHandler()
+	defer h.Close()
+	server, client := net.Pipe()
+	go h.Reject(server)
+
+	reply, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != string(maxClientsReplyBytes) {
+		t.Errorf("unexpected reply %q", reply)
+	}
+}
+
+func TestReapIdleClients(t *testing.T) {
+	setupLogger()
+	timeout := config.Properties.Timeout
+	config.Properties.Timeout = 1
+	defer func() {
+		config.Properties.Timeout = timeout
+	}()
+	h := MakeHandler()
+	defer h.Close()
+	ctx := context.Background()
+
+	idleServer, idle := net.Pipe()
+	go h.Handle(ctx, idleServer)
+	subServer, sub := net.Pipe()
+	go h.Handle(ctx, subServer)
+	_, _ = sub.Write([]byte("*2\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n"))
+	subReader := bufio.NewReader(sub)
+	for i := 0; i < 6; i++ { // *3 $9 subscribe $2 ch :1
+		if _, err := subReader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 空闲连接超时后被关闭
+	closed := make(chan error, 1)
+	go func() {
+		_, err := idle.Read(make([]byte, 1))
+		closed <- err
+	}()
+	select {
+	case err := <-closed:
+		if err != io.EOF {
+			t.Errorf("expected EOF, actual %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle client not closed")
+	}
+
+	// 订阅模式的连接不会被回收
+	time.Sleep(1100 * time.Millisecond)
+	_ = sub.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := subReader.ReadByte(); err == io.EOF {
+		t.Error("subscribed client should not be reaped")
+	}
+}
+
+func TestHandleReplyModeAndQuit(t *testing.T) {
+	setupLogger()
+	h := MakeHandler()
+	defer h.Close()
+	server, client := net.Pipe()
+	go h.Handle(context.Background(), server)
+	go func() {
+		_, _ = client.Write([]byte("CLIENT REPLY SKIP\r\nPING\r\nPING\r\n" +
+			"CLIENT REPLY OFF\r\nPING\r\nCLIENT REPLY ON\r\nECHO x\r\nQUIT\r\nPING\r\n"))
+	}()
+
+	// QUIT 回复之后关闭连接，之后的命令不再执行
+	_ = client.SetReadDeadline(time.Now().Add(3 * time.Second))
+	reply, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "+PONG\r\n+OK\r\n$1\r\nx\r\n+OK\r\n"; string(reply) != expected {
+		t.Errorf("expected %q, actual %q", expected, reply)
+	}
+}
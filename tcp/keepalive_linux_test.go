@@ -0,0 +1,60 @@
+package tcp
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// keepAliveOf 读取连接的 SO_KEEPALIVE 与 TCP_KEEPIDLE（秒）
+func keepAliveOf(t *testing.T, conn net.Conn) (bool, int) {
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enabled, idle int
+	err = raw.Control(func(fd uintptr) {
+		enabled, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		idle, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enabled != 0, idle
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, c := range []struct {
+		period  time.Duration
+		enabled bool
+		idle    int
+	}{
+		{300 * time.Second, true, 300},
+		{60 * time.Second, true, 60},
+		{0, false, 0},
+		{-1, false, 0},
+	} {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		setKeepAlive(conn, c.period)
+		enabled, idle := keepAliveOf(t, conn)
+		if enabled != c.enabled || (c.enabled && idle != c.idle) {
+			t.Errorf("period %v: expected keepalive %v/%ds, actual %v/%ds", c.period, c.enabled, c.idle, enabled, idle)
+		}
+		_ = conn.Close()
+		_ = client.Close()
+	}
+}
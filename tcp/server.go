@@ -10,14 +10,30 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type Config struct {
 	Address    string        `yaml:"address"`
-	MaxConnect uint32        `yaml:"max-connect"`
-	Timeout    time.Duration `yaml:"timeout"`
+	MaxConnect uint32        `yaml:"max-connect"` // 最大连接数，0表示不限制
+	KeepAlive  time.Duration `yaml:"keep-alive"`  // TCP keepalive 探测间隔，0表示关闭
+}
+
+// setKeepAlive 按配置设置连接的 keepalive
+// Accept 默认开启了15秒的 keepalive，关闭时需要显式设置
+func setKeepAlive(conn net.Conn, period time.Duration) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if period <= 0 {
+		_ = tcpConn.SetKeepAlive(false)
+		return
+	}
+	_ = tcpConn.SetKeepAlive(true)
+	_ = tcpConn.SetKeepAlivePeriod(period)
 }
 
 // ListenAndServerWithSignal 绑定IP+端口。响应系统中断停止
@@ -40,12 +56,12 @@ func ListenAndServerWithSignal(cfg *Config, handler tcp.Handler) error {
 		log.Fatal(err)
 	}
 	logger.Info(fmt.Sprintf("bind: %s, start listening...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan)
+	ListenAndServe(cfg, listener, handler, closeChan)
 	return nil
 }
 
 // ListenAndServe 监听端口，同时监听系统中断信号
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan struct{}) {
+func ListenAndServe(cfg *Config, listener net.Listener, handler tcp.Handler, closeChan chan struct{}) {
 	// 监听关闭信号
 	go func() {
 		<-closeChan
@@ -63,6 +79,7 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan s
 
 	ctx := context.Background()
 	var wait sync.WaitGroup // 实现多个协程并发执行
+	var connected int64     // 当前正在处理的连接数
 	for {
 		// 接收请求
 		conn, err := listener.Accept()
@@ -70,12 +87,26 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan s
 			logger.Fatal(err)
 			break
 		}
+		setKeepAlive(conn, cfg.KeepAlive)
+
+		// 超过最大连接数，拒绝新连接
+		// 回复错误可能阻塞，放到单独的协程中，避免影响后续连接的接收
+		if cfg.MaxConnect > 0 && atomic.LoadInt64(&connected) >= int64(cfg.MaxConnect) {
+			if rejecter, ok := handler.(tcp.Rejecter); ok {
+				go rejecter.Reject(conn)
+			} else {
+				_ = conn.Close()
+			}
+			continue
+		}
 
 		// handle
 		logger.Info("accept link")
 		wait.Add(1)
+		atomic.AddInt64(&connected, 1)
 		go func() {
 			defer func() {
+				atomic.AddInt64(&connected, -1)
 				wait.Done()
 			}()
 			handler.Handle(ctx, conn)
@@ -0,0 +1,100 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HildaM/GoKV/lib/logger"
+)
+
+// blockingHandler 处理连接直到 release 被关闭，拒绝连接时同样阻塞
+type blockingHandler struct {
+	release  chan struct{}
+	handled  int32
+	rejected int32
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, conn net.Conn) {
+	atomic.AddInt32(&h.handled, 1)
+	<-h.release
+	_ = conn.Close()
+}
+
+func (h *blockingHandler) Reject(conn net.Conn) {
+	atomic.AddInt32(&h.rejected, 1)
+	<-h.release
+	_, _ = conn.Write([]byte("-ERR max number of clients reached\r\n"))
+	_ = conn.Close()
+}
+
+func (h *blockingHandler) Close() error {
+	return nil
+}
+
+// waitUntil 等待条件成立，超时返回false
+func waitUntil(cond func() bool) bool {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestMaxConnect(t *testing.T) {
+	logger.Setup(&logger.Settings{
+		Path:       "logs",
+		Name:       "godis",
+		Ext:        "log",
+		TimeFormat: "2006-01-02",
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &blockingHandler{release: make(chan struct{})}
+	go ListenAndServe(&Config{MaxConnect: 1}, listener, handler, make(chan struct{}))
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+		defer conn.Close()
+	}
+	// 拒绝连接阻塞时，后续连接仍然能被接收
+	if !waitUntil(func() bool { return atomic.LoadInt32(&handler.rejected) == 2 }) {
+		t.Fatalf("expected 2 rejected connections, actual %d", atomic.LoadInt32(&handler.rejected))
+	}
+	if handled := atomic.LoadInt32(&handler.handled); handled != 1 {
+		t.Errorf("expected 1 handled connection, actual %d", handled)
+	}
+
+	close(handler.release)
+	buf := make([]byte, 64)
+	_ = conns[1].SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _ := conns[1].Read(buf)
+	if reply := string(buf[:n]); reply != "-ERR max number of clients reached\r\n" {
+		t.Errorf("unexpected reject reply %q", reply)
+	}
+
+	// 已有连接关闭后可以接收新连接，计数在 Handle 返回后才减少，因此重试连接
+	if !waitUntil(func() bool {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		time.Sleep(10 * time.Millisecond)
+		return atomic.LoadInt32(&handler.handled) == 2
+	}) {
+		t.Error("new connection not handled after previous one closed")
+	}
+}